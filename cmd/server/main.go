@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log"
@@ -11,23 +12,51 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/andrew/ai-cli-server/internal/agents"
 	"github.com/andrew/ai-cli-server/internal/agents/copilot"
 	"github.com/andrew/ai-cli-server/internal/agents/cursor"
+	"github.com/andrew/ai-cli-server/internal/agents/mock"
 	"github.com/andrew/ai-cli-server/internal/api"
+	"github.com/andrew/ai-cli-server/internal/api/middleware"
 	"github.com/andrew/ai-cli-server/internal/cli/management"
 	"github.com/andrew/ai-cli-server/internal/config"
 	"github.com/andrew/ai-cli-server/internal/database"
+	"github.com/andrew/ai-cli-server/internal/tracing"
 )
 
 func main() {
 	// Parse command-line flags
+	configPath := flag.String("config", "", "Config file, or comma-separated files merged in order (default $AICLI_CONFIG, then "+config.DefaultPath+")")
 	manageCmd := flag.Bool("manage", false, "Run interactive client management TUI")
 
 	// Automation subcommands for scripting
 	addClient := flag.String("add", "", "Add client with JSON input: {\"name\":\"...\", \"provider\":\"copilot\", \"models\":[\"*\"], \"rate_limit\":60}")
 	listClients := flag.Bool("list", false, "List all clients (JSON output)")
+	exportClients := flag.Bool("export-clients", false, "Print all clients, with API key hashes, for -import-clients (JSON output)")
+	importClients := flag.String("import-clients", "", "Recreate clients from an -export-clients file, skipping existing names (JSON output)")
+	newKeys := flag.Bool("new-keys", false, "With -import-clients, generate fresh API keys instead of keeping the exported hashes")
 	deleteClient := flag.Int64("delete", 0, "Delete client by ID")
+	activateClient := flag.Int64("activate", 0, "Re-enable a deactivated client's API key by ID (JSON output)")
+	deactivateClient := flag.Int64("deactivate", 0, "Disable a client's API key by ID, keeping the client (JSON output)")
+	listKeys := flag.Int64("list-keys", 0, "List a client's API keys by client ID (JSON output)")
+	addKey := flag.Int64("add-key", 0, "Add another API key to a client by client ID (JSON output)")
+	keyName := flag.String("key-name", "", "With -add-key, a name for the key, e.g. the region using it")
+	revokeKey := flag.Int64("revoke-key", 0, "Revoke an API key by key ID; requires -client (JSON output)")
+	keyClient := flag.Int64("client", 0, "With -revoke-key, the ID of the client owning the key")
+	resetUsage := flag.Int64("reset-usage", 0, "Clear usage logs for client by ID (keeps the client)")
+	auditLog := flag.Int("audit", 0, "Show the N most recent audit log entries (JSON output)")
+	usageReport := flag.Bool("usage-report", false, "Show usage totals across all clients and the top clients (JSON output)")
+	reportStart := flag.String("start-time", "", "With -usage-report, only count usage at or after this RFC3339 time")
+	reportEnd := flag.String("end-time", "", "With -usage-report, only count usage at or before this RFC3339 time")
+	reportTop := flag.Int("top", 10, "With -usage-report, the number of clients to rank")
 	listModels := flag.Bool("models", false, "List available models (JSON output)")
+	healthCheck := flag.Bool("healthcheck", false, "Run a trivial prompt through each available provider (JSON output)")
+	backupPath := flag.String("backup", "", "Write a consistent copy of the database to this path; safe while the server runs (JSON output)")
+	restorePath := flag.String("restore", "", "Replace the database with this backup; stop the server first (JSON output)")
+	assumeYes := flag.Bool("yes", false, "Skip the -restore confirmation prompt")
+	printConfig := flag.Bool("print-config", false, "Print the effective configuration (YAML, secrets redacted)")
+	validateOnly := flag.Bool("validate", false, "Run the startup checks, print a summary and exit non-zero on failure, without starting the server")
+	allowNoProviders := flag.Bool("allow-no-providers", false, "Start (or pass -validate) even when no provider CLI is available")
 
 	flag.Parse()
 
@@ -35,19 +64,62 @@ func main() {
 	logger := log.New(os.Stdout, "[ai-cli-server] ", log.LstdFlags)
 
 	// Load configuration
-	cfg, err := config.Load("configs/config.yaml")
+	cfg, err := config.Load(config.Paths(*configPath)...)
 	if err != nil {
 		logger.Fatalf("Failed to load config: %v", err)
 	}
 
+	if *printConfig {
+		data, err := cfg.EffectiveYAML()
+		if err != nil {
+			logger.Fatalf("Failed to print config: %v", err)
+		}
+		os.Stdout.Write(data)
+		return
+	}
+
+	// Restore swaps the database file, so it runs before the database is opened
+	if *restorePath != "" {
+		management.RestoreJSON(*restorePath, cfg.Database.Path, *assumeYes)
+		return
+	}
+
 	// Initialize database
-	db, err := database.New(cfg.Database.Path)
+	db, err := database.New(cfg.Database.Path, database.Options{
+		BusyTimeout:  cfg.Database.BusyTimeout,
+		MaxOpenConns: cfg.Database.MaxOpenConns,
+	})
 	if err != nil {
 		logger.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
 
+	if *validateOnly {
+		results := management.StartupChecks(cfg, db, newProviders(cfg), *allowNoProviders)
+		for _, result := range results {
+			fmt.Println(result)
+		}
+		if !management.ChecksPassed(results) {
+			fmt.Println("Startup checks failed")
+			os.Exit(1)
+		}
+		fmt.Println("Startup checks passed")
+		return
+	}
+
 	// Handle automation commands (JSON I/O for scripting)
+	if *backupPath != "" {
+		management.BackupJSON(db, *backupPath)
+		return
+	}
+
+	if *healthCheck {
+		if !management.HealthCheckJSON(newProviders(cfg), 30*time.Second) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *listModels {
 		manager := management.NewClientManager(cfg, db)
 		manager.ListModelsJSON()
@@ -66,12 +138,72 @@ func main() {
 		return
 	}
 
+	if *exportClients {
+		manager := management.NewClientManager(cfg, db)
+		manager.ExportClientsJSON()
+		return
+	}
+
+	if *importClients != "" {
+		manager := management.NewClientManager(cfg, db)
+		manager.ImportClientsJSON(*importClients, *newKeys)
+		return
+	}
+
 	if *deleteClient > 0 {
 		manager := management.NewClientManager(cfg, db)
 		manager.DeleteClientJSON(*deleteClient)
 		return
 	}
 
+	if *activateClient > 0 {
+		manager := management.NewClientManager(cfg, db)
+		manager.SetClientActiveJSON(*activateClient, true)
+		return
+	}
+
+	if *deactivateClient > 0 {
+		manager := management.NewClientManager(cfg, db)
+		manager.SetClientActiveJSON(*deactivateClient, false)
+		return
+	}
+
+	if *listKeys > 0 {
+		manager := management.NewClientManager(cfg, db)
+		manager.ListKeysJSON(*listKeys)
+		return
+	}
+
+	if *addKey > 0 {
+		manager := management.NewClientManager(cfg, db)
+		manager.AddKeyJSON(*addKey, *keyName)
+		return
+	}
+
+	if *revokeKey > 0 {
+		manager := management.NewClientManager(cfg, db)
+		manager.RevokeKeyJSON(*keyClient, *revokeKey)
+		return
+	}
+
+	if *resetUsage > 0 {
+		manager := management.NewClientManager(cfg, db)
+		manager.ResetUsageJSON(*resetUsage)
+		return
+	}
+
+	if *auditLog > 0 {
+		manager := management.NewClientManager(cfg, db)
+		manager.AuditLogsJSON(*auditLog)
+		return
+	}
+
+	if *usageReport {
+		manager := management.NewClientManager(cfg, db)
+		manager.UsageReportJSON(*reportStart, *reportEnd, *reportTop)
+		return
+	}
+
 	// Handle interactive management mode
 	if *manageCmd {
 		runClientManagement(cfg, db)
@@ -79,40 +211,69 @@ func main() {
 	}
 
 	// Default: run server
-	runServer(cfg, db, logger)
+	runServer(cfg, db, logger, *allowNoProviders)
 }
 
-func runServer(cfg *config.Config, db *database.DB, logger *log.Logger) {
+func runServer(cfg *config.Config, db *database.DB, logger *log.Logger, allowNoProviders bool) {
 	logger.Printf("Starting AI CLI Server on %s", cfg.Server.Address())
 	logger.Printf("Database initialized at %s", cfg.Database.Path)
 
-	// Initialize CLI providers
-	copilotProvider := copilot.NewProvider(
-		cfg.CLI.Copilot.BinaryPath,
-		cfg.CLI.Copilot.Timeout,
-		cfg.Auth.CopilotGitHubToken,
-	)
-	cursorProvider := cursor.NewProvider(
-		cfg.CLI.Cursor.BinaryPath,
-		cfg.CLI.Cursor.Timeout,
-		cfg.Auth.CursorAPIKey,
-	)
+	// Initialize CLI providers and check their availability
+	providers := newProviders(cfg)
+	for _, provider := range providers {
+		var label, binaryPath string
+		switch p := provider.(type) {
+		case *copilot.Provider:
+			label, binaryPath = "Copilot", p.BinaryPath
+		case *cursor.Provider:
+			label, binaryPath = "Cursor", p.BinaryPath
+		default:
+			logger.Printf("Mock provider enabled")
+			continue
+		}
+		if !provider.IsAvailable() {
+			logger.Printf("WARNING: %s CLI not found at %s", label, binaryPath)
+			continue
+		}
+		logger.Printf("%s CLI provider available", label)
+	}
+
+	// Fail fast on a broken setup rather than on the first request
+	results := management.StartupChecks(cfg, db, providers, allowNoProviders)
+	for _, result := range results {
+		logger.Printf("Startup check: %s", result)
+	}
+	if !management.ChecksPassed(results) {
+		logger.Fatalf("Startup checks failed; run with -validate to check a fix without starting the server")
+	}
+
+	// Seed the first client of a fresh database; its key can't be shown again
+	client, apiKey, err := management.BootstrapClient(cfg, db)
+	if err != nil {
+		logger.Fatalf("Failed to bootstrap client: %v", err)
+	}
+	if client != nil {
+		logger.Printf("Created bootstrap client %s (ID %d, provider %s, scopes %s) with API key: %s", client.Name, client.ID, client.Provider, client.Scopes, apiKey)
+		logger.Printf("Store this API key now; it will not be shown again")
+	}
 
-	// Check provider availability
-	if copilotProvider.IsAvailable() {
-		logger.Printf("Copilot CLI provider available")
-	} else {
-		logger.Printf("WARNING: Copilot CLI not found at %s", cfg.CLI.Copilot.BinaryPath)
+	// Prune old usage logs in the background
+	if cfg.Retention.UsageLogDays > 0 {
+		go pruneUsageLogs(db, cfg.Retention, logger)
 	}
 
-	if cursorProvider.IsAvailable() {
-		logger.Printf("Cursor CLI provider available")
-	} else {
-		logger.Printf("WARNING: Cursor CLI not found at %s", cfg.CLI.Cursor.BinaryPath)
+	// Export request spans when tracing is enabled
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		logger.Fatalf("Failed to set up tracing: %v", err)
+	}
+	if cfg.Tracing.Enabled {
+		logger.Printf("Tracing enabled, exporting to %s", cfg.Tracing.Endpoint)
 	}
 
 	// Setup routes
-	handler := api.SetupRoutes(db, copilotProvider, cursorProvider, logger)
+	drainer := middleware.NewDrainer()
+	handler := api.SetupRoutes(cfg, db, providers, drainer, logger)
 
 	// Create HTTP server
 	server := &http.Server{
@@ -122,10 +283,29 @@ func runServer(cfg *config.Config, db *database.DB, logger *log.Logger) {
 		WriteTimeout: cfg.Server.WriteTimeout,
 	}
 
+	// Load the certificate up front so a bad cert or key fails before listening
+	if cfg.Server.TLS.Enabled {
+		cert, err := tls.LoadX509KeyPair(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
+		if err != nil {
+			logger.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		server.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
 	// Start server in a goroutine
 	go func() {
-		logger.Printf("Server listening on http://%s", cfg.Server.Address())
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if cfg.Server.TLS.Enabled {
+			logger.Printf("Server listening on https://%s", cfg.Server.Address())
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			logger.Printf("Server listening on http://%s", cfg.Server.Address())
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Fatalf("Server failed to start: %v", err)
 		}
 	}()
@@ -137,17 +317,88 @@ func runServer(cfg *config.Config, db *database.DB, logger *log.Logger) {
 
 	logger.Println("Server shutting down...")
 
-	// Gracefully shutdown the server with a timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// Draining and closing the server share the shutdown timeout
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
+	// Let in-flight CLI executions finish, refusing new ones, for up to the
+	// drain timeout, or whatever of the shutdown timeout is left
+	drainCtx, cancelDrain := context.WithTimeout(ctx, cfg.Server.DrainTimeout)
+	stopProgress := logDrainProgress(drainer, logger, 5*time.Second)
+	if err := drainer.Drain(drainCtx); err != nil {
+		logger.Printf("Drain timeout reached, cancelling %d in-flight requests", drainer.InFlight())
+	}
+	stopProgress()
+	cancelDrain()
+
+	// Gracefully shutdown the server, giving cancelled requests the rest of the
+	// shutdown timeout to respond
 	if err := server.Shutdown(ctx); err != nil {
-		logger.Fatalf("Server forced to shutdown: %v", err)
+		logger.Printf("Shutdown timeout reached, closing remaining connections: %v", err)
+		server.Close()
+	}
+
+	// Flush spans still buffered for export
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Printf("Failed to flush traces: %v", err)
 	}
 
 	logger.Println("Server exited")
 }
 
+// logDrainProgress logs the number of requests still in flight every interval
+// while draining, until the returned function is called
+func logDrainProgress(drainer *middleware.Drainer, logger *log.Logger, interval time.Duration) func() {
+	logger.Printf("Draining %d in-flight requests", drainer.InFlight())
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				logger.Printf("Draining, %d requests still in flight", drainer.InFlight())
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// pruneUsageLogs periodically deletes usage logs older than the retention period
+func pruneUsageLogs(db database.Store, retention config.RetentionConfig, logger *log.Logger) {
+	for {
+		cutoff := time.Now().AddDate(0, 0, -retention.UsageLogDays)
+		pruned, err := db.DeleteUsageLogsBefore(cutoff, retention.BatchSize)
+		if err != nil {
+			logger.Printf("Failed to prune usage logs: %v", err)
+		} else {
+			logger.Printf("Pruned %d usage logs older than %d days", pruned, retention.UsageLogDays)
+		}
+		time.Sleep(database.Jitter(retention.Interval))
+	}
+}
+
+// newProviders creates every configured CLI provider
+func newProviders(cfg *config.Config) []agents.Provider {
+	providers := []agents.Provider{
+		copilot.NewProvider(cfg.CLI.Copilot, cfg.Auth.CopilotGitHubToken),
+		cursor.NewProvider(cfg.CLI.Cursor, cfg.Auth.CursorAPIKey),
+	}
+	if cfg.CLI.Mock.Enabled {
+		providers = append(providers, mock.NewProvider(cfg.CLI.Mock))
+	}
+	agents.DisableModels(providers, cfg.CLI.DisabledModels)
+	agents.ApplyModelCatalog(providers, cfg.CLI.ModelCatalog)
+	agents.ApplyEnvPolicy(providers, cfg.CLI.InheritEnv, cfg.CLI.StripEnv)
+	return providers
+}
+
 func runClientManagement(cfg *config.Config, db *database.DB) {
 	manager := management.NewClientManager(cfg, db)
 	if err := manager.Run(); err != nil {
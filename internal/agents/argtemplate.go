@@ -0,0 +1,99 @@
+package agents
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// ArgValues holds the values substituted into an argument template
+type ArgValues struct {
+	Scalars map[string]string   // {name} becomes the value; the entry is dropped when empty
+	Lists   map[string][]string // The entry is repeated once per value; dropped when empty
+	Flags   map[string]bool     // {name} is removed when true; the entry is dropped when false
+}
+
+// placeholderPattern matches {name} placeholders in template words
+var placeholderPattern = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// ExpandArgs builds CLI arguments from a template. Each template entry is one or
+// more whitespace-separated words, e.g. "--model {model}". Values are substituted
+// into already-split words and passed straight to exec, so they can never inject
+// extra arguments, whatever they contain. Unknown placeholders drop their entry.
+func ExpandArgs(template []string, values ArgValues) []string {
+	var args []string
+	for _, entry := range template {
+		words := strings.Fields(entry)
+
+		include := true
+		var list []string
+		listName := ""
+		for _, name := range entryPlaceholders(words) {
+			if v, ok := values.Scalars[name]; ok {
+				include = include && v != ""
+			} else if v, ok := values.Lists[name]; ok {
+				include = include && len(v) > 0
+				list, listName = v, name
+			} else if v, ok := values.Flags[name]; ok {
+				include = include && v
+			} else {
+				include = false
+			}
+		}
+		if !include {
+			continue
+		}
+
+		if listName == "" {
+			args = append(args, expandWords(words, values, "", "")...)
+			continue
+		}
+		for _, item := range list {
+			args = append(args, expandWords(words, values, listName, item)...)
+		}
+	}
+	return args
+}
+
+// TemplateUses reports whether any entry of an argument template uses the
+// named placeholder
+func TemplateUses(template []string, name string) bool {
+	for _, entry := range template {
+		if slices.Contains(entryPlaceholders(strings.Fields(entry)), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// entryPlaceholders returns the placeholder names used in an entry's words
+func entryPlaceholders(words []string) []string {
+	var names []string
+	for _, word := range words {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(word, -1) {
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// expandWords substitutes values into words, using item for the list placeholder
+func expandWords(words []string, values ArgValues, listName, item string) []string {
+	expanded := make([]string, 0, len(words))
+	for _, word := range words {
+		word = placeholderPattern.ReplaceAllStringFunc(word, func(match string) string {
+			name := match[1 : len(match)-1]
+			if name == listName {
+				return item
+			}
+			if v, ok := values.Scalars[name]; ok {
+				return v
+			}
+			return "" // Flags
+		})
+		if word != "" {
+			expanded = append(expanded, word)
+		}
+	}
+	return expanded
+}
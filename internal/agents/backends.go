@@ -0,0 +1,134 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Defaults for isolating a failing backend: after BreakerThreshold failures in
+// a row it gets no requests for BreakerCooldown, then one trial request
+const (
+	BreakerThreshold = 3
+	BreakerCooldown  = 30 * time.Second
+)
+
+// Backend is one installation of a CLI, with its own binary and credential
+type Backend struct {
+	BinaryPath string
+	Token      string
+	Weight     int // Relative share of requests; less than 1 counts as 1
+
+	current   int       // Smooth weighted round-robin state
+	failures  int       // Consecutive failures
+	openUntil time.Time // While in the future, the circuit is open and the backend skipped
+}
+
+// BackendPool spreads executions across a provider's backends by smooth
+// weighted round-robin, so a backend of weight 3 gets three requests for every
+// one of a weight 1 backend, interleaved rather than in bursts. A circuit
+// breaker takes a backend out of rotation after repeated failures.
+type BackendPool struct {
+	backends  []*Backend
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+	mu        sync.Mutex
+}
+
+// NewBackendPool creates a pool of the given backends using the default breaker settings
+func NewBackendPool(backends []Backend) *BackendPool {
+	pool := &BackendPool{threshold: BreakerThreshold, cooldown: BreakerCooldown, now: time.Now}
+	for _, backend := range backends {
+		if backend.Weight < 1 {
+			backend.Weight = 1
+		}
+		pool.backends = append(pool.backends, &backend)
+	}
+	return pool
+}
+
+// Next picks the backend for the next execution, skipping those whose circuit
+// is open. It returns nil when every circuit is open.
+func (p *BackendPool) Next() *Backend {
+	return p.NextExcept(nil)
+}
+
+// NextExcept is Next skipping the backends in tried as well, for retrying an
+// execution elsewhere. It returns nil once no backend is left to try.
+func (p *BackendPool) NextExcept(tried map[*Backend]bool) *Backend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	var best *Backend
+	total := 0
+	for _, backend := range p.backends {
+		if tried[backend] || now.Before(backend.openUntil) {
+			continue
+		}
+		backend.current += backend.Weight
+		total += backend.Weight
+		if best == nil || backend.current > best.current {
+			best = backend
+		}
+	}
+	if best != nil {
+		best.current -= total
+	}
+	return best
+}
+
+// First returns the first configured backend, without advancing the rotation
+func (p *BackendPool) First() *Backend {
+	return p.backends[0]
+}
+
+// Report records the outcome of an execution on backend. Failures to launch
+// its CLI count towards opening its circuit; a success closes it.
+func (p *BackendPool) Report(backend *Backend, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !IsBackendFailure(err) {
+		if err == nil {
+			backend.failures = 0
+		}
+		return
+	}
+	backend.failures++
+	if backend.failures >= p.threshold {
+		// A failed trial after the cooldown reopens the circuit straight away
+		backend.openUntil = p.now().Add(p.cooldown)
+	}
+}
+
+// IsAvailable reports whether any backend in rotation has its binary in PATH
+func (p *BackendPool) IsAvailable() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	for _, backend := range p.backends {
+		if now.Before(backend.openUntil) {
+			continue
+		}
+		if _, err := exec.LookPath(backend.BinaryPath); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBackendFailure reports whether an execution error says something about the
+// backend that ran it: its CLI couldn't be launched. A CLI that ran and exited
+// non-zero may have failed on the request, e.g. a bad prompt, as may a timeout
+// or an unknown model, so none of those count.
+func IsBackendFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return errors.Is(err, ErrProviderUnavailable)
+}
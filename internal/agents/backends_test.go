@@ -0,0 +1,104 @@
+package agents
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackendPoolWeightedRoundRobin(t *testing.T) {
+	pool := NewBackendPool([]Backend{{BinaryPath: "a", Weight: 3}, {BinaryPath: "b"}, {BinaryPath: "c", Weight: 2}})
+
+	var order string
+	for range 12 {
+		order += pool.Next().BinaryPath
+	}
+	// Smooth round-robin interleaves the heavier backends rather than bursting them
+	if want := "acabcaacabca"; order != want {
+		t.Errorf("picks = %s, want %s", order, want)
+	}
+}
+
+func TestBackendPoolBreaker(t *testing.T) {
+	now := time.Now()
+	pool := NewBackendPool([]Backend{{BinaryPath: "a"}, {BinaryPath: "b"}})
+	pool.now = func() time.Time { return now }
+	a := pool.backends[0]
+	failure := &ExecError{Provider: "test", Reason: ErrProviderUnavailable, ExitCode: -1}
+
+	// Failures that may depend on the request don't count, including a CLI
+	// that ran and exited non-zero
+	for range BreakerThreshold {
+		pool.Report(a, &ExecError{Provider: "test", Reason: ErrExecFailed, ExitCode: 1})
+		pool.Report(a, &ExecError{Provider: "test", Reason: ErrModelNotFound, ExitCode: 1})
+		pool.Report(a, &ExecError{Provider: "test", Reason: ErrExecTimeout, ExitCode: -1})
+	}
+	for range BreakerThreshold - 1 {
+		pool.Report(a, failure)
+	}
+	pool.Report(a, nil)
+	for range BreakerThreshold - 1 {
+		pool.Report(a, failure)
+	}
+	if picks := pickCounts(pool, 4); picks["a"] != 2 {
+		t.Fatalf("picks = %v before the threshold, want a in rotation", picks)
+	}
+
+	pool.Report(a, failure)
+	if picks := pickCounts(pool, 4); picks["a"] != 0 || picks["b"] != 4 {
+		t.Fatalf("picks = %v with a's circuit open, want only b", picks)
+	}
+
+	// After the cooldown a gets a trial; failing it reopens the circuit at once
+	now = now.Add(BreakerCooldown)
+	if picks := pickCounts(pool, 2); picks["a"] != 1 {
+		t.Fatalf("picks = %v after the cooldown, want a tried again", picks)
+	}
+	pool.Report(a, failure)
+	if picks := pickCounts(pool, 2); picks["a"] != 0 {
+		t.Fatalf("picks = %v after a failed trial, want a skipped", picks)
+	}
+
+	now = now.Add(BreakerCooldown)
+	pool.Report(a, nil)
+	if picks := pickCounts(pool, 4); picks["a"] != 2 {
+		t.Errorf("picks = %v after a success, want a back in rotation", picks)
+	}
+}
+
+func TestBackendPoolNextExcept(t *testing.T) {
+	pool := NewBackendPool([]Backend{{BinaryPath: "a", Weight: 3}, {BinaryPath: "b"}})
+
+	// Round-robin alone would pick a again; excluding it leaves b, then nothing
+	tried := map[*Backend]bool{}
+	var order string
+	for backend := pool.NextExcept(tried); backend != nil; backend = pool.NextExcept(tried) {
+		tried[backend] = true
+		order += backend.BinaryPath
+	}
+	if order != "ab" {
+		t.Errorf("picks = %s, want each backend once", order)
+	}
+}
+
+func TestBackendPoolAllOpen(t *testing.T) {
+	pool := NewBackendPool([]Backend{{BinaryPath: "a"}})
+	for range BreakerThreshold {
+		pool.Report(pool.First(), &ExecError{Provider: "test", Reason: ErrProviderUnavailable, ExitCode: -1})
+	}
+	if backend := pool.Next(); backend != nil {
+		t.Errorf("Next() = %+v with every circuit open, want nil", backend)
+	}
+	if pool.IsAvailable() {
+		t.Error("IsAvailable() = true with every circuit open, want false")
+	}
+}
+
+func pickCounts(pool *BackendPool, n int) map[string]int {
+	picks := map[string]int{}
+	for range n {
+		if backend := pool.Next(); backend != nil {
+			picks[backend.BinaryPath]++
+		}
+	}
+	return picks
+}
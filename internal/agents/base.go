@@ -1,17 +1,193 @@
 package agents
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
 	"os/exec"
 	"regexp"
 	"sync"
+	"time"
 )
 
+// MaxPromptArgLength is the largest prompt passed to a CLI as a single argument.
+// Linux caps one argument at 128 KiB (MAX_ARG_STRLEN), so larger prompts go via stdin.
+const MaxPromptArgLength = 96 * 1024
+
+// PromptExceedsArgLimit reports whether a prompt is too large to pass as an argument
+func PromptExceedsArgLimit(prompt string) bool {
+	return len(prompt) > MaxPromptArgLength
+}
+
+// commandWaitDelay bounds how long RunCommand waits for output after a CLI is killed
+const commandWaitDelay = 2 * time.Second
+
+// RunCommand runs cmd capturing stdout and stderr separately so CLI warnings
+// never end up in the response content. Failures are returned as they are, for
+// NewExecError to classify. With maxStdout > 0 the CLI is killed once stdout
+// exceeds it, and the first maxStdout bytes are returned as truncated.
+// When timings is not nil, the startup and generation phases are recorded in it.
+//
+// cmd.Stdin must be nil or a reader that ends, never the server's own stdin:
+// exec connects a nil Stdin to the null device, so a CLI that unexpectedly
+// asks for confirmation reads EOF and fails at once instead of waiting out
+// its timeout.
+func RunCommand(cmd *exec.Cmd, maxStdout int, timings *PhaseTimings) (stdout, stderr []byte, truncated bool, err error) {
+	outBuf := &cappedBuffer{limit: maxStdout, cmd: cmd}
+	var errBuf bytes.Buffer
+	cmd.Stdout = outBuf
+	cmd.Stderr = &errBuf
+	// Once the context kills the CLI, don't wait on children still holding its output pipes
+	cmd.WaitDelay = commandWaitDelay
+
+	if err = cmd.Start(); err == nil {
+		started := time.Now()
+		err = cmd.Wait()
+		if timings != nil {
+			timings.record(started, outBuf.firstWrite, time.Now())
+		}
+	}
+	if outBuf.exceeded {
+		// The kill is ours, so the partial output is the result
+		return outBuf.buf.Bytes(), errBuf.Bytes(), true, nil
+	}
+	return outBuf.buf.Bytes(), errBuf.Bytes(), false, err
+}
+
+// cappedBuffer collects a command's output up to limit bytes (no limit when
+// zero), killing the command at the first write past it. Later writes are
+// discarded rather than failed so the output copy drains until the pipe closes.
+type cappedBuffer struct {
+	buf        bytes.Buffer
+	limit      int
+	cmd        *exec.Cmd
+	exceeded   bool
+	firstWrite time.Time // When the command first produced output
+}
+
+// Write implements io.Writer
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	if c.firstWrite.IsZero() && len(p) > 0 {
+		c.firstWrite = time.Now()
+	}
+	if c.exceeded {
+		return len(p), nil
+	}
+	if c.limit > 0 && c.buf.Len()+len(p) > c.limit {
+		c.buf.Write(p[:c.limit-c.buf.Len()])
+		c.exceeded = true
+		if c.cmd.Process != nil {
+			c.cmd.Process.Kill()
+		}
+		return len(p), nil
+	}
+	return c.buf.Write(p)
+}
+
+// MetadataTimings is the ExecuteResponse.Metadata key holding PhaseTimings
+const MetadataTimings = "timings"
+
+// PhaseTimings splits a request's latency into the time spent waiting for an
+// execution slot, starting the CLI, and generating its output
+type PhaseTimings struct {
+	QueueWait  time.Duration // Set by the caller, which does the queueing
+	Startup    time.Duration // From starting the CLI until its first output
+	Generation time.Duration // From the first output until the CLI exited
+}
+
+// record fills in the CLI phases. A CLI that printed nothing spent its whole
+// run starting up.
+func (t *PhaseTimings) record(started, firstOutput, finished time.Time) {
+	if firstOutput.IsZero() {
+		firstOutput = finished
+	}
+	t.Startup = firstOutput.Sub(started)
+	t.Generation = finished.Sub(firstOutput)
+}
+
+// MarshalJSON reports each phase in milliseconds
+func (t PhaseTimings) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]int64{
+		"queue_wait_ms": t.QueueWait.Milliseconds(),
+		"startup_ms":    t.Startup.Milliseconds(),
+		"generation_ms": t.Generation.Milliseconds(),
+	})
+}
+
+// WithTimings adds the execution's phase timings to response metadata when the
+// request asked for them
+func WithTimings(req ExecuteRequest, metadata map[string]interface{}, timings PhaseTimings) map[string]interface{} {
+	if !req.Timings {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	metadata[MetadataTimings] = timings
+	return metadata
+}
+
+// Raw returns the CLI's unparsed output for requests that asked for it, or nil
+func Raw(req ExecuteRequest, stdout, stderr []byte) *RawOutput {
+	if !req.IncludeRaw {
+		return nil
+	}
+	return &RawOutput{Stdout: string(stdout), Stderr: string(stderr)}
+}
+
+// DebugMetadata returns response metadata holding the CLI's stderr for debug requests
+func DebugMetadata(req ExecuteRequest, stderr []byte) map[string]interface{} {
+	if !req.Debug || len(bytes.TrimSpace(stderr)) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"stderr": string(stderr)}
+}
+
 // BaseProvider contains common provider functionality
 type BaseProvider struct {
-	BinaryPath   string
-	modelsCache  []ModelInfo
-	modelsCached bool
-	mu           sync.RWMutex
+	BinaryPath      string
+	ModelsTTL       time.Duration // How long parsed models are reused; zero caches forever
+	PromptPrefix    string        // Provider-wide framing placed before every prompt
+	PromptSuffix    string        // Provider-wide framing placed after every prompt
+	modelsCache     []ModelInfo
+	modelsFetchedAt time.Time
+	disabledModels  map[string]bool
+	catalog         map[string]ModelCapabilities
+	inheritEnv      []string // Server variables the CLI inherits on top of DefaultInheritEnv
+	stripEnv        []string // Server variables the CLI never inherits
+	mu              sync.RWMutex
+
+	version          string
+	versionErr       error
+	versionFetchedAt time.Time
+	versionMu        sync.Mutex
+}
+
+// FramePrompt wraps a prompt in the provider's configured prefix and suffix
+func (b *BaseProvider) FramePrompt(prompt string) string {
+	return b.PromptPrefix + prompt + b.PromptSuffix
+}
+
+// SetEnvPolicy sets which server environment variables the CLI inherits,
+// besides DefaultInheritEnv, and which it never does. Call it before use.
+func (b *BaseProvider) SetEnvPolicy(inherit, strip []string) {
+	b.inheritEnv, b.stripEnv = inherit, strip
+}
+
+// Environ returns the part of the server's environment the CLI inherits
+func (b *BaseProvider) Environ() []string {
+	return InheritEnv(os.Environ(), b.inheritEnv, b.stripEnv)
+}
+
+// Binary returns the CLI binary to run for a request: its override, if any,
+// otherwise the provider's
+func (b *BaseProvider) Binary(req ExecuteRequest) string {
+	if req.BinaryPath != "" {
+		return req.BinaryPath
+	}
+	return b.BinaryPath
 }
 
 // IsAvailable checks if the CLI binary is available in PATH
@@ -31,10 +207,10 @@ func (b *BaseProvider) ParseModelsFromHelp(helpText string, pattern *regexp.Rege
 }
 
 // GetCachedModels returns cached models using double-check locking
-// If not cached, calls the fetcher function to populate the cache
+// If not cached or older than ModelsTTL, calls the fetcher function to populate the cache
 func (b *BaseProvider) GetCachedModels(fetcher func() []ModelInfo) []ModelInfo {
 	b.mu.RLock()
-	if b.modelsCached {
+	if b.modelsFresh() {
 		defer b.mu.RUnlock()
 		return b.modelsCache
 	}
@@ -44,17 +220,131 @@ func (b *BaseProvider) GetCachedModels(fetcher func() []ModelInfo) []ModelInfo {
 	defer b.mu.Unlock()
 
 	// Double-check after acquiring write lock
-	if b.modelsCached {
+	if b.modelsFresh() {
 		return b.modelsCache
 	}
 
+	b.fetchModels(fetcher)
+	return b.modelsCache
+}
+
+// RefreshCachedModels calls the fetcher regardless of the cache age, e.g. after a CLI upgrade
+func (b *BaseProvider) RefreshCachedModels(fetcher func() []ModelInfo) []ModelInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.fetchModels(fetcher)
+	return b.modelsCache
+}
+
+// modelsFresh reports whether the cache can be served; b.mu must be held
+func (b *BaseProvider) modelsFresh() bool {
+	if b.modelsFetchedAt.IsZero() {
+		return false
+	}
+	return b.ModelsTTL <= 0 || time.Since(b.modelsFetchedAt) < b.ModelsTTL
+}
+
+// fetchModels repopulates the cache; b.mu must be held for writing.
+// A failed fetch keeps the previous models rather than dropping them.
+func (b *BaseProvider) fetchModels(fetcher func() []ModelInfo) {
 	models := fetcher()
 	if len(models) > 0 {
 		b.modelsCache = models
-		b.modelsCached = true
+		b.modelsFetchedAt = time.Now()
+		b.markDisabled()
+		b.applyCatalog()
 	}
+}
 
-	return b.modelsCache
+// DisableModels marks the named models disabled in this and every later fetch
+func (b *BaseProvider) DisableModels(names []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.disabledModels = make(map[string]bool, len(names))
+	for _, name := range names {
+		b.disabledModels[name] = true
+	}
+	b.markDisabled()
+}
+
+// markDisabled applies disabledModels to the cache; b.mu must be held for writing
+func (b *BaseProvider) markDisabled() {
+	for i := range b.modelsCache {
+		if b.disabledModels[b.modelsCache[i].Name] {
+			b.modelsCache[i].Enabled = false
+		}
+	}
+}
+
+// SetModelCatalog attaches capabilities to the named models in this and every later fetch
+func (b *BaseProvider) SetModelCatalog(catalog map[string]ModelCapabilities) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.catalog = catalog
+	b.applyCatalog()
+}
+
+// applyCatalog applies catalog to the cache; b.mu must be held for writing.
+// Models without an entry keep empty capabilities.
+func (b *BaseProvider) applyCatalog() {
+	for i := range b.modelsCache {
+		b.modelsCache[i].ModelCapabilities = b.catalog[b.modelsCache[i].Name]
+	}
+}
+
+// UnknownVersion is reported for CLIs whose version can't be determined, e.g.
+// because they don't support --version
+const UnknownVersion = "unknown"
+
+// versionTimeout bounds how long a CLI may take to print its version
+const versionTimeout = 10 * time.Second
+
+// versionPattern matches a dotted version, optionally followed by a pre-release
+// or build suffix: 0.0.339, v1.2.3-beta.1, or 2025.09.18-7ae6800
+var versionPattern = regexp.MustCompile(`\d+(?:\.\d+)+(?:[-+][0-9A-Za-z.]+)?`)
+
+// ParseVersion extracts the first version number from a CLI's --version output,
+// or returns UnknownVersion when there is none
+func ParseVersion(output string) string {
+	if version := versionPattern.FindString(output); version != "" {
+		return version
+	}
+	return UnknownVersion
+}
+
+// RunVersion runs the binary with --version and parses what it prints.
+// CLIs that fail or print no version report UnknownVersion with the error.
+func RunVersion(binaryPath string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, binaryPath, "--version").CombinedOutput()
+	if err != nil {
+		return UnknownVersion, fmt.Errorf("%s --version: %w", binaryPath, err)
+	}
+	version := ParseVersion(string(output))
+	if version == UnknownVersion {
+		return UnknownVersion, fmt.Errorf("%s --version printed no version: %.80q", binaryPath, output)
+	}
+	return version, nil
+}
+
+// GetCachedVersion returns the cached CLI version, calling the fetcher when it
+// is not cached or older than ModelsTTL. Failures are cached too, so a CLI
+// without --version isn't run again on every readiness probe.
+func (b *BaseProvider) GetCachedVersion(fetcher func() (string, error)) (string, error) {
+	b.versionMu.Lock()
+	defer b.versionMu.Unlock()
+
+	fresh := !b.versionFetchedAt.IsZero() && (b.ModelsTTL <= 0 || time.Since(b.versionFetchedAt) < b.ModelsTTL)
+	if !fresh {
+		b.version, b.versionErr = fetcher()
+		b.versionFetchedAt = time.Now()
+	}
+	return b.version, b.versionErr
 }
 
 // ModelsToNames extracts enabled model names from ModelInfo slice
@@ -0,0 +1,261 @@
+package agents
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/config"
+)
+
+// countingFetcher returns a fetcher reporting how many times it ran in its model's name
+func countingFetcher(calls *int) func() []ModelInfo {
+	return func() []ModelInfo {
+		*calls++
+		return []ModelInfo{{Name: fmt.Sprintf("model-%d", *calls)}}
+	}
+}
+
+func TestCachedModelsExpire(t *testing.T) {
+	calls := 0
+	b := &BaseProvider{ModelsTTL: time.Hour}
+	fetch := countingFetcher(&calls)
+
+	if got := b.GetCachedModels(fetch); got[0].Name != "model-1" {
+		t.Fatalf("first fetch = %v", got)
+	}
+	if got := b.GetCachedModels(fetch); got[0].Name != "model-1" || calls != 1 {
+		t.Fatalf("fresh cache refetched: %v after %d calls", got, calls)
+	}
+
+	// Age the cache past its TTL, as an upgraded CLI would be noticed
+	b.modelsFetchedAt = time.Now().Add(-2 * time.Hour)
+	if got := b.GetCachedModels(fetch); got[0].Name != "model-2" || calls != 2 {
+		t.Errorf("stale cache = %v after %d calls, want a refetch", got, calls)
+	}
+}
+
+func TestCachedModelsZeroTTLCachesForever(t *testing.T) {
+	calls := 0
+	b := &BaseProvider{}
+	fetch := countingFetcher(&calls)
+
+	b.GetCachedModels(fetch)
+	b.modelsFetchedAt = time.Now().Add(-24 * 365 * time.Hour)
+	if got := b.GetCachedModels(fetch); got[0].Name != "model-1" || calls != 1 {
+		t.Errorf("zero TTL refetched: %v after %d calls", got, calls)
+	}
+}
+
+func TestRefreshCachedModels(t *testing.T) {
+	calls := 0
+	b := &BaseProvider{}
+	fetch := countingFetcher(&calls)
+
+	b.GetCachedModels(fetch)
+	if got := b.RefreshCachedModels(fetch); got[0].Name != "model-2" {
+		t.Errorf("refresh = %v, want a refetch despite a fresh cache", got)
+	}
+
+	// A failed fetch keeps the models already known
+	if got := b.RefreshCachedModels(func() []ModelInfo { return nil }); len(got) != 1 || got[0].Name != "model-2" {
+		t.Errorf("failed refresh = %v, want the previous models", got)
+	}
+}
+
+func TestDisabledModelsStayDisabled(t *testing.T) {
+	b := &BaseProvider{}
+	fetch := func() []ModelInfo {
+		return []ModelInfo{{Name: "gpt-5", Enabled: true}, {Name: "gpt-4", Enabled: true}}
+	}
+
+	b.GetCachedModels(fetch)
+	b.DisableModels([]string{"gpt-4"})
+	if got := ModelsToNames(b.GetCachedModels(fetch)); len(got) != 1 || got[0] != "gpt-5" {
+		t.Errorf("enabled models = %q, want only gpt-5", got)
+	}
+
+	// A refetch reports the model enabled again; it must stay disabled
+	if got := ModelsToNames(b.RefreshCachedModels(fetch)); len(got) != 1 || got[0] != "gpt-5" {
+		t.Errorf("enabled models after refresh = %q, want only gpt-5", got)
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{"copilot", "0.0.339\nCommit: 1a2b3c4\n", "0.0.339"},
+		{"cursor-agent", "2025.09.18-7ae6800\n", "2025.09.18-7ae6800"},
+		{"named with v prefix", "tool version v1.4.2-beta.1 (linux/amd64)\n", "1.4.2-beta.1"},
+		{"unsupported flag", "error: unknown option '--version'\n", UnknownVersion},
+		{"empty", "", UnknownVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseVersion(tt.output); got != tt.want {
+				t.Errorf("ParseVersion(%q) = %q, want %q", tt.output, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCachedVersionExpires(t *testing.T) {
+	calls := 0
+	b := &BaseProvider{ModelsTTL: time.Hour}
+	fetch := func() (string, error) {
+		calls++
+		return fmt.Sprintf("1.0.%d", calls), nil
+	}
+
+	b.GetCachedVersion(fetch)
+	if got, _ := b.GetCachedVersion(fetch); got != "1.0.1" || calls != 1 {
+		t.Fatalf("fresh cache = %q after %d calls, want no refetch", got, calls)
+	}
+
+	b.versionFetchedAt = time.Now().Add(-2 * time.Hour)
+	if got, _ := b.GetCachedVersion(fetch); got != "1.0.2" || calls != 2 {
+		t.Errorf("stale cache = %q after %d calls, want a refetch", got, calls)
+	}
+}
+
+func TestRunCommandCapsOutput(t *testing.T) {
+	// yes writes forever, so only the cap ends the run
+	start := time.Now()
+	stdout, _, truncated, err := RunCommand(exec.Command("yes", "abc"), 1000, nil)
+	if err != nil {
+		t.Fatalf("RunCommand() error = %v", err)
+	}
+	if !truncated || len(stdout) != 1000 {
+		t.Errorf("RunCommand() = %d bytes, truncated %v; want the first 1000, truncated", len(stdout), truncated)
+	}
+	if !bytes.HasPrefix(stdout, []byte("abc\nabc\n")) {
+		t.Errorf("stdout starts %q, want the CLI's output", stdout[:min(len(stdout), 16)])
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("RunCommand() took %v, want the CLI killed at the cap", elapsed)
+	}
+
+	// Output within the cap is returned whole
+	stdout, _, truncated, err = RunCommand(exec.Command("echo", "hello"), 1000, nil)
+	if err != nil || truncated || string(stdout) != "hello\n" {
+		t.Errorf("RunCommand() = %q, %v, %v; want the whole output", stdout, truncated, err)
+	}
+}
+
+func TestRunCommandRecordsPhases(t *testing.T) {
+	var timings PhaseTimings
+	if _, _, _, err := RunCommand(exec.Command("sh", "-c", "sleep 0.2; echo hi; sleep 0.2"), 0, &timings); err != nil {
+		t.Fatalf("RunCommand() error = %v", err)
+	}
+	if timings.Startup < 150*time.Millisecond || timings.Generation < 150*time.Millisecond {
+		t.Errorf("timings = %+v, want startup and generation of about 200ms each", timings)
+	}
+
+	// Without output the whole run is startup
+	timings = PhaseTimings{}
+	RunCommand(exec.Command("true"), 0, &timings)
+	if timings.Generation != 0 {
+		t.Errorf("silent run generation = %v, want 0", timings.Generation)
+	}
+}
+
+func TestRunCommandSeparatesStderr(t *testing.T) {
+	// Interleaved lines, then a megabyte on each stream at once: far more than
+	// a pipe buffer holds, so reading one stream while the other fills would hang
+	script := `for i in 1 2 3; do echo out$i; echo err$i >&2; done
+head -c 1048576 /dev/zero | tr '\0' e >&2 &
+head -c 1048576 /dev/zero | tr '\0' o
+wait`
+
+	type result struct {
+		stdout, stderr []byte
+		err            error
+	}
+	done := make(chan result, 1)
+	go func() {
+		stdout, stderr, _, err := RunCommand(exec.Command("sh", "-c", script), 0, nil)
+		done <- result{stdout, stderr, err}
+	}()
+
+	var got result
+	select {
+	case got = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("RunCommand() didn't return, want both streams drained together")
+	}
+	if got.err != nil {
+		t.Fatalf("RunCommand() error = %v", got.err)
+	}
+	wantOut := "out1\nout2\nout3\n" + strings.Repeat("o", 1<<20)
+	wantErr := "err1\nerr2\nerr3\n" + strings.Repeat("e", 1<<20)
+	if string(got.stdout) != wantOut {
+		t.Errorf("stdout = %d bytes starting %q, want only the stdout lines and %d o's", len(got.stdout), got.stdout[:min(len(got.stdout), 20)], 1<<20)
+	}
+	if string(got.stderr) != wantErr {
+		t.Errorf("stderr = %d bytes starting %q, want only the stderr lines and %d e's", len(got.stderr), got.stderr[:min(len(got.stderr), 20)], 1<<20)
+	}
+}
+
+func TestModelCatalogAnnotatesFetchedModels(t *testing.T) {
+	b := &BaseProvider{}
+	fetch := func() []ModelInfo {
+		return []ModelInfo{{Name: "gpt-5", Enabled: true}, {Name: "gpt-4", Enabled: true}}
+	}
+	tools := true
+	b.SetModelCatalog(map[string]ModelCapabilities{
+		"gpt-5":   {ContextWindow: 400000, SupportsTools: &tools},
+		"unknown": {ContextWindow: 1},
+	})
+
+	models := b.GetCachedModels(fetch)
+	if len(models) != 2 {
+		t.Fatalf("models = %v, want only the two the CLI reported", models)
+	}
+	if models[0].ContextWindow != 400000 || models[0].SupportsTools == nil || !*models[0].SupportsTools {
+		t.Errorf("gpt-5 = %+v, want the catalog's capabilities", models[0])
+	}
+	if models[1].ModelCapabilities != (ModelCapabilities{}) {
+		t.Errorf("gpt-4 = %+v, want no capabilities without a catalog entry", models[1])
+	}
+
+	// A refetch is annotated again
+	if models := b.RefreshCachedModels(fetch); models[0].ContextWindow != 400000 {
+		t.Errorf("gpt-5 after refresh = %+v, want the catalog's capabilities", models[0])
+	}
+}
+
+func TestCatalogPricing(t *testing.T) {
+	price := func(p float64) *float64 { return &p }
+	entries := []config.ModelCatalogEntry{
+		{Name: "gpt-5", InputPrice: price(1), OutputPrice: price(2)},
+		{Name: "gpt-5", Provider: "cursor", InputPrice: price(3), OutputPrice: price(4)},
+		{Name: "sonnet-4", Provider: "cursor"},
+		{Name: "sonnet-4", InputPrice: price(5), OutputPrice: price(6)},
+	}
+	tests := []struct {
+		provider, model string
+		want            *ModelPricing
+	}{
+		{"copilot", "gpt-5", &ModelPricing{Input: 1, Output: 2}},
+		{"cursor", "gpt-5", &ModelPricing{Input: 3, Output: 4}},
+		{"copilot", "sonnet-4", &ModelPricing{Input: 5, Output: 6}},
+		// The provider's own entry wins even without prices
+		{"cursor", "sonnet-4", nil},
+		{"copilot", "unknown", nil},
+	}
+	for _, tt := range tests {
+		got := CatalogPricing(entries, tt.provider, tt.model)
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("CatalogPricing(%s, %s) = %v, want %v", tt.provider, tt.model, got, tt.want)
+		}
+	}
+	if cost := (&ModelPricing{Input: 3, Output: 15}).Cost(1000, 200); cost != 0.006 {
+		t.Errorf("Cost() = %v, want 0.006", cost)
+	}
+}
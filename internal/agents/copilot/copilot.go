@@ -2,34 +2,78 @@ package copilot
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
 	"os/exec"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/config"
 )
 
 // Provider implements the CLI provider interface for GitHub Copilot CLI
 type Provider struct {
 	agents.BaseProvider
-	timeout time.Duration
-	token   string
+	timeout      time.Duration
+	toolsTimeout time.Duration
+	backends     *agents.BackendPool
+	promptAsArg  bool
+	structured   bool
+	argsTemplate []string
 }
 
-// NewProvider creates a new Copilot CLI provider
-func NewProvider(binaryPath string, timeout time.Duration, token string) *Provider {
+// NewProvider creates a new Copilot CLI provider. token is used by backends
+// without their own, and by the single backend when none are configured.
+func NewProvider(cfg config.CopilotConfig, token string) *Provider {
+	binaryPath := cfg.BinaryPath
 	if binaryPath == "" {
 		binaryPath = "copilot"
 	}
+	timeout := cfg.Timeout
 	if timeout == 0 {
 		timeout = 120 * time.Second
 	}
+	modelsTTL := time.Hour
+	if cfg.ModelsTTL != nil {
+		modelsTTL = *cfg.ModelsTTL
+	}
+	toolsTimeout := cfg.ToolsTimeout
+	if toolsTimeout == 0 {
+		toolsTimeout = timeout
+	}
+	argsTemplate := cfg.Args
+	if len(argsTemplate) == 0 {
+		argsTemplate = DefaultArgs
+	}
+	backends := []agents.Backend{{BinaryPath: binaryPath, Token: token}}
+	if len(cfg.Backends) > 0 {
+		backends = backends[:0]
+		for _, backend := range cfg.Backends {
+			b := agents.Backend{BinaryPath: backend.BinaryPath, Token: backend.Token, Weight: backend.Weight}
+			if b.BinaryPath == "" {
+				b.BinaryPath = binaryPath
+			}
+			if b.Token == "" {
+				b.Token = token
+			}
+			backends = append(backends, b)
+		}
+	}
 	return &Provider{
-		BaseProvider: agents.BaseProvider{BinaryPath: binaryPath},
+		BaseProvider: agents.BaseProvider{
+			BinaryPath:   backends[0].BinaryPath, // Probed for models and version
+			ModelsTTL:    modelsTTL,
+			PromptPrefix: cfg.PromptPrefix,
+			PromptSuffix: cfg.PromptSuffix,
+		},
 		timeout:      timeout,
-		token:        token,
+		toolsTimeout: toolsTimeout,
+		backends:     agents.NewBackendPool(backends),
+		promptAsArg:  cfg.PromptAsArg == nil || *cfg.PromptAsArg,
+		structured:   cfg.StructuredOutput,
+		argsTemplate: argsTemplate,
 	}
 }
 
@@ -38,6 +82,16 @@ func (p *Provider) Name() string {
 	return "copilot"
 }
 
+// IsAvailable reports whether any backend not isolated by its circuit breaker
+// has its binary in PATH
+func (p *Provider) IsAvailable() bool {
+	return p.backends.IsAvailable()
+}
+
+// modelErrorPattern matches the CLI rejecting --model, e.g.
+// error: option '--model <model>' argument 'x' is invalid. Allowed choices are ...
+var modelErrorPattern = regexp.MustCompile(`--model <model>' argument .* is invalid`)
+
 // modelPattern matches: --model <model>   Set the AI model to use (choices: "model1", "model2", ...)
 var modelPattern = regexp.MustCompile(`--model\s+<model>\s+[^(]*\(choices:\s*([^)]+)\)`)
 
@@ -56,77 +110,255 @@ func (p *Provider) GetModelsInfo() []agents.ModelInfo {
 	return p.GetCachedModels(p.fetchModelsFromCLI)
 }
 
+// RefreshModels re-parses the models from the CLI help output
+func (p *Provider) RefreshModels() []agents.ModelInfo {
+	return p.RefreshCachedModels(p.fetchModelsFromCLI)
+}
+
 // GetSupportedModels returns the models supported by Copilot CLI
 func (p *Provider) GetSupportedModels() []string {
 	return agents.ModelsToNames(p.GetModelsInfo())
 }
 
+// Version returns the installed CLI's version from --version, cached like the models
+func (p *Provider) Version() (string, error) {
+	return p.GetCachedVersion(func() (string, error) {
+		return agents.RunVersion(p.BinaryPath)
+	})
+}
+
+// readOnlyTools are allowed when a client isn't granted unrestricted tool use,
+// letting the CLI inspect a working directory without modifying it
+var readOnlyTools = []string{
+	"shell(ls)",
+	"shell(cat)",
+	"shell(grep)",
+	"shell(find)",
+	"shell(git status)",
+	"shell(git diff)",
+	"shell(git log)",
+	"shell(git show)",
+}
+
+// DefaultArgs is the argument template matching the current Copilot CLI flags.
+// -s (silent) makes the CLI output only the response; with structured output
+// enabled it is replaced by JSON carrying the model, session and token usage.
+var DefaultArgs = []string{
+	"-p {prompt}",
+	"-s",
+	"--output-format json {structured_output}",
+	"--model {model}",
+	"--allow-all-tools {allow_all_tools}",
+	"--allow-tool {read_only_tools}",
+	"--allow-tool {allow_tools}",
+	"--deny-tool {deny_tools}",
+}
+
+// PromptNeedsArg reports whether prompts are passed in -p, which the CLI needs
+// to run non-interactively, rather than piped to stdin
+func (p *Provider) PromptNeedsArg() bool {
+	return p.promptAsArg
+}
+
+// SupportsToolFilters reports that allow and deny lists map to --allow-tool and --deny-tool
+func (p *Provider) SupportsToolFilters() bool {
+	return true
+}
+
+// DefaultTools returns the read-only tools clients without unrestricted tools get
+func (p *Provider) DefaultTools() []string {
+	return readOnlyTools
+}
+
+// SupportsStopSequences reports whether the argument template passes {stop} to
+// the CLI. The current Copilot CLI has no such flag, so the default doesn't.
+func (p *Provider) SupportsStopSequences() bool {
+	return agents.TemplateUses(p.argsTemplate, "stop")
+}
+
+// buildArgs constructs the copilot CLI arguments for a request from the template
+// Also reports whether the prompt is written to stdin rather than passed as an argument
+func (p *Provider) buildArgs(req agents.ExecuteRequest) ([]string, bool) {
+	// The CLI only runs non-interactively with -p, so the prompt goes to stdin
+	// only when it is configured to read it there; Execute refuses prompts too
+	// large for the argument
+	promptViaStdin := !p.promptAsArg
+	prompt := ""
+	if !promptViaStdin {
+		prompt = req.Prompt
+	}
+
+	// Only clients granted unrestricted tools may run anything; others get a
+	// read-only set plus whatever the request explicitly allows
+	var defaultTools []string
+	if !req.AllowAllTools {
+		defaultTools = readOnlyTools
+	}
+
+	args := agents.ExpandArgs(p.argsTemplate, agents.ArgValues{
+		Scalars: map[string]string{
+			"prompt": prompt,
+			"model":  req.Model,
+		},
+		Lists: map[string][]string{
+			"read_only_tools": defaultTools,
+			"allow_tools":     req.AllowTools,
+			"deny_tools":      req.DenyTools,
+			"stop":            req.Stop,
+		},
+		Flags: map[string]bool{
+			"allow_all_tools":   req.AllowAllTools,
+			"force":             req.Force,
+			"structured_output": p.structured,
+		},
+	})
+	return args, promptViaStdin
+}
+
+// buildEnv constructs the child process environment for a request: the
+// inherited part of the server's, the backend's credential, and the client's
+func (p *Provider) buildEnv(req agents.ExecuteRequest, token string) []string {
+	env := p.Environ()
+	if token != "" {
+		env = append(env, "COPILOT_GITHUB_TOKEN="+token)
+	}
+	for k, v := range req.EnvironmentVars {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// DryRun describes the command Execute would run without running it
+func (p *Provider) DryRun(req agents.ExecuteRequest) *agents.CommandPreview {
+	req.Prompt = p.FramePrompt(req.Prompt)
+	args, promptViaStdin := p.buildArgs(req)
+	return &agents.CommandPreview{
+		BinaryPath:       p.Binary(req),
+		Args:             args,
+		EnvKeys:          agents.EnvKeys(p.buildEnv(req, p.backends.First().Token)),
+		PromptViaStdin:   promptViaStdin,
+		WorkingDirectory: req.WorkingDirectory,
+	}
+}
+
 // Execute runs a prompt against the Copilot CLI
 func (p *Provider) Execute(ctx context.Context, req agents.ExecuteRequest) (*agents.ExecuteResponse, error) {
 	startTime := time.Now()
 
-	// Set timeout
+	// Set timeout, allowing longer for runs that may use tools
 	timeout := p.timeout
+	if req.ToolsEnabled() {
+		timeout = p.toolsTimeout
+	}
 	if req.Timeout > 0 {
 		timeout = req.Timeout
 	}
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	// Build command arguments
-	// Use -s (silent) to output only the response, and --allow-all-tools for non-interactive mode
-	args := []string{"-p", req.Prompt, "-s", "--allow-all-tools"}
-
-	if req.Model != "" {
-		args = append(args, "--model", req.Model)
+	// Frame the prompt before building args so both the argument and stdin paths see it
+	req.Prompt = p.FramePrompt(req.Prompt)
+	if p.promptAsArg && agents.PromptExceedsArgLimit(req.Prompt) {
+		// Without -p the CLI would start an interactive session and hang
+		err := fmt.Errorf("prompt is %d bytes, over the %d byte argument limit", len(req.Prompt), agents.MaxPromptArgLength)
+		return nil, &agents.ExecError{Provider: p.Name(), Reason: agents.ErrPromptTooLarge, ExitCode: -1, Err: err}
 	}
+	args, promptViaStdin := p.buildArgs(req)
 
-	for _, tool := range req.AllowTools {
-		args = append(args, "--allow-tool", tool)
-	}
+	// Run on the next backend in rotation, moving on while a backend's binary
+	// can't even be started; any other failure is the request's
+	var output, stderr []byte
+	var truncated bool
+	var timings agents.PhaseTimings
+	var err error
+	for tried := map[*agents.Backend]bool{}; ; {
+		backend := p.backends.NextExcept(tried)
+		if backend == nil {
+			if err == nil {
+				err = &agents.ExecError{Provider: p.Name(), Reason: agents.ErrProviderUnavailable, ExitCode: -1, Err: errors.New("every backend is failing")}
+			}
+			return nil, err
+		}
+		tried[backend] = true
 
-	for _, tool := range req.DenyTools {
-		args = append(args, "--deny-tool", tool)
-	}
-
-	// Create command
-	cmd := exec.CommandContext(ctx, p.BinaryPath, args...)
+		binary := backend.BinaryPath
+		if req.BinaryPath != "" {
+			binary = req.BinaryPath
+		}
+		cmd := exec.CommandContext(ctx, binary, args...)
+		if promptViaStdin {
+			cmd.Stdin = strings.NewReader(req.Prompt)
+		}
+		if req.WorkingDirectory != "" {
+			cmd.Dir = req.WorkingDirectory
+		}
+		cmd.Env = p.buildEnv(req, backend.Token)
 
-	// Set environment variables
-	env := os.Environ()
-	if p.token != "" {
-		env = append(env, "COPILOT_GITHUB_TOKEN="+p.token)
+		timings = agents.PhaseTimings{}
+		output, stderr, truncated, err = agents.RunCommand(cmd, req.MaxOutputBytes, &timings)
+		if err != nil {
+			err = agents.NewExecError(ctx, p.Name(), err, output, stderr, modelErrorPattern)
+		}
+		if err == nil {
+			p.backends.Report(backend, nil)
+			break
+		}
+		if req.BinaryPath != "" {
+			// A missing override is the client's problem, not the backend's
+			if !errors.Is(err, agents.ErrProviderUnavailable) {
+				p.backends.Report(backend, err)
+			}
+			return nil, err
+		}
+		p.backends.Report(backend, err)
+		if !errors.Is(err, agents.ErrProviderUnavailable) {
+			return nil, err
+		}
 	}
-	if req.WorkingDirectory != "" {
-		cmd.Dir = req.WorkingDirectory
-	}
-	for k, v := range req.EnvironmentVars {
-		env = append(env, k+"="+v)
-	}
-	cmd.Env = env
 
-	// Execute command
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return nil, fmt.Errorf("copilot CLI execution failed: %w, output: %s", err, string(output))
+	// Copilot CLI with -s flag returns plain text output; structured output is
+	// JSON, falling back to the raw text if the CLI didn't produce any
+	result := &parsedOutput{Content: string(output)}
+	if p.structured {
+		if result, err = parseOutput(output); err != nil {
+			if truncated {
+				err = fmt.Errorf("output exceeded %d bytes: %w", req.MaxOutputBytes, err)
+			}
+			return nil, &agents.ExecError{Provider: p.Name(), Reason: agents.ErrExecFailed, ExitCode: -1, Err: err}
+		}
+	}
+	content := result.Content
+	if truncated {
+		// The cut may have split a multi-byte character
+		content = strings.ToValidUTF8(content, "")
 	}
-
-	// Copilot CLI with -s flag returns plain text output, not JSON
-	content := string(output)
 
 	responseTime := time.Since(startTime)
 
-	// Estimate tokens
-	promptTokens := agents.EstimateTokens(req.Prompt)
-	completionTokens := agents.EstimateTokens(content)
+	// Prefer the usage the CLI reported, estimating tokens when it reported none
+	promptTokens, completionTokens := result.PromptTokens, result.CompletionTokens
+	if !result.UsageReported {
+		promptTokens = agents.EstimateTokens(req.Prompt)
+		completionTokens = agents.EstimateTokens(content)
+	}
+
+	// Plain text output doesn't name the model, so fall back to the requested one
+	model := result.Model
+	if model == "" {
+		model = req.Model
+	}
 
 	return &agents.ExecuteResponse{
 		Content:          content,
-		Model:            req.Model, // Use the requested model since copilot doesn't return it
+		Model:            model,
 		PromptTokens:     promptTokens,
 		CompletionTokens: completionTokens,
 		TotalTokens:      promptTokens + completionTokens,
+		UsageReported:    result.UsageReported,
 		ResponseTime:     responseTime,
-		SessionID:        "",
+		SessionID:        result.SessionID,
+		Truncated:        truncated,
+		Metadata:         agents.WithTimings(req, agents.DebugMetadata(req, stderr), timings),
+		RawOutput:        agents.Raw(req, output, stderr),
 	}, nil
 }
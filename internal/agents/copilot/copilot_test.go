@@ -0,0 +1,285 @@
+package copilot
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/config"
+)
+
+// fakeCLI writes an executable shell script standing in for the Copilot CLI
+// and returns its path
+func fakeCLI(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "copilot")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExecutePromptPlacement(t *testing.T) {
+	// The fake CLI echoes its arguments, then whatever it reads from stdin
+	path := fakeCLI(t, `printf 'args:%s\n' "$*"; printf 'stdin:'; cat`)
+	asArg, viaStdin := true, false
+	large := strings.Repeat("x", agents.MaxPromptArgLength+1)
+	tests := []struct {
+		name        string
+		promptAsArg *bool
+		prompt      string
+		wantStdin   bool
+	}{
+		{"default passes -p", nil, "hello", false},
+		{"prompt_as_arg true passes -p", &asArg, "hello", false},
+		{"prompt_as_arg false pipes stdin", &viaStdin, "hello", true},
+		{"oversized prompt with prompt_as_arg false pipes stdin", &viaStdin, large, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProvider(config.CopilotConfig{BinaryPath: path, PromptAsArg: tt.promptAsArg}, "")
+			resp, err := p.Execute(context.Background(), agents.ExecuteRequest{Prompt: tt.prompt, Model: "gpt-5"})
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			args, stdin, _ := strings.Cut(strings.TrimPrefix(resp.Content, "args:"), "\nstdin:")
+			if tt.wantStdin {
+				if stdin != tt.prompt || strings.Contains(args, "-p") {
+					t.Errorf("args %.40q, stdin %.40q; want the prompt on stdin only", args, stdin)
+				}
+				return
+			}
+			if stdin != "" || !strings.HasPrefix(args, "-p "+tt.prompt+" ") {
+				t.Errorf("args %.40q, stdin %.40q; want -p followed by the prompt", args, stdin)
+			}
+		})
+	}
+}
+
+func TestExecuteRefusesPromptTooLargeForP(t *testing.T) {
+	// Like the real CLI, the fake one only answers with -p; without it, it
+	// would wait for input in an interactive session
+	ran := filepath.Join(t.TempDir(), "ran")
+	path := fakeCLI(t, `touch `+ran+`; case " $* " in *" -p "*) printf answered ;; *) echo 'missing -p' >&2; exit 1 ;; esac`)
+	p := NewProvider(config.CopilotConfig{BinaryPath: path}, "")
+
+	resp, err := p.Execute(context.Background(), agents.ExecuteRequest{Prompt: "hello", Model: "gpt-5"})
+	if err != nil || resp.Content != "answered" {
+		t.Fatalf("Execute() = %v, %v; want the CLI run with -p", resp, err)
+	}
+	os.Remove(ran)
+
+	large := strings.Repeat("x", agents.MaxPromptArgLength+1)
+	if _, err := p.Execute(context.Background(), agents.ExecuteRequest{Prompt: large, Model: "gpt-5"}); !errors.Is(err, agents.ErrPromptTooLarge) {
+		t.Errorf("Execute() of an oversized prompt error = %v, want ErrPromptTooLarge", err)
+	}
+	if _, err := os.Stat(ran); err == nil {
+		t.Error("the CLI ran for an oversized prompt, want it refused up front")
+	}
+	if !p.PromptNeedsArg() {
+		t.Error("PromptNeedsArg() = false by default, want true")
+	}
+}
+
+func TestVersion(t *testing.T) {
+	p := NewProvider(config.CopilotConfig{BinaryPath: fakeCLI(t, `printf '0.0.339\nCommit: 1a2b3c4\n'`)}, "")
+	if version, err := p.Version(); err != nil || version != "0.0.339" {
+		t.Errorf("Version() = %q, %v; want 0.0.339", version, err)
+	}
+
+	// An older CLI without --version reports unknown rather than failing the caller
+	p = NewProvider(config.CopilotConfig{BinaryPath: fakeCLI(t, `echo "error: unknown option '$1'" >&2; exit 1`)}, "")
+	if version, err := p.Version(); err == nil || version != agents.UnknownVersion {
+		t.Errorf("Version() = %q, %v; want unknown with an error", version, err)
+	}
+}
+
+func TestBuildArgsTools(t *testing.T) {
+	p := NewProvider(config.CopilotConfig{}, "")
+
+	args, _ := p.buildArgs(agents.ExecuteRequest{Prompt: "hi", AllowTools: []string{"write"}, DenyTools: []string{"shell(rm)"}})
+	for _, want := range []string{"shell(ls)", "write", "shell(rm)"} {
+		if !slices.Contains(args, want) {
+			t.Errorf("args = %q, missing %q", args, want)
+		}
+	}
+	if slices.Contains(args, "--allow-all-tools") {
+		t.Errorf("args = %q, want no --allow-all-tools without AllowAllTools", args)
+	}
+
+	args, _ = p.buildArgs(agents.ExecuteRequest{Prompt: "hi", AllowAllTools: true})
+	if !slices.Contains(args, "--allow-all-tools") || slices.Contains(args, "shell(ls)") {
+		t.Errorf("args = %q, want --allow-all-tools instead of the read-only set", args)
+	}
+}
+
+func TestExecuteFramesPrompt(t *testing.T) {
+	// The fake CLI echoes its arguments and stdin, so the output is whatever
+	// the CLI was given
+	binary := fakeCLI(t, `printf '%s\n' "$@"; cat`)
+
+	viaStdin := false
+	for _, promptAsArg := range []*bool{nil, &viaStdin} {
+		p := NewProvider(config.CopilotConfig{
+			BinaryPath:   binary,
+			PromptAsArg:  promptAsArg,
+			PromptPrefix: "Respond concisely.\n\n",
+			PromptSuffix: "\n\nNo markdown.",
+		}, "")
+		resp, err := p.Execute(context.Background(), agents.ExecuteRequest{Prompt: "What is Go?", Model: "gpt-5"})
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		if want := "Respond concisely.\n\nWhat is Go?\n\nNo markdown."; !strings.Contains(resp.Content, want) {
+			t.Errorf("CLI received %q, want the framed prompt %q", resp.Content, want)
+		}
+	}
+}
+
+func TestExecuteStructuredOutput(t *testing.T) {
+	// The fake CLI only answers in JSON when asked to
+	binary := fakeCLI(t, `case "$*" in
+*"--output-format json"*) echo '{"type": "result", "result": "Hi.", "model": "gpt-5-mini", "usage": {"input_tokens": 40, "output_tokens": 3}}' ;;
+*) echo "Hi." ;;
+esac`)
+	req := agents.ExecuteRequest{Prompt: "Say hi", Model: "gpt-5"}
+
+	resp, err := NewProvider(config.CopilotConfig{BinaryPath: binary, StructuredOutput: true}, "").Execute(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if resp.Content != "Hi." || resp.Model != "gpt-5-mini" || !resp.UsageReported || resp.PromptTokens != 40 || resp.CompletionTokens != 3 {
+		t.Errorf("structured Execute() = %+v, want the CLI's content, model and usage", resp)
+	}
+
+	resp, err = NewProvider(config.CopilotConfig{BinaryPath: binary}, "").Execute(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if resp.Content != "Hi.\n" || resp.Model != "gpt-5" || resp.UsageReported {
+		t.Errorf("plain Execute() = %+v, want the text with the requested model and estimated usage", resp)
+	}
+}
+
+func TestExecuteToolsTimeout(t *testing.T) {
+	// The CLI outlasts the plain timeout but not the tools timeout
+	path := fakeCLI(t, "sleep 0.5; printf done")
+	p := NewProvider(config.CopilotConfig{BinaryPath: path, Timeout: 100 * time.Millisecond, ToolsTimeout: 10 * time.Second}, "")
+
+	if _, err := p.Execute(context.Background(), agents.ExecuteRequest{Prompt: "hello", Model: "gpt-5"}); !errors.Is(err, agents.ErrExecTimeout) {
+		t.Errorf("plain Execute() error = %v, want a timeout", err)
+	}
+	for _, req := range []agents.ExecuteRequest{
+		{Prompt: "hello", Model: "gpt-5", AllowTools: []string{"shell"}},
+		{Prompt: "hello", Model: "gpt-5", AllowAllTools: true},
+		{Prompt: "hello", Model: "gpt-5", Force: true},
+	} {
+		if resp, err := p.Execute(context.Background(), req); err != nil || resp.Content != "done" {
+			t.Errorf("Execute(%+v) = %+v, %v; want the run to finish within tools_timeout", req, resp, err)
+		}
+	}
+}
+
+func TestExecuteFailsFastOnInteractivePrompt(t *testing.T) {
+	// The fake CLI consumes any piped prompt, then waits for a confirmation
+	path := fakeCLI(t, `cat >/dev/null; printf 'Trust this folder? [y/N] '; read answer || { echo 'no answer' >&2; exit 1; }; sleep 30`)
+	asArg, viaStdin := true, false
+	for _, promptAsArg := range []*bool{&asArg, &viaStdin} {
+		p := NewProvider(config.CopilotConfig{BinaryPath: path, PromptAsArg: promptAsArg, Timeout: 20 * time.Second}, "")
+		start := time.Now()
+		_, err := p.Execute(context.Background(), agents.ExecuteRequest{Prompt: "hello", Model: "gpt-5"})
+		if err == nil || errors.Is(err, agents.ErrExecTimeout) {
+			t.Errorf("prompt_as_arg %v: Execute() error = %v, want the CLI to fail on EOF", *promptAsArg, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("prompt_as_arg %v: Execute() took %v, want it to fail without waiting for the timeout", *promptAsArg, elapsed)
+		}
+	}
+}
+
+func TestBuildEnvStripsServerSecrets(t *testing.T) {
+	t.Setenv("DATABASE_PASSWORD", "server-secret")
+	t.Setenv("GH_TOKEN", "server-token")
+	t.Setenv("HTTPS_PROXY", "http://proxy:3128")
+	p := NewProvider(config.CopilotConfig{}, "provider-token")
+	p.SetEnvPolicy(nil, []string{"HTTPS_PROXY"})
+
+	env := p.buildEnv(agents.ExecuteRequest{EnvironmentVars: map[string]string{"PROJECT": "demo"}}, "provider-token")
+	for _, entry := range env {
+		if strings.HasPrefix(entry, "DATABASE_PASSWORD=") || strings.HasPrefix(entry, "GH_TOKEN=") || strings.HasPrefix(entry, "HTTPS_PROXY=") {
+			t.Errorf("env has %q, want server variables outside the inherited set left out", entry)
+		}
+	}
+	for _, want := range []string{"PATH=" + os.Getenv("PATH"), "COPILOT_GITHUB_TOKEN=provider-token", "PROJECT=demo"} {
+		if !slices.Contains(env, want) {
+			t.Errorf("env = %q, want %q", env, want)
+		}
+	}
+}
+
+func TestExecuteSpreadsAcrossBackends(t *testing.T) {
+	binary := fakeCLI(t, `cat >/dev/null; printf '%s' "$COPILOT_GITHUB_TOKEN"`)
+	p := NewProvider(config.CopilotConfig{Backends: []config.CopilotBackend{
+		{BinaryPath: binary, Token: "token-a", Weight: 2},
+		{BinaryPath: filepath.Join(t.TempDir(), "missing")},
+		{BinaryPath: binary, Token: "token-b"},
+	}}, "default-token")
+
+	// The missing backend is passed over within each request, then taken out
+	// of rotation once its circuit opens
+	counts := map[string]int{}
+	for range 12 {
+		resp, err := p.Execute(context.Background(), agents.ExecuteRequest{Prompt: "hi", Model: "gpt-5"})
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+		counts[resp.Content]++
+	}
+	if counts["token-a"] != 8 || counts["token-b"] != 4 {
+		t.Errorf("requests per token = %v, want 8 on token-a and 4 on token-b", counts)
+	}
+	if !p.IsAvailable() {
+		t.Error("IsAvailable() = false, want the working backends to count")
+	}
+}
+
+func TestExecuteTriesEveryBackend(t *testing.T) {
+	// The missing backend is picked several times in a row by weight, so the
+	// healthy one must still be reached after it fails
+	p := NewProvider(config.CopilotConfig{Backends: []config.CopilotBackend{
+		{BinaryPath: filepath.Join(t.TempDir(), "missing"), Weight: 3},
+		{BinaryPath: fakeCLI(t, `cat >/dev/null; printf '%s' "$COPILOT_GITHUB_TOKEN"`), Token: "healthy"},
+	}}, "")
+
+	for i := range 4 {
+		resp, err := p.Execute(context.Background(), agents.ExecuteRequest{Prompt: "hi", Model: "gpt-5"})
+		if err != nil {
+			t.Fatalf("request %d: Execute() error = %v, want the healthy backend to serve it", i, err)
+		}
+		if resp.Content != "healthy" {
+			t.Errorf("request %d: content = %q, want the healthy backend's token", i, resp.Content)
+		}
+	}
+}
+
+func TestExecuteFailingCLIKeepsBackend(t *testing.T) {
+	// A CLI that runs and exits non-zero fails the request, which may be at fault
+	p := NewProvider(config.CopilotConfig{Backends: []config.CopilotBackend{
+		{BinaryPath: fakeCLI(t, "cat >/dev/null; echo 'bad request' >&2; exit 1")},
+	}}, "")
+
+	for range agents.BreakerThreshold + 1 {
+		if _, err := p.Execute(context.Background(), agents.ExecuteRequest{Prompt: "hi", Model: "gpt-5"}); !errors.Is(err, agents.ErrExecFailed) {
+			t.Fatalf("Execute() error = %v, want the CLI's failure", err)
+		}
+	}
+	if !p.IsAvailable() {
+		t.Error("IsAvailable() = false, want failing requests to leave the backend in rotation")
+	}
+}
@@ -0,0 +1,140 @@
+package copilot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// outputEvent is one JSON object emitted by the Copilot CLI in structured
+// output mode: a single object, or a newline-delimited stream of events where
+// the answer, model, session and usage may arrive on different events
+type outputEvent struct {
+	Type           string       `json:"type"`
+	IsError        bool         `json:"is_error"`
+	Result         string       `json:"result"`
+	Content        string       `json:"content"`
+	Text           string       `json:"text"`
+	Model          string       `json:"model"`
+	Error          string       `json:"error"`
+	Message        string       `json:"message"`
+	SessionID      string       `json:"session_id"`
+	SessionIDCamel string       `json:"sessionId"`
+	Usage          *outputUsage `json:"usage"`
+}
+
+// outputUsage is token usage reported by the Copilot CLI, when it reports any.
+// Both OpenAI-style and Anthropic-style field names are accepted.
+type outputUsage struct {
+	InputTokens       int `json:"input_tokens"`
+	OutputTokens      int `json:"output_tokens"`
+	PromptTokens      int `json:"prompt_tokens"`
+	CompletionTokens  int `json:"completion_tokens"`
+	InputTokensCamel  int `json:"inputTokens"`
+	OutputTokensCamel int `json:"outputTokens"`
+}
+
+// parsedOutput is the final result extracted from structured Copilot CLI output
+type parsedOutput struct {
+	Content   string
+	Model     string
+	SessionID string
+
+	// Usage reported by the CLI; UsageReported is false when it reported none
+	PromptTokens     int
+	CompletionTokens int
+	UsageReported    bool
+}
+
+// parseOutput extracts the final result from structured Copilot CLI output.
+// Non-JSON lines are ignored; an error event is returned as an error. Output
+// with no JSON events at all, e.g. from a CLI that ignored the flag, is
+// returned verbatim as the content.
+func parseOutput(output []byte) (*parsedOutput, error) {
+	result := &parsedOutput{}
+	sawEvent, sawContent, final := false, false, false
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(output)+1)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+
+		var event outputEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			continue
+		}
+		sawEvent = true
+
+		if event.Type == "error" || event.IsError {
+			return nil, fmt.Errorf("copilot CLI returned an error: %s", event.errorMessage())
+		}
+
+		// A result event (or an untyped single object) holds the final answer;
+		// until one arrives the last event with content stands in for it
+		content := event.content()
+		switch {
+		case event.Type == "result" || (event.Type == "" && content != ""):
+			result.Content, sawContent, final = content, true, true
+		case content != "" && !final:
+			result.Content, sawContent = content, true
+		}
+		if event.Model != "" {
+			result.Model = event.Model
+		}
+		if id := event.sessionID(); id != "" {
+			result.SessionID = id
+		}
+		if u := event.Usage; u != nil {
+			prompt := max(u.InputTokens, u.PromptTokens, u.InputTokensCamel)
+			completion := max(u.OutputTokens, u.CompletionTokens, u.OutputTokensCamel)
+			if prompt > 0 || completion > 0 {
+				result.PromptTokens, result.CompletionTokens, result.UsageReported = prompt, completion, true
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read copilot CLI output: %w", err)
+	}
+
+	if !sawEvent {
+		// Not JSON at all - return raw output
+		return &parsedOutput{Content: string(output)}, nil
+	}
+	if !sawContent {
+		return nil, fmt.Errorf("copilot CLI output contained no result")
+	}
+	return result, nil
+}
+
+// content returns the event's answer text, preferring newer field names
+func (e *outputEvent) content() string {
+	for _, s := range []string{e.Result, e.Content, e.Text} {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// sessionID returns the event's session ID under either spelling
+func (e *outputEvent) sessionID() string {
+	if e.SessionID != "" {
+		return e.SessionID
+	}
+	return e.SessionIDCamel
+}
+
+// errorMessage picks the most descriptive message from an error event
+func (e *outputEvent) errorMessage() string {
+	for _, msg := range []string{e.Error, e.Message, e.Result, e.Content} {
+		if msg = strings.TrimSpace(msg); msg != "" {
+			return msg
+		}
+	}
+	return "unknown error"
+}
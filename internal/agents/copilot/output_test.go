@@ -0,0 +1,66 @@
+package copilot
+
+import (
+	"testing"
+)
+
+func TestParseOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    parsedOutput
+		wantErr bool
+	}{
+		{
+			name:   "plain text",
+			output: "Go is a programming language.\n",
+			want:   parsedOutput{Content: "Go is a programming language.\n"},
+		},
+		{
+			name:   "single object",
+			output: `{"result": "Go is a language.", "model": "gpt-5", "session_id": "s-1", "usage": {"input_tokens": 12, "output_tokens": 5}}`,
+			want:   parsedOutput{Content: "Go is a language.", Model: "gpt-5", SessionID: "s-1", PromptTokens: 12, CompletionTokens: 5, UsageReported: true},
+		},
+		{
+			name: "event stream with a result",
+			output: `{"type": "init", "sessionId": "s-2", "model": "claude-sonnet-4"}
+{"type": "message", "content": "Thinking..."}
+{"type": "result", "result": "Done.", "usage": {"promptTokens": 0, "prompt_tokens": 30, "completion_tokens": 2}}
+`,
+			want: parsedOutput{Content: "Done.", Model: "claude-sonnet-4", SessionID: "s-2", PromptTokens: 30, CompletionTokens: 2, UsageReported: true},
+		},
+		{
+			name: "content events without a result",
+			output: `{"type": "message", "text": "First."}
+{"type": "message", "text": "Second."}
+`,
+			want: parsedOutput{Content: "Second."},
+		},
+		{
+			name:   "non-JSON chatter around events",
+			output: "Loading...\n" + `{"result": "Hi."}` + "\n",
+			want:   parsedOutput{Content: "Hi."},
+		},
+		{
+			name:    "error event",
+			output:  `{"type": "error", "message": "rate limited"}`,
+			wantErr: true,
+		},
+		{
+			name:    "events without a result",
+			output:  `{"type": "init", "model": "gpt-5"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOutput([]byte(tt.output))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseOutput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("parseOutput() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -2,35 +2,60 @@ package cursor
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
 	"os/exec"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/config"
 )
 
 // Provider implements the CLI provider interface for Cursor CLI
 type Provider struct {
 	agents.BaseProvider
-	timeout time.Duration
-	apiKey  string
+	timeout      time.Duration
+	toolsTimeout time.Duration
+	apiKey       string
+	promptAsArg  bool
+	argsTemplate []string
 }
 
 // NewProvider creates a new Cursor CLI provider
-func NewProvider(binaryPath string, timeout time.Duration, apiKey string) *Provider {
+func NewProvider(cfg config.CursorConfig, apiKey string) *Provider {
+	binaryPath := cfg.BinaryPath
 	if binaryPath == "" {
 		binaryPath = "cursor-agent"
 	}
+	timeout := cfg.Timeout
 	if timeout == 0 {
 		timeout = 120 * time.Second
 	}
+	modelsTTL := time.Hour
+	if cfg.ModelsTTL != nil {
+		modelsTTL = *cfg.ModelsTTL
+	}
+	toolsTimeout := cfg.ToolsTimeout
+	if toolsTimeout == 0 {
+		toolsTimeout = timeout
+	}
+	argsTemplate := cfg.Args
+	if len(argsTemplate) == 0 {
+		argsTemplate = DefaultArgs
+	}
 	return &Provider{
-		BaseProvider: agents.BaseProvider{BinaryPath: binaryPath},
+		BaseProvider: agents.BaseProvider{
+			BinaryPath:   binaryPath,
+			ModelsTTL:    modelsTTL,
+			PromptPrefix: cfg.PromptPrefix,
+			PromptSuffix: cfg.PromptSuffix,
+		},
 		timeout:      timeout,
+		toolsTimeout: toolsTimeout,
 		apiKey:       apiKey,
+		promptAsArg:  cfg.PromptAsArg,
+		argsTemplate: argsTemplate,
 	}
 }
 
@@ -39,6 +64,10 @@ func (p *Provider) Name() string {
 	return "cursor"
 }
 
+// modelErrorPattern matches the CLI rejecting --model. Its wording has varied
+// between releases, so this covers the common phrasings.
+var modelErrorPattern = regexp.MustCompile(`(?i)cannot use this model|(unknown|invalid|unsupported) model|model \S+ (not found|is not available)`)
+
 // modelPattern matches: --model <model>  Model to use (e.g., gpt-5, sonnet-4, sonnet-4-thinking)
 var modelPattern = regexp.MustCompile(`--model\s+<model>\s+[^(]*\(e\.g\.?,?\s*([^)]+)\)`)
 
@@ -57,75 +86,150 @@ func (p *Provider) GetModelsInfo() []agents.ModelInfo {
 	return p.GetCachedModels(p.fetchModelsFromCLI)
 }
 
+// RefreshModels re-parses the models from the CLI help output
+func (p *Provider) RefreshModels() []agents.ModelInfo {
+	return p.RefreshCachedModels(p.fetchModelsFromCLI)
+}
+
 // GetSupportedModels returns the models supported by Cursor CLI
 func (p *Provider) GetSupportedModels() []string {
 	return agents.ModelsToNames(p.GetModelsInfo())
 }
 
+// Version returns the installed CLI's version from --version, cached like the models
+func (p *Provider) Version() (string, error) {
+	return p.GetCachedVersion(func() (string, error) {
+		return agents.RunVersion(p.BinaryPath)
+	})
+}
+
+// SupportsSessionResume reports that cursor-agent resumes sessions with --resume
+func (p *Provider) SupportsSessionResume() bool {
+	return true
+}
+
+// SupportsStopSequences reports whether the argument template passes {stop} to
+// the CLI. The current cursor-agent has no such flag, so the default doesn't.
+func (p *Provider) SupportsStopSequences() bool {
+	return agents.TemplateUses(p.argsTemplate, "stop")
+}
+
+// DefaultArgs is the argument template matching the current cursor-agent flags
+var DefaultArgs = []string{
+	"-p",
+	"--output-format json",
+	"{prompt}",
+	"--model {model}",
+	"--force {force}",
+	"--resume {session_id}",
+}
+
+// buildArgs constructs the cursor-agent arguments for a request from the template
+// Also reports whether the prompt is written to stdin rather than passed as an argument
+func (p *Provider) buildArgs(req agents.ExecuteRequest) ([]string, bool) {
+	// Write the prompt to stdin so it stays out of the process table, unless the
+	// CLI is configured to take it as an argument and it fits in one
+	promptViaStdin := !p.promptAsArg || agents.PromptExceedsArgLimit(req.Prompt)
+	prompt := ""
+	if !promptViaStdin {
+		prompt = req.Prompt
+	}
+
+	args := agents.ExpandArgs(p.argsTemplate, agents.ArgValues{
+		Scalars: map[string]string{
+			"prompt":     prompt,
+			"model":      req.Model,
+			"session_id": req.SessionID,
+		},
+		Lists: map[string][]string{
+			"stop": req.Stop,
+		},
+		Flags: map[string]bool{
+			"force": req.Force,
+		},
+	})
+	return args, promptViaStdin
+}
+
+// buildEnv constructs the child process environment for a request: the
+// inherited part of the server's, the provider's credential, and the client's
+func (p *Provider) buildEnv(req agents.ExecuteRequest) []string {
+	env := p.Environ()
+	if p.apiKey != "" {
+		env = append(env, "CURSOR_API_KEY="+p.apiKey)
+	}
+	for k, v := range req.EnvironmentVars {
+		env = append(env, k+"="+v)
+	}
+	return env
+}
+
+// DryRun describes the command Execute would run without running it
+func (p *Provider) DryRun(req agents.ExecuteRequest) *agents.CommandPreview {
+	req.Prompt = p.FramePrompt(req.Prompt)
+	args, promptViaStdin := p.buildArgs(req)
+	return &agents.CommandPreview{
+		BinaryPath:       p.Binary(req),
+		Args:             args,
+		EnvKeys:          agents.EnvKeys(p.buildEnv(req)),
+		PromptViaStdin:   promptViaStdin,
+		WorkingDirectory: req.WorkingDirectory,
+	}
+}
+
 // Execute runs a prompt against the Cursor CLI
 func (p *Provider) Execute(ctx context.Context, req agents.ExecuteRequest) (*agents.ExecuteResponse, error) {
 	startTime := time.Now()
 
-	// Set timeout
+	// Set timeout, allowing longer for runs that may use tools
 	timeout := p.timeout
+	if req.ToolsEnabled() {
+		timeout = p.toolsTimeout
+	}
 	if req.Timeout > 0 {
 		timeout = req.Timeout
 	}
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	// Build command arguments
-	args := []string{"-p", "--output-format", "json", req.Prompt}
-
-	if req.Model != "" {
-		args = append(args, "--model", req.Model)
-	}
-
-	if req.Force {
-		args = append(args, "--force")
-	}
+	// Frame the prompt before building args so both the argument and stdin paths see it
+	req.Prompt = p.FramePrompt(req.Prompt)
+	args, promptViaStdin := p.buildArgs(req)
 
 	// Create command
-	cmd := exec.CommandContext(ctx, p.BinaryPath, args...)
-
-	// Set environment variables
-	env := os.Environ()
-	if p.apiKey != "" {
-		env = append(env, "CURSOR_API_KEY="+p.apiKey)
+	cmd := exec.CommandContext(ctx, p.Binary(req), args...)
+	if promptViaStdin {
+		cmd.Stdin = strings.NewReader(req.Prompt)
 	}
 	if req.WorkingDirectory != "" {
 		cmd.Dir = req.WorkingDirectory
 	}
-	for k, v := range req.EnvironmentVars {
-		env = append(env, k+"="+v)
-	}
-	cmd.Env = env
+	cmd.Env = p.buildEnv(req)
 
 	// Execute command
-	output, err := cmd.CombinedOutput()
+	var timings agents.PhaseTimings
+	output, stderr, truncated, err := agents.RunCommand(cmd, req.MaxOutputBytes, &timings)
 	if err != nil {
-		return nil, fmt.Errorf("cursor CLI execution failed: %w, output: %s", err, string(output))
-	}
-
-	// Parse JSON output
-	var result struct {
-		Content  string `json:"content"`
-		Model    string `json:"model"`
-		Metadata struct {
-			SessionID string `json:"session_id"`
-		} `json:"metadata"`
+		return nil, agents.NewExecError(ctx, p.Name(), err, output, stderr, modelErrorPattern)
 	}
 
-	if err := json.Unmarshal(output, &result); err != nil {
-		// If JSON parsing fails, return raw output
-		result.Content = string(output)
+	// Parse JSON output (a single object or a stream of events)
+	result, err := parseOutput(output)
+	if err != nil {
+		if truncated {
+			err = fmt.Errorf("output exceeded %d bytes: %w", req.MaxOutputBytes, err)
+		}
+		return nil, &agents.ExecError{Provider: p.Name(), Reason: agents.ErrExecFailed, ExitCode: -1, Err: err}
 	}
 
 	responseTime := time.Since(startTime)
 
-	// Estimate tokens
-	promptTokens := agents.EstimateTokens(req.Prompt)
-	completionTokens := agents.EstimateTokens(result.Content)
+	// Prefer the usage the CLI reported, estimating tokens when it reported none
+	promptTokens, completionTokens := result.PromptTokens, result.CompletionTokens
+	if !result.UsageReported {
+		promptTokens = agents.EstimateTokens(req.Prompt)
+		completionTokens = agents.EstimateTokens(result.Content)
+	}
 
 	return &agents.ExecuteResponse{
 		Content:          result.Content,
@@ -133,7 +237,12 @@ func (p *Provider) Execute(ctx context.Context, req agents.ExecuteRequest) (*age
 		PromptTokens:     promptTokens,
 		CompletionTokens: completionTokens,
 		TotalTokens:      promptTokens + completionTokens,
+		Cost:             result.Cost,
+		UsageReported:    result.UsageReported,
 		ResponseTime:     responseTime,
-		SessionID:        result.Metadata.SessionID,
+		SessionID:        result.SessionID,
+		Truncated:        truncated,
+		Metadata:         agents.WithTimings(req, agents.DebugMetadata(req, stderr), timings),
+		RawOutput:        agents.Raw(req, output, stderr),
 	}, nil
 }
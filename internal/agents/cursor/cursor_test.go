@@ -0,0 +1,156 @@
+package cursor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/config"
+)
+
+func TestBuildArgsPromptPlacement(t *testing.T) {
+	// cursor-agent's -p is a print-mode switch, so it stays whether or not
+	// the prompt is an argument
+	req := agents.ExecuteRequest{Prompt: "hello", Model: "sonnet-4"}
+
+	args, stdin := NewProvider(config.CursorConfig{}, "").buildArgs(req)
+	if !stdin || !slices.Contains(args, "-p") || slices.Contains(args, "hello") {
+		t.Errorf("default args = %q, stdin %v; want -p with the prompt on stdin", args, stdin)
+	}
+
+	args, stdin = NewProvider(config.CursorConfig{PromptAsArg: true}, "").buildArgs(req)
+	if stdin || !slices.Contains(args, "-p") || !slices.Contains(args, "hello") {
+		t.Errorf("prompt_as_arg args = %q, stdin %v; want -p and the prompt argument", args, stdin)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cursor-agent")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\necho 2025.09.18-7ae6800\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	p := NewProvider(config.CursorConfig{BinaryPath: path}, "")
+	if version, err := p.Version(); err != nil || version != "2025.09.18-7ae6800" {
+		t.Errorf("Version() = %q, %v; want 2025.09.18-7ae6800", version, err)
+	}
+}
+
+func TestNoToolFilters(t *testing.T) {
+	// cursor-agent has no per-tool flags, so requests with tool lists must be
+	// rejected rather than run unrestricted
+	var provider agents.Provider = NewProvider(config.CursorConfig{}, "")
+	if filterer, ok := provider.(agents.ToolFilterer); ok && filterer.SupportsToolFilters() {
+		t.Error("cursor claims to apply allow_tools and deny_tools")
+	}
+
+	args, _ := NewProvider(config.CursorConfig{}, "").buildArgs(agents.ExecuteRequest{Prompt: "hi", Force: true})
+	if !slices.Contains(args, "--force") {
+		t.Errorf("args = %q, want --force for a forced request", args)
+	}
+}
+
+func TestDryRunFramesPrompt(t *testing.T) {
+	p := NewProvider(config.CursorConfig{PromptAsArg: true, PromptPrefix: "Respond concisely.\n\n", PromptSuffix: "\n\nNo markdown."}, "")
+	preview := p.DryRun(agents.ExecuteRequest{Prompt: "What is Go?", Model: "sonnet-4"})
+	if want := "Respond concisely.\n\nWhat is Go?\n\nNo markdown."; !slices.Contains(preview.Args, want) {
+		t.Errorf("args = %q, want the framed prompt %q", preview.Args, want)
+	}
+}
+
+func TestBuildArgsResume(t *testing.T) {
+	p := NewProvider(config.CursorConfig{}, "")
+
+	args, _ := p.buildArgs(agents.ExecuteRequest{Prompt: "hi", Model: "sonnet-4"})
+	if slices.Contains(args, "--resume") {
+		t.Errorf("args = %q, want no --resume without a session", args)
+	}
+
+	args, _ = p.buildArgs(agents.ExecuteRequest{Prompt: "hi", Model: "sonnet-4", SessionID: "chat-123"})
+	if i := slices.Index(args, "--resume"); i < 0 || i+1 >= len(args) || args[i+1] != "chat-123" {
+		t.Errorf("args = %q, want --resume chat-123", args)
+	}
+}
+
+func TestExecuteFailsFastOnInteractivePrompt(t *testing.T) {
+	// The fake CLI consumes any piped prompt, then waits for a confirmation
+	path := filepath.Join(t.TempDir(), "cursor-agent")
+	script := "#!/bin/sh\ncat >/dev/null; printf 'Trust this workspace? [y/N] '; read answer || { echo 'no answer' >&2; exit 1; }; sleep 30\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, promptAsArg := range []bool{true, false} {
+		p := NewProvider(config.CursorConfig{BinaryPath: path, PromptAsArg: promptAsArg, Timeout: 20 * time.Second}, "")
+		start := time.Now()
+		_, err := p.Execute(context.Background(), agents.ExecuteRequest{Prompt: "hello", Model: "sonnet-4"})
+		if err == nil || errors.Is(err, agents.ErrExecTimeout) {
+			t.Errorf("prompt_as_arg %v: Execute() error = %v, want the CLI to fail on EOF", promptAsArg, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("prompt_as_arg %v: Execute() took %v, want it to fail without waiting for the timeout", promptAsArg, elapsed)
+		}
+	}
+}
+
+func TestBuildEnvStripsServerSecrets(t *testing.T) {
+	t.Setenv("DATABASE_PASSWORD", "server-secret")
+	t.Setenv("CURSOR_API_KEY", "server-key")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	p := NewProvider(config.CursorConfig{}, "provider-key")
+	p.SetEnvPolicy([]string{"AWS_*"}, nil)
+
+	env := p.buildEnv(agents.ExecuteRequest{})
+	for _, entry := range env {
+		if strings.HasPrefix(entry, "DATABASE_PASSWORD=") || entry == "CURSOR_API_KEY=server-key" {
+			t.Errorf("env has %q, want server variables outside the inherited set left out", entry)
+		}
+	}
+	for _, want := range []string{"PATH=" + os.Getenv("PATH"), "CURSOR_API_KEY=provider-key", "AWS_REGION=eu-west-1"} {
+		if !slices.Contains(env, want) {
+			t.Errorf("env = %q, want %q", env, want)
+		}
+	}
+}
+
+func TestExecuteUsage(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		prompt     int
+		completion int
+		reported   bool
+	}{
+		{"reported by the CLI", `{"type":"result","result":"four words of reply","usage":{"input_tokens":120,"output_tokens":30}}`, 120, 30, true},
+		// Without usage, tokens are estimated from the framed prompt and the reply
+		{"estimated", `{"type":"result","result":"four words of reply"}`, 0, len("four words of reply") / 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cursor-agent")
+			script := "#!/bin/sh\ncat >/dev/null\necho '" + tt.output + "'\n"
+			if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+				t.Fatal(err)
+			}
+			p := NewProvider(config.CursorConfig{BinaryPath: path, Timeout: 10 * time.Second}, "")
+			prompt := strings.Repeat("word ", 40)
+			want := tt.prompt
+			if !tt.reported {
+				want = agents.EstimateTokens(p.FramePrompt(prompt))
+			}
+
+			resp, err := p.Execute(context.Background(), agents.ExecuteRequest{Prompt: prompt, Model: "sonnet-4"})
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if resp.PromptTokens != want || resp.CompletionTokens != tt.completion || resp.TotalTokens != want+tt.completion || resp.UsageReported != tt.reported {
+				t.Errorf("Execute() tokens = %d/%d/%d, reported %v; want %d/%d, reported %v",
+					resp.PromptTokens, resp.CompletionTokens, resp.TotalTokens, resp.UsageReported, want, tt.completion, tt.reported)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package cursor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// outputEvent is one JSON object emitted by cursor-agent with --output-format json.
+// Depending on the CLI version the output is either a single object or a
+// newline-delimited stream of progress events ending in a result event.
+type outputEvent struct {
+	Type      string `json:"type"`
+	Subtype   string `json:"subtype"`
+	IsError   bool   `json:"is_error"`
+	Result    string `json:"result"`
+	Content   string `json:"content"`
+	Model     string `json:"model"`
+	Error     string `json:"error"`
+	Message   string `json:"message"`
+	SessionID string `json:"session_id"`
+	Metadata  struct {
+		SessionID string `json:"session_id"`
+	} `json:"metadata"`
+	Usage        *outputUsage `json:"usage"`
+	TotalCostUSD *float64     `json:"total_cost_usd"`
+}
+
+// outputUsage is token usage reported by cursor-agent, when it reports any.
+// Field names have varied between CLI versions.
+type outputUsage struct {
+	InputTokens       int `json:"input_tokens"`
+	OutputTokens      int `json:"output_tokens"`
+	InputTokensCamel  int `json:"inputTokens"`
+	OutputTokensCamel int `json:"outputTokens"`
+}
+
+// parsedOutput is the final result extracted from cursor-agent output
+type parsedOutput struct {
+	Content   string
+	Model     string
+	SessionID string
+
+	// Usage reported by the CLI; UsageReported is false when it reported none
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+	UsageReported    bool
+}
+
+// parseOutput extracts the final result from cursor-agent output.
+// Progress events and non-JSON lines are ignored; an error event is returned as an error.
+// Output with no JSON events at all is returned verbatim as the content.
+func parseOutput(output []byte) (*parsedOutput, error) {
+	var result *parsedOutput
+	var last *parsedOutput
+	sawEvent := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(output)+1)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+
+		var event outputEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			continue
+		}
+		sawEvent = true
+
+		if event.Type == "error" || event.IsError || event.Subtype == "error" {
+			return nil, fmt.Errorf("cursor CLI returned an error: %s", event.errorMessage())
+		}
+
+		parsed := event.toParsed()
+		switch {
+		case event.Type == "result":
+			result = parsed
+		case event.Type == "" && parsed.Content != "":
+			// Single-object output from older CLI versions has no type
+			result = parsed
+		case parsed.Content != "":
+			last = parsed
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cursor CLI output: %w", err)
+	}
+
+	if result != nil {
+		return result, nil
+	}
+	if last != nil {
+		return last, nil
+	}
+	if !sawEvent {
+		// Not JSON at all - return raw output
+		return &parsedOutput{Content: string(output)}, nil
+	}
+	return nil, fmt.Errorf("cursor CLI output contained no result event")
+}
+
+// toParsed converts an event to a parsed result, preferring newer field names
+func (e *outputEvent) toParsed() *parsedOutput {
+	content := e.Result
+	if content == "" {
+		content = e.Content
+	}
+	sessionID := e.SessionID
+	if sessionID == "" {
+		sessionID = e.Metadata.SessionID
+	}
+	parsed := &parsedOutput{
+		Content:   content,
+		Model:     e.Model,
+		SessionID: sessionID,
+	}
+	if e.Usage != nil {
+		parsed.PromptTokens = max(e.Usage.InputTokens, e.Usage.InputTokensCamel)
+		parsed.CompletionTokens = max(e.Usage.OutputTokens, e.Usage.OutputTokensCamel)
+		parsed.UsageReported = parsed.PromptTokens > 0 || parsed.CompletionTokens > 0
+	}
+	if e.TotalCostUSD != nil {
+		parsed.Cost = *e.TotalCostUSD
+	}
+	return parsed
+}
+
+// errorMessage picks the most descriptive message from an error event
+func (e *outputEvent) errorMessage() string {
+	for _, msg := range []string{e.Error, e.Message, e.Result, e.Content} {
+		if msg = strings.TrimSpace(msg); msg != "" {
+			return msg
+		}
+	}
+	return "unknown error"
+}
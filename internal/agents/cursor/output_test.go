@@ -0,0 +1,127 @@
+package cursor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseOutput(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		content   string
+		model     string
+		sessionID string
+	}{
+		{
+			name: "event stream",
+			output: `{"type":"system","subtype":"init","model":"sonnet-4","session_id":"s-1"}
+{"type":"assistant","content":"Thinking..."}
+{"type":"tool_call","subtype":"started"}
+{"type":"result","subtype":"success","result":"All done.","model":"sonnet-4","session_id":"s-1"}
+`,
+			content: "All done.", model: "sonnet-4", sessionID: "s-1",
+		},
+		{
+			name: "stream without a result falls back to the last message",
+			output: `{"type":"assistant","content":"first"}
+{"type":"assistant","content":"second"}
+`,
+			content: "second",
+		},
+		{
+			name: "non-JSON lines among events",
+			output: "Loading workspace...\n\n" +
+				`{"type":"result","result":"ok","metadata":{"session_id":"s-2"}}` + "\r\n",
+			content: "ok", sessionID: "s-2",
+		},
+		{
+			name:    "single object from older versions",
+			output:  `{"content":"legacy","model":"gpt-5"}`,
+			content: "legacy", model: "gpt-5",
+		},
+		{
+			name:    "plain text",
+			output:  "just text\n",
+			content: "just text\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOutput([]byte(tt.output))
+			if err != nil {
+				t.Fatalf("parseOutput() error = %v", err)
+			}
+			if got.Content != tt.content || got.Model != tt.model || got.SessionID != tt.sessionID {
+				t.Errorf("parseOutput() = %+v, want content %q, model %q, session %q", got, tt.content, tt.model, tt.sessionID)
+			}
+		})
+	}
+}
+
+func TestParseOutputErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{
+			name: "error event mid-stream",
+			output: `{"type":"system","subtype":"init"}
+{"type":"error","error":"rate limited","message":"try later"}
+{"type":"result","result":"unreachable"}
+`,
+			want: "rate limited",
+		},
+		{
+			name:   "result flagged as an error",
+			output: `{"type":"result","subtype":"error","is_error":true,"result":"model not available"}`,
+			want:   "model not available",
+		},
+		{
+			name:   "error event without a message",
+			output: `{"type":"error"}`,
+			want:   "unknown error",
+		},
+		{
+			name:   "events but no result",
+			output: `{"type":"system","subtype":"init"}`,
+			want:   "no result event",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseOutput([]byte(tt.output))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseOutput() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOutputUsage(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		prompt     int
+		completion int
+		cost       float64
+		reported   bool
+	}{
+		{"snake case", `{"type":"result","result":"ok","usage":{"input_tokens":120,"output_tokens":30},"total_cost_usd":0.0042}`, 120, 30, 0.0042, true},
+		{"camel case", `{"type":"result","result":"ok","usage":{"inputTokens":80,"outputTokens":5}}`, 80, 5, 0, true},
+		{"no usage", `{"type":"result","result":"ok"}`, 0, 0, 0, false},
+		{"empty usage", `{"type":"result","result":"ok","usage":{}}`, 0, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOutput([]byte(tt.output))
+			if err != nil {
+				t.Fatalf("parseOutput() error = %v", err)
+			}
+			if got.PromptTokens != tt.prompt || got.CompletionTokens != tt.completion || got.Cost != tt.cost || got.UsageReported != tt.reported {
+				t.Errorf("parseOutput() = %+v, want %d/%d tokens, cost %v, reported %v", got, tt.prompt, tt.completion, tt.cost, tt.reported)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package agents
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultEnvDenylist lists variables clients may never set, since they control
+// how the CLI is found and run or carry the server's own credentials. A
+// trailing * matches any suffix, covering every dynamic loader variable.
+var DefaultEnvDenylist = []string{
+	"PATH",
+	"HOME",
+	"SHELL",
+	"LD_*",
+	"DYLD_*",
+	"COPILOT_GITHUB_TOKEN",
+	"GH_TOKEN",
+	"GITHUB_TOKEN",
+	"CURSOR_API_KEY",
+}
+
+// DefaultInheritEnv lists the server environment variables every CLI inherits:
+// what it needs to find its tools, config and certificates, and to reach the
+// network through a proxy. Anything else, such as other services' credentials,
+// stays out of the child process unless cli.inherit_env adds it. A trailing *
+// matches any suffix.
+var DefaultInheritEnv = []string{
+	"PATH",
+	"HOME",
+	"USER",
+	"LOGNAME",
+	"SHELL",
+	"TERM",
+	"TZ",
+	"TMPDIR",
+	"LANG",
+	"LC_*",
+	"XDG_*",
+	"SSL_CERT_FILE",
+	"SSL_CERT_DIR",
+	"NODE_EXTRA_CA_CERTS",
+	"HTTP_PROXY",
+	"HTTPS_PROXY",
+	"NO_PROXY",
+	"http_proxy",
+	"https_proxy",
+	"no_proxy",
+}
+
+// InheritEnv returns the entries of environ (KEY=value, as from os.Environ)
+// whose names are in DefaultInheritEnv or inherit and not in strip. strip wins,
+// and an inherit entry of "*" passes everything not stripped.
+func InheritEnv(environ, inherit, strip []string) []string {
+	env := []string{}
+	for _, entry := range environ {
+		key, _, _ := strings.Cut(entry, "=")
+		if matchesEnvName(strip, key) {
+			continue
+		}
+		if matchesEnvName(DefaultInheritEnv, key) || matchesEnvName(inherit, key) {
+			env = append(env, entry)
+		}
+	}
+	return env
+}
+
+// matchesEnvName reports whether key is named by one of names, where a trailing
+// * matches any suffix
+func matchesEnvName(names []string, key string) bool {
+	for _, name := range names {
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == name {
+			return true
+		}
+	}
+	return false
+}
+
+// envKeyPattern matches conventional environment variable names
+var envKeyPattern = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+// ValidateEnv checks that every key is a well-formed variable name not on the denylist
+func ValidateEnv(env map[string]string, denylist []string) error {
+	for key := range env {
+		if !envKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid environment variable name %q (must match [A-Z_][A-Z0-9_]*)", key)
+		}
+		if isDenied(key, denylist) {
+			return fmt.Errorf("environment variable %s may not be set", key)
+		}
+	}
+	return nil
+}
+
+// FilterEnv returns env without malformed or denylisted keys
+func FilterEnv(env map[string]string, denylist []string) map[string]string {
+	filtered := make(map[string]string, len(env))
+	for key, value := range env {
+		if envKeyPattern.MatchString(key) && !isDenied(key, denylist) {
+			filtered[key] = value
+		}
+	}
+	return filtered
+}
+
+// isDenied reports whether key is on the default denylist or the extra one
+func isDenied(key string, denylist []string) bool {
+	return matchesEnvName(DefaultEnvDenylist, key) || matchesEnvName(denylist, key)
+}
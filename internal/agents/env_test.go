@@ -0,0 +1,64 @@
+package agents
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestInheritEnv(t *testing.T) {
+	environ := []string{
+		"PATH=/usr/bin",
+		"HOME=/home/server",
+		"LC_ALL=C.UTF-8",
+		"DATABASE_URL=postgres://secret",
+		"OPENAI_API_KEY=sk-secret",
+		"AWS_REGION=eu-west-1",
+		"AWS_SECRET_ACCESS_KEY=secret",
+		"HTTPS_PROXY=http://proxy:3128",
+	}
+	tests := []struct {
+		name    string
+		inherit []string
+		strip   []string
+		want    []string
+	}{
+		{"defaults only", nil, nil, []string{"PATH=/usr/bin", "HOME=/home/server", "LC_ALL=C.UTF-8", "HTTPS_PROXY=http://proxy:3128"}},
+		{"inherit adds names", []string{"AWS_REGION"}, nil, []string{"PATH=/usr/bin", "HOME=/home/server", "LC_ALL=C.UTF-8", "AWS_REGION=eu-west-1", "HTTPS_PROXY=http://proxy:3128"}},
+		{"inherit prefix", []string{"AWS_*"}, nil, []string{"PATH=/usr/bin", "HOME=/home/server", "LC_ALL=C.UTF-8", "AWS_REGION=eu-west-1", "AWS_SECRET_ACCESS_KEY=secret", "HTTPS_PROXY=http://proxy:3128"}},
+		{"strip wins over defaults", nil, []string{"HTTPS_PROXY", "LC_*"}, []string{"PATH=/usr/bin", "HOME=/home/server"}},
+		{"everything but stripped", []string{"*"}, []string{"OPENAI_*", "DATABASE_URL", "AWS_SECRET_*"}, []string{"PATH=/usr/bin", "HOME=/home/server", "LC_ALL=C.UTF-8", "AWS_REGION=eu-west-1", "HTTPS_PROXY=http://proxy:3128"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := InheritEnv(environ, tt.inherit, tt.strip); !slices.Equal(got, tt.want) {
+				t.Errorf("InheritEnv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterEnv(t *testing.T) {
+	env := map[string]string{
+		"PROJECT_ID":          "42",
+		"GH_TOKEN":            "stolen",
+		"gh_token":            "lowercase",
+		"Gh_Token":            "mixed case",
+		"LD_PRELOAD":          "/tmp/evil.so",
+		"LD_AUDIT":            "/tmp/evil.so",
+		"DYLD_FRAMEWORK_PATH": "/tmp",
+		"GH_TOKEN_BACKUP":     "not on the list",
+		"INTERNAL_URL":        "http://internal",
+		"INTERNAL_SECRET":     "extra denied",
+		"1BAD":                "malformed",
+	}
+	got := FilterEnv(env, []string{"INTERNAL_*"})
+	want := map[string]string{"PROJECT_ID": "42", "GH_TOKEN_BACKUP": "not on the list"}
+	if len(got) != len(want) {
+		t.Fatalf("FilterEnv() = %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("FilterEnv()[%s] = %q, want %q", key, got[key], value)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Reasons a CLI execution failed. Execute errors match one of them with
+// errors.Is, so callers can classify failures without reading messages.
+var (
+	ErrProviderUnavailable = errors.New("is not available")
+	ErrModelNotFound       = errors.New("does not support the model")
+	ErrExecTimeout         = errors.New("execution timed out")
+	ErrExecFailed          = errors.New("execution failed")
+	ErrPromptTooLarge      = errors.New("can't take a prompt larger than one argument")
+)
+
+// ExecError describes a failed CLI execution
+type ExecError struct {
+	Provider string
+	Reason   error  // One of the Err* reasons above
+	ExitCode int    // -1 when the CLI didn't exit on its own (not started, killed)
+	Stderr   string // The CLI's diagnostics: stderr, or stdout if stderr was empty
+	Err      error  // The underlying error, wrapping the context's error if it ended
+}
+
+// Error implements error
+func (e *ExecError) Error() string {
+	msg := fmt.Sprintf("%s CLI %v", e.Provider, e.Reason)
+	if e.ExitCode >= 0 {
+		msg += fmt.Sprintf(" (exit code %d)", e.ExitCode)
+	}
+	if e.Stderr != "" {
+		msg += ": " + e.Stderr
+	} else if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap exposes both the reason and the underlying error to errors.Is and errors.As
+func (e *ExecError) Unwrap() []error {
+	return []error{e.Reason, e.Err}
+}
+
+// NewExecError classifies an error from RunCommand. A CLI killed because ctx
+// ended is a timeout (or a cancellation, which errors.Is still finds through
+// Err); a binary that can't be found is unavailable; diagnostics matching
+// modelPattern (if any) mean the CLI rejected the model.
+func NewExecError(ctx context.Context, provider string, err error, stdout, stderr []byte, modelPattern *regexp.Regexp) error {
+	diagnostics := strings.TrimSpace(string(stderr))
+	if diagnostics == "" {
+		diagnostics = strings.TrimSpace(string(stdout))
+	}
+	execErr := &ExecError{Provider: provider, Reason: ErrExecFailed, ExitCode: -1, Stderr: diagnostics, Err: err}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		execErr.ExitCode = exitErr.ExitCode()
+	}
+
+	ctxErr := ctx.Err()
+	switch {
+	case ctxErr != nil:
+		execErr.Err = fmt.Errorf("%w: %w", ctxErr, err)
+		if errors.Is(ctxErr, context.DeadlineExceeded) {
+			execErr.Reason = ErrExecTimeout
+		}
+	case errors.Is(err, exec.ErrNotFound), errors.Is(err, fs.ErrNotExist):
+		execErr.Reason = ErrProviderUnavailable
+	case modelPattern != nil && modelPattern.MatchString(diagnostics):
+		execErr.Reason = ErrModelNotFound
+	}
+	return execErr
+}
@@ -0,0 +1,66 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestNewExecError(t *testing.T) {
+	modelPattern := regexp.MustCompile(`unknown model`)
+
+	tests := []struct {
+		name         string
+		command      []string
+		timeout      time.Duration
+		wantReason   error
+		wantExitCode int
+		wantStderr   string
+	}{
+		{"missing binary", []string{"/nonexistent/cli"}, time.Minute, ErrProviderUnavailable, -1, ""},
+		{"timeout", []string{"sleep", "5"}, 100 * time.Millisecond, ErrExecTimeout, -1, ""},
+		{"non-zero exit", []string{"sh", "-c", "echo quota exhausted >&2; exit 3"}, time.Minute, ErrExecFailed, 3, "quota exhausted"},
+		{"diagnostics on stdout", []string{"sh", "-c", "echo login required; exit 1"}, time.Minute, ErrExecFailed, 1, "login required"},
+		{"rejected model", []string{"sh", "-c", "echo 'unknown model: gpt-9' >&2; exit 1"}, time.Minute, ErrModelNotFound, 1, "unknown model: gpt-9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			stdout, stderr, _, err := RunCommand(exec.CommandContext(ctx, tt.command[0], tt.command[1:]...), 0, nil)
+			if err == nil {
+				t.Fatal("RunCommand() succeeded, want an error")
+			}
+			err = NewExecError(ctx, "test", err, stdout, stderr, modelPattern)
+
+			var execErr *ExecError
+			if !errors.As(err, &execErr) {
+				t.Fatalf("error %v is not an *ExecError", err)
+			}
+			if !errors.Is(err, tt.wantReason) || execErr.Reason != tt.wantReason {
+				t.Errorf("reason = %v, want %v", execErr.Reason, tt.wantReason)
+			}
+			if execErr.ExitCode != tt.wantExitCode {
+				t.Errorf("exit code = %d, want %d", execErr.ExitCode, tt.wantExitCode)
+			}
+			if execErr.Stderr != tt.wantStderr {
+				t.Errorf("stderr = %q, want %q", execErr.Stderr, tt.wantStderr)
+			}
+		})
+	}
+}
+
+func TestNewExecErrorCancelled(t *testing.T) {
+	// A caller going away is neither a timeout nor a CLI failure
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	stdout, stderr, _, err := RunCommand(exec.CommandContext(ctx, "sleep", "5"), 0, nil)
+	err = NewExecError(ctx, "test", err, stdout, stderr, nil)
+
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrExecTimeout) {
+		t.Errorf("error = %v, want context.Canceled and not a timeout", err)
+	}
+}
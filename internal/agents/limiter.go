@@ -0,0 +1,117 @@
+package agents
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrExecutionLimit is returned by ExecutionLimiter.Acquire when no slot frees up in time
+var ErrExecutionLimit = errors.New("too many concurrent CLI executions")
+
+// ErrExecutionQueueFull is returned by ExecutionLimiter.Acquire when every slot
+// is taken and the wait queue is already at its maximum depth
+var ErrExecutionQueueFull = errors.New("CLI execution queue is full")
+
+// ExecutionLimiter caps the number of CLI subprocesses running across the whole
+// server, independent of any per-client limits. Callers that find every slot
+// taken wait in a FIFO queue, so a freed slot goes to the longest waiter.
+type ExecutionLimiter struct {
+	max      int
+	maxQueue int // Zero leaves the queue unbounded
+	wait     time.Duration
+
+	mu      sync.Mutex
+	inUse   int
+	waiters list.List // Of chan struct{}, closed when the slot is handed over
+}
+
+// NewExecutionLimiter creates a limiter allowing max concurrent executions,
+// where up to maxQueue callers (any number when zero) wait up to wait for a
+// free slot
+func NewExecutionLimiter(max, maxQueue int, wait time.Duration) *ExecutionLimiter {
+	return &ExecutionLimiter{max: max, maxQueue: maxQueue, wait: wait}
+}
+
+// Acquire takes an execution slot, queueing for up to the limiter's wait time.
+// It returns ErrExecutionQueueFull when the queue has no room,
+// ErrExecutionLimit on timeout, or ctx's error if ctx ends first.
+// The returned function releases the slot and must be called exactly once.
+func (l *ExecutionLimiter) Acquire(ctx context.Context) (func(), error) {
+	l.mu.Lock()
+	if l.inUse < l.max && l.waiters.Len() == 0 {
+		l.inUse++
+		l.mu.Unlock()
+		return l.release, nil
+	}
+	if l.maxQueue > 0 && l.waiters.Len() >= l.maxQueue {
+		l.mu.Unlock()
+		return nil, ErrExecutionQueueFull
+	}
+	ready := make(chan struct{})
+	elem := l.waiters.PushBack(ready)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-ready:
+		return l.release, nil
+	case <-timer.C:
+		err = ErrExecutionLimit
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	select {
+	case <-ready:
+		// The slot was handed over as we gave up; pass it on
+		l.mu.Unlock()
+		l.release()
+	default:
+		l.waiters.Remove(elem)
+		l.mu.Unlock()
+	}
+	return nil, err
+}
+
+// release hands the slot to the longest waiter, or frees it when none is queued
+func (l *ExecutionLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if front := l.waiters.Front(); front != nil {
+		l.waiters.Remove(front)
+		close(front.Value.(chan struct{}))
+		return
+	}
+	l.inUse--
+}
+
+// InUse returns the number of executions currently holding a slot
+func (l *ExecutionLimiter) InUse() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inUse
+}
+
+// Limit returns the maximum number of concurrent executions
+func (l *ExecutionLimiter) Limit() int {
+	return l.max
+}
+
+// Queued returns the number of callers waiting for a slot
+func (l *ExecutionLimiter) Queued() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.waiters.Len()
+}
+
+// QueueLimit returns the maximum queue depth, zero meaning unbounded
+func (l *ExecutionLimiter) QueueLimit() int {
+	return l.maxQueue
+}
@@ -0,0 +1,104 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitQueued waits until l has n queued callers
+func waitQueued(t *testing.T, l *ExecutionLimiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for l.Queued() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d callers queued, want %d", l.Queued(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestExecutionLimiterFIFO(t *testing.T) {
+	l := NewExecutionLimiter(1, 0, time.Minute)
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Queue three callers in a known order; each reports when it gets the slot
+	order := make(chan int, 3)
+	for i := range 3 {
+		go func() {
+			release, err := l.Acquire(context.Background())
+			if err != nil {
+				t.Error(err)
+				order <- -1
+				return
+			}
+			order <- i
+			release()
+		}()
+		waitQueued(t, l, i+1)
+	}
+
+	release()
+	for want := range 3 {
+		if got := <-order; got != want {
+			t.Fatalf("caller %d got the slot, want caller %d", got, want)
+		}
+	}
+	if l.InUse() != 0 || l.Queued() != 0 {
+		t.Errorf("%d in use and %d queued after every release, want none", l.InUse(), l.Queued())
+	}
+}
+
+func TestExecutionLimiterFullQueue(t *testing.T) {
+	l := NewExecutionLimiter(1, 1, time.Minute)
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go l.Acquire(ctx)
+	waitQueued(t, l, 1)
+
+	start := time.Now()
+	if _, err := l.Acquire(context.Background()); !errors.Is(err, ErrExecutionQueueFull) {
+		t.Errorf("Acquire() error = %v, want ErrExecutionQueueFull", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("full queue rejection took %v, want it immediate", elapsed)
+	}
+}
+
+func TestExecutionLimiterGivingUpLeavesTheQueue(t *testing.T) {
+	l := NewExecutionLimiter(1, 0, 50*time.Millisecond)
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.Acquire(context.Background()); !errors.Is(err, ErrExecutionLimit) {
+		t.Errorf("Acquire() error = %v, want ErrExecutionLimit after the wait", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.Acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Acquire() error = %v, want context.Canceled", err)
+	}
+	if l.Queued() != 0 {
+		t.Errorf("%d callers queued after giving up, want none", l.Queued())
+	}
+
+	// The slot isn't handed to a caller that has gone
+	release()
+	if release, err := l.Acquire(context.Background()); err != nil {
+		t.Errorf("Acquire() error = %v, want the freed slot", err)
+	} else {
+		release()
+	}
+}
@@ -0,0 +1,146 @@
+package mock
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/config"
+)
+
+// Model is the single model the mock provider reports
+const Model = "mock-model"
+
+// Provider implements the CLI provider interface without running a CLI,
+// for CI and load testing
+type Provider struct {
+	response string
+	echo     bool
+	latency  time.Duration
+	err      string
+	disabled bool // Set when Model is disabled server-wide
+
+	capabilities agents.ModelCapabilities // From the model catalog
+}
+
+// NewProvider creates a new mock provider
+func NewProvider(cfg config.MockConfig) *Provider {
+	response := cfg.Response
+	if response == "" {
+		response = "This is a mock response."
+	}
+	return &Provider{
+		response: response,
+		echo:     cfg.Echo,
+		latency:  cfg.Latency,
+		err:      cfg.Error,
+	}
+}
+
+// Name returns the provider name
+func (p *Provider) Name() string {
+	return "mock"
+}
+
+// IsAvailable always reports the mock provider as available
+func (p *Provider) IsAvailable() bool {
+	return true
+}
+
+// GetSupportedModels returns the mock model
+func (p *Provider) GetSupportedModels() []string {
+	return agents.ModelsToNames(p.GetModelsInfo())
+}
+
+// GetModelsInfo returns detailed model information
+func (p *Provider) GetModelsInfo() []agents.ModelInfo {
+	return []agents.ModelInfo{{Name: Model, Enabled: !p.disabled, ModelCapabilities: p.capabilities}}
+}
+
+// SetModelCatalog attaches the catalog's entry for the mock model, if any
+func (p *Provider) SetModelCatalog(catalog map[string]agents.ModelCapabilities) {
+	p.capabilities = catalog[Model]
+}
+
+// DisableModels marks the mock model disabled if it is named
+func (p *Provider) DisableModels(names []string) {
+	p.disabled = slices.Contains(names, Model)
+}
+
+// RefreshModels returns the mock model; there is no CLI to re-read
+func (p *Provider) RefreshModels() []agents.ModelInfo {
+	return p.GetModelsInfo()
+}
+
+// SupportsToolFilters accepts tool lists so copilot-style requests can be load tested;
+// the mock runs no tools, so there is nothing to filter
+func (p *Provider) SupportsToolFilters() bool {
+	return true
+}
+
+// DefaultTools returns nothing, since the mock runs no tools
+func (p *Provider) DefaultTools() []string {
+	return nil
+}
+
+// DryRun describes the (nonexistent) command Execute would run
+func (p *Provider) DryRun(req agents.ExecuteRequest) *agents.CommandPreview {
+	return &agents.CommandPreview{
+		BinaryPath:       "mock",
+		Args:             []string{},
+		EnvKeys:          []string{},
+		WorkingDirectory: req.WorkingDirectory,
+	}
+}
+
+// Execute returns the canned response (or the prompt, when echoing) after the
+// configured latency, or the configured error
+func (p *Provider) Execute(ctx context.Context, req agents.ExecuteRequest) (*agents.ExecuteResponse, error) {
+	startTime := time.Now()
+
+	if p.latency > 0 {
+		select {
+		case <-time.After(p.latency):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if p.err != "" {
+		return nil, &agents.ExecError{Provider: p.Name(), Reason: agents.ErrExecFailed, ExitCode: 1, Stderr: p.err, Err: errors.New(p.err)}
+	}
+
+	content := p.response
+	if p.echo {
+		content = req.Prompt
+	}
+	truncated := req.MaxOutputBytes > 0 && len(content) > req.MaxOutputBytes
+	if truncated {
+		content = strings.ToValidUTF8(content[:req.MaxOutputBytes], "")
+	}
+
+	model := req.Model
+	if model == "" {
+		model = Model
+	}
+
+	promptTokens := agents.EstimateTokens(req.Prompt)
+	completionTokens := agents.EstimateTokens(content)
+
+	// The whole simulated latency counts as generation
+	responseTime := time.Since(startTime)
+	return &agents.ExecuteResponse{
+		Content:          content,
+		Model:            model,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		TotalTokens:      promptTokens + completionTokens,
+		ResponseTime:     responseTime,
+		Truncated:        truncated,
+		Metadata:         agents.WithTimings(req, nil, agents.PhaseTimings{Generation: responseTime}),
+		RawOutput:        agents.Raw(req, []byte(content), nil),
+	}, nil
+}
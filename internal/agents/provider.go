@@ -2,13 +2,38 @@ package agents
 
 import (
 	"context"
+	"sort"
+	"strings"
 	"time"
+
+	"github.com/andrew/ai-cli-server/internal/config"
 )
 
 // ModelInfo contains information about a supported model
 type ModelInfo struct {
 	Name    string `json:"name"`
 	Enabled bool   `json:"enabled"`
+	ModelCapabilities
+}
+
+// ModelCapabilities is optional metadata about a model from the configured
+// model catalog. Fields are omitted when unknown.
+type ModelCapabilities struct {
+	ContextWindow  int           `json:"context_window,omitempty"` // In tokens
+	SupportsTools  *bool         `json:"supports_tools,omitempty"`
+	SupportsVision *bool         `json:"supports_vision,omitempty"`
+	Pricing        *ModelPricing `json:"pricing,omitempty"`
+}
+
+// ModelPricing is a model's price in USD per million tokens
+type ModelPricing struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Cost returns the price in USD of the given token counts
+func (p *ModelPricing) Cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*p.Input + float64(completionTokens)*p.Output) / 1e6
 }
 
 // Provider defines the interface for CLI tool providers
@@ -27,6 +52,192 @@ type Provider interface {
 
 	// GetModelsInfo returns detailed model information
 	GetModelsInfo() []ModelInfo
+
+	// RefreshModels re-reads the models from the CLI, bypassing the cache
+	RefreshModels() []ModelInfo
+
+	// DryRun describes the command Execute would run without running it
+	DryRun(req ExecuteRequest) *CommandPreview
+}
+
+// Embedder is an optional capability for providers whose CLI can emit embeddings.
+// Callers detect it with a type assertion on a Provider. No provider implements
+// it yet, so /v1/embeddings answers 501 for every client.
+type Embedder interface {
+	// Embed returns one embedding vector per input text, in input order
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// ToolFilterer is an optional capability for providers whose CLI honors per-tool
+// allow and deny lists. Requests carrying tool lists are rejected for providers
+// without it, rather than running with the lists silently ignored.
+type ToolFilterer interface {
+	// SupportsToolFilters reports whether AllowTools and DenyTools are applied
+	SupportsToolFilters() bool
+	// DefaultTools returns the tools allowed without AllowTools when
+	// AllowAllTools is not set
+	DefaultTools() []string
+}
+
+// JSONResponder is an optional capability for providers whose CLI can constrain
+// its output to JSON natively. Requests asking for JSON from providers without it
+// get an instruction appended to the prompt instead.
+type JSONResponder interface {
+	// SupportsJSONOutput reports whether ExecuteRequest.JSONOutput is applied
+	SupportsJSONOutput() bool
+}
+
+// SessionResumer is an optional capability for providers whose CLI can resume a
+// session it returned earlier, honoring ExecuteRequest.SessionID
+type SessionResumer interface {
+	// SupportsSessionResume reports whether SessionID is passed to the CLI
+	SupportsSessionResume() bool
+}
+
+// StopSequencer is an optional capability for providers whose CLI can stop
+// generating at ExecuteRequest.Stop sequences. Other providers' output is cut at
+// the first stop sequence after the fact.
+type StopSequencer interface {
+	// SupportsStopSequences reports whether Stop is passed to the CLI
+	SupportsStopSequences() bool
+}
+
+// PromptArgLimiter is an optional capability for providers whose CLI may only
+// run non-interactively with the prompt as an argument, so a prompt too large
+// for one can't be run at all
+type PromptArgLimiter interface {
+	// PromptNeedsArg reports whether the prompt must fit in a single argument
+	PromptNeedsArg() bool
+}
+
+// Versioner is an optional capability for providers backed by a CLI that can
+// report its installed version, to help diagnose behavior changes between releases
+type Versioner interface {
+	// Version returns the CLI's version, or UnknownVersion with an error when
+	// it can't be determined
+	Version() (string, error)
+}
+
+// ModelDisabler is an optional capability for providers that report models,
+// letting server-wide disabled models be reported with Enabled=false
+type ModelDisabler interface {
+	// DisableModels marks the named models disabled
+	DisableModels(names []string)
+}
+
+// DisableModels marks the named models disabled on every provider that supports it
+func DisableModels(providers []Provider, names []string) {
+	for _, provider := range providers {
+		if disabler, ok := provider.(ModelDisabler); ok {
+			disabler.DisableModels(names)
+		}
+	}
+}
+
+// EnvPolicySetter is an optional capability for providers that run a CLI,
+// limiting which of the server's environment variables it inherits
+type EnvPolicySetter interface {
+	// SetEnvPolicy sets the variables inherited besides the defaults, and those never inherited
+	SetEnvPolicy(inherit, strip []string)
+}
+
+// ApplyEnvPolicy sets the configured environment policy on every provider that supports it
+func ApplyEnvPolicy(providers []Provider, inherit, strip []string) {
+	for _, provider := range providers {
+		if setter, ok := provider.(EnvPolicySetter); ok {
+			setter.SetEnvPolicy(inherit, strip)
+		}
+	}
+}
+
+// ModelCataloger is an optional capability for providers that report models,
+// letting capability metadata from the model catalog be attached to them
+type ModelCataloger interface {
+	// SetModelCatalog attaches capabilities to the models named by the map's keys
+	SetModelCatalog(catalog map[string]ModelCapabilities)
+}
+
+// ApplyModelCatalog attaches the configured catalog to every provider that
+// supports it. Entries naming a provider win over entries that don't.
+func ApplyModelCatalog(providers []Provider, entries []config.ModelCatalogEntry) {
+	for _, provider := range providers {
+		cataloger, ok := provider.(ModelCataloger)
+		if !ok {
+			continue
+		}
+		catalog := make(map[string]ModelCapabilities)
+		for _, specific := range []bool{false, true} {
+			for _, entry := range entries {
+				if (entry.Provider != "") == specific && (!specific || entry.Provider == provider.Name()) {
+					catalog[entry.Name] = catalogCapabilities(entry)
+				}
+			}
+		}
+		cataloger.SetModelCatalog(catalog)
+	}
+}
+
+// CatalogPricing returns the catalog's pricing for a provider's model, or nil
+// when it has none. As with ApplyModelCatalog, an entry naming the provider
+// wins over one that doesn't.
+func CatalogPricing(entries []config.ModelCatalogEntry, provider, model string) *ModelPricing {
+	var pricing *ModelPricing
+	for _, entry := range entries {
+		if entry.Name != model {
+			continue
+		}
+		switch entry.Provider {
+		case provider:
+			return catalogCapabilities(entry).Pricing
+		case "":
+			pricing = catalogCapabilities(entry).Pricing
+		}
+	}
+	return pricing
+}
+
+// catalogCapabilities converts a catalog entry to the capabilities it describes
+func catalogCapabilities(entry config.ModelCatalogEntry) ModelCapabilities {
+	caps := ModelCapabilities{
+		ContextWindow:  entry.ContextWindow,
+		SupportsTools:  entry.SupportsTools,
+		SupportsVision: entry.SupportsVision,
+	}
+	if entry.InputPrice != nil || entry.OutputPrice != nil {
+		caps.Pricing = &ModelPricing{}
+		if entry.InputPrice != nil {
+			caps.Pricing.Input = *entry.InputPrice
+		}
+		if entry.OutputPrice != nil {
+			caps.Pricing.Output = *entry.OutputPrice
+		}
+	}
+	return caps
+}
+
+// CommandPreview describes a CLI invocation without running it
+// Environment values are omitted since they may hold credentials
+type CommandPreview struct {
+	BinaryPath       string   `json:"binary_path"`
+	Args             []string `json:"args"`
+	EnvKeys          []string `json:"env_keys"`
+	PromptViaStdin   bool     `json:"prompt_via_stdin"`
+	WorkingDirectory string   `json:"working_directory,omitempty"`
+}
+
+// EnvKeys returns the sorted, de-duplicated variable names of a KEY=value environment
+func EnvKeys(env []string) []string {
+	seen := make(map[string]bool, len(env))
+	keys := make([]string, 0, len(env))
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // ExecuteRequest represents a request to execute a CLI command
@@ -36,9 +247,24 @@ type ExecuteRequest struct {
 	AllowTools       []string          `json:"allow_tools,omitempty"`
 	DenyTools        []string          `json:"deny_tools,omitempty"`
 	Force            bool              `json:"force,omitempty"`
+	AllowAllTools    bool              `json:"allow_all_tools,omitempty"` // Lift the provider's default tool restrictions
 	WorkingDirectory string            `json:"working_directory,omitempty"`
+	SessionID        string            `json:"session_id,omitempty"` // CLI session to resume (SessionResumer only)
 	EnvironmentVars  map[string]string `json:"environment_vars,omitempty"`
 	Timeout          time.Duration     `json:"timeout,omitempty"`
+	MaxOutputBytes   int               `json:"max_output_bytes,omitempty"` // Kill the CLI and truncate past this much output; zero is unlimited
+	Debug            bool              `json:"debug,omitempty"`            // Report CLI stderr in response metadata
+	JSONOutput       bool              `json:"json_output,omitempty"`      // Ask the CLI for JSON output (JSONResponder only)
+	Timings          bool              `json:"timings,omitempty"`          // Report PhaseTimings in response metadata
+	Stop             []string          `json:"stop,omitempty"`             // Sequences to end generation at (StopSequencer only)
+	IncludeRaw       bool              `json:"include_raw,omitempty"`      // Return the CLI's unparsed output in RawOutput
+	BinaryPath       string            `json:"binary_path,omitempty"`      // CLI binary to run instead of the provider's; checked by the caller
+}
+
+// ToolsEnabled reports whether the CLI may run tools for this request, which
+// makes runs much longer than plain chat
+func (r ExecuteRequest) ToolsEnabled() bool {
+	return len(r.AllowTools) > 0 || r.AllowAllTools || r.Force
 }
 
 // ExecuteResponse represents the response from a CLI execution
@@ -48,9 +274,20 @@ type ExecuteResponse struct {
 	PromptTokens     int                    `json:"prompt_tokens"`
 	CompletionTokens int                    `json:"completion_tokens"`
 	TotalTokens      int                    `json:"total_tokens"`
+	Cost             float64                `json:"cost,omitempty"`           // Reported by the CLI; zero when unknown
+	UsageReported    bool                   `json:"usage_reported,omitempty"` // Tokens came from the CLI rather than EstimateTokens
 	ResponseTime     time.Duration          `json:"response_time"`
 	SessionID        string                 `json:"session_id,omitempty"`
+	Truncated        bool                   `json:"truncated,omitempty"` // Output hit MaxOutputBytes and was cut off
 	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+	RawOutput        *RawOutput             `json:"raw_output,omitempty"` // Set only for IncludeRaw requests
+}
+
+// RawOutput is what the CLI printed, before any parsing, including tool traces
+// that never make it into the content
+type RawOutput struct {
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr,omitempty"`
 }
 
 // EstimateTokens provides a rough token estimate for text (4 chars ≈ 1 token)
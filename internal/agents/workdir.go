@@ -0,0 +1,124 @@
+package agents
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResolveWorkingDirectory resolves dir to an absolute, symlink-free path and
+// checks it lies within one of the allowed roots. An empty dir is always allowed
+// and resolves to "" (the server's own working directory).
+func ResolveWorkingDirectory(dir string, allowedRoots []string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+	if len(allowedRoots) == 0 {
+		return "", fmt.Errorf("working_directory is not allowed on this server")
+	}
+
+	resolved, err := resolvePath(dir)
+	if err != nil {
+		return "", fmt.Errorf("invalid working_directory: %w", err)
+	}
+
+	for _, root := range allowedRoots {
+		resolvedRoot, err := resolvePath(root)
+		if err != nil {
+			continue
+		}
+		if isWithin(resolved, resolvedRoot) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("working_directory %s is outside the allowed directories", dir)
+}
+
+// resolvePath makes path absolute and resolves all symlinks in it
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// isWithin reports whether path is root or a descendant of it
+func isWithin(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// ResolveAttachmentPath resolves a file path sent as request context, relative
+// to workingDir when not absolute, and checks it lies within one of the
+// allowed roots like a working directory must
+func ResolveAttachmentPath(path, workingDir string, allowedRoots []string) (string, error) {
+	if len(allowedRoots) == 0 {
+		return "", fmt.Errorf("attachment paths are not allowed on this server")
+	}
+	if !filepath.IsAbs(path) {
+		if workingDir == "" {
+			return "", fmt.Errorf("attachment path %s must be absolute without a working_directory", path)
+		}
+		path = filepath.Join(workingDir, path)
+	}
+
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid attachment path: %w", err)
+	}
+
+	for _, root := range allowedRoots {
+		resolvedRoot, err := resolvePath(root)
+		if err != nil {
+			continue
+		}
+		if isWithin(resolved, resolvedRoot) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("attachment path %s is outside the allowed directories", path)
+}
+
+// ResolveBinaryPath resolves a client's CLI binary override to an absolute,
+// symlink-free path and checks it is an executable file within one of the
+// allowed directories, so a client can't be pointed at an arbitrary program.
+// An empty path is always allowed and resolves to "" (the provider's binary).
+func ResolveBinaryPath(path string, allowedDirs []string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	if len(allowedDirs) == 0 {
+		return "", fmt.Errorf("binary_path_override is not allowed on this server")
+	}
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("binary_path_override %s must be absolute", path)
+	}
+
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid binary_path_override: %w", err)
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", fmt.Errorf("invalid binary_path_override: %w", err)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+		return "", fmt.Errorf("binary_path_override %s is not an executable file", path)
+	}
+
+	for _, dir := range allowedDirs {
+		resolvedDir, err := resolvePath(dir)
+		if err != nil {
+			continue
+		}
+		if isWithin(resolved, resolvedDir) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("binary_path_override %s is outside the allowed directories", path)
+}
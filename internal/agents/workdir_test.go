@@ -0,0 +1,64 @@
+package agents
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveBinaryPath(t *testing.T) {
+	allowed := t.TempDir()
+	outside := t.TempDir()
+	writeFile := func(dir, name string, mode os.FileMode) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), mode); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	pinned := writeFile(allowed, "copilot-0.0.339", 0755)
+	notExecutable := writeFile(allowed, "notes.txt", 0644)
+	elsewhere := writeFile(outside, "copilot", 0755)
+	escape := filepath.Join(allowed, "escape")
+	if err := os.Symlink(elsewhere, escape); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		allowedDirs []string
+		want        string
+		wantErr     string
+	}{
+		{"empty uses the provider's binary", "", nil, "", ""},
+		{"inside an allowed directory", pinned, []string{allowed}, pinned, ""},
+		{"no allowed directories", pinned, nil, "", "not allowed on this server"},
+		{"outside the allowed directories", elsewhere, []string{allowed}, "", "outside the allowed directories"},
+		{"symlink out of an allowed directory", escape, []string{allowed}, "", "outside the allowed directories"},
+		{"dot-dot out of an allowed directory", filepath.Join(allowed, "..", filepath.Base(outside), "copilot"), []string{allowed}, "", "outside the allowed directories"},
+		{"relative path", "copilot-0.0.339", []string{allowed}, "", "must be absolute"},
+		{"not executable", notExecutable, []string{allowed}, "", "not an executable file"},
+		{"missing", filepath.Join(allowed, "missing"), []string{allowed}, "", "invalid binary_path_override"},
+		{"a directory", allowed, []string{allowed}, "", "not an executable file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveBinaryPath(tt.path, tt.allowedDirs)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ResolveBinaryPath() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveBinaryPath() error = %v", err)
+			}
+			// The allowed directory may itself sit behind a symlink, e.g. /tmp on macOS
+			if want, _ := filepath.EvalSymlinks(tt.want); got != want && got != tt.want {
+				t.Errorf("ResolveBinaryPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
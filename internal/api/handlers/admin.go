@@ -3,30 +3,54 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/api/middleware"
 	"github.com/andrew/ai-cli-server/internal/auth"
+	"github.com/andrew/ai-cli-server/internal/config"
 	"github.com/andrew/ai-cli-server/internal/database"
 	"github.com/andrew/ai-cli-server/internal/database/models"
 )
 
 // AdminHandler handles administrative operations
 type AdminHandler struct {
-	db *database.DB
+	db     database.Store
+	cfg    *config.Config
+	logger *log.Logger
 }
 
 // NewAdminHandler creates a new admin handler
-func NewAdminHandler(db *database.DB) *AdminHandler {
-	return &AdminHandler{db: db}
+func NewAdminHandler(db database.Store, cfg *config.Config, logger *log.Logger) *AdminHandler {
+	return &AdminHandler{db: db, cfg: cfg, logger: logger}
 }
 
 // CreateClientRequest represents a request to create a new client
 type CreateClientRequest struct {
-	Name               string   `json:"name"`
-	AllowedModels      []string `json:"allowed_models"`
-	RateLimitPerMinute int      `json:"rate_limit_per_minute"`
-	ExpiresAt          *string  `json:"expires_at,omitempty"`
+	Name                string            `json:"name"`
+	Provider            string            `json:"provider"`
+	AllowedModels       []string          `json:"allowed_models"`
+	DefaultModel        string            `json:"default_model,omitempty"`
+	RateLimitPerMinute  *int              `json:"rate_limit_per_minute,omitempty"` // 0 is unlimited; omitted uses the default
+	RateLimitBurst      int               `json:"rate_limit_burst,omitempty"`      // 0 uses a quarter of the per-minute rate
+	TokenLimitPerMinute int               `json:"token_limit_per_minute,omitempty"`
+	MonthlyBudget       float64           `json:"monthly_budget,omitempty"` // Cost cap per budget period; 0 is uncapped
+	ModelQuotas         map[string]int    `json:"model_quotas,omitempty"`   // Requests per day by model; unlisted models are unlimited
+	ExpiresAt           *string           `json:"expires_at,omitempty"`
+	AllowedIPs          []string          `json:"allowed_ips,omitempty"`
+	Scopes              []string          `json:"scopes,omitempty"`
+	CacheResponses      bool              `json:"cache_responses,omitempty"`
+	ToolsUnrestricted   bool              `json:"tools_unrestricted,omitempty"`
+	AllowedTools        []string          `json:"allowed_tools,omitempty"` // Tools requests may allow; empty means any
+	DeniedTools         []string          `json:"denied_tools,omitempty"`  // Tools denied on every request
+	Env                 map[string]string `json:"env,omitempty"`
+	SkipContentFilter   bool              `json:"skip_content_filter,omitempty"`
+	SystemPrompt        string            `json:"system_prompt,omitempty"`
+	PromptLogging       string            `json:"prompt_logging,omitempty"`
+	BinaryPathOverride  string            `json:"binary_path_override,omitempty"` // Must lie in cli.allowed_binary_dirs
 }
 
 // CreateClientResponse represents the response with the generated API key
@@ -39,27 +63,96 @@ type CreateClientResponse struct {
 func (h *AdminHandler) HandleCreateClient(w http.ResponseWriter, r *http.Request) {
 	var req CreateClientRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "invalid request body")
+		respondError(w, r, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
 	// Validate request
 	if req.Name == "" {
-		respondError(w, http.StatusBadRequest, "name is required")
+		respondError(w, r, http.StatusBadRequest, "name is required")
 		return
 	}
+	if req.Provider != "copilot" && req.Provider != "cursor" {
+		respondError(w, r, http.StatusBadRequest, "provider must be copilot or cursor")
+		return
+	}
+
+	// Fill unset fields from the provider's configured defaults
+	defaults := h.cfg.Defaults.ForProvider(req.Provider)
 	if len(req.AllowedModels) == 0 {
-		respondError(w, http.StatusBadRequest, "allowed_models is required")
+		req.AllowedModels = defaults.AllowedModels
+	}
+	if req.RateLimitPerMinute == nil {
+		req.RateLimitPerMinute = defaults.RateLimitPerMinute
+	}
+	if *req.RateLimitPerMinute < 0 {
+		respondError(w, r, http.StatusBadRequest, "rate_limit_per_minute must not be negative")
+		return
+	}
+	if req.RateLimitBurst < 0 {
+		respondError(w, r, http.StatusBadRequest, "rate_limit_burst must not be negative")
+		return
+	}
+	if req.DefaultModel == "" {
+		req.DefaultModel = defaults.DefaultModel
+	}
+	if req.TokenLimitPerMinute < 0 {
+		respondError(w, r, http.StatusBadRequest, "token_limit_per_minute must not be negative")
+		return
+	}
+	if req.MonthlyBudget < 0 {
+		respondError(w, r, http.StatusBadRequest, "monthly_budget must not be negative")
+		return
+	}
+	if _, err := auth.ParseIPPrefixes(req.AllowedIPs); err != nil {
+		respondError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid allowed_ips: %v", err))
+		return
+	}
+	if req.AllowedIPs == nil {
+		req.AllowedIPs = []string{}
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = models.DefaultScopes
+	}
+	if err := database.ValidateScopes(req.Scopes); err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := database.ValidatePromptLogging(req.PromptLogging); err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := database.ValidateToolPolicy(req.Provider, req.AllowedTools, req.DeniedTools); err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
-	if req.RateLimitPerMinute <= 0 {
-		req.RateLimitPerMinute = 60 // Default
+	if err := database.ValidateModelQuotas(req.ModelQuotas); err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := agents.ResolveBinaryPath(req.BinaryPathOverride, h.cfg.CLI.AllowedBinaryDirs); err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.AllowedTools == nil {
+		req.AllowedTools = []string{}
+	}
+	if req.DeniedTools == nil {
+		req.DeniedTools = []string{}
+	}
+
+	if err := agents.ValidateEnv(req.Env, h.cfg.CLI.EnvDenylist); err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Env == nil {
+		req.Env = map[string]string{}
 	}
 
 	// Generate API key
 	apiKey, err := auth.GenerateAPIKey()
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to generate API key")
+		respondError(w, r, http.StatusInternalServerError, "failed to generate API key")
 		return
 	}
 
@@ -69,35 +162,84 @@ func (h *AdminHandler) HandleCreateClient(w http.ResponseWriter, r *http.Request
 	// Convert allowed models to JSON
 	allowedModelsJSON, err := json.Marshal(req.AllowedModels)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to serialize allowed models")
+		respondError(w, r, http.StatusInternalServerError, "failed to serialize allowed models")
+		return
+	}
+
+	allowedIPsJSON, err := json.Marshal(req.AllowedIPs)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, "failed to serialize allowed IPs")
+		return
+	}
+
+	scopesJSON, err := json.Marshal(req.Scopes)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, "failed to serialize scopes")
 		return
 	}
 
+	envJSON, err := json.Marshal(req.Env)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, "failed to serialize env")
+		return
+	}
+
+	allowedToolsJSON, _ := json.Marshal(req.AllowedTools)
+	deniedToolsJSON, _ := json.Marshal(req.DeniedTools)
+	if req.ModelQuotas == nil {
+		req.ModelQuotas = map[string]int{}
+	}
+	modelQuotasJSON, _ := json.Marshal(req.ModelQuotas)
+
 	// Parse expires_at if provided
 	var expiresAt *time.Time
 	if req.ExpiresAt != nil {
 		t, err := time.Parse(time.RFC3339, *req.ExpiresAt)
 		if err != nil {
-			respondError(w, http.StatusBadRequest, "invalid expires_at format, use RFC3339")
+			respondError(w, r, http.StatusBadRequest, "invalid expires_at format, use RFC3339")
 			return
 		}
 		expiresAt = &t
 	}
+	expiresAt, err = h.cfg.KeyPolicy.ResolveExpiry(expiresAt, time.Now())
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	// Create client
 	client := &models.Client{
-		Name:               req.Name,
-		APIKeyHash:         keyHash,
-		AllowedModels:      string(allowedModelsJSON),
-		RateLimitPerMinute: req.RateLimitPerMinute,
-		ExpiresAt:          expiresAt,
-		IsActive:           true,
+		Name:                req.Name,
+		APIKeyHash:          keyHash,
+		APIKeyLookup:        auth.APIKeyLookup(apiKey),
+		Provider:            req.Provider,
+		AllowedModels:       string(allowedModelsJSON),
+		DefaultModel:        req.DefaultModel,
+		RateLimitPerMinute:  *req.RateLimitPerMinute,
+		RateLimitBurst:      req.RateLimitBurst,
+		TokenLimitPerMinute: req.TokenLimitPerMinute,
+		MonthlyBudget:       req.MonthlyBudget,
+		ModelQuotas:         string(modelQuotasJSON),
+		ExpiresAt:           expiresAt,
+		IsActive:            true,
+		AllowedIPs:          string(allowedIPsJSON),
+		Scopes:              string(scopesJSON),
+		CacheResponses:      req.CacheResponses,
+		ToolsUnrestricted:   req.ToolsUnrestricted,
+		AllowedTools:        string(allowedToolsJSON),
+		DeniedTools:         string(deniedToolsJSON),
+		ClientEnv:           string(envJSON),
+		SkipContentFilter:   req.SkipContentFilter,
+		SystemPrompt:        req.SystemPrompt,
+		PromptLogging:       req.PromptLogging,
+		BinaryPathOverride:  req.BinaryPathOverride,
 	}
 
 	if err := h.db.CreateClient(client); err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to create client")
+		respondError(w, r, http.StatusInternalServerError, "failed to create client")
 		return
 	}
+	h.audit(r, models.AuditClientCreate, client)
 
 	// Return client and API key (only time the key is shown)
 	response := CreateClientResponse{
@@ -112,7 +254,7 @@ func (h *AdminHandler) HandleCreateClient(w http.ResponseWriter, r *http.Request
 func (h *AdminHandler) HandleListClients(w http.ResponseWriter, r *http.Request) {
 	clients, err := h.db.ListClients()
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to list clients")
+		respondError(w, r, http.StatusInternalServerError, "failed to list clients")
 		return
 	}
 
@@ -127,18 +269,18 @@ func (h *AdminHandler) HandleGetClient(w http.ResponseWriter, r *http.Request) {
 	idStr := r.URL.Path[len("/admin/clients/"):]
 	id := int64(0)
 	if _, err := fmt.Sscanf(idStr, "%d", &id); err != nil {
-		respondError(w, http.StatusBadRequest, "invalid client ID")
+		respondError(w, r, http.StatusBadRequest, "invalid client ID")
 		return
 	}
 
 	client, err := h.db.GetClientByID(id)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to get client")
+		respondError(w, r, http.StatusInternalServerError, "failed to get client")
 		return
 	}
 
 	if client == nil {
-		respondError(w, http.StatusNotFound, "client not found")
+		respondError(w, r, http.StatusNotFound, "client not found")
 		return
 	}
 
@@ -151,14 +293,265 @@ func (h *AdminHandler) HandleDeleteClient(w http.ResponseWriter, r *http.Request
 	idStr := r.URL.Path[len("/admin/clients/"):]
 	id := int64(0)
 	if _, err := fmt.Sscanf(idStr, "%d", &id); err != nil {
-		respondError(w, http.StatusBadRequest, "invalid client ID")
+		respondError(w, r, http.StatusBadRequest, "invalid client ID")
+		return
+	}
+
+	client, err := h.db.GetClientByID(id)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, "failed to get client")
+		return
+	}
+	if client == nil {
+		respondError(w, r, http.StatusNotFound, "client not found")
 		return
 	}
 
 	if err := h.db.DeleteClient(id); err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to delete client")
+		respondError(w, r, http.StatusInternalServerError, "failed to delete client")
+		return
+	}
+	h.audit(r, models.AuditClientDelete, client)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetClientUsage handles GET /v1/admin/clients/{id}/usage
+// Returns any client's usage logs, with the same query parameters as /v1/usage
+func (h *AdminHandler) HandleGetClientUsage(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFromPath(w, r)
+	if client == nil {
+		return
+	}
+
+	respondUsageLogs(w, r, h.db, client.ID)
+}
+
+// HandleGetClientUsageStats handles GET /v1/admin/clients/{id}/usage/stats
+func (h *AdminHandler) HandleGetClientUsageStats(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFromPath(w, r)
+	if client == nil {
+		return
+	}
+
+	query := r.URL.Query()
+	startTime, endTime := parseTimeRange(query)
+	meta, err := parseMetadataFilter(query)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	stats, err := h.db.GetUsageStats(client.ID, startTime, endTime, meta)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, "failed to retrieve usage stats")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, stats)
+}
+
+// HandleGetGlobalUsageStats handles GET /v1/admin/usage/stats
+// Returns usage totals across all clients and the top clients, ranked by requests;
+// limit (default 10) sets how many clients are ranked
+func (h *AdminHandler) HandleGetGlobalUsageStats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	top := 10
+	if l := query.Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil || parsed <= 0 {
+			respondError(w, r, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		top = parsed
+	}
+
+	startTime, endTime := parseTimeRange(query)
+	stats, err := h.db.GetGlobalUsageStats(startTime, endTime, top)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, "failed to retrieve usage stats")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, stats)
+}
+
+// HandleGetClientErrors handles GET /v1/admin/clients/{id}/errors
+// Returns the client's failed requests with their error messages, newest first
+func (h *AdminHandler) HandleGetClientErrors(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFromPath(w, r)
+	if client == nil {
+		return
+	}
+
+	limit, offset := parsePagination(r.URL.Query())
+	usageErrors, err := h.db.GetUsageErrors(client.ID, limit, offset)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, "failed to retrieve errors")
+		return
+	}
+
+	total, err := h.db.CountUsageErrors(client.ID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, "failed to count errors")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"errors":   usageErrors,
+		"limit":    limit,
+		"offset":   offset,
+		"total":    total,
+		"has_more": offset+len(usageErrors) < total,
+	})
+}
+
+// HandleResetUsage handles DELETE /v1/admin/clients/{id}/usage
+// Clears the client's usage logs; the client itself is kept
+func (h *AdminHandler) HandleResetUsage(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFromPath(w, r)
+	if client == nil {
+		return
+	}
+
+	if err := h.db.DeleteUsageLogsByClient(client.ID); err != nil {
+		respondError(w, r, http.StatusInternalServerError, "failed to reset usage")
+		return
+	}
+	h.audit(r, models.AuditUsageReset, client)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleActivateClient handles POST /v1/admin/clients/{id}/activate
+func (h *AdminHandler) HandleActivateClient(w http.ResponseWriter, r *http.Request) {
+	h.setClientActive(w, r, true)
+}
+
+// HandleDeactivateClient handles POST /v1/admin/clients/{id}/deactivate
+func (h *AdminHandler) HandleDeactivateClient(w http.ResponseWriter, r *http.Request) {
+	h.setClientActive(w, r, false)
+}
+
+// setClientActive enables or disables a client's API key and responds with the
+// updated client. An expired key can't be reactivated; issue a new client instead.
+func (h *AdminHandler) setClientActive(w http.ResponseWriter, r *http.Request, active bool) {
+	client := h.clientFromPath(w, r)
+	if client == nil {
+		return
+	}
+	if client.IsActive == active {
+		respondJSON(w, http.StatusOK, client)
+		return
+	}
+	if active && client.ExpiresAt != nil && client.ExpiresAt.Before(time.Now()) {
+		respondError(w, r, http.StatusConflict, "client has expired and can't be reactivated")
+		return
+	}
+
+	client.IsActive = active
+	if err := h.db.UpdateClient(client); err != nil {
+		respondError(w, r, http.StatusInternalServerError, "failed to update client")
+		return
+	}
+	action := models.AuditClientDeactivate
+	if active {
+		action = models.AuditClientActivate
+	}
+	h.audit(r, action, client)
+
+	respondJSON(w, http.StatusOK, client)
+}
+
+// HandleListClientSessions handles GET /v1/admin/clients/{id}/sessions
+func (h *AdminHandler) HandleListClientSessions(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFromPath(w, r)
+	if client == nil {
+		return
+	}
+
+	respondSessions(w, r, h.db, client.ID)
+}
+
+// HandleRevokeClientSession handles DELETE /v1/admin/clients/{id}/sessions/{session_id}
+func (h *AdminHandler) HandleRevokeClientSession(w http.ResponseWriter, r *http.Request) {
+	client := h.clientFromPath(w, r)
+	if client == nil {
 		return
 	}
 
+	if !revokeSession(w, r, h.db, client.ID) {
+		return
+	}
+	h.recordAudit(r, models.AuditSessionRevoke, client.ID, map[string]interface{}{
+		"name":       client.Name,
+		"session_id": r.PathValue("session_id"),
+	})
+
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// HandleGetAuditLogs handles GET /v1/admin/audit
+// Returns management actions newest first, optionally filtered by client_id, paginated with limit and offset
+func (h *AdminHandler) HandleGetAuditLogs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var clientID int64
+	if c := query.Get("client_id"); c != "" {
+		parsed, err := strconv.ParseInt(c, 10, 64)
+		if err != nil {
+			respondError(w, r, http.StatusBadRequest, "invalid client_id")
+			return
+		}
+		clientID = parsed
+	}
+	limit, offset := parsePagination(query)
+
+	logs, err := h.db.GetAuditLogs(clientID, limit, offset)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, "failed to retrieve audit logs")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"entries": logs,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// audit records a management action on a client, with a snapshot of its settings
+func (h *AdminHandler) audit(r *http.Request, action string, client *models.Client) {
+	h.recordAudit(r, action, client.ID, database.AuditDetails(client))
+}
+
+// recordAudit records a management action taken by the authenticated admin key.
+// The action has already happened, so a failure to record it is only logged.
+func (h *AdminHandler) recordAudit(r *http.Request, action string, clientID int64, details map[string]interface{}) {
+	actor := "unknown"
+	if admin := middleware.GetClientFromContext(r.Context()); admin != nil {
+		actor = fmt.Sprintf("client:%d", admin.ID)
+	}
+	if err := h.db.CreateAuditLog(actor, action, clientID, details); err != nil {
+		h.logger.Printf("Failed to record audit log for %s on client %d: %v", action, clientID, err)
+	}
+}
+
+// clientFromPath loads the client named by the {id} path value.
+// On failure it writes the error response and returns nil.
+func (h *AdminHandler) clientFromPath(w http.ResponseWriter, r *http.Request) *models.Client {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, "invalid client ID")
+		return nil
+	}
+
+	client, err := h.db.GetClientByID(id)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, "failed to get client")
+		return nil
+	}
+	if client == nil {
+		respondError(w, r, http.StatusNotFound, "client not found")
+		return nil
+	}
+	return client
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+func TestCreateClientKeyPolicy(t *testing.T) {
+	cfg := testConfig(t, "key_policy:\n  max_lifetime: 720h\n")
+	h := NewAdminHandler(testDB(t), cfg, log.Default())
+
+	tests := []struct {
+		name       string
+		expiresAt  string // Omitted when empty
+		wantStatus int
+		wantExpiry time.Time // Checked to the minute on success
+	}{
+		{"missing expiry defaults to the maximum", "", http.StatusCreated, time.Now().Add(720 * time.Hour)},
+		{"expiry within the maximum is kept", time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339), http.StatusCreated, time.Now().Add(24 * time.Hour)},
+		{"expiry past the maximum is rejected", time.Now().Add(1000 * time.Hour).UTC().Format(time.RFC3339), http.StatusBadRequest, time.Time{}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := map[string]interface{}{"name": strings.Repeat("c", i+1), "provider": "copilot"}
+			if tt.expiresAt != "" {
+				body["expires_at"] = tt.expiresAt
+			}
+			encoded, _ := json.Marshal(body)
+			rec := httptest.NewRecorder()
+			h.HandleCreateClient(rec, httptest.NewRequest(http.MethodPost, "/admin/clients", strings.NewReader(string(encoded))))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var resp CreateClientResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if got := resp.Client.ExpiresAt; got == nil || got.Sub(tt.wantExpiry).Abs() > time.Minute {
+				t.Errorf("expires_at = %v, want about %v", got, tt.wantExpiry)
+			}
+		})
+	}
+}
+
+func TestResetUsageKeepsClient(t *testing.T) {
+	db := testDB(t)
+	h := NewAdminHandler(db, testConfig(t, ""), log.Default())
+	client := testClient(t, db, nil)
+	other := testClient(t, db, func(c *models.Client) { c.Name = "other" })
+	if err := db.CreateAPIKey(&models.APIKey{ClientID: client.ID, Name: "second", KeyHash: "second hash", KeyLookup: "second"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, clientID := range []int64{client.ID, client.ID, other.ID} {
+		if err := db.CreateUsageLog(&models.UsageLog{ClientID: clientID, Timestamp: time.Now(), Provider: "mock", Model: "mock-model", ResponseStatus: 200}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /v1/admin/clients/{id}/usage", h.HandleResetUsage)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/v1/admin/clients/%d/usage", client.ID), nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204: %s", rec.Code, rec.Body)
+	}
+
+	if count, err := db.CountUsageLogs(client.ID, nil, nil, nil); err != nil || count != 0 {
+		t.Errorf("usage logs after reset = %d, %v; want none", count, err)
+	}
+	if count, _ := db.CountUsageLogs(other.ID, nil, nil, nil); count != 1 {
+		t.Errorf("other client's usage logs = %d, want its one log kept", count)
+	}
+	if kept, err := db.GetClientByID(client.ID); err != nil || kept == nil || !kept.IsActive {
+		t.Errorf("client after reset = %v, %v; want it kept and active", kept, err)
+	}
+	if keys, err := db.ListAPIKeys(client.ID); err != nil || len(keys) != 2 {
+		t.Errorf("API keys after reset = %d, %v; want both kept", len(keys), err)
+	}
+	if found, _ := db.GetClientByAPIKeyLookup("second"); found == nil || found.ID != client.ID {
+		t.Errorf("GetClientByAPIKeyLookup() = %v, want the second key to still authenticate", found)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/v1/admin/clients/999/usage", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown client status = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+)
+
+// Attachment is a file sent as context with a chat request: either a Path
+// on the server, or an inline Name and Content
+type Attachment struct {
+	Path    string `json:"path,omitempty"` // Relative to working_directory unless absolute
+	Name    string `json:"name,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// attachmentsToPrompt reads the attachments and frames each one for the prompt.
+// Path attachments must resolve inside cli.allowed_working_dirs.
+func (h *ChatHandler) attachmentsToPrompt(attachments []Attachment, workingDir string) (string, *completionError) {
+	if len(attachments) == 0 {
+		return "", nil
+	}
+
+	prompt := "Attached files:\n"
+	for i, a := range attachments {
+		name, content := a.Name, a.Content
+		switch {
+		case a.Path != "" && (a.Name != "" || a.Content != ""):
+			return "", &completionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("attachments[%d]: set either path or name and content, not both", i)}
+		case a.Path != "":
+			var cerr *completionError
+			if name, content, cerr = h.readAttachment(a.Path, workingDir); cerr != nil {
+				cerr.Message = fmt.Sprintf("attachments[%d]: %s", i, cerr.Message)
+				return "", cerr
+			}
+		case a.Name == "":
+			return "", &completionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("attachments[%d]: path or name is required", i)}
+		}
+		prompt += fmt.Sprintf("<file name=%q>\n%s\n</file>\n", name, strings.TrimSuffix(content, "\n"))
+	}
+	return prompt + "\n", nil
+}
+
+// readAttachment reads a path attachment, refusing files that could never fit
+// in a prompt or aren't text
+func (h *ChatHandler) readAttachment(path, workingDir string) (string, string, *completionError) {
+	resolved, err := agents.ResolveAttachmentPath(path, workingDir, h.cfg.CLI.AllowedWorkingDirs)
+	if err != nil {
+		return "", "", &completionError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	f, err := os.Open(resolved)
+	if err != nil {
+		return "", "", &completionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("failed to open attachment %s", path)}
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() {
+		return "", "", &completionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("attachment %s is not a regular file", path)}
+	}
+
+	// The prompt limit counts characters, which take at most utf8.UTFMax bytes
+	limit := int64(h.cfg.Limits.MaxPromptChars) * utf8.UTFMax
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return "", "", &completionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("failed to read attachment %s", path)}
+	}
+	if int64(len(data)) > limit {
+		return "", "", &completionError{Status: http.StatusRequestEntityTooLarge, Message: fmt.Sprintf("attachment %s exceeds the maximum prompt size", path)}
+	}
+	if !utf8.Valid(data) {
+		return "", "", &completionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("attachment %s is not UTF-8 text", path)}
+	}
+	return path, string(data), nil
+}
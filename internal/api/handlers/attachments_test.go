@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andrew/ai-cli-server/internal/agents/mock"
+	"github.com/andrew/ai-cli-server/internal/config"
+)
+
+func TestAttachments(t *testing.T) {
+	allowed, outside := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(allowed, "main.go"), []byte("package main\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig(t, "cli:\n  allowed_working_dirs: [\""+allowed+"\"]\n")
+	db := testDB(t)
+	h := testChatHandler(cfg, db, mock.NewProvider(config.MockConfig{Echo: true}))
+	client := testClient(t, db, nil)
+
+	tests := []struct {
+		name        string
+		workingDir  string
+		attachments []Attachment
+		wantStatus  int
+		wantPrompt  string
+	}{
+		{"inline", "", []Attachment{{Name: "notes.md", Content: "remember the milk"}}, http.StatusOK, "<file name=\"notes.md\">\nremember the milk\n</file>"},
+		{"absolute path", "", []Attachment{{Path: filepath.Join(allowed, "main.go")}}, http.StatusOK, "package main\n</file>"},
+		{"path relative to the working directory", allowed, []Attachment{{Path: "main.go"}}, http.StatusOK, "<file name=\"main.go\">\npackage main\n</file>"},
+		{"path outside the allowlist", "", []Attachment{{Path: filepath.Join(outside, "secret.txt")}}, http.StatusBadRequest, ""},
+		{"relative path escaping the working directory", allowed, []Attachment{{Path: filepath.Join("..", filepath.Base(outside), "secret.txt")}}, http.StatusBadRequest, ""},
+		{"path and inline content", "", []Attachment{{Path: filepath.Join(allowed, "main.go"), Content: "x"}}, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, cerr := h.complete(context.Background(), client, ChatCompletionRequest{
+				Model: mock.Model, Messages: userMessage(tt.name), WorkingDirectory: tt.workingDir, Attachments: tt.attachments,
+			})
+			if tt.wantStatus != http.StatusOK {
+				if cerr == nil || cerr.Status != tt.wantStatus {
+					t.Fatalf("complete() error = %v, want status %d", cerr, tt.wantStatus)
+				}
+				return
+			}
+			if cerr != nil {
+				t.Fatalf("complete() error = %s", cerr.Message)
+			}
+			prompt := resp.(*ChatCompletionResponse).Content
+			if !strings.Contains(prompt, tt.wantPrompt) || strings.Index(prompt, tt.wantPrompt) > strings.Index(prompt, tt.name) {
+				t.Errorf("prompt = %q, want %q ahead of the messages", prompt, tt.wantPrompt)
+			}
+			if strings.Contains(prompt, "hunter2") {
+				t.Errorf("prompt = %q leaks a file outside the allowlist", prompt)
+			}
+		})
+	}
+}
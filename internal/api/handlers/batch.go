@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/andrew/ai-cli-server/internal/api/middleware"
+)
+
+// BatchCompletionRequest represents a batch of chat completion requests
+type BatchCompletionRequest struct {
+	Requests []ChatCompletionRequest `json:"requests"`
+}
+
+// BatchItemResult is the outcome of one request in a batch
+type BatchItemResult struct {
+	Index        int         `json:"index"`
+	Status       int         `json:"status"`
+	Response     interface{} `json:"response,omitempty"`
+	Error        string      `json:"error,omitempty"`
+	FinishReason string      `json:"finish_reason,omitempty"` // "timeout" or "error" when the CLI ran and failed
+}
+
+// BatchCompletionResponse holds per-item results in request order
+type BatchCompletionResponse struct {
+	Results []BatchItemResult `json:"results"`
+}
+
+// HandleBatchCompletion handles POST /v1/chat/completions/batch
+func (h *ChatHandler) HandleBatchCompletion(w http.ResponseWriter, r *http.Request) {
+	client := middleware.GetClientFromContext(r.Context())
+	if client == nil {
+		respondError(w, r, http.StatusInternalServerError, "client not found in context")
+		return
+	}
+
+	// Parse request
+	var req BatchCompletionRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	if len(req.Requests) == 0 {
+		respondError(w, r, http.StatusBadRequest, "requests must contain at least one item")
+		return
+	}
+	if len(req.Requests) > h.cfg.Batch.MaxItems {
+		respondError(w, r, http.StatusBadRequest, fmt.Sprintf("batch has %d requests, exceeds maximum of %d", len(req.Requests), h.cfg.Batch.MaxItems))
+		return
+	}
+
+	results := make([]BatchItemResult, len(req.Requests))
+	jobs := make(chan int)
+
+	// Bounded worker pool so a batch can't spawn an unbounded number of CLI processes
+	workers := h.cfg.Batch.Workers
+	if workers > len(req.Requests) {
+		workers = len(req.Requests)
+	}
+
+	// Each worker runs its share of the items one after another
+	h.extendWriteDeadline(w, (len(req.Requests)+workers-1)/workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				results[index] = h.completeBatchItem(r, index, req.Requests[index])
+			}
+		}()
+	}
+
+	for index := range req.Requests {
+		jobs <- index
+	}
+	close(jobs)
+	wg.Wait()
+
+	respondJSON(w, http.StatusOK, BatchCompletionResponse{Results: results})
+}
+
+// completeBatchItem runs one batch item, charging it against the client's rate limit
+func (h *ChatHandler) completeBatchItem(r *http.Request, index int, req ChatCompletionRequest) BatchItemResult {
+	client := middleware.GetClientFromContext(r.Context())
+
+	if h.rateLimiter != nil && !h.rateLimiter.Allow(client, r.URL.Path) {
+		return BatchItemResult{Index: index, Status: http.StatusTooManyRequests, Error: "rate limit exceeded"}
+	}
+
+	result, cerr := h.complete(r.Context(), client, req)
+	if cerr != nil {
+		return BatchItemResult{Index: index, Status: cerr.Status, Error: cerr.Message, FinishReason: cerr.FinishReason}
+	}
+	return BatchItemResult{Index: index, Status: http.StatusOK, Response: result}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andrew/ai-cli-server/internal/agents/copilot"
+	"github.com/andrew/ai-cli-server/internal/config"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+func TestBinaryPathOverride(t *testing.T) {
+	binDir := t.TempDir()
+	pinned := filepath.Join(binDir, "copilot")
+	if err := os.WriteFile(pinned, []byte("#!/bin/sh\necho pinned\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(t, "cli:\n  allowed_binary_dirs: [\""+binDir+"\"]\n")
+	db := testDB(t)
+	provider := copilot.NewProvider(config.CopilotConfig{BinaryPath: fakeCLI(t, "echo configured")}, "")
+	h := testChatHandler(cfg, db, provider)
+
+	tests := []struct {
+		name        string
+		override    string
+		wantStatus  int
+		wantContent string
+	}{
+		{"unset runs the configured binary", "", http.StatusOK, "configured\n"},
+		{"override inside the allowed directory", pinned, http.StatusOK, "pinned\n"},
+		{"override outside the allowed directory", provider.BinaryPath, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := testClient(t, db, func(c *models.Client) {
+				c.Provider = "copilot"
+				c.BinaryPathOverride = tt.override
+			})
+			resp, cerr := h.complete(context.Background(), client, ChatCompletionRequest{Model: "gpt-5", Messages: userMessage("hi")})
+			if tt.wantStatus != http.StatusOK {
+				if cerr == nil || cerr.Status != tt.wantStatus {
+					t.Fatalf("complete() error = %v, want status %d", cerr, tt.wantStatus)
+				}
+				return
+			}
+			if cerr != nil {
+				t.Fatalf("complete() error = %s", cerr.Message)
+			}
+			if got := resp.(*ChatCompletionResponse).Content; got != tt.wantContent {
+				t.Errorf("content = %q, want %q", got, tt.wantContent)
+			}
+		})
+	}
+}
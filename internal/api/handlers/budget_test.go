@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/agents/mock"
+	"github.com/andrew/ai-cli-server/internal/config"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+func TestMonthlyBudget(t *testing.T) {
+	for _, period := range []string{config.BudgetPeriodCalendarMonth, config.BudgetPeriodRolling30Days} {
+		t.Run(period, func(t *testing.T) {
+			cfg := testConfig(t, "limits:\n  budget_period: "+period+"\n")
+			db := testDB(t)
+			client := testClient(t, db, func(c *models.Client) { c.MonthlyBudget = 1 })
+			h := testChatHandler(cfg, db, mock.NewProvider(config.MockConfig{}))
+
+			spend := func(cost float64, at time.Time) {
+				t.Helper()
+				if err := db.CreateUsageLog(&models.UsageLog{ClientID: client.ID, Timestamp: at, Provider: "mock", Model: mock.Model, ResponseStatus: http.StatusOK, Cost: cost}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			complete := func() *completionError {
+				t.Helper()
+				_, cerr := h.complete(context.Background(), client, ChatCompletionRequest{Model: mock.Model, Messages: userMessage("hi")})
+				return cerr
+			}
+
+			// Spend before the period began doesn't count against it
+			now := time.Now()
+			spend(5, cfg.Limits.BudgetPeriodStart(now).Add(-time.Hour))
+			spend(0.6, now)
+			if cerr := complete(); cerr != nil {
+				t.Fatalf("complete() under budget error = %s", cerr.Message)
+			}
+
+			spend(0.4, now)
+			cerr := complete()
+			if cerr == nil || cerr.Status != http.StatusPaymentRequired {
+				t.Fatalf("complete() at budget error = %v, want status %d", cerr, http.StatusPaymentRequired)
+			}
+
+			// Dry runs don't spend, so they are still described
+			if _, cerr := h.complete(context.Background(), client, ChatCompletionRequest{Model: mock.Model, Messages: userMessage("hi"), DryRun: true}); cerr != nil {
+				t.Errorf("dry run over budget error = %s", cerr.Message)
+			}
+
+			// Raising the cap lets the client through again
+			client.MonthlyBudget = 2
+			if cerr := complete(); cerr != nil {
+				t.Errorf("complete() after raising the budget error = %s", cerr.Message)
+			}
+		})
+	}
+}
+
+func TestMonthlyBudgetPricesUnreportedCost(t *testing.T) {
+	// The mock, like copilot, reports no cost, so the catalog prices its tokens
+	cfg := testConfig(t, `
+cli:
+  model_catalog:
+    - name: `+mock.Model+`
+      input_price: 200000
+      output_price: 200000
+`)
+	db := testDB(t)
+	h := testChatHandler(cfg, db, mock.NewProvider(config.MockConfig{}))
+	client := testClient(t, db, func(c *models.Client) { c.MonthlyBudget = 1 })
+
+	// At 20 cents a token, the first request's few tokens cross the cap
+	resp, cerr := h.complete(context.Background(), client, ChatCompletionRequest{Model: mock.Model, Messages: userMessage("hello there")})
+	if cerr != nil {
+		t.Fatalf("complete() under budget error = %s", cerr.Message)
+	}
+	completion := resp.(*ChatCompletionResponse)
+	logs, err := db.GetUsageLogs(client.ID, 1, 0, nil, nil, nil)
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("GetUsageLogs() = %v, %v; want one log", logs, err)
+	}
+	if want := float64(completion.TotalTokens) * 0.2; math.Abs(logs[0].Cost-want) > 1e-9 || want < 1 {
+		t.Fatalf("logged cost = %v, want %v priced from the catalog and past the budget", logs[0].Cost, want)
+	}
+
+	_, cerr = h.complete(context.Background(), client, ChatCompletionRequest{Model: mock.Model, Messages: userMessage("hello again")})
+	if cerr == nil || cerr.Status != http.StatusPaymentRequired {
+		t.Errorf("complete() over budget error = %v, want status %d", cerr, http.StatusPaymentRequired)
+	}
+}
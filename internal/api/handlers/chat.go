@@ -1,47 +1,128 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/andrew/ai-cli-server/internal/agents"
-	"github.com/andrew/ai-cli-server/internal/agents/copilot"
-	"github.com/andrew/ai-cli-server/internal/agents/cursor"
 	"github.com/andrew/ai-cli-server/internal/api/middleware"
+	"github.com/andrew/ai-cli-server/internal/config"
 	"github.com/andrew/ai-cli-server/internal/database"
 	"github.com/andrew/ai-cli-server/internal/database/models"
+	"github.com/andrew/ai-cli-server/internal/filter"
+	"github.com/andrew/ai-cli-server/internal/tracing"
+	"github.com/andrew/ai-cli-server/internal/webhook"
+	"go.opentelemetry.io/otel/codes"
 )
 
+// RateLimiter consumes a client's request allowance outside the rate limit middleware
+type RateLimiter interface {
+	Allow(client *models.Client, path string) bool
+}
+
 // ChatHandler handles chat completion requests
 type ChatHandler struct {
-	db        *database.DB
-	providers map[string]agents.Provider
+	db          database.Store
+	cfg         *config.Config
+	notifier    *webhook.Notifier
+	rateLimiter RateLimiter
+	executions  *agents.ExecutionLimiter
+	phases      *PhaseHistograms
+	providers   map[string]agents.Provider
+	filter      *filter.Filter
+	sampler     *promptSampler
+	inflight    *inflightGroup
 }
 
-// NewChatHandler creates a new chat handler
-func NewChatHandler(db *database.DB, copilotProvider *copilot.Provider, cursorProvider *cursor.Provider) *ChatHandler {
+// NewChatHandler creates a new chat handler serving the given providers by name.
+// Completion phase timings are recorded in phases unless it is nil.
+func NewChatHandler(db database.Store, cfg *config.Config, notifier *webhook.Notifier, rateLimiter RateLimiter, executions *agents.ExecutionLimiter, phases *PhaseHistograms, providers ...agents.Provider) *ChatHandler {
+	byName := make(map[string]agents.Provider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name()] = provider
+	}
 	return &ChatHandler{
-		db: db,
-		providers: map[string]agents.Provider{
-			"copilot": copilotProvider,
-			"cursor":  cursorProvider,
-		},
+		db:          db,
+		cfg:         cfg,
+		notifier:    notifier,
+		rateLimiter: rateLimiter,
+		executions:  executions,
+		phases:      phases,
+		providers:   byName,
+		filter:      filter.New(cfg.Filter),
+		sampler:     newPromptSampler(*cfg.Logging.PromptSampleRate, cfg.Logging.PromptSampleSeed),
+		inflight:    newInflightGroup(),
 	}
 }
 
 // ChatCompletionRequest represents an incoming chat completion request
 type ChatCompletionRequest struct {
-	Provider         string    `json:"provider"`
-	Model            string    `json:"model"`
-	Messages         []Message `json:"messages"`
-	AllowTools       []string  `json:"allow_tools,omitempty"`
-	DenyTools        []string  `json:"deny_tools,omitempty"`
-	Force            bool      `json:"force,omitempty"`
-	WorkingDirectory string    `json:"working_directory,omitempty"`
+	Provider         string       `json:"provider"`
+	Model            string       `json:"model"`
+	Messages         []Message    `json:"messages"`
+	AllowTools       []string     `json:"allow_tools,omitempty"`
+	DenyTools        []string     `json:"deny_tools,omitempty"`
+	Force            bool         `json:"force,omitempty"`
+	WorkingDirectory string       `json:"working_directory,omitempty"`
+	Attachments      []Attachment `json:"attachments,omitempty"`   // Files included in the prompt as context
+	SessionID        string       `json:"session_id,omitempty"`    // Continue a persisted conversation
+	DryRun           bool         `json:"dry_run,omitempty"`       // Return the CLI command instead of running it
+	Cache            bool         `json:"cache,omitempty"`         // Serve identical requests from the response cache
+	Debug            bool         `json:"debug,omitempty"`         // Include CLI stderr in the response metadata
+	IncludeRaw       bool         `json:"include_raw,omitempty"`   // Return the unparsed CLI output; needs the raw_output scope
+	OpenAICompat     bool         `json:"openai_compat,omitempty"` // Respond with the OpenAI chat.completion shape
+
+	// Metadata tags the request's usage log for later filtering, e.g. {"project": "search"}
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Stop ends the completion at the first of these sequences, which is left out
+	Stop StopSequences `json:"stop,omitempty"`
+
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+// StopSequences are a request's stop sequences, given as a list or, as OpenAI
+// clients may, a single string
+type StopSequences []string
+
+// maxStopSequences is the most stop sequences a request may give, as in OpenAI's API
+const maxStopSequences = 4
+
+// UnmarshalJSON implements json.Unmarshaler
+func (s *StopSequences) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = StopSequences{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(s))
+}
+
+// ResponseFormat selects the shape of the completion content
+type ResponseFormat struct {
+	Type string `json:"type"` // "text" (default) or "json_object"
 }
 
+// JSON mode enforcement, reported in ChatCompletionResponse.JSONMode
+const (
+	jsonModeNative = "native" // The CLI constrained its own output
+	jsonModePrompt = "prompt" // An instruction was appended and the output validated
+)
+
+// jsonInstruction is appended to prompts for providers without native JSON output
+const jsonInstruction = "\n\nRespond with a single valid JSON object only, without markdown code fences or any other text."
+
 // Message represents a chat message
 type Message struct {
 	Role    string `json:"role"`
@@ -54,86 +135,420 @@ type ChatCompletionResponse struct {
 	Provider         string `json:"provider"`
 	Model            string `json:"model"`
 	Content          string `json:"content"`
+	SessionID        string `json:"session_id,omitempty"`
 	PromptTokens     int    `json:"prompt_tokens"`
 	CompletionTokens int    `json:"completion_tokens"`
 	TotalTokens      int    `json:"total_tokens"`
 	DurationMs       int64  `json:"duration_ms"`
+	Cached           bool   `json:"cached"`
+	FinishReason     string `json:"finish_reason"`       // finishReasonStop, or finishReasonLength when truncated
+	Truncated        bool   `json:"truncated,omitempty"` // CLI output exceeded limits.max_response_bytes
+	JSONMode         string `json:"json_mode,omitempty"` // How a json_object response_format was enforced
+
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	RawOutput *agents.RawOutput      `json:"raw_output,omitempty"` // The CLI's unparsed output, for include_raw
+}
+
+// DryRunResponse describes the CLI command a request would run
+type DryRunResponse struct {
+	Provider string                 `json:"provider"`
+	Model    string                 `json:"model"`
+	DryRun   bool                   `json:"dry_run"`
+	Command  *agents.CommandPreview `json:"command"`
 }
 
 // HandleChatCompletion handles POST /v1/chat/completions
 func (h *ChatHandler) HandleChatCompletion(w http.ResponseWriter, r *http.Request) {
+	h.serveChatCompletion(w, r, false)
+}
+
+// HandleOpenAIChatCompletion handles POST /v1/openai/chat/completions,
+// which always responds in the OpenAI chat.completion shape
+func (h *ChatHandler) HandleOpenAIChatCompletion(w http.ResponseWriter, r *http.Request) {
+	h.serveChatCompletion(w, r, true)
+}
+
+// serveChatCompletion runs a single chat completion request, responding in the
+// OpenAI shape when openAICompat is set or the request asks for it
+func (h *ChatHandler) serveChatCompletion(w http.ResponseWriter, r *http.Request, openAICompat bool) {
 	client := middleware.GetClientFromContext(r.Context())
 	if client == nil {
-		respondError(w, http.StatusInternalServerError, "client not found in context")
+		respondError(w, r, http.StatusInternalServerError, "client not found in context")
 		return
 	}
 
 	// Parse request
 	var req ChatCompletionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "invalid request body")
+	if !decodeJSONBody(w, r, &req) {
 		return
 	}
 
-	// Client has a single provider - always use it
-	req.Provider = client.Provider
+	h.extendWriteDeadline(w, 1)
+	result, cerr := h.complete(r.Context(), client, req)
+	if cerr != nil {
+		respondCompletionError(w, r, cerr)
+		return
+	}
 
-	// Use client default model if not specified
-	if req.Model == "" {
-		if client.DefaultModel != "" {
-			req.Model = client.DefaultModel
-		} else {
-			// Use first available model from provider
-			if provider, ok := h.providers[req.Provider]; ok {
-				models := provider.GetSupportedModels()
-				if len(models) > 0 {
-					req.Model = models[0]
-				}
-			}
+	if resp, ok := result.(*ChatCompletionResponse); ok && (openAICompat || req.OpenAICompat) {
+		respondJSON(w, http.StatusOK, toOpenAIChatCompletion(resp))
+		return
+	}
+	respondJSON(w, http.StatusOK, result)
+}
+
+// resolveModel returns the model a client's request runs: the requested one,
+// else the client's default, else the first its provider supports. It is empty
+// when there is none.
+func (h *ChatHandler) resolveModel(client *models.Client, model string) string {
+	if model != "" {
+		return model
+	}
+	if client.DefaultModel != "" {
+		return client.DefaultModel
+	}
+	if provider, ok := h.providers[client.Provider]; ok {
+		if models := provider.GetSupportedModels(); len(models) > 0 {
+			return models[0]
 		}
 	}
+	return ""
+}
+
+// extendWriteDeadline moves the response's write deadline past the longest
+// that rounds of CLI runs, one after another, can take, queueing included, so
+// server.write_timeout doesn't cut off a response the CLI was allowed to take
+// longer over. Without a write timeout there is no deadline to move.
+func (h *ChatHandler) extendWriteDeadline(w http.ResponseWriter, rounds int) {
+	if h.cfg.Server.WriteTimeout <= 0 {
+		return
+	}
+	run := h.cfg.Limits.ExecutionWait + h.cfg.CLI.LongestTimeout()
+	deadline := time.Now().Add(h.cfg.Server.WriteTimeout + time.Duration(rounds)*run)
+	// Writers that can't set deadlines, such as test recorders, have none to extend
+	http.NewResponseController(w).SetWriteDeadline(deadline)
+}
+
+// Finish reasons report how a completion ended
+const (
+	finishReasonStop    = "stop"    // The CLI completed normally
+	finishReasonLength  = "length"  // Output was truncated at limits.max_response_bytes
+	finishReasonTimeout = "timeout" // The CLI ran past its timeout
+	finishReasonError   = "error"   // The CLI failed or its output was unusable
+)
+
+// completionError is a failed completion and the HTTP status to report it with
+type completionError struct {
+	Status       int
+	Message      string
+	RetryAfter   time.Duration // Sent as Retry-After when set
+	FinishReason string        // Set when the CLI ran and failed: finishReasonTimeout or finishReasonError
+}
+
+// respondCompletionError sends a completionError, with Retry-After when it has
+// one and finish_reason when the CLI ran
+func respondCompletionError(w http.ResponseWriter, r *http.Request, cerr *completionError) {
+	if cerr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(cerr.RetryAfter.Seconds()))))
+	}
+	middleware.RespondFinishedError(w, r, cerr.Status, cerr.Message, cerr.FinishReason)
+}
+
+// complete validates and executes a single chat completion for a client
+// Returns a *ChatCompletionResponse, or a *DryRunResponse for dry runs
+func (h *ChatHandler) complete(ctx context.Context, client *models.Client, req ChatCompletionRequest) (interface{}, *completionError) {
+	// Client has a single provider - always use it
+	req.Provider = client.Provider
+
+	req.Model = h.resolveModel(client, req.Model)
 
 	// Validate we have both provider and model
 	if req.Model == "" {
-		respondError(w, http.StatusBadRequest, "model is required (no default configured)")
-		return
+		return nil, &completionError{Status: http.StatusBadRequest, Message: "model is required (no default configured)"}
+	}
+	if err := database.ValidateMetadata(req.Metadata); err != nil {
+		return nil, &completionError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	if len(req.Stop) > maxStopSequences {
+		return nil, &completionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("stop allows at most %d sequences", maxStopSequences)}
+	}
+	if slices.Contains(req.Stop, "") {
+		return nil, &completionError{Status: http.StatusBadRequest, Message: "stop sequences must not be empty"}
+	}
+	if req.IncludeRaw && !database.HasScope(client, models.ScopeRawOutput) {
+		return nil, &completionError{Status: http.StatusForbidden, Message: fmt.Sprintf("include_raw requires the %s scope", models.ScopeRawOutput)}
 	}
 
 	// Get provider
 	provider, ok := h.providers[req.Provider]
 	if !ok {
-		respondError(w, http.StatusBadRequest, fmt.Sprintf("unknown provider: %s", req.Provider))
-		return
+		return nil, &completionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("unknown provider: %s", req.Provider)}
 	}
 
-	// Check if provider is available
+	// Check if provider is available, falling back to another provider if configured
+	var fallbackFrom *string
 	if !provider.IsAvailable() {
-		respondError(w, http.StatusServiceUnavailable, fmt.Sprintf("provider %s is not available", req.Provider))
-		return
+		h.notifier.Notify(webhook.Event{
+			Type:     webhook.EventProviderUnavailable,
+			ClientID: client.ID,
+			Details:  map[string]interface{}{"provider": req.Provider},
+		})
+		fallback, toProvider, toModel := h.findFallback(req.Provider, req.Model)
+		if fallback == nil {
+			return nil, &completionError{Status: http.StatusServiceUnavailable, Message: fmt.Sprintf("provider %s is not available", req.Provider)}
+		}
+		from := req.Provider + "/" + req.Model
+		fallbackFrom = &from
+		provider, req.Provider, req.Model = fallback, toProvider, toModel
+	}
+
+	// The client's tool policy bounds what a request may allow, and its denied
+	// tools apply to every request
+	allowedTools, deniedTools := database.ParseClientTools(client)
+	if len(allowedTools) > 0 {
+		for _, tool := range req.AllowTools {
+			if !slices.Contains(allowedTools, tool) {
+				return nil, &completionError{Status: http.StatusForbidden, Message: fmt.Sprintf("tool %s is not allowed for this client", tool)}
+			}
+		}
+	}
+	req.DenyTools = slices.Concat(req.DenyTools, deniedTools)
+
+	// Tool lists only help if the CLI applies them; cursor-agent has no per-tool flags
+	if len(req.AllowTools) > 0 || len(req.DenyTools) > 0 {
+		if filterer, ok := provider.(agents.ToolFilterer); !ok || !filterer.SupportsToolFilters() {
+			return nil, &completionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("provider %s does not support allow_tools or deny_tools", req.Provider)}
+		}
+	}
+
+	// JSON output is enforced by the CLI where supported, otherwise via the prompt
+	jsonMode := ""
+	if req.ResponseFormat != nil {
+		switch req.ResponseFormat.Type {
+		case "", "text":
+		case "json_object":
+			jsonMode = jsonModePrompt
+			if responder, ok := provider.(agents.JSONResponder); ok && responder.SupportsJSONOutput() {
+				jsonMode = jsonModeNative
+			}
+		default:
+			return nil, &completionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("unsupported response_format type: %s", req.ResponseFormat.Type)}
+		}
+	}
+
+	// Stop sequences are passed to the CLI where supported, otherwise the output is cut at them
+	stopNative := false
+	if sequencer, ok := provider.(agents.StopSequencer); ok && sequencer.SupportsStopSequences() {
+		stopNative = true
+	}
+
+	// force skips the CLI's approvals (cursor's --force runs any command), so it is
+	// limited to clients granted unrestricted tools
+	if req.Force && !client.ToolsUnrestricted {
+		return nil, &completionError{Status: http.StatusForbidden, Message: "force requires a client with unrestricted tools"}
 	}
 
 	// Check if model is allowed for this client
-	if !database.IsModelAllowed(client, req.Model) && !database.IsModelAllowed(client, "*") {
-		respondError(w, http.StatusForbidden, fmt.Sprintf("model %s is not allowed for this client", req.Model))
-		return
+	if !database.IsModelAllowed(client, req.Model) {
+		return nil, &completionError{Status: http.StatusForbidden, Message: fmt.Sprintf("model %s is not allowed for this client", req.Model)}
+	}
+	if slices.Contains(h.cfg.CLI.DisabledModels, req.Model) {
+		return nil, &completionError{Status: http.StatusServiceUnavailable, Message: fmt.Sprintf("model %s is disabled on this server", req.Model)}
+	}
+
+	// Load prior turns when continuing a conversation
+	var history []models.ConversationMessage
+	resumeSessionID := "" // Set when the CLI resumes the session itself
+	if req.SessionID != "" {
+		if len(req.SessionID) > maxSessionIDLength {
+			return nil, &completionError{Status: http.StatusBadRequest, Message: fmt.Sprintf("session_id must be at most %d characters", maxSessionIDLength)}
+		}
+
+		revoked, err := h.db.IsSessionRevoked(req.SessionID)
+		if err != nil {
+			return nil, &completionError{Status: http.StatusInternalServerError, Message: "failed to check session"}
+		}
+		if revoked {
+			return nil, &completionError{Status: http.StatusForbidden, Message: "session has been revoked"}
+		}
+
+		conv, err := h.db.GetConversation(req.SessionID)
+		if err != nil {
+			return nil, &completionError{Status: http.StatusInternalServerError, Message: "failed to load conversation"}
+		}
+		if conv == nil {
+			// A session the CLI itself returned to this client is resumed by the CLI,
+			// which keeps its own context, rather than replayed from a transcript
+			if resumer, ok := provider.(agents.SessionResumer); ok && resumer.SupportsSessionResume() {
+				owned, err := h.db.SessionBelongsTo(client.ID, req.SessionID)
+				if err != nil {
+					return nil, &completionError{Status: http.StatusInternalServerError, Message: "failed to check session"}
+				}
+				// Creating a transcript under an ID the CLI may have handed another
+				// client would claim it and lock its owner out
+				if !owned {
+					return nil, &completionError{Status: http.StatusNotFound, Message: "session not found"}
+				}
+				resumeSessionID = req.SessionID
+			}
+		}
+		switch {
+		case conv != nil && conv.ClientID != client.ID:
+			return nil, &completionError{Status: http.StatusForbidden, Message: "session does not belong to this client"}
+		case conv != nil:
+			history = conv.Messages
+		case resumeSessionID == "":
+			conv = &models.Conversation{ID: req.SessionID, ClientID: client.ID}
+			if err := h.db.CreateConversation(conv); err != nil {
+				return nil, &completionError{Status: http.StatusInternalServerError, Message: "failed to create conversation"}
+			}
+		}
 	}
 
-	// Convert messages to prompt (simple concatenation)
-	prompt := h.messagesToPrompt(req.Messages)
+	// The CLI runs with tools enabled, so confine it to configured directories
+	workingDir, err := agents.ResolveWorkingDirectory(req.WorkingDirectory, h.cfg.CLI.AllowedWorkingDirs)
+	if err != nil {
+		return nil, &completionError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	// A client pinned to its own CLI binary runs it, checked against the allowed
+	// directories on every request since they may have changed, unless a
+	// fallback moved the request to another provider
+	binaryPath := ""
+	if req.Provider == client.Provider {
+		if binaryPath, err = agents.ResolveBinaryPath(client.BinaryPathOverride, h.cfg.CLI.AllowedBinaryDirs); err != nil {
+			return nil, &completionError{Status: http.StatusForbidden, Message: err.Error()}
+		}
+	}
+
+	// Convert messages to prompt (simple concatenation), with the client's system
+	// prompt first so nothing the client sends can come before it
+	_, promptSpan := tracing.Start(ctx, "prompt_build")
+	attachments, cerr := h.attachmentsToPrompt(req.Attachments, workingDir)
+	if cerr != nil {
+		promptSpan.End()
+		return nil, cerr
+	}
+	prompt := systemPromptToPrompt(client.SystemPrompt) + historyToPrompt(history) + attachments + h.messagesToPrompt(req.Messages)
+	if jsonMode == jsonModePrompt {
+		prompt += jsonInstruction
+	}
+	promptSpan.End()
+	if promptChars := utf8.RuneCountInString(prompt); promptChars > h.cfg.Limits.MaxPromptChars {
+		return nil, &completionError{Status: http.StatusRequestEntityTooLarge, Message: fmt.Sprintf("prompt is %d characters, exceeds maximum of %d", promptChars, h.cfg.Limits.MaxPromptChars)}
+	}
+
+	if limiter, ok := provider.(agents.PromptArgLimiter); ok && limiter.PromptNeedsArg() && agents.PromptExceedsArgLimit(prompt) {
+		return nil, &completionError{Status: http.StatusRequestEntityTooLarge, Message: fmt.Sprintf("prompt is %d bytes, exceeds the %d bytes provider %s can take as an argument", len(prompt), agents.MaxPromptArgLength, req.Provider)}
+	}
+
+	// Decide once per request whether its usage logs keep the prompt
+	logPrompt := h.sampler.Sample()
+
+	// Block prompts matching the content filter before they reach the CLI. The
+	// prompt isn't stored in the usage log since it may hold what was filtered.
+	if !client.SkipContentFilter {
+		if reason, blocked := h.filter.Check(prompt); blocked {
+			errorMsg := fmt.Sprintf("prompt blocked by content filter: %s", reason)
+			h.db.CreateUsageLog(&models.UsageLog{
+				ClientID:       client.ID,
+				Timestamp:      time.Now(),
+				Provider:       req.Provider,
+				Model:          req.Model,
+				ResponseStatus: http.StatusUnprocessableEntity,
+				ErrorMessage:   &errorMsg,
+				RequestBytes:   middleware.RequestBytes(ctx),
+				FallbackFrom:   fallbackFrom,
+				Metadata:       req.Metadata,
+			})
+			return nil, &completionError{Status: http.StatusUnprocessableEntity, Message: errorMsg}
+		}
+	}
 
 	// Execute CLI request
 	startTime := time.Now()
+
+	// Per-client environment, minus anything on the denylist
+	clientEnv, err := database.ParseClientEnv(client)
+	if err != nil {
+		return nil, &completionError{Status: http.StatusInternalServerError, Message: "failed to load client environment"}
+	}
+
 	cliReq := agents.ExecuteRequest{
 		Prompt:           prompt,
 		Model:            req.Model,
 		AllowTools:       req.AllowTools,
 		DenyTools:        req.DenyTools,
 		Force:            req.Force,
-		WorkingDirectory: req.WorkingDirectory,
+		AllowAllTools:    client.ToolsUnrestricted,
+		SessionID:        resumeSessionID,
+		WorkingDirectory: workingDir,
+		EnvironmentVars:  agents.FilterEnv(clientEnv, h.cfg.CLI.EnvDenylist),
+		MaxOutputBytes:   h.cfg.Limits.MaxResponseBytes,
+		Debug:            req.Debug,
+		JSONOutput:       jsonMode == jsonModeNative,
+		Timings:          h.phases != nil,
+		Stop:             req.Stop,
+		IncludeRaw:       req.IncludeRaw,
+		BinaryPath:       binaryPath,
 	}
 
-	resp, err := provider.Execute(r.Context(), cliReq)
+	// Dry runs describe the command without executing it or recording usage
+	if req.DryRun {
+		return &DryRunResponse{
+			Provider: req.Provider,
+			Model:    req.Model,
+			DryRun:   true,
+			Command:  provider.DryRun(cliReq),
+		}, nil
+	}
+
+	// Serve identical requests from the cache when the request or client opts in.
+	// A cached answer has no CLI output to show, so include_raw always runs the CLI.
+	useCache := (req.Cache || client.CacheResponses) && !req.IncludeRaw
+	cacheKey := ""
+	var resp *agents.ExecuteResponse
+	if useCache {
+		cacheKey = responseCacheKey(req.Provider, cliReq)
+		if entry, err := h.db.GetCachedResponse(cacheKey); err == nil && entry != nil {
+			resp = &agents.ExecuteResponse{
+				Content:          entry.Content,
+				Model:            entry.Model,
+				PromptTokens:     entry.PromptTokens,
+				CompletionTokens: entry.CompletionTokens,
+				TotalTokens:      entry.PromptTokens + entry.CompletionTokens,
+				ResponseTime:     time.Since(startTime),
+			}
+		}
+	}
+	cached := resp != nil
+
+	if !cached {
+		if cerr := h.checkBudget(client); cerr != nil {
+			return nil, cerr
+		}
+		if cerr := h.checkModelQuota(client, req.Model); cerr != nil {
+			return nil, cerr
+		}
+
+		// Identical requests already running share that execution, except those
+		// resuming a CLI session, since each resume moves the session on
+		execute := func(ctx context.Context) (*agents.ExecuteResponse, *completionError, error) {
+			return h.execute(ctx, client, provider, req.Provider, cliReq)
+		}
+		var cerr *completionError
+		if resumeSessionID == "" {
+			resp, cerr, err = h.inflight.do(ctx, inflightKey(client.ID, req.Provider, cliReq), execute)
+		} else {
+			resp, cerr, err = execute(ctx)
+		}
+		if cerr != nil {
+			return nil, cerr
+		}
+	}
 	if err != nil {
+		status, message := executeErrorStatus(err)
+
 		// Log error usage
 		errorMsg := err.Error()
 		usageLog := &models.UsageLog{
@@ -141,33 +556,127 @@ func (h *ChatHandler) HandleChatCompletion(w http.ResponseWriter, r *http.Reques
 			Timestamp:      time.Now(),
 			Provider:       req.Provider,
 			Model:          req.Model,
-			Prompt:         &prompt,
-			ResponseStatus: http.StatusInternalServerError,
+			Prompt:         h.loggedPrompt(client, prompt, logPrompt),
+			ResponseStatus: status,
 			ResponseTimeMs: int(time.Since(startTime).Milliseconds()),
 			ErrorMessage:   &errorMsg,
+			RequestBytes:   middleware.RequestBytes(ctx),
+			FallbackFrom:   fallbackFrom,
+			Metadata:       req.Metadata,
 		}
 		h.db.CreateUsageLog(usageLog)
 
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("CLI execution failed: %v", err))
-		return
+		// A caller hanging up is not a CLI problem, so don't alert on it
+		if status != statusClientClosedRequest {
+			h.notifier.Notify(webhook.Event{
+				Type:     webhook.EventCLIError,
+				ClientID: client.ID,
+				Details: map[string]interface{}{
+					"provider": req.Provider,
+					"model":    req.Model,
+					"error":    errorMsg,
+				},
+			})
+		}
+
+		return nil, &completionError{Status: status, Message: fmt.Sprintf("%s: %v", message, err), FinishReason: errorFinishReason(status)}
+	}
+
+	// Output cut at a stop sequence ended there rather than at the size limit
+	if !cached && !stopNative {
+		if content, ok := cutAtStop(resp.Content, req.Stop); ok {
+			resp.Content = content
+			resp.Truncated = false
+		}
+	}
+
+	// Output that doesn't parse fails the request, and isn't cached
+	if jsonMode != "" {
+		content, ok := extractJSON(resp.Content)
+		if !ok {
+			errorMsg := "CLI output is not valid JSON"
+			h.db.CreateUsageLog(&models.UsageLog{
+				ClientID:         client.ID,
+				Timestamp:        time.Now(),
+				Provider:         req.Provider,
+				Model:            resp.Model,
+				Prompt:           h.loggedPrompt(client, prompt, logPrompt),
+				PromptTokens:     resp.PromptTokens,
+				CompletionTokens: resp.CompletionTokens,
+				TotalTokens:      resp.TotalTokens,
+				Cost:             resp.Cost,
+				UsageReported:    resp.UsageReported,
+				ResponseStatus:   http.StatusBadGateway,
+				ResponseTimeMs:   int(resp.ResponseTime.Milliseconds()),
+				ErrorMessage:     &errorMsg,
+				RequestBytes:     middleware.RequestBytes(ctx),
+				FallbackFrom:     fallbackFrom,
+				Metadata:         req.Metadata,
+			})
+			return nil, &completionError{Status: http.StatusBadGateway, Message: errorMsg, FinishReason: finishReasonError}
+		}
+		resp.Content = content
+	}
+
+	// Truncated output is a one-off failure mode, not an answer worth replaying
+	if useCache && !cached && !resp.Truncated {
+		h.db.PutCachedResponse(&models.CachedResponse{
+			Key:              cacheKey,
+			Provider:         req.Provider,
+			Model:            resp.Model,
+			Content:          resp.Content,
+			PromptTokens:     resp.PromptTokens,
+			CompletionTokens: resp.CompletionTokens,
+			ExpiresAt:        time.Now().Add(h.cfg.Cache.TTL),
+		})
+	}
+
+	// Persist the new turn
+	sessionID := resp.SessionID
+	if req.SessionID != "" {
+		sessionID = req.SessionID
+	}
+	if req.SessionID != "" && resumeSessionID == "" {
+		for _, msg := range req.Messages {
+			h.db.AppendMessage(req.SessionID, msg.Role, msg.Content)
+		}
+		h.db.AppendMessage(req.SessionID, "assistant", resp.Content)
 	}
 
-	// Log usage
+	// Log usage (cache hits are recorded at zero cost)
 	usageLog := &models.UsageLog{
 		ClientID:         client.ID,
-		SessionID:        &resp.SessionID,
+		SessionID:        &sessionID,
 		Timestamp:        time.Now(),
 		Provider:         req.Provider,
 		Model:            resp.Model,
-		Prompt:           &prompt,
+		Prompt:           h.loggedPrompt(client, prompt, logPrompt),
 		PromptTokens:     resp.PromptTokens,
 		CompletionTokens: resp.CompletionTokens,
 		TotalTokens:      resp.TotalTokens,
+		Cost:             resp.Cost,
+		UsageReported:    resp.UsageReported,
 		ResponseStatus:   http.StatusOK,
 		ResponseTimeMs:   int(resp.ResponseTime.Milliseconds()),
+		RequestBytes:     middleware.RequestBytes(ctx),
+		ResponseBytes:    int64(len(resp.Content)),
+		FallbackFrom:     fallbackFrom,
+		Metadata:         req.Metadata,
 	}
+	_, logSpan := tracing.Start(ctx, "usage_log")
 	if err := h.db.CreateUsageLog(usageLog); err != nil {
 		// Log error but don't fail the request
+		logSpan.RecordError(err)
+	}
+	logSpan.End()
+
+	// Report which provider and model the request was rerouted from, and
+	// whether token counts are the CLI's own rather than estimates
+	if fallbackFrom != nil {
+		resp.Metadata = withMetadata(resp.Metadata, "fallback_from", *fallbackFrom)
+	}
+	if resp.UsageReported {
+		resp.Metadata = withMetadata(resp.Metadata, "usage_reported", true)
 	}
 
 	// Return response
@@ -176,13 +685,348 @@ func (h *ChatHandler) HandleChatCompletion(w http.ResponseWriter, r *http.Reques
 		Provider:         req.Provider,
 		Model:            resp.Model,
 		Content:          resp.Content,
+		SessionID:        sessionID,
 		PromptTokens:     resp.PromptTokens,
 		CompletionTokens: resp.CompletionTokens,
 		TotalTokens:      resp.TotalTokens,
 		DurationMs:       resp.ResponseTime.Milliseconds(),
+		Cached:           cached,
+		FinishReason:     finishReason(resp),
+		Truncated:        resp.Truncated,
+		JSONMode:         jsonMode,
+		Metadata:         resp.Metadata,
+		RawOutput:        resp.RawOutput,
+	}
+
+	return &response, nil
+}
+
+// execute runs cliReq on provider once an execution slot is free, within the
+// client's token rate limit
+func (h *ChatHandler) execute(ctx context.Context, client *models.Client, provider agents.Provider, providerName string, cliReq agents.ExecuteRequest) (*agents.ExecuteResponse, *completionError, error) {
+	queueStart := time.Now()
+	release, cerr := h.acquireExecution(ctx)
+	if cerr != nil {
+		return nil, cerr, nil
+	}
+	defer release()
+	queueWait := time.Since(queueStart)
+
+	reserved, cerr := h.reserveTokens(client, cliReq.Prompt)
+	if cerr != nil {
+		return nil, cerr, nil
+	}
+	execCtx, execSpan := tracing.Start(ctx, "cli_execute",
+		tracing.AttrClientID.Int64(client.ID),
+		tracing.AttrProvider.String(providerName),
+		tracing.AttrModel.String(cliReq.Model),
+	)
+	resp, err := provider.Execute(execCtx, cliReq)
+	if err != nil {
+		execSpan.RecordError(err)
+		execSpan.SetStatus(codes.Error, err.Error())
+	} else {
+		execSpan.SetAttributes(
+			tracing.AttrPromptTokens.Int(resp.PromptTokens),
+			tracing.AttrCompletionTokens.Int(resp.CompletionTokens),
+			tracing.AttrDurationMs.Int64(resp.ResponseTime.Milliseconds()),
+		)
+	}
+	execSpan.End()
+	if err != nil {
+		return nil, nil, err
+	}
+	if reserved > 0 {
+		h.reconcileTokens(client, reserved, resp.TotalTokens)
+	}
+	// Price the tokens from the model catalog when the CLI reports no cost of
+	// its own, so budgets apply to every provider
+	if resp.Cost == 0 {
+		if pricing := agents.CatalogPricing(h.cfg.CLI.ModelCatalog, providerName, cliReq.Model); pricing != nil {
+			resp.Cost = pricing.Cost(resp.PromptTokens, resp.CompletionTokens)
+		}
+	}
+	h.observePhases(providerName, resp, queueWait)
+	return resp, nil, nil
+}
+
+// observePhases adds the execution slot wait to the timings the provider
+// reported and records them in the phase histograms
+func (h *ChatHandler) observePhases(provider string, resp *agents.ExecuteResponse, queueWait time.Duration) {
+	timings, ok := resp.Metadata[agents.MetadataTimings].(agents.PhaseTimings)
+	if h.phases == nil || !ok {
+		return
+	}
+	timings.QueueWait = queueWait
+	resp.Metadata[agents.MetadataTimings] = timings
+	h.phases.Observe(provider, resp.Model, timings)
+}
+
+// withMetadata sets key in response metadata, creating the map if needed
+func withMetadata(metadata map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	metadata[key] = value
+	return metadata
+}
+
+// findFallback returns the provider, and the provider name and model to use,
+// from the first configured fallback rule that matches and is itself available.
+// Returns a nil provider when there is none.
+func (h *ChatHandler) findFallback(providerName, model string) (agents.Provider, string, string) {
+	for _, rule := range h.cfg.CLI.Fallbacks {
+		if rule.Provider != providerName {
+			continue
+		}
+		if rule.Model != "" && !database.MatchModelPattern(rule.Model, model) {
+			continue
+		}
+		toProvider := rule.ToProvider
+		if toProvider == "" {
+			toProvider = h.priorityFallback(providerName)
+		}
+		fallback, ok := h.providers[toProvider]
+		if !ok || !fallback.IsAvailable() {
+			continue
+		}
+		toModel := rule.ToModel
+		if toModel == "" {
+			toModel = model
+		}
+		return fallback, toProvider, toModel
+	}
+	return nil, "", ""
+}
+
+// priorityFallback returns the first available provider other than
+// providerName in cli.provider_priority, or "" if there is none
+func (h *ChatHandler) priorityFallback(providerName string) string {
+	names := make([]string, 0, len(h.providers))
+	for name := range h.providers {
+		names = append(names, name)
+	}
+	for _, name := range config.RankProviders(h.cfg.CLI.ProviderPriority, names) {
+		if name != providerName && h.providers[name].IsAvailable() {
+			return name
+		}
+	}
+	return ""
+}
+
+// acquireExecution waits for a server-wide CLI execution slot, returning 503
+// when the queue is full or none frees up in time
+func (h *ChatHandler) acquireExecution(ctx context.Context) (func(), *completionError) {
+	release, err := h.executions.Acquire(ctx)
+	if errors.Is(err, agents.ErrExecutionLimit) {
+		return nil, &completionError{Status: http.StatusServiceUnavailable, Message: "server is busy, too many concurrent CLI executions", RetryAfter: time.Second}
+	}
+	if errors.Is(err, agents.ErrExecutionQueueFull) {
+		return nil, &completionError{Status: http.StatusServiceUnavailable, Message: "server is busy, too many requests queued for CLI execution", RetryAfter: time.Second}
+	}
+	if err != nil {
+		status, message := executeErrorStatus(err)
+		return nil, &completionError{Status: status, Message: fmt.Sprintf("%s: %v", message, err)}
+	}
+	return release, nil
+}
+
+// checkBudget rejects a client whose cost so far in the current budget period
+// has reached its monthly_budget, if it has one
+func (h *ChatHandler) checkBudget(client *models.Client) *completionError {
+	if client.MonthlyBudget <= 0 {
+		return nil
+	}
+
+	spent, err := h.db.GetUsageCost(client.ID, h.cfg.Limits.BudgetPeriodStart(time.Now()))
+	if err != nil {
+		return &completionError{Status: http.StatusInternalServerError, Message: "failed to check budget"}
 	}
+	if spent >= client.MonthlyBudget {
+		return &completionError{Status: http.StatusPaymentRequired, Message: fmt.Sprintf("budget of %.2f for this period exhausted (%.2f spent)", client.MonthlyBudget, spent)}
+	}
+	return nil
+}
+
+// checkModelQuota rejects a request once the client has used up its daily
+// quota for the model, if the model has one. Days start at local midnight.
+func (h *ChatHandler) checkModelQuota(client *models.Client, model string) *completionError {
+	quota, ok := database.ParseModelQuotas(client)[model]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	used, err := h.db.CountModelUsageSince(client.ID, model, today)
+	if err != nil {
+		return &completionError{Status: http.StatusInternalServerError, Message: "failed to check model quota"}
+	}
+	if used >= quota {
+		return &completionError{
+			Status:     http.StatusTooManyRequests,
+			Message:    fmt.Sprintf("daily quota of %d requests for model %s exhausted", quota, model),
+			RetryAfter: today.AddDate(0, 0, 1).Sub(now),
+		}
+	}
+	return nil
+}
+
+// reserveTokens charges the prompt's estimated tokens against the client's
+// tokens-per-minute limit, if any, before the CLI runs. Returns the tokens reserved.
+func (h *ChatHandler) reserveTokens(client *models.Client, prompt string) (int, *completionError) {
+	limit := client.TokenLimitPerMinute
+	if limit <= 0 {
+		return 0, nil
+	}
+
+	estimate := agents.EstimateTokens(prompt)
+	if estimate > limit {
+		return 0, &completionError{Status: http.StatusRequestEntityTooLarge, Message: fmt.Sprintf("prompt is about %d tokens, exceeds token limit of %d per minute", estimate, limit)}
+	}
+
+	windowStart := time.Now().Truncate(time.Minute)
+	ok, err := h.db.ReserveTokens(client.ID, windowStart, estimate, limit)
+	if err != nil {
+		return 0, &completionError{Status: http.StatusInternalServerError, Message: "failed to check token limit"}
+	}
+	if !ok {
+		h.notifier.Notify(webhook.Event{
+			Type:     webhook.EventRateLimitExceeded,
+			ClientID: client.ID,
+			Details: map[string]interface{}{
+				"client_name":            client.Name,
+				"token_limit_per_minute": limit,
+			},
+		})
+		return 0, &completionError{
+			Status:     http.StatusTooManyRequests,
+			Message:    "token rate limit exceeded",
+			RetryAfter: time.Until(windowStart.Add(time.Minute)),
+		}
+	}
+	return estimate, nil
+}
+
+// reconcileTokens corrects the reservation to the tokens the completion actually
+// used. The difference lands in the current window, which may be a later one.
+func (h *ChatHandler) reconcileTokens(client *models.Client, reserved, used int) {
+	if delta := used - reserved; delta != 0 {
+		h.db.AddTokenUsage(client.ID, time.Now().Truncate(time.Minute), delta)
+	}
+}
+
+// responseCacheKey derives a content address for a request from everything that
+// affects the CLI output
+func responseCacheKey(provider string, req agents.ExecuteRequest) string {
+	prompt := strings.TrimSpace(strings.ReplaceAll(req.Prompt, "\r\n", "\n"))
+
+	hash := sha256.New()
+	for _, part := range []string{
+		provider,
+		req.Model,
+		prompt,
+		strings.Join(req.AllowTools, ","),
+		strings.Join(req.DenyTools, ","),
+		strconv.FormatBool(req.Force),
+		strconv.FormatBool(req.AllowAllTools),
+		req.WorkingDirectory,
+		strconv.FormatBool(req.JSONOutput),
+		req.SessionID,
+		strings.Join(req.Stop, "\x00"),
+		req.BinaryPath,
+	} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
 
-	respondJSON(w, http.StatusOK, response)
+// cutAtStop returns content up to the earliest of the stop sequences, reporting
+// false when none occurs
+func cutAtStop(content string, stop []string) (string, bool) {
+	cut := -1
+	for _, sequence := range stop {
+		if i := strings.Index(content, sequence); i >= 0 && (cut < 0 || i < cut) {
+			cut = i
+		}
+	}
+	if cut < 0 {
+		return content, false
+	}
+	return content[:cut], true
+}
+
+// extractJSON returns content as JSON, unwrapping a markdown code fence the
+// model may have added despite instructions. Reports false if it doesn't parse.
+func extractJSON(content string) (string, bool) {
+	trimmed := strings.TrimSpace(content)
+	if fenced, ok := strings.CutPrefix(trimmed, "```"); ok {
+		fenced = strings.TrimPrefix(fenced, "json")
+		if body, ok := strings.CutSuffix(fenced, "```"); ok {
+			trimmed = strings.TrimSpace(body)
+		}
+	}
+	if !json.Valid([]byte(trimmed)) {
+		return "", false
+	}
+	return trimmed, true
+}
+
+// maxSessionIDLength bounds client-chosen conversation IDs
+const maxSessionIDLength = 128
+
+// historyToPrompt renders prior conversation turns as a transcript preceding the new prompt
+func historyToPrompt(history []models.ConversationMessage) string {
+	if len(history) == 0 {
+		return ""
+	}
+	prompt := "Previous conversation:\n"
+	for _, msg := range history {
+		prompt += msg.Role + ": " + msg.Content + "\n"
+	}
+	return prompt + "\n"
+}
+
+// loggedPrompt returns the prompt as a usage log should store it, following the
+// client's prompt logging mode or the server default. Requests left out of the
+// prompt sample store none.
+func (h *ChatHandler) loggedPrompt(client *models.Client, prompt string, sampled bool) *string {
+	if !sampled {
+		return nil
+	}
+	mode := client.PromptLogging
+	if mode == "" {
+		mode = h.cfg.Logging.Prompts
+	}
+	return redactPrompt(prompt, mode, h.cfg.Logging.PromptTruncateChars)
+}
+
+// redactPrompt applies a prompt logging mode: nil for none, a SHA-256 digest
+// for hash, the first limit characters for truncate, and the prompt otherwise
+func redactPrompt(prompt, mode string, limit int) *string {
+	switch mode {
+	case models.PromptLogNone:
+		return nil
+	case models.PromptLogHash:
+		sum := sha256.Sum256([]byte(prompt))
+		digest := "sha256:" + hex.EncodeToString(sum[:])
+		return &digest
+	case models.PromptLogTruncate:
+		if utf8.RuneCountInString(prompt) > limit {
+			truncated := string([]rune(prompt)[:limit]) + "..."
+			return &truncated
+		}
+	}
+	return &prompt
+}
+
+// systemPromptToPrompt formats a client's system prompt to lead the prompt
+func systemPromptToPrompt(systemPrompt string) string {
+	if systemPrompt == "" {
+		return ""
+	}
+	return "System instructions (these take precedence over everything below):\n" + systemPrompt + "\n\n"
 }
 
 // messagesToPrompt converts messages to a single prompt string
@@ -195,3 +1039,42 @@ func (h *ChatHandler) messagesToPrompt(messages []Message) string {
 	}
 	return prompt
 }
+
+// statusClientClosedRequest is the non-standard status (nginx's 499) recorded
+// when the caller disconnects before the CLI finishes
+const statusClientClosedRequest = 499
+
+// finishReason reports how a successful execution ended
+func finishReason(resp *agents.ExecuteResponse) string {
+	if resp.Truncated {
+		return finishReasonLength
+	}
+	return finishReasonStop
+}
+
+// errorFinishReason reports how a failed execution ended, by its response status
+func errorFinishReason(status int) string {
+	if status == http.StatusGatewayTimeout {
+		return finishReasonTimeout
+	}
+	return finishReasonError
+}
+
+// executeErrorStatus maps a provider error to a response status and message,
+// separating cancellations and timeouts from genuine CLI failures
+func executeErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest, "request cancelled"
+	case errors.Is(err, agents.ErrExecTimeout), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "CLI execution timed out"
+	case errors.Is(err, agents.ErrProviderUnavailable):
+		return http.StatusServiceUnavailable, "provider CLI is not available"
+	case errors.Is(err, agents.ErrPromptTooLarge):
+		return http.StatusRequestEntityTooLarge, "prompt too large for the CLI"
+	case errors.Is(err, agents.ErrModelNotFound):
+		return http.StatusBadRequest, "model rejected by the CLI"
+	default:
+		return http.StatusInternalServerError, "CLI execution failed"
+	}
+}
@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/agents/copilot"
+	"github.com/andrew/ai-cli-server/internal/agents/cursor"
+	"github.com/andrew/ai-cli-server/internal/agents/mock"
+	"github.com/andrew/ai-cli-server/internal/config"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+func TestExecutionErrorStatuses(t *testing.T) {
+	cfg := testConfig(t, "")
+	db := testDB(t)
+	client := testClient(t, db, func(c *models.Client) { c.Provider = "cursor" })
+
+	tests := []struct {
+		name       string
+		script     string
+		timeout    time.Duration // The provider's timeout
+		cancel     time.Duration // Cancels the request this long after it starts, when set
+		wantStatus int
+	}{
+		{"caller cancels mid-execution", "sleep 5", time.Minute, 200 * time.Millisecond, statusClientClosedRequest},
+		{"CLI times out", "sleep 5", 200 * time.Millisecond, 0, http.StatusGatewayTimeout},
+		{"CLI fails", "echo boom >&2; exit 1", time.Minute, 0, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := cursor.NewProvider(config.CursorConfig{BinaryPath: fakeCLI(t, tt.script), Timeout: tt.timeout}, "")
+			h := testChatHandler(cfg, db, provider)
+
+			ctx := context.Background()
+			if tt.cancel > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithCancel(ctx)
+				timer := time.AfterFunc(tt.cancel, cancel)
+				defer timer.Stop()
+			}
+
+			started := time.Now()
+			_, cerr := h.complete(ctx, client, ChatCompletionRequest{Model: "sonnet-4", Messages: userMessage(tt.name)})
+			if cerr == nil || cerr.Status != tt.wantStatus {
+				t.Fatalf("complete() error = %v, want status %d", cerr, tt.wantStatus)
+			}
+			if elapsed := time.Since(started); elapsed > 4*time.Second {
+				t.Errorf("complete() took %v, want the CLI killed promptly", elapsed)
+			}
+
+			logs, err := db.GetUsageLogs(client.ID, 1, 0, nil, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(logs) == 0 || logs[0].ResponseStatus != tt.wantStatus {
+				t.Errorf("usage log = %+v, want status %d", logs, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// nativeJSONProvider is the mock provider claiming native JSON output
+type nativeJSONProvider struct {
+	*mock.Provider
+}
+
+// SupportsJSONOutput implements agents.JSONResponder
+func (nativeJSONProvider) SupportsJSONOutput() bool {
+	return true
+}
+
+func TestJSONResponseFormat(t *testing.T) {
+	cfg := testConfig(t, "")
+	db := testDB(t)
+	client := testClient(t, db, nil)
+
+	tests := []struct {
+		name        string
+		provider    agents.Provider
+		wantStatus  int
+		wantContent string
+		wantMode    string
+	}{
+		{"valid JSON via the prompt", mock.NewProvider(config.MockConfig{Response: `{"answer": 42}`}), http.StatusOK, `{"answer": 42}`, jsonModePrompt},
+		{"fenced JSON is unwrapped", mock.NewProvider(config.MockConfig{Response: "```json\n{\"answer\": 42}\n```"}), http.StatusOK, `{"answer": 42}`, jsonModePrompt},
+		{"valid JSON natively", nativeJSONProvider{mock.NewProvider(config.MockConfig{Response: `{"answer": 42}`})}, http.StatusOK, `{"answer": 42}`, jsonModeNative},
+		{"invalid JSON", mock.NewProvider(config.MockConfig{Response: "The answer is 42."}), http.StatusBadGateway, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := testChatHandler(cfg, db, tt.provider)
+			resp, cerr := h.complete(context.Background(), client, ChatCompletionRequest{
+				Model:          mock.Model,
+				Messages:       userMessage(tt.name),
+				ResponseFormat: &ResponseFormat{Type: "json_object"},
+			})
+			if tt.wantStatus != http.StatusOK {
+				if cerr == nil || cerr.Status != tt.wantStatus {
+					t.Fatalf("complete() error = %v, want status %d", cerr, tt.wantStatus)
+				}
+				return
+			}
+			if cerr != nil {
+				t.Fatalf("complete() error = %s", cerr.Message)
+			}
+			completion := resp.(*ChatCompletionResponse)
+			if completion.Content != tt.wantContent || completion.JSONMode != tt.wantMode {
+				t.Errorf("content %q, json_mode %q; want %q, %q", completion.Content, completion.JSONMode, tt.wantContent, tt.wantMode)
+			}
+
+			// Only providers without native JSON output are instructed through the prompt
+			logs, err := db.GetUsageLogs(client.ID, 1, 0, nil, nil, nil)
+			if err != nil || len(logs) != 1 || logs[0].Prompt == nil {
+				t.Fatalf("GetUsageLogs() = %v, %v; want the logged prompt", logs, err)
+			}
+			if instructed := strings.Contains(*logs[0].Prompt, jsonInstruction); instructed != (tt.wantMode == jsonModePrompt) {
+				t.Errorf("prompt %q has the JSON instruction: %v, want %v", *logs[0].Prompt, instructed, !instructed)
+			}
+		})
+	}
+}
+
+func TestOversizedOutputIsTruncated(t *testing.T) {
+	cfg := testConfig(t, "limits:\n  max_response_bytes: 1000\n")
+	db := testDB(t)
+	provider := copilot.NewProvider(config.CopilotConfig{BinaryPath: fakeCLI(t, "exec yes abc")}, "")
+	h := testChatHandler(cfg, db, provider)
+	client := testClient(t, db, func(c *models.Client) { c.Provider = "copilot" })
+
+	resp, cerr := h.complete(context.Background(), client, ChatCompletionRequest{Model: "gpt-5", Messages: userMessage("say abc forever")})
+	if cerr != nil {
+		t.Fatalf("complete() error = %s", cerr.Message)
+	}
+	completion := resp.(*ChatCompletionResponse)
+	if !completion.Truncated || len(completion.Content) != 1000 {
+		t.Errorf("got %d bytes, truncated %v; want 1000, truncated", len(completion.Content), completion.Truncated)
+	}
+	if completion.CompletionTokens != agents.EstimateTokens(completion.Content) {
+		t.Errorf("completion_tokens = %d, want the estimate for the content returned", completion.CompletionTokens)
+	}
+}
+
+func TestFinishReason(t *testing.T) {
+	cfg := testConfig(t, "limits:\n  max_response_bytes: 10\n")
+	db := testDB(t)
+	mockClient := testClient(t, db, nil)
+	cursorClient := testClient(t, db, func(c *models.Client) { c.Name += "-cursor"; c.Provider = "cursor" })
+
+	tests := []struct {
+		name     string
+		provider agents.Provider
+		client   *models.Client
+		model    string
+		want     string
+	}{
+		{"clean completion", mock.NewProvider(config.MockConfig{Response: "done"}), mockClient, mock.Model, finishReasonStop},
+		{"truncated output", mock.NewProvider(config.MockConfig{Response: strings.Repeat("x", 50)}), mockClient, mock.Model, finishReasonLength},
+		{"timeout", cursor.NewProvider(config.CursorConfig{BinaryPath: fakeCLI(t, "exec sleep 5"), Timeout: 100 * time.Millisecond}, ""), cursorClient, "sonnet-4", finishReasonTimeout},
+		{"CLI failure", cursor.NewProvider(config.CursorConfig{BinaryPath: fakeCLI(t, "exit 1")}, ""), cursorClient, "sonnet-4", finishReasonError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := testChatHandler(cfg, db, tt.provider)
+			resp, cerr := h.complete(context.Background(), tt.client, ChatCompletionRequest{Model: tt.model, Messages: userMessage(tt.name)})
+			// Failures have no completion, so their reason rides on the error
+			var got string
+			if cerr != nil {
+				got = cerr.FinishReason
+			} else {
+				got = resp.(*ChatCompletionResponse).FinishReason
+			}
+			if got != tt.want {
+				t.Errorf("finish_reason = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFinishReasonInErrorResponse(t *testing.T) {
+	cfg := testConfig(t, "")
+	db := testDB(t)
+	client := testClient(t, db, func(c *models.Client) { c.Provider = "cursor" })
+	provider := cursor.NewProvider(config.CursorConfig{BinaryPath: fakeCLI(t, "exec sleep 5"), Timeout: 100 * time.Millisecond}, "")
+	h := testChatHandler(cfg, db, provider)
+
+	rec := httptest.NewRecorder()
+	body := `{"model":"sonnet-4","messages":[{"role":"user","content":"hi"}]}`
+	withClient(client, h.HandleChatCompletion).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", rec.Code)
+	}
+	var resp struct {
+		Error struct {
+			Type         string `json:"type"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error.FinishReason != finishReasonTimeout || resp.Error.Type != "server_error" {
+		t.Errorf("error = %+v, want a server_error with finish_reason %q", resp.Error, finishReasonTimeout)
+	}
+}
+
+func TestSlowCompletionOutlastsWriteTimeout(t *testing.T) {
+	cfg := testConfig(t, "server:\n  write_timeout: 100ms\ncli:\n  mock:\n    latency: 300ms\n")
+	db := testDB(t)
+	client := testClient(t, db, nil)
+	h := testChatHandler(cfg, db, mock.NewProvider(cfg.CLI.Mock))
+
+	server := httptest.NewUnstartedServer(withClient(client, h.HandleChatCompletion))
+	server.Config.WriteTimeout = cfg.Server.WriteTimeout
+	server.Start()
+	defer server.Close()
+
+	body := `{"model":"mock-model","messages":[{"role":"user","content":"take your time"}]}`
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed after the write timeout: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestExecuteErrorStatus(t *testing.T) {
+	tests := []struct {
+		reason error
+		want   int
+	}{
+		{agents.ErrProviderUnavailable, http.StatusServiceUnavailable},
+		{agents.ErrModelNotFound, http.StatusBadRequest},
+		{agents.ErrPromptTooLarge, http.StatusRequestEntityTooLarge},
+		{agents.ErrExecTimeout, http.StatusGatewayTimeout},
+		{agents.ErrExecFailed, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		err := &agents.ExecError{Provider: "cursor", Reason: tt.reason, ExitCode: 1}
+		if got, _ := executeErrorStatus(err); got != tt.want {
+			t.Errorf("executeErrorStatus(%v) = %d, want %d", tt.reason, got, tt.want)
+		}
+	}
+}
+
+func TestRequestMetadata(t *testing.T) {
+	cfg := testConfig(t, "")
+	db := testDB(t)
+	client := testClient(t, db, nil)
+	h := testChatHandler(cfg, db, mock.NewProvider(config.MockConfig{}))
+
+	_, cerr := h.complete(context.Background(), client, ChatCompletionRequest{
+		Model:    mock.Model,
+		Messages: userMessage("hi"),
+		Metadata: map[string]string{"project": "search"},
+	})
+	if cerr != nil {
+		t.Fatalf("complete() error = %s", cerr.Message)
+	}
+	logs, err := db.GetUsageLogs(client.ID, 1, 0, nil, nil, nil)
+	if err != nil || len(logs) != 1 || logs[0].Metadata["project"] != "search" {
+		t.Fatalf("GetUsageLogs() = %+v, %v; want one log tagged project=search", logs, err)
+	}
+
+	_, cerr = h.complete(context.Background(), client, ChatCompletionRequest{
+		Model:    mock.Model,
+		Messages: userMessage("hi"),
+		Metadata: map[string]string{"bad key": "x"},
+	})
+	if cerr == nil || cerr.Status != http.StatusBadRequest {
+		t.Errorf("complete() with an invalid metadata key error = %v, want status %d", cerr, http.StatusBadRequest)
+	}
+}
+
+func TestStopSequences(t *testing.T) {
+	cfg := testConfig(t, "limits:\n  max_response_bytes: 20\n")
+	db := testDB(t)
+	mockClient := testClient(t, db, nil)
+	copilotClient := testClient(t, db, func(c *models.Client) { c.Name += "-copilot"; c.Provider = "copilot" })
+
+	// The mock has no stop flag, so its output is cut at the first sequence,
+	// even one that only appears before the size limit cut the rest
+	h := testChatHandler(cfg, db, mock.NewProvider(config.MockConfig{Response: "one END two STOP" + strings.Repeat("x", 50)}))
+	resp, cerr := h.complete(context.Background(), mockClient, ChatCompletionRequest{Model: mock.Model, Messages: userMessage("hi"), Stop: StopSequences{"STOP", "END"}})
+	if cerr != nil {
+		t.Fatalf("complete() error = %s", cerr.Message)
+	}
+	completion := resp.(*ChatCompletionResponse)
+	if completion.Content != "one " || completion.FinishReason != finishReasonStop || completion.Truncated {
+		t.Errorf("content %q, finish_reason %q, truncated %v; want %q cut at END", completion.Content, completion.FinishReason, completion.Truncated, "one ")
+	}
+
+	// An args template with {stop} hands the sequences to the CLI, which echoes them back uncut
+	provider := copilot.NewProvider(config.CopilotConfig{
+		BinaryPath: fakeCLI(t, `printf '%s\n' "$@"`),
+		Args:       []string{"-p {prompt}", "--stop {stop}"},
+	}, "")
+	h = testChatHandler(cfg, db, provider)
+	resp, cerr = h.complete(context.Background(), copilotClient, ChatCompletionRequest{Model: "gpt-5", Messages: userMessage("hi"), Stop: StopSequences{"hi"}})
+	if cerr != nil {
+		t.Fatalf("complete() error = %s", cerr.Message)
+	}
+	if got := resp.(*ChatCompletionResponse).Content; !strings.Contains(got, "--stop\nhi") {
+		t.Errorf("content = %q, want the CLI's arguments, --stop hi included", got)
+	}
+
+	_, cerr = h.complete(context.Background(), copilotClient, ChatCompletionRequest{Model: "gpt-5", Messages: userMessage("hi"), Stop: StopSequences{""}})
+	if cerr == nil || cerr.Status != http.StatusBadRequest {
+		t.Errorf("complete() with an empty stop sequence error = %v, want status %d", cerr, http.StatusBadRequest)
+	}
+}
+
+func TestStopSequencesAcceptString(t *testing.T) {
+	var req ChatCompletionRequest
+	if err := json.Unmarshal([]byte(`{"stop": "\n"}`), &req); err != nil || !slices.Equal(req.Stop, []string{"\n"}) {
+		t.Errorf("stop = %q, %v; want a single sequence", req.Stop, err)
+	}
+	if err := json.Unmarshal([]byte(`{"stop": ["a", "b"]}`), &req); err != nil || !slices.Equal(req.Stop, []string{"a", "b"}) {
+		t.Errorf("stop = %q, %v; want both sequences", req.Stop, err)
+	}
+}
+
+func TestIncludeRaw(t *testing.T) {
+	cfg := testConfig(t, "")
+	db := testDB(t)
+	// A tool event and the result on stdout, a warning on stderr
+	stdout := `{"type":"tool_call","name":"shell"}` + "\n" + `{"type":"result","result":"done"}`
+	provider := cursor.NewProvider(config.CursorConfig{BinaryPath: fakeCLI(t, "echo '"+stdout+"'; echo warning >&2")}, "")
+	h := testChatHandler(cfg, db, provider)
+	permitted := testClient(t, db, func(c *models.Client) {
+		c.Provider = "cursor"
+		c.Scopes = `["chat", "raw_output"]`
+	})
+	denied := testClient(t, db, func(c *models.Client) { c.Name += "-denied"; c.Provider = "cursor" })
+
+	complete := func(client *models.Client, includeRaw bool) (*ChatCompletionResponse, *completionError) {
+		t.Helper()
+		resp, cerr := h.complete(context.Background(), client, ChatCompletionRequest{Model: "sonnet-4", Messages: userMessage("hi"), IncludeRaw: includeRaw})
+		if cerr != nil {
+			return nil, cerr
+		}
+		return resp.(*ChatCompletionResponse), nil
+	}
+
+	resp, cerr := complete(permitted, true)
+	if cerr != nil {
+		t.Fatalf("complete() error = %s", cerr.Message)
+	}
+	if resp.Content != "done" || resp.RawOutput == nil || resp.RawOutput.Stdout != stdout+"\n" || resp.RawOutput.Stderr != "warning\n" {
+		t.Errorf("content %q, raw_output %+v; want the parsed result and the CLI's full output", resp.Content, resp.RawOutput)
+	}
+
+	// Not asked for, no raw output
+	if resp, cerr = complete(permitted, false); cerr != nil || resp.RawOutput != nil {
+		t.Errorf("complete() without include_raw = %+v, %v; want no raw_output", resp, cerr)
+	}
+
+	// Without the scope, asking is refused
+	if _, cerr = complete(denied, true); cerr == nil || cerr.Status != http.StatusForbidden {
+		t.Errorf("complete() without the raw_output scope error = %v, want status %d", cerr, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/api/middleware"
+	"github.com/andrew/ai-cli-server/internal/database"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+// EmbeddingsRequest represents an incoming embeddings request.
+// Input accepts either a single string or an array of strings.
+type EmbeddingsRequest struct {
+	Model string          `json:"model"`
+	Input json.RawMessage `json:"input"`
+}
+
+// Embedding represents a single OpenAI-style embedding object
+type Embedding struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// EmbeddingsUsage represents token usage for an embeddings request
+type EmbeddingsUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// EmbeddingsResponse represents an OpenAI-style embeddings list
+type EmbeddingsResponse struct {
+	Object   string          `json:"object"`
+	Data     []Embedding     `json:"data"`
+	Provider string          `json:"provider"`
+	Model    string          `json:"model"`
+	Usage    EmbeddingsUsage `json:"usage"`
+}
+
+// embeddingsProviderSuffix keeps embeddings usage distinct from chat usage in stats
+const embeddingsProviderSuffix = ":embeddings"
+
+// HandleEmbeddings handles POST /v1/embeddings. It is a stub until a provider
+// implements agents.Embedder; until then it answers 501.
+func (h *ChatHandler) HandleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	client := middleware.GetClientFromContext(r.Context())
+	if client == nil {
+		respondError(w, r, http.StatusInternalServerError, "client not found in context")
+		return
+	}
+
+	// Parse request
+	var req EmbeddingsRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	texts, err := parseEmbeddingsInput(req.Input)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Get provider
+	provider, ok := h.providers[client.Provider]
+	if !ok {
+		respondError(w, r, http.StatusBadRequest, fmt.Sprintf("unknown provider: %s", client.Provider))
+		return
+	}
+
+	// Check the provider CLI can emit embeddings at all
+	embedder, ok := provider.(agents.Embedder)
+	if !ok {
+		respondError(w, r, http.StatusNotImplemented, fmt.Sprintf("provider %s does not support embeddings", client.Provider))
+		return
+	}
+
+	if !provider.IsAvailable() {
+		respondError(w, r, http.StatusServiceUnavailable, fmt.Sprintf("provider %s is not available", client.Provider))
+		return
+	}
+
+	// Use client default model if not specified
+	if req.Model == "" {
+		req.Model = client.DefaultModel
+	}
+	if req.Model != "" && !database.IsModelAllowed(client, req.Model) {
+		respondError(w, r, http.StatusForbidden, fmt.Sprintf("model %s is not allowed for this client", req.Model))
+		return
+	}
+	if slices.Contains(h.cfg.CLI.DisabledModels, req.Model) {
+		respondError(w, r, http.StatusServiceUnavailable, fmt.Sprintf("model %s is disabled on this server", req.Model))
+		return
+	}
+
+	promptTokens := 0
+	for _, text := range texts {
+		promptTokens += agents.EstimateTokens(text)
+	}
+
+	if cerr := h.checkBudget(client); cerr != nil {
+		respondCompletionError(w, r, cerr)
+		return
+	}
+	if cerr := h.checkModelQuota(client, req.Model); cerr != nil {
+		respondCompletionError(w, r, cerr)
+		return
+	}
+	release, cerr := h.acquireExecution(r.Context())
+	if cerr != nil {
+		respondCompletionError(w, r, cerr)
+		return
+	}
+	defer release()
+
+	// Execute embeddings request
+	startTime := time.Now()
+	vectors, err := embedder.Embed(r.Context(), texts)
+	usageLog := &models.UsageLog{
+		ClientID:       client.ID,
+		Timestamp:      time.Now(),
+		Provider:       client.Provider + embeddingsProviderSuffix,
+		Model:          req.Model,
+		PromptTokens:   promptTokens,
+		TotalTokens:    promptTokens,
+		ResponseStatus: http.StatusOK,
+		ResponseTimeMs: int(time.Since(startTime).Milliseconds()),
+		RequestBytes:   middleware.RequestBytes(r.Context()),
+	}
+	if err != nil {
+		errorMsg := err.Error()
+		usageLog.ResponseStatus = http.StatusInternalServerError
+		usageLog.ErrorMessage = &errorMsg
+		h.db.CreateUsageLog(usageLog)
+
+		respondError(w, r, http.StatusInternalServerError, fmt.Sprintf("embeddings execution failed: %v", err))
+		return
+	}
+	h.db.CreateUsageLog(usageLog)
+
+	data := make([]Embedding, len(vectors))
+	for i, vector := range vectors {
+		data[i] = Embedding{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: vector,
+		}
+	}
+
+	respondJSON(w, http.StatusOK, EmbeddingsResponse{
+		Object:   "list",
+		Data:     data,
+		Provider: client.Provider,
+		Model:    req.Model,
+		Usage: EmbeddingsUsage{
+			PromptTokens: promptTokens,
+			TotalTokens:  promptTokens,
+		},
+	})
+}
+
+// parseEmbeddingsInput accepts either a string or an array of strings
+func parseEmbeddingsInput(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("input is required")
+	}
+
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return []string{single}, nil
+	}
+
+	var texts []string
+	if err := json.Unmarshal(raw, &texts); err != nil {
+		return nil, fmt.Errorf("input must be a string or an array of strings")
+	}
+	if len(texts) == 0 {
+		return nil, fmt.Errorf("input is required")
+	}
+	return texts, nil
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/agents/copilot"
+	"github.com/andrew/ai-cli-server/internal/agents/cursor"
+	"github.com/andrew/ai-cli-server/internal/agents/mock"
+	"github.com/andrew/ai-cli-server/internal/api/middleware"
+	"github.com/andrew/ai-cli-server/internal/config"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+func TestEmbeddingsNotImplemented(t *testing.T) {
+	cfg := testConfig(t, "")
+	db := testDB(t)
+	// No provider can emit embeddings yet, so the route is a stub for all of them
+	providers := []agents.Provider{
+		mock.NewProvider(config.MockConfig{}),
+		copilot.NewProvider(config.CopilotConfig{}, ""),
+		cursor.NewProvider(config.CursorConfig{}, ""),
+	}
+	h := testChatHandler(cfg, db, providers...)
+
+	for _, provider := range providers {
+		t.Run(provider.Name(), func(t *testing.T) {
+			client := testClient(t, db, func(c *models.Client) { c.Provider = provider.Name() })
+			rec := httptest.NewRecorder()
+			body := `{"input":["first text","second text"]}`
+			withClient(client, h.HandleEmbeddings).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader(body)))
+			if rec.Code != http.StatusNotImplemented {
+				t.Fatalf("status = %d, want 501: %s", rec.Code, rec.Body)
+			}
+
+			var resp struct {
+				Error middleware.OpenAIError `json:"error"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			wantMessage := "provider " + provider.Name() + " does not support embeddings"
+			if resp.Error.Message != wantMessage || resp.Error.Type != "invalid_request_error" || resp.Error.Code == nil || *resp.Error.Code != "unsupported" {
+				t.Errorf("error = %+v, want %q with type invalid_request_error and code unsupported", resp.Error, wantMessage)
+			}
+			if count, _ := db.CountUsageLogs(client.ID, nil, nil, nil); count != 0 {
+				t.Errorf("usage logs = %d, want none for a request that never ran", count)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/api/middleware"
+	"github.com/andrew/ai-cli-server/internal/database"
+)
+
+// EstimateRequest is a chat completion to estimate the size and cost of
+type EstimateRequest struct {
+	Model            string    `json:"model,omitempty"` // Empty resolves as for a completion
+	Messages         []Message `json:"messages"`
+	CompletionTokens *int      `json:"completion_tokens,omitempty"` // Assumed completion length; unset uses cli.estimate_completion_tokens
+}
+
+// EstimateResponse is an estimate of a completion's tokens and cost. Prompt
+// tokens are counted like a completion's estimated usage; completion tokens
+// are the assumption.
+type EstimateResponse struct {
+	Provider         string               `json:"provider"`
+	Model            string               `json:"model"`
+	PromptTokens     int                  `json:"prompt_tokens"`
+	CompletionTokens int                  `json:"completion_tokens"`
+	TotalTokens      int                  `json:"total_tokens"`
+	Cost             *float64             `json:"cost"`              // USD; null when the model catalog has no pricing for it
+	Pricing          *agents.ModelPricing `json:"pricing,omitempty"` // The catalog pricing the cost was computed with
+}
+
+// HandleEstimate handles POST /v1/estimate. It builds the prompt a completion
+// would send and estimates its tokens and cost, without running the CLI or
+// recording usage.
+func (h *ChatHandler) HandleEstimate(w http.ResponseWriter, r *http.Request) {
+	client := middleware.GetClientFromContext(r.Context())
+	if client == nil {
+		respondError(w, r, http.StatusInternalServerError, "client not found in context")
+		return
+	}
+
+	var req EstimateRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	model := h.resolveModel(client, req.Model)
+	if model == "" {
+		respondError(w, r, http.StatusBadRequest, "model is required (no default configured)")
+		return
+	}
+	if !database.IsModelAllowed(client, model) {
+		respondError(w, r, http.StatusForbidden, fmt.Sprintf("model %s is not allowed for this client", model))
+		return
+	}
+	completionTokens := *h.cfg.CLI.EstimateCompletionTokens
+	if req.CompletionTokens != nil {
+		if *req.CompletionTokens < 0 {
+			respondError(w, r, http.StatusBadRequest, "completion_tokens must not be negative")
+			return
+		}
+		completionTokens = *req.CompletionTokens
+	}
+
+	prompt := systemPromptToPrompt(client.SystemPrompt) + h.messagesToPrompt(req.Messages)
+	resp := EstimateResponse{
+		Provider:         client.Provider,
+		Model:            model,
+		PromptTokens:     agents.EstimateTokens(prompt),
+		CompletionTokens: completionTokens,
+	}
+	resp.TotalTokens = resp.PromptTokens + resp.CompletionTokens
+	if pricing := agents.CatalogPricing(h.cfg.CLI.ModelCatalog, client.Provider, model); pricing != nil {
+		cost := pricing.Cost(resp.PromptTokens, resp.CompletionTokens)
+		resp.Cost, resp.Pricing = &cost, pricing
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/agents/mock"
+	"github.com/andrew/ai-cli-server/internal/config"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+func TestEstimate(t *testing.T) {
+	cfg := testConfig(t, `
+cli:
+  estimate_completion_tokens: 200
+  model_catalog:
+    - name: `+mock.Model+`
+      input_price: 3
+      output_price: 15
+`)
+	db := testDB(t)
+	provider := mock.NewProvider(config.MockConfig{})
+	agents.ApplyModelCatalog([]agents.Provider{provider}, cfg.CLI.ModelCatalog)
+	h := testChatHandler(cfg, db, provider)
+	client := testClient(t, db, func(c *models.Client) { c.SystemPrompt = "Answer in French." })
+
+	estimate := func(body string) (int, EstimateResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		withClient(client, h.HandleEstimate).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/estimate", strings.NewReader(body)))
+		var resp EstimateResponse
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rec.Code, resp
+	}
+
+	// Prompt tokens are the tokenizer's count of the prompt a completion would send
+	content := strings.Repeat("How many tokens is this? ", 40)
+	status, resp := estimate(`{"model":"` + mock.Model + `","messages":[{"role":"user","content":"` + content + `"}]}`)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+	wantPrompt := agents.EstimateTokens(systemPromptToPrompt(client.SystemPrompt) + h.messagesToPrompt(userMessage(content)))
+	if resp.PromptTokens != wantPrompt || resp.CompletionTokens != 200 || resp.TotalTokens != wantPrompt+200 {
+		t.Errorf("tokens = %d + %d = %d, want %d + 200", resp.PromptTokens, resp.CompletionTokens, resp.TotalTokens, wantPrompt)
+	}
+	wantCost := (float64(wantPrompt)*3 + 200*15) / 1e6
+	if resp.Cost == nil || *resp.Cost != wantCost {
+		t.Errorf("cost = %v, want %v", resp.Cost, wantCost)
+	}
+
+	// The request can give its own completion length, and the model defaults
+	// as it would for a completion
+	status, resp = estimate(`{"messages":[{"role":"user","content":"hi"}],"completion_tokens":0}`)
+	if status != http.StatusOK || resp.Model != mock.Model || resp.CompletionTokens != 0 {
+		t.Errorf("estimate() = %d, %+v; want the default model and no completion tokens", status, resp)
+	}
+	if status, _ := estimate(`{"model":"other","messages":[]}`); status != http.StatusOK {
+		t.Errorf("status for a model without pricing = %d, want 200", status)
+	}
+
+	// Nothing runs, so nothing is logged
+	if count, err := db.CountUsageLogs(client.ID, nil, nil, nil); err != nil || count != 0 {
+		t.Errorf("CountUsageLogs() = %d, %v; want 0", count, err)
+	}
+}
+
+func TestEstimateWithoutPricing(t *testing.T) {
+	cfg := testConfig(t, "")
+	db := testDB(t)
+	h := testChatHandler(cfg, db, mock.NewProvider(config.MockConfig{}))
+	client := testClient(t, db, func(c *models.Client) { c.AllowedModels = `["other"]` })
+
+	rec := httptest.NewRecorder()
+	body := `{"model":"other","messages":[{"role":"user","content":"hi"}]}`
+	withClient(client, h.HandleEstimate).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/estimate", strings.NewReader(body)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"cost":null`) || !strings.Contains(rec.Body.String(), `"completion_tokens":500`) {
+		t.Errorf("response = %d %s, want a null cost and the default 500 completion tokens", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	body = `{"model":"` + mock.Model + `","messages":[]}`
+	withClient(client, h.HandleEstimate).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/estimate", strings.NewReader(body)))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status for a model the client isn't allowed = %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/andrew/ai-cli-server/internal/agents/copilot"
+	"github.com/andrew/ai-cli-server/internal/agents/cursor"
+	"github.com/andrew/ai-cli-server/internal/agents/mock"
+	"github.com/andrew/ai-cli-server/internal/config"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+func TestFallbackServesWhenPrimaryIsDown(t *testing.T) {
+	cfg := testConfig(t, `
+cli:
+  fallbacks:
+    - provider: copilot
+      model: gpt-*
+      to_provider: mock
+      to_model: `+mock.Model+`
+`)
+	db := testDB(t)
+	down := copilot.NewProvider(config.CopilotConfig{BinaryPath: "/nonexistent/copilot"}, "")
+	h := testChatHandler(cfg, db, down, mock.NewProvider(config.MockConfig{}))
+	client := testClient(t, db, func(c *models.Client) { c.Provider = "copilot" })
+
+	resp, cerr := h.complete(context.Background(), client, ChatCompletionRequest{Model: "gpt-5", Messages: userMessage("hi")})
+	if cerr != nil {
+		t.Fatalf("complete() error = %s", cerr.Message)
+	}
+	completion := resp.(*ChatCompletionResponse)
+	if completion.Provider != "mock" || completion.Model != mock.Model {
+		t.Errorf("served by %s/%s, want mock/%s", completion.Provider, completion.Model, mock.Model)
+	}
+	if got := completion.Metadata["fallback_from"]; got != "copilot/gpt-5" {
+		t.Errorf("metadata fallback_from = %v, want copilot/gpt-5", got)
+	}
+
+	logs, err := db.GetUsageLogs(client.ID, 1, 0, nil, nil, nil)
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("GetUsageLogs() = %v, %v; want one log", logs, err)
+	}
+	if logs[0].FallbackFrom == nil || *logs[0].FallbackFrom != "copilot/gpt-5" || logs[0].Provider != "mock" {
+		t.Errorf("usage log provider %s, fallback_from %v; want mock from copilot/gpt-5", logs[0].Provider, logs[0].FallbackFrom)
+	}
+
+	// A model no rule matches still fails
+	if _, cerr := h.complete(context.Background(), client, ChatCompletionRequest{Model: "claude-sonnet-4", Messages: userMessage("hi")}); cerr == nil || cerr.Status != http.StatusServiceUnavailable {
+		t.Errorf("complete() error = %v, want 503 without a matching fallback", cerr)
+	}
+}
+
+func TestFallbackFollowsProviderPriority(t *testing.T) {
+	cfg := testConfig(t, `
+cli:
+  provider_priority: [copilot, mock, cursor]
+  fallbacks:
+    - provider: cursor
+`)
+	db := testDB(t)
+	copilotDown := copilot.NewProvider(config.CopilotConfig{BinaryPath: "/nonexistent/copilot"}, "")
+	cursorDown := cursor.NewProvider(config.CursorConfig{BinaryPath: "/nonexistent/cursor-agent"}, "")
+	h := testChatHandler(cfg, db, copilotDown, cursorDown, mock.NewProvider(config.MockConfig{}))
+	client := testClient(t, db, func(c *models.Client) { c.Provider = "cursor" })
+
+	// copilot ranks first but is down too, so the rule without a to_provider picks mock
+	resp, cerr := h.complete(context.Background(), client, ChatCompletionRequest{Model: mock.Model, Messages: userMessage("hi")})
+	if cerr != nil {
+		t.Fatalf("complete() error = %s", cerr.Message)
+	}
+	if got := resp.(*ChatCompletionResponse).Provider; got != "mock" {
+		t.Errorf("served by %s, want mock", got)
+	}
+}
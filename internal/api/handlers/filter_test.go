@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/andrew/ai-cli-server/internal/agents/mock"
+	"github.com/andrew/ai-cli-server/internal/config"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+func TestContentFilterBlocksPrompts(t *testing.T) {
+	cfg := testConfig(t, "content_filter:\n  rules:\n    - name: secret\n      keyword: \"top secret\"\n")
+	db := testDB(t)
+	h := testChatHandler(cfg, db, mock.NewProvider(config.MockConfig{}))
+	client := testClient(t, db, nil)
+	exempt := testClient(t, db, func(c *models.Client) { c.Name += "-exempt"; c.SkipContentFilter = true })
+
+	blocked := ChatCompletionRequest{Model: mock.Model, Messages: userMessage("share the TOP SECRET plans")}
+	_, cerr := h.complete(context.Background(), client, blocked)
+	if cerr == nil || cerr.Status != http.StatusUnprocessableEntity || !strings.Contains(cerr.Message, "secret") {
+		t.Fatalf("complete() error = %v, want 422 naming the rule", cerr)
+	}
+	logs, err := db.GetUsageLogs(client.ID, 10, 0, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].ResponseStatus != http.StatusUnprocessableEntity || logs[0].ErrorMessage == nil || logs[0].Prompt != nil {
+		t.Errorf("usage logs = %+v, want one 422 with an error and no prompt", logs)
+	}
+
+	if _, cerr := h.complete(context.Background(), client, ChatCompletionRequest{Model: mock.Model, Messages: userMessage("share the plans")}); cerr != nil {
+		t.Errorf("clean prompt failed: %s", cerr.Message)
+	}
+	if _, cerr := h.complete(context.Background(), exempt, blocked); cerr != nil {
+		t.Errorf("exempt client's prompt failed: %s", cerr.Message)
+	}
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+)
+
+// HealthHandler handles readiness probes
+type HealthHandler struct {
+	providers []agents.Provider
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler(providers ...agents.Provider) *HealthHandler {
+	return &HealthHandler{providers: providers}
+}
+
+// ProviderStatus represents the readiness of a single provider
+type ProviderStatus struct {
+	Name      string `json:"name"`
+	Available bool   `json:"available"`
+	Version   string `json:"version,omitempty"` // Installed CLI version, for available CLI providers
+}
+
+// ReadinessResponse represents the readiness probe response
+type ReadinessResponse struct {
+	Status    string           `json:"status"`
+	Providers []ProviderStatus `json:"providers"`
+}
+
+// HandleReady handles GET /health/ready
+// Returns 503 when no provider CLI is usable
+func (h *HealthHandler) HandleReady(w http.ResponseWriter, r *http.Request) {
+	response := ReadinessResponse{
+		Status:    "ready",
+		Providers: make([]ProviderStatus, 0, len(h.providers)),
+	}
+
+	anyAvailable := false
+	for _, provider := range h.providers {
+		available := provider.IsAvailable()
+		if available {
+			anyAvailable = true
+		}
+		response.Providers = append(response.Providers, ProviderStatus{
+			Name:      provider.Name(),
+			Available: available,
+			Version:   providerVersion(provider, available),
+		})
+	}
+
+	status := http.StatusOK
+	if !anyAvailable {
+		response.Status = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+
+	respondJSON(w, status, response)
+}
+
+// providerVersion returns an available provider's CLI version, or "" for
+// providers that aren't available or don't run a CLI
+func providerVersion(provider agents.Provider, available bool) string {
+	versioner, ok := provider.(agents.Versioner)
+	if !available || !ok {
+		return ""
+	}
+	version, _ := versioner.Version()
+	return version
+}
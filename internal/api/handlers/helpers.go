@@ -2,7 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+
+	"github.com/andrew/ai-cli-server/internal/api/middleware"
 )
 
 // respondJSON sends a JSON response
@@ -12,7 +16,23 @@ func respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
-// respondError sends an error response
-func respondError(w http.ResponseWriter, status int, message string) {
-	respondJSON(w, status, map[string]string{"error": message})
+// respondError sends an error response in the shape the route's clients expect
+func respondError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	middleware.RespondError(w, r, status, message)
+}
+
+// decodeJSONBody decodes a JSON request body into v. The size limit is applied
+// by the BodyLimit middleware; exceeding it is reported as 413.
+// On failure it writes the error response and returns false.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			respondError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxErr.Limit))
+			return false
+		}
+		respondError(w, r, http.StatusBadRequest, "invalid request body")
+		return false
+	}
+	return true
 }
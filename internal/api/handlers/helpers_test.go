@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/api/middleware"
+	"github.com/andrew/ai-cli-server/internal/config"
+	"github.com/andrew/ai-cli-server/internal/database"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+// testConfig loads a config file with the given contents, defaults applied
+func testConfig(t *testing.T, contents string) *config.Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	return cfg
+}
+
+// testDB opens a migrated database that is removed with the test
+func testDB(t *testing.T) *database.DB {
+	t.Helper()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"), database.Options{BusyTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("database.New() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// testClient creates an active client of the mock provider, after edit adjusts it
+func testClient(t *testing.T, db *database.DB, edit func(*models.Client)) *models.Client {
+	t.Helper()
+	client := &models.Client{Name: t.Name(), Provider: "mock", AllowedModels: `["*"]`, IsActive: true}
+	if edit != nil {
+		edit(client)
+	}
+	if client.APIKeyHash == "" {
+		client.APIKeyHash = "hash of " + client.Name // Unique, as key hashes must be
+	}
+	if err := db.CreateClient(client); err != nil {
+		t.Fatalf("CreateClient() error = %v", err)
+	}
+	return client
+}
+
+// testChatHandler creates a chat handler over db and providers without
+// webhooks or rate limiting
+func testChatHandler(cfg *config.Config, db *database.DB, providers ...agents.Provider) *ChatHandler {
+	executions := agents.NewExecutionLimiter(cfg.Limits.MaxConcurrentExecutions, cfg.Limits.MaxQueuedExecutions, cfg.Limits.ExecutionWait)
+	return NewChatHandler(db, cfg, nil, nil, executions, nil, providers...)
+}
+
+// fakeCLI writes an executable shell script standing in for a provider's CLI
+// and returns its path
+func fakeCLI(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cli")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// userMessage is a request's single user message
+func userMessage(content string) []Message {
+	return []Message{{Role: "user", Content: content}}
+}
+
+// withClient serves handler as client, as the auth middleware would
+func withClient(client *models.Client, handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r.WithContext(context.WithValue(r.Context(), middleware.ClientContextKey, client)))
+	})
+}
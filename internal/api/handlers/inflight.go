@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+)
+
+// executeFunc runs one CLI execution. A *completionError reports a request that
+// never reached the CLI, such as a full execution queue.
+type executeFunc func(ctx context.Context) (*agents.ExecuteResponse, *completionError, error)
+
+// inflightGroup coalesces identical executions running at the same time, so a
+// burst of duplicate requests runs the CLI once. Nothing is kept once the
+// execution finishes; that is the response cache's job.
+type inflightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*inflightCall
+}
+
+// inflightCall is one shared execution and the requests waiting on it
+type inflightCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int // Requests still waiting; the execution is cancelled when none are
+
+	resp *agents.ExecuteResponse
+	cerr *completionError
+	err  error
+}
+
+// newInflightGroup creates an empty group
+func newInflightGroup() *inflightGroup {
+	return &inflightGroup{calls: make(map[string]*inflightCall)}
+}
+
+// do runs execute for the first request with a key and has later requests with
+// the same key wait for its result. The execution outlives the request that
+// started it and is only cancelled once every waiting request has gone. Each
+// request gets its own copy of the response, which it may modify.
+func (g *inflightGroup) do(ctx context.Context, key string, execute executeFunc) (*agents.ExecuteResponse, *completionError, error) {
+	g.mu.Lock()
+	call, ok := g.calls[key]
+	if !ok {
+		execCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		call = &inflightCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = call
+		go g.run(execCtx, key, call, execute)
+	}
+	call.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		g.leave(key, call)
+		return nil, nil, ctx.Err()
+	}
+	if call.resp == nil {
+		return nil, call.cerr, call.err
+	}
+	resp := *call.resp
+	resp.Metadata = maps.Clone(call.resp.Metadata)
+	return &resp, nil, nil
+}
+
+// run executes a call and removes it once finished, so later requests start afresh
+func (g *inflightGroup) run(ctx context.Context, key string, call *inflightCall, execute executeFunc) {
+	defer call.cancel()
+	call.resp, call.cerr, call.err = execute(ctx)
+
+	g.mu.Lock()
+	g.forget(key, call)
+	g.mu.Unlock()
+	close(call.done)
+}
+
+// leave gives up waiting on a call. When nobody else is waiting the call is
+// cancelled, and forgotten so a new request doesn't join it.
+func (g *inflightGroup) leave(key string, call *inflightCall) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	call.waiters--
+	if call.waiters == 0 {
+		call.cancel()
+		g.forget(key, call)
+	}
+}
+
+// forget removes call unless a newer call has replaced it; g.mu must be held
+func (g *inflightGroup) forget(key string, call *inflightCall) {
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+}
+
+// inflightKey identifies a client's execution; requests coalesce only with the
+// same client's, so each is still checked and logged against its own client.
+// Unlike the cache key it covers what the response reports besides content.
+func inflightKey(clientID int64, provider string, req agents.ExecuteRequest) string {
+	return strings.Join([]string{
+		strconv.FormatInt(clientID, 10),
+		strconv.FormatBool(req.Debug),
+		strconv.FormatBool(req.IncludeRaw),
+		responseCacheKey(provider, req),
+	}, ":")
+}
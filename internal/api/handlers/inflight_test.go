@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/agents/mock"
+	"github.com/andrew/ai-cli-server/internal/config"
+)
+
+// gatedProvider is the mock provider counting its executions and holding each
+// until release is closed
+type gatedProvider struct {
+	*mock.Provider
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+// Execute implements agents.Provider
+func (p *gatedProvider) Execute(ctx context.Context, req agents.ExecuteRequest) (*agents.ExecuteResponse, error) {
+	p.calls.Add(1)
+	select {
+	case <-p.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return p.Provider.Execute(ctx, req)
+}
+
+// waitForWaiters blocks until n requests wait on a single coalesced execution
+func waitForWaiters(t *testing.T, g *inflightGroup, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		g.mu.Lock()
+		waiters := 0
+		for _, call := range g.calls {
+			waiters = max(waiters, call.waiters)
+		}
+		g.mu.Unlock()
+		if waiters == n {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d requests to share an execution", n)
+}
+
+func TestConcurrentIdenticalRequestsShareExecution(t *testing.T) {
+	const n = 10
+	cfg := testConfig(t, "")
+	db := testDB(t)
+	client := testClient(t, db, nil)
+	provider := &gatedProvider{Provider: mock.NewProvider(config.MockConfig{Response: "shared"}), release: make(chan struct{})}
+	h := testChatHandler(cfg, db, provider)
+
+	var wg sync.WaitGroup
+	results := make([]*completionError, n)
+	contents := make([]string, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, cerr := h.complete(context.Background(), client, ChatCompletionRequest{Model: mock.Model, Messages: userMessage("hi")})
+			results[i] = cerr
+			if cerr == nil {
+				contents[i] = resp.(*ChatCompletionResponse).Content
+			}
+		}()
+	}
+	waitForWaiters(t, h.inflight, n)
+	close(provider.release)
+	wg.Wait()
+
+	for i, cerr := range results {
+		if cerr != nil || contents[i] != "shared" {
+			t.Errorf("request %d = %q, %v; want the shared response", i, contents[i], cerr)
+		}
+	}
+	if calls := provider.calls.Load(); calls != 1 {
+		t.Errorf("Execute() ran %d times, want once", calls)
+	}
+	logs, err := db.GetUsageLogs(client.ID, 2*n, 0, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != n {
+		t.Errorf("%d usage logs, want one per request (%d)", len(logs), n)
+	}
+
+	// Once finished, nothing is kept: the next request runs the CLI again
+	if _, cerr := h.complete(context.Background(), client, ChatCompletionRequest{Model: mock.Model, Messages: userMessage("hi")}); cerr != nil {
+		t.Fatalf("complete() error = %s", cerr.Message)
+	}
+	if calls := provider.calls.Load(); calls != 2 {
+		t.Errorf("Execute() ran %d times after a later request, want twice", calls)
+	}
+}
+
+func TestSharedExecutionOutlivesCancelledRequest(t *testing.T) {
+	cfg := testConfig(t, "")
+	db := testDB(t)
+	client := testClient(t, db, nil)
+	provider := &gatedProvider{Provider: mock.NewProvider(config.MockConfig{}), release: make(chan struct{})}
+	h := testChatHandler(cfg, db, provider)
+	req := ChatCompletionRequest{Model: mock.Model, Messages: userMessage("hi")}
+
+	// The first request starts the execution, then hangs up
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan *completionError)
+	go func() {
+		_, cerr := h.complete(ctx, client, req)
+		first <- cerr
+	}()
+	waitForWaiters(t, h.inflight, 1)
+
+	second := make(chan *completionError)
+	go func() {
+		_, cerr := h.complete(context.Background(), client, req)
+		second <- cerr
+	}()
+	waitForWaiters(t, h.inflight, 2)
+
+	cancel()
+	if cerr := <-first; cerr == nil || cerr.Status != statusClientClosedRequest {
+		t.Errorf("cancelled request error = %v, want status %d", cerr, statusClientClosedRequest)
+	}
+	close(provider.release)
+	if cerr := <-second; cerr != nil {
+		t.Errorf("remaining request error = %s, want the execution to finish for it", cerr.Message)
+	}
+}
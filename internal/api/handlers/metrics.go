@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+)
+
+// MetricsHandler serves server gauges in the Prometheus text exposition format
+type MetricsHandler struct {
+	executions *agents.ExecutionLimiter
+	phases     *PhaseHistograms
+}
+
+// NewMetricsHandler creates a new metrics handler
+func NewMetricsHandler(executions *agents.ExecutionLimiter, phases *PhaseHistograms) *MetricsHandler {
+	return &MetricsHandler{executions: executions, phases: phases}
+}
+
+// HandleMetrics handles GET /metrics
+func (h *MetricsHandler) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeGauge(w, "ai_cli_server_cli_executions_in_use", "CLI subprocesses currently running", h.executions.InUse())
+	writeGauge(w, "ai_cli_server_cli_executions_limit", "Maximum concurrent CLI subprocesses", h.executions.Limit())
+	writeGauge(w, "ai_cli_server_cli_executions_queued", "Requests waiting for a CLI execution slot", h.executions.Queued())
+	writeGauge(w, "ai_cli_server_cli_executions_queue_limit", "Maximum requests waiting for a slot (0 is unbounded)", h.executions.QueueLimit())
+	h.phases.write(w)
+}
+
+// writeGauge writes a single unlabeled gauge with its HELP and TYPE lines
+func writeGauge(w http.ResponseWriter, name, help string, value int) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, value)
+}
+
+// Phases of a chat completion's latency, the phase label of PhaseHistograms
+const (
+	phaseQueueWait  = "queue_wait"
+	phaseStartup    = "startup"
+	phaseGeneration = "generation"
+)
+
+// phaseBuckets are the histogram upper bounds in seconds, from a quick queue
+// hand-off to a long tool-enabled run
+var phaseBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// phaseMetric is the name of the per-phase latency histogram
+const phaseMetric = "ai_cli_server_cli_phase_duration_seconds"
+
+// phaseSeries identifies one labeled histogram
+type phaseSeries struct {
+	provider, model, phase string
+}
+
+// histogram is a cumulative Prometheus histogram over phaseBuckets
+type histogram struct {
+	counts []uint64 // Observations at or below each bucket's bound
+	count  uint64
+	sum    float64
+}
+
+// PhaseHistograms records chat completion latency per provider, model, and
+// phase: waiting for an execution slot, starting the CLI, and generating output.
+// A nil *PhaseHistograms records nothing.
+type PhaseHistograms struct {
+	mu     sync.Mutex
+	series map[phaseSeries]*histogram
+}
+
+// NewPhaseHistograms creates empty phase histograms
+func NewPhaseHistograms() *PhaseHistograms {
+	return &PhaseHistograms{series: make(map[phaseSeries]*histogram)}
+}
+
+// Observe records one completion's phase timings
+func (p *PhaseHistograms) Observe(provider, model string, timings agents.PhaseTimings) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.observe(phaseSeries{provider, model, phaseQueueWait}, timings.QueueWait)
+	p.observe(phaseSeries{provider, model, phaseStartup}, timings.Startup)
+	p.observe(phaseSeries{provider, model, phaseGeneration}, timings.Generation)
+}
+
+// observe adds d to a series; p.mu must be held
+func (p *PhaseHistograms) observe(key phaseSeries, d time.Duration) {
+	h, ok := p.series[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(phaseBuckets))}
+		p.series[key] = h
+	}
+	seconds := d.Seconds()
+	for i, bound := range phaseBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// write writes every series in the text exposition format, in a stable order
+func (p *PhaseHistograms) write(w http.ResponseWriter) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keys := make([]phaseSeries, 0, len(p.series))
+	for key := range p.series {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b phaseSeries) int {
+		return strings.Compare(a.provider+"\x00"+a.model+"\x00"+a.phase, b.provider+"\x00"+b.model+"\x00"+b.phase)
+	})
+
+	fmt.Fprintf(w, "# HELP %s CLI completion latency by phase: queue_wait, startup, or generation\n# TYPE %s histogram\n", phaseMetric, phaseMetric)
+	for _, key := range keys {
+		h := p.series[key]
+		labels := fmt.Sprintf(`provider="%s",model="%s",phase="%s"`, escapeLabel(key.provider), escapeLabel(key.model), key.phase)
+		for i, bound := range phaseBuckets {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%g\"} %d\n", phaseMetric, labels, bound, h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", phaseMetric, labels, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %g\n", phaseMetric, labels, h.sum)
+		fmt.Fprintf(w, "%s_count{%s} %d\n", phaseMetric, labels, h.count)
+	}
+}
+
+// labelEscaper escapes label values as the text exposition format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a label value
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/agents/mock"
+	"github.com/andrew/ai-cli-server/internal/config"
+)
+
+func TestMetricsReportQueueDepth(t *testing.T) {
+	executions := agents.NewExecutionLimiter(1, 5, time.Minute)
+	release, err := executions.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go executions.Acquire(ctx)
+	for executions.Queued() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	rec := httptest.NewRecorder()
+	NewMetricsHandler(executions, nil).HandleMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		"ai_cli_server_cli_executions_in_use 1\n",
+		"ai_cli_server_cli_executions_queued 1\n",
+		"ai_cli_server_cli_executions_queue_limit 5\n",
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("/metrics is missing %q:\n%s", want, rec.Body)
+		}
+	}
+}
+
+func TestMetricsReportPhaseHistograms(t *testing.T) {
+	cfg := testConfig(t, "")
+	db := testDB(t)
+	client := testClient(t, db, nil)
+	executions := agents.NewExecutionLimiter(cfg.Limits.MaxConcurrentExecutions, cfg.Limits.MaxQueuedExecutions, cfg.Limits.ExecutionWait)
+	phases := NewPhaseHistograms()
+	h := NewChatHandler(db, cfg, nil, nil, executions, phases, mock.NewProvider(config.MockConfig{}))
+
+	resp, cerr := h.complete(context.Background(), client, ChatCompletionRequest{Model: mock.Model, Messages: userMessage("hi")})
+	if cerr != nil {
+		t.Fatalf("complete() error = %s", cerr.Message)
+	}
+	if _, ok := resp.(*ChatCompletionResponse).Metadata[agents.MetadataTimings].(agents.PhaseTimings); !ok {
+		t.Errorf("metadata = %v, want phase timings", resp.(*ChatCompletionResponse).Metadata)
+	}
+
+	rec := httptest.NewRecorder()
+	NewMetricsHandler(executions, phases).HandleMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, phase := range []string{"queue_wait", "startup", "generation"} {
+		want := `ai_cli_server_cli_phase_duration_seconds_count{provider="mock",model="` + mock.Model + `",phase="` + phase + `"} 1` + "\n"
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("/metrics is missing %q:\n%s", want, rec.Body)
+		}
+	}
+
+	// Without histograms, nothing is measured
+	h = testChatHandler(cfg, db, mock.NewProvider(config.MockConfig{}))
+	resp, _ = h.complete(context.Background(), client, ChatCompletionRequest{Model: mock.Model, Messages: userMessage("hi")})
+	if _, ok := resp.(*ChatCompletionResponse).Metadata[agents.MetadataTimings]; ok {
+		t.Error("timings reported with metrics disabled")
+	}
+}
+
+func TestBusyServerSetsRetryAfter(t *testing.T) {
+	cfg := testConfig(t, "limits:\n  max_concurrent_executions: 1\n  max_queued_executions: 1\n")
+	h := testChatHandler(cfg, testDB(t))
+	release, cerr := h.acquireExecution(context.Background())
+	if cerr != nil {
+		t.Fatal(cerr.Message)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.acquireExecution(ctx)
+	for h.executions.Queued() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	_, cerr = h.acquireExecution(context.Background())
+	if cerr == nil || cerr.Status != http.StatusServiceUnavailable {
+		t.Fatalf("acquireExecution() error = %v, want 503 with the queue full", cerr)
+	}
+	rec := httptest.NewRecorder()
+	respondCompletionError(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil), cerr)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("queue full response has no Retry-After")
+	}
+}
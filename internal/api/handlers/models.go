@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+)
+
+// ModelsHandler lists and refreshes the models each provider's CLI reports
+type ModelsHandler struct {
+	providers []agents.Provider
+}
+
+// NewModelsHandler creates a new models handler
+func NewModelsHandler(providers ...agents.Provider) *ModelsHandler {
+	return &ModelsHandler{providers: providers}
+}
+
+// ProviderModels represents the models of a single provider
+type ProviderModels struct {
+	Provider  string             `json:"provider"`
+	Available bool               `json:"available"`
+	Models    []agents.ModelInfo `json:"models"`
+}
+
+// HandleListModels handles GET /v1/models
+// Models are served from each provider's cache, re-read once it is older than models_ttl
+func (h *ModelsHandler) HandleListModels(w http.ResponseWriter, r *http.Request) {
+	h.respondModels(w, func(p agents.Provider) []agents.ModelInfo {
+		return p.GetModelsInfo()
+	})
+}
+
+// HandleRefreshModels handles POST /v1/admin/models/refresh
+// Re-reads every available provider's models, e.g. after upgrading a CLI
+func (h *ModelsHandler) HandleRefreshModels(w http.ResponseWriter, r *http.Request) {
+	h.respondModels(w, func(p agents.Provider) []agents.ModelInfo {
+		return p.RefreshModels()
+	})
+}
+
+// respondModels writes the enabled models of every provider, skipping unavailable ones
+func (h *ModelsHandler) respondModels(w http.ResponseWriter, models func(agents.Provider) []agents.ModelInfo) {
+	response := make([]ProviderModels, 0, len(h.providers))
+	for _, provider := range h.providers {
+		entry := ProviderModels{
+			Provider:  provider.Name(),
+			Available: provider.IsAvailable(),
+			Models:    []agents.ModelInfo{},
+		}
+		if entry.Available {
+			for _, model := range models(provider) {
+				if model.Enabled {
+					entry.Models = append(entry.Models, model)
+				}
+			}
+		}
+		response = append(response, entry)
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"providers": response,
+	})
+}
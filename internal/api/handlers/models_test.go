@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/agents/mock"
+	"github.com/andrew/ai-cli-server/internal/config"
+)
+
+func TestDisabledModel(t *testing.T) {
+	cfg := testConfig(t, "cli:\n  disabled_models: [\""+mock.Model+"\"]\n")
+	db := testDB(t)
+	provider := mock.NewProvider(config.MockConfig{})
+	agents.DisableModels([]agents.Provider{provider}, cfg.CLI.DisabledModels)
+
+	// A client allowed every model is still refused the disabled one
+	h := testChatHandler(cfg, db, provider)
+	client := testClient(t, db, nil)
+	_, cerr := h.complete(context.Background(), client, ChatCompletionRequest{Model: mock.Model, Messages: userMessage("hi")})
+	if cerr == nil || cerr.Status != http.StatusServiceUnavailable {
+		t.Fatalf("complete() error = %v, want status 503", cerr)
+	}
+
+	// and /v1/models leaves it out
+	rec := httptest.NewRecorder()
+	NewModelsHandler(provider).HandleListModels(rec, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	var resp struct {
+		Providers []ProviderModels `json:"providers"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Providers) != 1 || len(resp.Providers[0].Models) != 0 {
+		t.Errorf("/v1/models = %+v, want the mock provider without models", resp.Providers)
+	}
+	if models := provider.GetSupportedModels(); len(models) != 0 {
+		t.Errorf("GetSupportedModels() = %q, want the disabled model left out", models)
+	}
+}
+
+func TestModelsListCatalogCapabilities(t *testing.T) {
+	cfg := testConfig(t, `
+cli:
+  model_catalog:
+    - name: `+mock.Model+`
+      context_window: 1000
+    - name: `+mock.Model+`
+      provider: mock
+      context_window: 2000
+      supports_vision: false
+      input_price: 3
+      output_price: 15
+`)
+	provider := mock.NewProvider(config.MockConfig{})
+	agents.ApplyModelCatalog([]agents.Provider{provider}, cfg.CLI.ModelCatalog)
+
+	rec := httptest.NewRecorder()
+	NewModelsHandler(provider).HandleListModels(rec, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	var resp struct {
+		Providers []struct {
+			Models []map[string]interface{} `json:"models"`
+		} `json:"providers"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Providers) != 1 || len(resp.Providers[0].Models) != 1 {
+		t.Fatalf("/v1/models = %+v, want the mock model", resp.Providers)
+	}
+
+	// The provider's own entry wins, and unset fields are left out
+	model := resp.Providers[0].Models[0]
+	if model["context_window"] != float64(2000) || model["supports_vision"] != false {
+		t.Errorf("model = %v, want the mock entry's capabilities", model)
+	}
+	if pricing, _ := model["pricing"].(map[string]interface{}); pricing["input"] != float64(3) || pricing["output"] != float64(15) {
+		t.Errorf("pricing = %v, want input 3 and output 15", model["pricing"])
+	}
+	if _, ok := model["supports_tools"]; ok {
+		t.Errorf("model = %v, want supports_tools omitted when unknown", model)
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"time"
+)
+
+// OpenAIChatCompletion is the canonical OpenAI chat completion object
+type OpenAIChatCompletion struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []OpenAIChoice `json:"choices"`
+	Usage   OpenAIUsage    `json:"usage"`
+}
+
+// OpenAIChoice is a single completion choice
+type OpenAIChoice struct {
+	Index        int     `json:"index"`
+	Message      Message `json:"message"`
+	FinishReason string  `json:"finish_reason"`
+}
+
+// OpenAIUsage is token usage in OpenAI's nested shape
+type OpenAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// toOpenAIChatCompletion reshapes a native response into the OpenAI object
+func toOpenAIChatCompletion(resp *ChatCompletionResponse) *OpenAIChatCompletion {
+	return &OpenAIChatCompletion{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   resp.Model,
+		Choices: []OpenAIChoice{{
+			Index:        0,
+			Message:      Message{Role: "assistant", Content: resp.Content},
+			FinishReason: resp.FinishReason,
+		}},
+		Usage: OpenAIUsage{
+			PromptTokens:     resp.PromptTokens,
+			CompletionTokens: resp.CompletionTokens,
+			TotalTokens:      resp.TotalTokens,
+		},
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/agents/mock"
+	"github.com/andrew/ai-cli-server/internal/config"
+)
+
+// openAIResponse is the chat.completion object as an OpenAI SDK decodes it,
+// declared here rather than reusing OpenAIChatCompletion so the test checks
+// the wire format
+type openAIResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+	Choices []struct {
+		Index   int `json:"index"`
+		Message struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+		TotalTokens      int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+func TestOpenAIChatCompletionShape(t *testing.T) {
+	cfg := testConfig(t, "")
+	db := testDB(t)
+	client := testClient(t, db, nil)
+	h := testChatHandler(cfg, db, mock.NewProvider(config.MockConfig{Echo: true}))
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		body    string
+	}{
+		{"openai route", h.HandleOpenAIChatCompletion, `{"model":"mock-model","messages":[{"role":"user","content":"hello there"}]}`},
+		{"openai_compat flag", h.HandleChatCompletion, `{"model":"mock-model","openai_compat":true,"messages":[{"role":"user","content":"hello there"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			withClient(client, tt.handler).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+
+			// Nothing outside the OpenAI object, such as the native top-level content
+			var resp openAIResponse
+			decoder := json.NewDecoder(rec.Body)
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&resp); err != nil {
+				t.Fatalf("decoding as an OpenAI chat.completion: %v", err)
+			}
+
+			if resp.ID == "" || resp.Object != "chat.completion" || resp.Model != "mock-model" {
+				t.Errorf("id, object, model = %q, %q, %q; want an ID, chat.completion and mock-model", resp.ID, resp.Object, resp.Model)
+			}
+			if created := time.Unix(resp.Created, 0); time.Since(created).Abs() > time.Minute {
+				t.Errorf("created = %v, want about now", created)
+			}
+			if len(resp.Choices) != 1 {
+				t.Fatalf("choices = %+v, want one", resp.Choices)
+			}
+			choice := resp.Choices[0]
+			if choice.Index != 0 || choice.Message.Role != "assistant" || !strings.Contains(choice.Message.Content, "hello there") || choice.FinishReason != finishReasonStop {
+				t.Errorf("choice = %+v, want the assistant's echo, finished with %q", choice, finishReasonStop)
+			}
+			if u := resp.Usage; u.PromptTokens == 0 || u.CompletionTokens == 0 || u.TotalTokens != u.PromptTokens+u.CompletionTokens {
+				t.Errorf("usage = %+v, want prompt and completion tokens adding up to the total", u)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/agents/mock"
+	"github.com/andrew/ai-cli-server/internal/config"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+func TestModelQuota(t *testing.T) {
+	const expensive = "expensive-model"
+	cfg := testConfig(t, "")
+	db := testDB(t)
+	client := testClient(t, db, func(c *models.Client) { c.ModelQuotas = `{"` + expensive + `": 2}` })
+	h := testChatHandler(cfg, db, mock.NewProvider(config.MockConfig{}))
+	complete := func(model string) *completionError {
+		t.Helper()
+		_, cerr := h.complete(context.Background(), client, ChatCompletionRequest{Model: model, Messages: userMessage("hi")})
+		return cerr
+	}
+
+	// Yesterday's requests and failures don't count toward today's quota
+	now := time.Now()
+	for _, log := range []models.UsageLog{
+		{Timestamp: now.AddDate(0, 0, -1), ResponseStatus: http.StatusOK},
+		{Timestamp: now, ResponseStatus: http.StatusInternalServerError},
+	} {
+		log.ClientID, log.Provider, log.Model = client.ID, "mock", expensive
+		if err := db.CreateUsageLog(&log); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := range 2 {
+		if cerr := complete(expensive); cerr != nil {
+			t.Fatalf("request %d within quota error = %s", i+1, cerr.Message)
+		}
+	}
+	cerr := complete(expensive)
+	if cerr == nil || cerr.Status != http.StatusTooManyRequests {
+		t.Fatalf("complete() past quota error = %v, want status %d", cerr, http.StatusTooManyRequests)
+	}
+	if cerr.RetryAfter <= 0 || cerr.RetryAfter > 24*time.Hour {
+		t.Errorf("Retry-After = %v, want the time until midnight", cerr.RetryAfter)
+	}
+
+	// A model without a quota stays unlimited
+	for i := range 5 {
+		if cerr := complete(mock.Model); cerr != nil {
+			t.Fatalf("unlimited model request %d error = %s", i+1, cerr.Message)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"math/rand/v2"
+	"sync"
+)
+
+// promptSampler decides which requests have their prompt kept in the usage log.
+// With a fixed seed the sequence of decisions is reproducible.
+type promptSampler struct {
+	rate float64
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// newPromptSampler creates a sampler keeping about rate of prompts, seeded
+// with seed, or randomly when seed is 0
+func newPromptSampler(rate float64, seed uint64) *promptSampler {
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	return &promptSampler{rate: rate, rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+// Sample reports whether the next request's prompt should be logged
+func (s *promptSampler) Sample() bool {
+	if s.rate >= 1 {
+		return true
+	}
+	if s.rate <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rng.Float64() < s.rate
+}
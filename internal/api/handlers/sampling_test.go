@@ -0,0 +1,38 @@
+package handlers
+
+import "testing"
+
+func TestPromptSamplerRates(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     float64
+		min, max int // Expected kept prompts out of 1000
+	}{
+		{"zero logs none", 0, 0, 0},
+		{"one logs all", 1, 1000, 1000},
+		{"fraction logs about that share", 0.25, 200, 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sampler := newPromptSampler(tt.rate, 42)
+			kept := 0
+			for range 1000 {
+				if sampler.Sample() {
+					kept++
+				}
+			}
+			if kept < tt.min || kept > tt.max {
+				t.Errorf("rate %v kept %d of 1000, want %d-%d", tt.rate, kept, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestPromptSamplerSeedIsReproducible(t *testing.T) {
+	a, b := newPromptSampler(0.5, 7), newPromptSampler(0.5, 7)
+	for i := range 100 {
+		if a.Sample() != b.Sample() {
+			t.Fatalf("decision %d differs between samplers with the same seed", i)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/andrew/ai-cli-server/internal/api/middleware"
+	"github.com/andrew/ai-cli-server/internal/database"
+)
+
+// SessionHandler lists and revokes the calling client's sessions
+type SessionHandler struct {
+	db database.Store
+}
+
+// NewSessionHandler creates a new session handler
+func NewSessionHandler(db database.Store) *SessionHandler {
+	return &SessionHandler{db: db}
+}
+
+// HandleListSessions handles GET /v1/sessions
+func (h *SessionHandler) HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	client := middleware.GetClientFromContext(r.Context())
+	if client == nil {
+		respondError(w, r, http.StatusInternalServerError, "client not found in context")
+		return
+	}
+
+	respondSessions(w, r, h.db, client.ID)
+}
+
+// HandleRevokeSession handles DELETE /v1/sessions/{session_id}
+func (h *SessionHandler) HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	client := middleware.GetClientFromContext(r.Context())
+	if client == nil {
+		respondError(w, r, http.StatusInternalServerError, "client not found in context")
+		return
+	}
+
+	if revokeSession(w, r, h.db, client.ID) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// respondSessions writes a page of a client's sessions, paginated by the
+// request's limit and offset query parameters
+func respondSessions(w http.ResponseWriter, r *http.Request, db database.Store, clientID int64) {
+	limit, offset := parsePagination(r.URL.Query())
+
+	sessions, err := db.ListSessions(clientID, limit, offset)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, "failed to retrieve sessions")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"sessions": sessions,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+// revokeSession revokes the {session_id} path value if the client has used it.
+// On failure it writes the error response and returns false.
+func revokeSession(w http.ResponseWriter, r *http.Request, db database.Store, clientID int64) bool {
+	sessionID := r.PathValue("session_id")
+
+	owned, err := db.SessionBelongsTo(clientID, sessionID)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, "failed to look up session")
+		return false
+	}
+	if !owned {
+		respondError(w, r, http.StatusNotFound, "session not found")
+		return false
+	}
+
+	if err := db.RevokeSession(clientID, sessionID); err != nil {
+		respondError(w, r, http.StatusInternalServerError, "failed to revoke session")
+		return false
+	}
+	return true
+}
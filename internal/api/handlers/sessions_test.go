@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/agents/cursor"
+	"github.com/andrew/ai-cli-server/internal/config"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+func TestCursorResumesOwnedSessions(t *testing.T) {
+	cfg := testConfig(t, "")
+	db := testDB(t)
+	h := testChatHandler(cfg, db, cursor.NewProvider(config.CursorConfig{BinaryPath: fakeCLI(t, "exit 0")}, ""))
+	owner := testClient(t, db, func(c *models.Client) { c.Provider = "cursor" })
+	other := testClient(t, db, func(c *models.Client) { c.Name += "-other"; c.Provider = "cursor" })
+
+	// The CLI returned the session to owner in an earlier response
+	sessionID := "cli-session-1"
+	if err := db.CreateUsageLog(&models.UsageLog{ClientID: owner.ID, Timestamp: time.Now(), Provider: "cursor", Model: "sonnet-4", ResponseStatus: 200, SessionID: &sessionID}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another client can neither resume the session nor claim its ID
+	_, cerr := h.complete(context.Background(), other, ChatCompletionRequest{
+		Model: "sonnet-4", Messages: userMessage("and then?"), SessionID: sessionID, DryRun: true,
+	})
+	if cerr == nil || cerr.Status != http.StatusNotFound {
+		t.Fatalf("complete() by another client error = %v, want 404", cerr)
+	}
+	if conv, err := db.GetConversation(sessionID); err != nil || conv != nil {
+		t.Fatalf("GetConversation() = %+v, %v; want no conversation created", conv, err)
+	}
+
+	// so the owner still resumes it
+	resp, cerr := h.complete(context.Background(), owner, ChatCompletionRequest{
+		Model: "sonnet-4", Messages: userMessage("and then?"), SessionID: sessionID, DryRun: true,
+	})
+	if cerr != nil {
+		t.Fatalf("complete() error = %s", cerr.Message)
+	}
+	if args := resp.(*DryRunResponse).Command.Args; !slices.Contains(args, "--resume") {
+		t.Errorf("args = %q, want the owner's session resumed", args)
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/api/middleware"
+)
+
+// StatusHandler reports this process's current load for autoscalers
+type StatusHandler struct {
+	executions *agents.ExecutionLimiter
+	load       *middleware.LoadTracker
+	providers  []agents.Provider
+}
+
+// NewStatusHandler creates a new status handler
+func NewStatusHandler(executions *agents.ExecutionLimiter, load *middleware.LoadTracker, providers ...agents.Provider) *StatusHandler {
+	return &StatusHandler{executions: executions, load: load, providers: providers}
+}
+
+// ExecutionStatus reports use of the server-wide CLI execution limit
+type ExecutionStatus struct {
+	InUse       int     `json:"in_use"`
+	Limit       int     `json:"limit"`
+	Utilization float64 `json:"utilization"` // InUse / Limit
+	Queued      int     `json:"queued"`      // Requests waiting for a slot
+}
+
+// RecentStatus reports request outcomes over the trailing window
+type RecentStatus struct {
+	WindowSeconds int     `json:"window_seconds"`
+	Requests      int     `json:"requests"`
+	Errors        int     `json:"errors"`     // Requests that failed with a 5xx
+	ErrorRate     float64 `json:"error_rate"` // Errors / Requests, 0 with no requests
+}
+
+// StatusResponse represents the GET /status response
+type StatusResponse struct {
+	ActiveRequests int64            `json:"active_requests"`
+	Executions     ExecutionStatus  `json:"executions"`
+	Providers      []ProviderStatus `json:"providers"`
+	Recent         RecentStatus     `json:"recent"`
+}
+
+// HandleStatus handles GET /status
+// Counts come from in-memory counters, so it is cheap enough to poll and never
+// waits on the database or a CLI
+func (h *StatusHandler) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	snapshot := h.load.Snapshot()
+	response := StatusResponse{
+		ActiveRequests: snapshot.Active,
+		Executions: ExecutionStatus{
+			InUse:  h.executions.InUse(),
+			Limit:  h.executions.Limit(),
+			Queued: h.executions.Queued(),
+		},
+		Providers: make([]ProviderStatus, 0, len(h.providers)),
+		Recent: RecentStatus{
+			WindowSeconds: int(snapshot.Window.Seconds()),
+			Requests:      snapshot.Requests,
+			Errors:        snapshot.Errors,
+		},
+	}
+	if response.Executions.Limit > 0 {
+		response.Executions.Utilization = float64(response.Executions.InUse) / float64(response.Executions.Limit)
+	}
+	if snapshot.Requests > 0 {
+		response.Recent.ErrorRate = float64(snapshot.Errors) / float64(snapshot.Requests)
+	}
+	for _, provider := range h.providers {
+		response.Providers = append(response.Providers, ProviderStatus{
+			Name:      provider.Name(),
+			Available: provider.IsAvailable(),
+		})
+	}
+
+	respondJSON(w, http.StatusOK, response)
+}
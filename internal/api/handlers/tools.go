@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/api/middleware"
+	"github.com/andrew/ai-cli-server/internal/database"
+)
+
+// Where a client's effective tool policy comes from
+const (
+	toolPolicyClient = "client" // The client has allowed_tools or denied_tools
+	toolPolicyServer = "server" // The provider's defaults apply unchanged
+)
+
+// ToolsHandler reports what tools the calling client may use
+type ToolsHandler struct {
+	providers map[string]agents.Provider
+}
+
+// NewToolsHandler creates a new tools handler
+func NewToolsHandler(providers ...agents.Provider) *ToolsHandler {
+	byName := make(map[string]agents.Provider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name()] = provider
+	}
+	return &ToolsHandler{providers: byName}
+}
+
+// ToolPolicyResponse is the calling client's effective tool policy
+type ToolPolicyResponse struct {
+	Provider            string   `json:"provider"`
+	SupportsToolFilters bool     `json:"supports_tool_filters"` // Whether requests may send allow_tools and deny_tools
+	Unrestricted        bool     `json:"unrestricted"`          // The CLI may run any tool not denied
+	DefaultTools        []string `json:"default_tools"`         // Allowed on every request; empty when unrestricted
+	AllowedTools        []string `json:"allowed_tools"`         // What allow_tools may add; empty means any
+	DeniedTools         []string `json:"denied_tools"`          // Denied on every request
+	Source              string   `json:"source"`                // toolPolicyClient or toolPolicyServer
+}
+
+// HandleListTools handles GET /v1/tools
+func (h *ToolsHandler) HandleListTools(w http.ResponseWriter, r *http.Request) {
+	client := middleware.GetClientFromContext(r.Context())
+	if client == nil {
+		respondError(w, r, http.StatusInternalServerError, "client not found in context")
+		return
+	}
+
+	allowedTools, deniedTools := database.ParseClientTools(client)
+	resp := ToolPolicyResponse{
+		Provider:     client.Provider,
+		Unrestricted: client.ToolsUnrestricted,
+		DefaultTools: []string{},
+		AllowedTools: allowedTools,
+		DeniedTools:  deniedTools,
+		Source:       toolPolicyServer,
+	}
+	if len(allowedTools) > 0 || len(deniedTools) > 0 {
+		resp.Source = toolPolicyClient
+	}
+	if filterer, ok := h.providers[client.Provider].(agents.ToolFilterer); ok && filterer.SupportsToolFilters() {
+		resp.SupportsToolFilters = true
+		if tools := filterer.DefaultTools(); tools != nil && !client.ToolsUnrestricted {
+			resp.DefaultTools = tools
+		}
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/andrew/ai-cli-server/internal/agents/cursor"
+	"github.com/andrew/ai-cli-server/internal/config"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+func TestCursorToolPolicy(t *testing.T) {
+	cfg := testConfig(t, "")
+	db := testDB(t)
+	provider := cursor.NewProvider(config.CursorConfig{BinaryPath: fakeCLI(t, "exit 0")}, "")
+	h := testChatHandler(cfg, db, provider)
+	restricted := testClient(t, db, func(c *models.Client) { c.Provider = "cursor" })
+	unrestricted := testClient(t, db, func(c *models.Client) { c.Name += "-unrestricted"; c.Provider = "cursor"; c.ToolsUnrestricted = true })
+
+	tests := []struct {
+		name       string
+		client     *models.Client
+		req        ChatCompletionRequest
+		wantStatus int
+	}{
+		{"allow_tools is rejected", unrestricted, ChatCompletionRequest{AllowTools: []string{"write"}}, http.StatusBadRequest},
+		{"deny_tools is rejected", unrestricted, ChatCompletionRequest{DenyTools: []string{"shell(rm)"}}, http.StatusBadRequest},
+		{"force needs unrestricted tools", restricted, ChatCompletionRequest{Force: true}, http.StatusForbidden},
+		{"force with unrestricted tools", unrestricted, ChatCompletionRequest{Force: true}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			req.Model, req.Messages, req.DryRun = "sonnet-4", userMessage("list the files"), true
+			resp, cerr := h.complete(context.Background(), tt.client, req)
+			if tt.wantStatus != http.StatusOK {
+				if cerr == nil || cerr.Status != tt.wantStatus {
+					t.Fatalf("complete() error = %v, want status %d", cerr, tt.wantStatus)
+				}
+				return
+			}
+			if cerr != nil {
+				t.Fatalf("complete() error = %s", cerr.Message)
+			}
+			if args := resp.(*DryRunResponse).Command.Args; !slices.Contains(args, "--force") {
+				t.Errorf("args = %q, want --force", args)
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -11,11 +13,11 @@ import (
 
 // UsageHandler handles usage tracking requests
 type UsageHandler struct {
-	db *database.DB
+	db database.Store
 }
 
 // NewUsageHandler creates a new usage handler
-func NewUsageHandler(db *database.DB) *UsageHandler {
+func NewUsageHandler(db database.Store) *UsageHandler {
 	return &UsageHandler{db: db}
 }
 
@@ -23,50 +25,45 @@ func NewUsageHandler(db *database.DB) *UsageHandler {
 func (h *UsageHandler) HandleGetUsage(w http.ResponseWriter, r *http.Request) {
 	client := middleware.GetClientFromContext(r.Context())
 	if client == nil {
-		respondError(w, http.StatusInternalServerError, "client not found in context")
+		respondError(w, r, http.StatusInternalServerError, "client not found in context")
 		return
 	}
 
-	// Parse query parameters
-	query := r.URL.Query()
-	limit := 100
-	offset := 0
-
-	if l := query.Get("limit"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
-			limit = parsed
-		}
-	}
+	respondUsageLogs(w, r, h.db, client.ID)
+}
 
-	if o := query.Get("offset"); o != "" {
-		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
-			offset = parsed
-		}
+// respondUsageLogs writes a page of a client's usage logs, paginated and filtered
+// by the request's limit, offset, start_time, end_time, metadata_key, and
+// metadata_value query parameters
+func respondUsageLogs(w http.ResponseWriter, r *http.Request, db database.Store, clientID int64) {
+	query := r.URL.Query()
+	limit, offset := parsePagination(query)
+	startTime, endTime := parseTimeRange(query)
+	meta, err := parseMetadataFilter(query)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	var startTime, endTime *time.Time
-	if st := query.Get("start_time"); st != "" {
-		if t, err := time.Parse(time.RFC3339, st); err == nil {
-			startTime = &t
-		}
-	}
-	if et := query.Get("end_time"); et != "" {
-		if t, err := time.Parse(time.RFC3339, et); err == nil {
-			endTime = &t
-		}
+	// Get usage logs
+	logs, err := db.GetUsageLogs(clientID, limit, offset, startTime, endTime, meta)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, "failed to retrieve usage logs")
+		return
 	}
 
-	// Get usage logs
-	logs, err := h.db.GetUsageLogs(client.ID, limit, offset, startTime, endTime)
+	total, err := db.CountUsageLogs(clientID, startTime, endTime, meta)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to retrieve usage logs")
+		respondError(w, r, http.StatusInternalServerError, "failed to count usage logs")
 		return
 	}
 
 	respondJSON(w, http.StatusOK, map[string]interface{}{
-		"logs":   logs,
-		"limit":  limit,
-		"offset": offset,
+		"logs":     logs,
+		"limit":    limit,
+		"offset":   offset,
+		"total":    total,
+		"has_more": offset+len(logs) < total,
 	})
 }
 
@@ -74,14 +71,98 @@ func (h *UsageHandler) HandleGetUsage(w http.ResponseWriter, r *http.Request) {
 func (h *UsageHandler) HandleGetUsageStats(w http.ResponseWriter, r *http.Request) {
 	client := middleware.GetClientFromContext(r.Context())
 	if client == nil {
-		respondError(w, http.StatusInternalServerError, "client not found in context")
+		respondError(w, r, http.StatusInternalServerError, "client not found in context")
 		return
 	}
 
 	// Parse query parameters
 	query := r.URL.Query()
-	var startTime, endTime *time.Time
+	startTime, endTime := parseTimeRange(query)
+	meta, err := parseMetadataFilter(query)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
 
+	// Get usage stats
+	stats, err := h.db.GetUsageStats(client.ID, startTime, endTime, meta)
+	if err != nil {
+		respondError(w, r, http.StatusInternalServerError, "failed to retrieve usage stats")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, stats)
+}
+
+// HandleGetUsageTimeSeries handles GET /v1/usage/timeseries
+func (h *UsageHandler) HandleGetUsageTimeSeries(w http.ResponseWriter, r *http.Request) {
+	client := middleware.GetClientFromContext(r.Context())
+	if client == nil {
+		respondError(w, r, http.StatusInternalServerError, "client not found in context")
+		return
+	}
+
+	// Parse query parameters
+	query := r.URL.Query()
+	startTime, endTime := parseTimeRange(query)
+
+	interval := query.Get("interval")
+	if interval == "" {
+		interval = database.IntervalDay
+	}
+	if interval != database.IntervalHour && interval != database.IntervalDay {
+		respondError(w, r, http.StatusBadRequest, "interval must be \"hour\" or \"day\"")
+		return
+	}
+
+	// Get usage time series
+	buckets, err := h.db.GetUsageTimeSeries(client.ID, startTime, endTime, interval)
+	if err != nil {
+		respondError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"interval": interval,
+		"buckets":  buckets,
+	})
+}
+
+// parsePagination reads limit (default 100) and offset (default 0) query parameters
+func parsePagination(query url.Values) (limit, offset int) {
+	limit = 100
+	if l := query.Get("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+
+	if o := query.Get("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+	return limit, offset
+}
+
+// parseMetadataFilter reads the optional metadata_key and metadata_value query
+// parameters, which must be given together
+func parseMetadataFilter(query url.Values) (*database.MetadataFilter, error) {
+	key, value := query.Get("metadata_key"), query.Get("metadata_value")
+	if key == "" && value == "" {
+		return nil, nil
+	}
+	if key == "" || value == "" {
+		return nil, fmt.Errorf("metadata_key and metadata_value must be given together")
+	}
+	if err := database.ValidateMetadataKey(key); err != nil {
+		return nil, err
+	}
+	return &database.MetadataFilter{Key: key, Value: value}, nil
+}
+
+// parseTimeRange reads the optional RFC3339 start_time and end_time query parameters
+func parseTimeRange(query url.Values) (startTime, endTime *time.Time) {
 	if st := query.Get("start_time"); st != "" {
 		if t, err := time.Parse(time.RFC3339, st); err == nil {
 			startTime = &t
@@ -92,13 +173,5 @@ func (h *UsageHandler) HandleGetUsageStats(w http.ResponseWriter, r *http.Reques
 			endTime = &t
 		}
 	}
-
-	// Get usage stats
-	stats, err := h.db.GetUsageStats(client.ID, startTime, endTime)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "failed to retrieve usage stats")
-		return
-	}
-
-	respondJSON(w, http.StatusOK, stats)
+	return startTime, endTime
 }
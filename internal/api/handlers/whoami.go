@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/api/middleware"
+	"github.com/andrew/ai-cli-server/internal/database"
+)
+
+// WhoAmIResponse describes the calling client. It carries no secrets.
+type WhoAmIResponse struct {
+	ID                  int64          `json:"id"`
+	Name                string         `json:"name"`
+	Provider            string         `json:"provider"`
+	AllowedModels       []string       `json:"allowed_models"`
+	DefaultModel        string         `json:"default_model,omitempty"`
+	Scopes              []string       `json:"scopes"`
+	RateLimitPerMinute  int            `json:"rate_limit_per_minute"`
+	RateLimitBurst      int            `json:"rate_limit_burst,omitempty"` // Effective burst; omitted when unlimited
+	TokenLimitPerMinute int            `json:"token_limit_per_minute"`
+	MonthlyBudget       float64        `json:"monthly_budget,omitempty"`
+	ModelQuotas         map[string]int `json:"model_quotas,omitempty"` // Requests per day by model
+	ExpiresAt           *time.Time     `json:"expires_at,omitempty"`
+	IsActive            bool           `json:"is_active"`
+}
+
+// HandleWhoAmI handles GET /v1/whoami, letting a key be checked without a
+// billable chat call. Authenticate has already rejected invalid keys.
+func HandleWhoAmI(w http.ResponseWriter, r *http.Request) {
+	client := middleware.GetClientFromContext(r.Context())
+	if client == nil {
+		respondError(w, r, http.StatusInternalServerError, "client not found in context")
+		return
+	}
+
+	resp := WhoAmIResponse{
+		ID:                  client.ID,
+		Name:                client.Name,
+		Provider:            client.Provider,
+		AllowedModels:       []string{},
+		DefaultModel:        client.DefaultModel,
+		Scopes:              []string{},
+		RateLimitPerMinute:  client.RateLimitPerMinute,
+		TokenLimitPerMinute: client.TokenLimitPerMinute,
+		MonthlyBudget:       client.MonthlyBudget,
+		ModelQuotas:         database.ParseModelQuotas(client),
+		ExpiresAt:           client.ExpiresAt,
+		IsActive:            client.IsActive,
+	}
+	if client.RateLimitPerMinute > 0 {
+		resp.RateLimitBurst = database.RateLimitBurst(client)
+	}
+	json.Unmarshal([]byte(client.AllowedModels), &resp.AllowedModels)
+	json.Unmarshal([]byte(client.Scopes), &resp.Scopes)
+
+	respondJSON(w, http.StatusOK, resp)
+}
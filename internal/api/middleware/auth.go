@@ -3,7 +3,10 @@ package middleware
 import (
 	"context"
 	"encoding/json"
+	"math"
 	"net/http"
+	"net/netip"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -11,6 +14,9 @@ import (
 	"github.com/andrew/ai-cli-server/internal/auth"
 	"github.com/andrew/ai-cli-server/internal/database"
 	"github.com/andrew/ai-cli-server/internal/database/models"
+	"github.com/andrew/ai-cli-server/internal/tracing"
+	"github.com/andrew/ai-cli-server/internal/webhook"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/time/rate"
 )
 
@@ -21,32 +27,36 @@ const ClientContextKey contextKey = "client"
 
 // AuthMiddleware validates API keys and loads client information
 type AuthMiddleware struct {
-	db *database.DB
+	db             database.Store
+	trustedProxies []netip.Prefix
 }
 
 // NewAuthMiddleware creates a new authentication middleware
-func NewAuthMiddleware(db *database.DB) *AuthMiddleware {
-	return &AuthMiddleware{db: db}
+// X-Forwarded-For is only honored for requests arriving from trustedProxies
+func NewAuthMiddleware(db database.Store, trustedProxies []string) *AuthMiddleware {
+	prefixes, _ := auth.ParseIPPrefixes(trustedProxies) // Validated at config load
+	return &AuthMiddleware{db: db, trustedProxies: prefixes}
 }
 
 // Authenticate validates the API key and loads client into context
 func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Rejections end the span on return; accepted requests end it before
+		// the handler runs. Ending a span twice is a no-op.
+		_, span := tracing.Start(r.Context(), "auth")
+		defer span.End()
+
 		// Extract API key from Authorization header
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			respondJSON(w, http.StatusUnauthorized, map[string]string{
-				"error": "missing authorization header",
-			})
+			RespondError(w, r, http.StatusUnauthorized, "missing authorization header")
 			return
 		}
 
 		// Parse Bearer token
 		parts := strings.SplitN(authHeader, " ", 2)
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			respondJSON(w, http.StatusUnauthorized, map[string]string{
-				"error": "invalid authorization header format",
-			})
+			RespondError(w, r, http.StatusUnauthorized, "invalid authorization header format")
 			return
 		}
 
@@ -54,67 +64,130 @@ func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 
 		// Validate API key format
 		if !auth.ValidateAPIKeyFormat(apiKey) {
-			respondJSON(w, http.StatusUnauthorized, map[string]string{
-				"error": "invalid API key format",
-			})
+			RespondError(w, r, http.StatusUnauthorized, "invalid API key format")
 			return
 		}
 
-		// Hash and lookup client
-		keyHash := auth.HashAPIKey(apiKey)
-		client, err := m.db.GetClientByAPIKeyHash(keyHash)
+		// Find the client by lookup ID, or by SHA-256 for keys with a legacy hash
+		legacyHash := auth.LegacyHashAPIKey(apiKey)
+		client, err := m.db.GetClientByAPIKeyLookup(auth.APIKeyLookup(apiKey))
+		if err == nil && client == nil {
+			client, err = m.db.GetClientByAPIKeyHash(legacyHash)
+		}
 		if err != nil {
-			respondJSON(w, http.StatusInternalServerError, map[string]string{
-				"error": "failed to validate API key",
-			})
+			RespondError(w, r, http.StatusInternalServerError, "failed to validate API key")
 			return
 		}
 
-		if client == nil {
-			respondJSON(w, http.StatusUnauthorized, map[string]string{
-				"error": "invalid API key",
-			})
+		if client == nil || !auth.VerifyAPIKey(apiKey, client.APIKeyHash) {
+			RespondError(w, r, http.StatusUnauthorized, "invalid API key")
 			return
 		}
 
+		// Now that the key is known, replace a legacy hash with an Argon2id one.
+		// Failing to upgrade doesn't fail the request; the next one retries.
+		if auth.IsLegacyHash(client.APIKeyHash) {
+			m.db.UpgradeClientKeyHash(client.ID, legacyHash, auth.APIKeyLookup(apiKey), auth.HashAPIKey(apiKey))
+		}
+
 		// Check if client is active
 		if !client.IsActive {
-			respondJSON(w, http.StatusForbidden, map[string]string{
-				"error": "API key is inactive",
-			})
+			RespondError(w, r, http.StatusForbidden, "API key is inactive")
 			return
 		}
 
 		// Check if client is expired
 		if client.ExpiresAt != nil && client.ExpiresAt.Before(time.Now()) {
-			respondJSON(w, http.StatusForbidden, map[string]string{
-				"error": "API key has expired",
-			})
+			RespondError(w, r, http.StatusForbidden, "API key has expired")
 			return
 		}
 
+		// Check source IP against the client's allowlist
+		if !m.isIPAllowed(r, client) {
+			RespondError(w, r, http.StatusForbidden, "source IP is not allowed for this API key")
+			return
+		}
+
+		span.SetAttributes(tracing.AttrClientID.Int64(client.ID))
+		span.End()
+		tracing.SetClient(r.Context(), client.ID)
+
 		// Add client to context
 		ctx := context.WithValue(r.Context(), ClientContextKey, client)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// isIPAllowed checks the request source IP against the client's allowlist
+// An empty allowlist means no restriction
+func (m *AuthMiddleware) isIPAllowed(r *http.Request, client *models.Client) bool {
+	allowed, err := auth.ParseAllowedIPs(client.AllowedIPs)
+	if err != nil {
+		return false
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+
+	ip, ok := m.clientIP(r)
+	if !ok {
+		return false
+	}
+	return auth.IPInPrefixes(ip, allowed)
+}
+
+// clientIP resolves the request source IP, walking X-Forwarded-For from the
+// nearest hop while the hops are trusted proxies
+func (m *AuthMiddleware) clientIP(r *http.Request) (netip.Addr, bool) {
+	var ip netip.Addr
+	if addrPort, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		ip = addrPort.Addr().Unmap()
+	} else if addr, err := netip.ParseAddr(r.RemoteAddr); err == nil {
+		ip = addr.Unmap()
+	} else {
+		return netip.Addr{}, false
+	}
+
+	if !auth.IPInPrefixes(ip, m.trustedProxies) {
+		return ip, true
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		ip = hop.Unmap()
+		if !auth.IPInPrefixes(ip, m.trustedProxies) {
+			break
+		}
+	}
+	return ip, true
+}
+
 // RateLimitMiddleware implements per-client rate limiting
 type RateLimitMiddleware struct {
-	db       *database.DB
+	db       database.Store
+	notifier *webhook.Notifier
 	limiters map[int64]*rate.Limiter
 	mu       sync.RWMutex
 }
 
-// NewRateLimitMiddleware creates a new rate limiting middleware
-func NewRateLimitMiddleware(db *database.DB) *RateLimitMiddleware {
+// NewRateLimitMiddleware creates a new rate limiting middleware that cleans up
+// old buckets and idle limiters every cleanupInterval (plus jitter)
+func NewRateLimitMiddleware(db database.Store, notifier *webhook.Notifier, cleanupInterval time.Duration) *RateLimitMiddleware {
 	m := &RateLimitMiddleware{
 		db:       db,
+		notifier: notifier,
 		limiters: make(map[int64]*rate.Limiter),
 	}
 
 	// Start cleanup goroutine
-	go m.cleanupLimiters()
+	go m.cleanupLimiters(cleanupInterval)
 
 	return m
 }
@@ -124,40 +197,103 @@ func (m *RateLimitMiddleware) RateLimit(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		client := GetClientFromContext(r.Context())
 		if client == nil {
-			respondJSON(w, http.StatusInternalServerError, map[string]string{
-				"error": "client not found in context",
-			})
+			RespondError(w, r, http.StatusInternalServerError, "client not found in context")
 			return
 		}
 
-		// Get or create limiter for this client
-		limiter := m.getLimiter(client.ID, client.RateLimitPerMinute)
-
-		// Check rate limit
-		if !limiter.Allow() {
-			respondJSON(w, http.StatusTooManyRequests, map[string]string{
-				"error": "rate limit exceeded",
-			})
+		_, span := tracing.Start(r.Context(), "rate_limit", tracing.AttrClientID.Int64(client.ID))
+		allowed := m.Allow(client, r.URL.Path)
+		span.SetAttributes(attribute.Bool("rate_limit.allowed", allowed))
+		span.End()
+		m.setRateLimitHeaders(w, client, !allowed)
+		if !allowed {
+			RespondError(w, r, http.StatusTooManyRequests, "rate limit exceeded")
 			return
 		}
 
-		// Record in database for persistent tracking
-		windowStart := time.Now().Truncate(time.Minute)
-		if err := m.db.IncrementRateLimitBucket(client.ID, windowStart); err != nil {
-			// Log error but don't fail the request
-		}
-
 		next.ServeHTTP(w, r)
 	})
 }
 
-// getLimiter gets or creates a rate limiter for a client
-func (m *RateLimitMiddleware) getLimiter(clientID int64, ratePerMinute int) *rate.Limiter {
+// setRateLimitHeaders reports the client's request allowance so well-behaved
+// clients can throttle themselves. Values come from the token bucket that
+// enforces the limit: Remaining is the whole requests left in the bucket and
+// Reset the Unix time it will be full again. Retry-After is added on rejections.
+// Unlimited clients get no headers.
+func (m *RateLimitMiddleware) setRateLimitHeaders(w http.ResponseWriter, client *models.Client, rejected bool) {
+	if client.RateLimitPerMinute <= 0 {
+		return
+	}
+	limiter := m.getLimiter(client)
+	now := time.Now()
+	tokens := limiter.TokensAt(now)
+
+	header := w.Header()
+	header.Set("X-RateLimit-Limit", strconv.Itoa(client.RateLimitPerMinute))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(int(math.Max(0, math.Floor(tokens)))))
+
+	perSecond := float64(limiter.Limit())
+	if perSecond <= 0 {
+		return
+	}
+	untilFull := (float64(limiter.Burst()) - tokens) / perSecond
+	resetAt := float64(now.UnixNano())/float64(time.Second) + untilFull
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(int64(math.Ceil(resetAt)), 10))
+	if rejected {
+		untilNext := math.Ceil((1 - tokens) / perSecond)
+		header.Set("Retry-After", strconv.Itoa(int(math.Max(1, untilNext))))
+	}
+}
+
+// Allow consumes one request from the client's allowance for path
+// Returns false and fires a webhook notification when the limit is exceeded
+func (m *RateLimitMiddleware) Allow(client *models.Client, path string) bool {
+	// Get or create limiter for this client
+	limiter := m.getLimiter(client)
+
+	// Check rate limit
+	if !limiter.Allow() {
+		m.notifier.Notify(webhook.Event{
+			Type:     webhook.EventRateLimitExceeded,
+			ClientID: client.ID,
+			Details: map[string]interface{}{
+				"client_name":           client.Name,
+				"rate_limit_per_minute": client.RateLimitPerMinute,
+				"path":                  path,
+			},
+		})
+		return false
+	}
+
+	// Record in database for persistent tracking
+	windowStart := time.Now().Truncate(time.Minute)
+	if err := m.db.IncrementRateLimitBucket(client.ID, windowStart); err != nil {
+		// Log error but don't fail the request
+	}
+
+	return true
+}
+
+// getLimiter gets or creates a rate limiter for a client. A cached limiter
+// built for a different rate or burst (the client's limit was updated, or its
+// ID now belongs to a new client) is replaced.
+func (m *RateLimitMiddleware) getLimiter(client *models.Client) *rate.Limiter {
+	// Rate per minute converted to per second. A limit of zero is unlimited;
+	// rate.Inf allows every event whatever the burst.
+	limit, burst := rate.Inf, 0
+	if client.RateLimitPerMinute > 0 {
+		limit = rate.Limit(float64(client.RateLimitPerMinute) / 60.0)
+		burst = database.RateLimitBurst(client)
+	}
+	current := func(l *rate.Limiter) bool {
+		return l.Limit() == limit && l.Burst() == burst
+	}
+
 	m.mu.RLock()
-	limiter, exists := m.limiters[clientID]
+	limiter, exists := m.limiters[client.ID]
 	m.mu.RUnlock()
 
-	if exists {
+	if exists && current(limiter) {
 		return limiter
 	}
 
@@ -165,28 +301,62 @@ func (m *RateLimitMiddleware) getLimiter(clientID int64, ratePerMinute int) *rat
 	defer m.mu.Unlock()
 
 	// Double-check after acquiring write lock
-	if limiter, exists := m.limiters[clientID]; exists {
+	if limiter, exists := m.limiters[client.ID]; exists && current(limiter) {
 		return limiter
 	}
 
-	// Create new limiter (rate per minute converted to per second)
-	ratePerSecond := float64(ratePerMinute) / 60.0
-	limiter = rate.NewLimiter(rate.Limit(ratePerSecond), ratePerMinute)
-	m.limiters[clientID] = limiter
+	limiter = rate.NewLimiter(limit, burst)
+	m.limiters[client.ID] = limiter
 
 	return limiter
 }
 
-// cleanupLimiters removes inactive limiters periodically
-func (m *RateLimitMiddleware) cleanupLimiters() {
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
+// cleanupLimiters removes inactive limiters and stale database rows periodically.
+// Each wait is jittered so a fleet of servers doesn't clean up in lockstep.
+func (m *RateLimitMiddleware) cleanupLimiters(interval time.Duration) {
+	for {
+		time.Sleep(database.Jitter(interval))
+
+		m.pruneIdleLimiters(time.Now())
+		if ids, err := m.db.ListClientIDs(); err == nil {
+			m.pruneDeletedLimiters(ids)
+		}
 
-	for range ticker.C {
 		// Cleanup old rate limit buckets in database
 		if err := m.db.CleanupOldRateLimitBuckets(time.Now().Add(-1 * time.Hour)); err != nil {
 			// Log error
 		}
+
+		// Evict expired cached responses
+		if err := m.db.DeleteExpiredCacheEntries(time.Now()); err != nil {
+			// Log error
+		}
+	}
+}
+
+// pruneIdleLimiters drops limiters whose bucket has refilled completely. A full
+// bucket behaves exactly like a new one, so clients that have gone quiet are
+// forgotten without loosening their limit.
+func (m *RateLimitMiddleware) pruneIdleLimiters(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for clientID, limiter := range m.limiters {
+		if limiter.TokensAt(now) >= float64(limiter.Burst()) {
+			delete(m.limiters, clientID)
+		}
+	}
+}
+
+// pruneDeletedLimiters drops limiters of clients that no longer exist
+func (m *RateLimitMiddleware) pruneDeletedLimiters(clientIDs map[int64]bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for clientID := range m.limiters {
+		if !clientIDs[clientID] {
+			delete(m.limiters, clientID)
+		}
 	}
 }
 
@@ -0,0 +1,319 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/auth"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+// okHandler answers every request with 200
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+func TestRateLimitZeroIsUnlimited(t *testing.T) {
+	db := testDB(t)
+	client := testClient(t, db, func(c *models.Client) { c.RateLimitPerMinute = 0 })
+	handler := NewRateLimitMiddleware(db, nil, time.Hour).RateLimit(okHandler)
+
+	for i := range 500 {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, asClient(httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil), client))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d got %d, want every request allowed", i+1, rec.Code)
+		}
+		if limit := rec.Header().Get("X-RateLimit-Limit"); limit != "" {
+			t.Fatalf("unlimited client got X-RateLimit-Limit %q", limit)
+		}
+	}
+}
+
+func TestRateLimitThrottlesPastBurst(t *testing.T) {
+	db := testDB(t)
+	client := testClient(t, db, func(c *models.Client) { c.RateLimitPerMinute, c.RateLimitBurst = 60, 3 })
+	handler := NewRateLimitMiddleware(db, nil, time.Hour).RateLimit(okHandler)
+
+	for i := range 4 {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, asClient(httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil), client))
+		want := http.StatusOK
+		if i == 3 {
+			want = http.StatusTooManyRequests
+		}
+		if rec.Code != want {
+			t.Fatalf("request %d got %d, want %d", i+1, rec.Code, want)
+		}
+		if rec.Header().Get("X-RateLimit-Limit") != "60" {
+			t.Errorf("request %d X-RateLimit-Limit = %q, want 60", i+1, rec.Header().Get("X-RateLimit-Limit"))
+		}
+		if i == 3 && rec.Header().Get("Retry-After") == "" {
+			t.Error("throttled request has no Retry-After")
+		}
+	}
+}
+
+func TestRateLimitFollowsUpdatedLimit(t *testing.T) {
+	db := testDB(t)
+	client := testClient(t, db, func(c *models.Client) { c.RateLimitPerMinute, c.RateLimitBurst = 60, 1 })
+	m := NewRateLimitMiddleware(db, nil, time.Hour)
+
+	if !m.Allow(client, "/") || m.Allow(client, "/") {
+		t.Fatal("a burst of 1 should allow exactly one request")
+	}
+	// Lifting the limit takes effect on the next request
+	client.RateLimitPerMinute = 0
+	for range 10 {
+		if !m.Allow(client, "/") {
+			t.Fatal("request throttled after the limit was lifted")
+		}
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	db := testDB(t)
+	client := testClient(t, db, func(c *models.Client) { c.RateLimitPerMinute, c.RateLimitBurst = 60, 2 })
+	handler := NewRateLimitMiddleware(db, nil, time.Hour).RateLimit(okHandler)
+
+	tests := []struct {
+		wantStatus     int
+		wantRemaining  string
+		wantRetryAfter bool
+	}{
+		{http.StatusOK, "1", false},
+		{http.StatusOK, "0", false},
+		{http.StatusTooManyRequests, "0", true},
+	}
+	for i, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, asClient(httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil), client))
+		header := rec.Header()
+		if rec.Code != tt.wantStatus {
+			t.Fatalf("request %d got %d, want %d", i+1, rec.Code, tt.wantStatus)
+		}
+		if got := header.Get("X-RateLimit-Limit"); got != "60" {
+			t.Errorf("request %d X-RateLimit-Limit = %q, want 60", i+1, got)
+		}
+		if got := header.Get("X-RateLimit-Remaining"); got != tt.wantRemaining {
+			t.Errorf("request %d X-RateLimit-Remaining = %q, want %s", i+1, got, tt.wantRemaining)
+		}
+		reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+		if err != nil || reset < time.Now().Unix() || reset > time.Now().Add(3*time.Second).Unix() {
+			t.Errorf("request %d X-RateLimit-Reset = %q, want a time within the 2s refill", i+1, header.Get("X-RateLimit-Reset"))
+		}
+		if got := header.Get("Retry-After"); (got != "") != tt.wantRetryAfter {
+			t.Errorf("request %d Retry-After = %q, want it only on the rejection", i+1, got)
+		} else if tt.wantRetryAfter && got != "1" {
+			t.Errorf("Retry-After = %q, want 1 at one request per second", got)
+		}
+	}
+}
+
+func TestIdleLimitersAgeOut(t *testing.T) {
+	db := testDB(t)
+	m := NewRateLimitMiddleware(db, nil, time.Hour)
+	busy := testClient(t, db, func(c *models.Client) { c.RateLimitPerMinute, c.RateLimitBurst = 60, 5 })
+	idle := testClient(t, db, func(c *models.Client) { c.Name += "-idle"; c.RateLimitPerMinute, c.RateLimitBurst = 60, 5 })
+
+	m.Allow(busy, "/")
+	m.Allow(idle, "/")
+	if len(m.limiters) != 2 {
+		t.Fatalf("%d limiters, want 2", len(m.limiters))
+	}
+
+	// Both buckets are still refilling, so neither is forgotten yet
+	m.pruneIdleLimiters(time.Now())
+	if len(m.limiters) != 2 {
+		t.Fatalf("%d limiters after pruning refilling buckets, want 2", len(m.limiters))
+	}
+
+	// A second later the idle client's bucket is full again; the busy
+	// client's isn't, having spent its whole burst
+	for range 5 {
+		m.Allow(busy, "/")
+	}
+	m.pruneIdleLimiters(time.Now().Add(1100 * time.Millisecond))
+	if _, ok := m.limiters[idle.ID]; ok || len(m.limiters) != 1 {
+		t.Errorf("limiters = %v, want only the busy client's", m.limiters)
+	}
+}
+
+func TestRateChangeTakesEffect(t *testing.T) {
+	db := testDB(t)
+	m := NewRateLimitMiddleware(db, nil, time.Hour)
+	client := testClient(t, db, func(c *models.Client) { c.RateLimitPerMinute = 4 }) // A burst of 1
+
+	if !m.Allow(client, "/") || m.Allow(client, "/") {
+		t.Fatal("4 requests per minute should allow exactly one request at once")
+	}
+
+	// Raising the limit through UpdateClient applies to the client as the
+	// auth middleware next loads it, without waiting for the old bucket
+	client.RateLimitPerMinute = 40
+	if err := db.UpdateClient(client); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := db.GetClientByID(client.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 10 {
+		if !m.Allow(reloaded, "/") {
+			t.Fatalf("request %d throttled after the limit was raised to a burst of 10", i+1)
+		}
+	}
+}
+
+func TestDeletedClientLimitersAreEvicted(t *testing.T) {
+	db := testDB(t)
+	m := NewRateLimitMiddleware(db, nil, time.Hour)
+	kept := testClient(t, db, func(c *models.Client) { c.RateLimitPerMinute = 60 })
+	deleted := testClient(t, db, func(c *models.Client) { c.Name += "-deleted"; c.RateLimitPerMinute = 60 })
+	m.Allow(kept, "/")
+	m.Allow(deleted, "/")
+
+	if err := db.DeleteClient(deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := db.ListClientIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.pruneDeletedLimiters(ids)
+
+	if _, ok := m.limiters[deleted.ID]; ok {
+		t.Error("deleted client's limiter was kept")
+	}
+	if _, ok := m.limiters[kept.ID]; !ok {
+		t.Error("existing client's limiter was evicted")
+	}
+}
+
+func TestAuthenticateUpgradesLegacyHashes(t *testing.T) {
+	db := testDB(t)
+	handler := NewAuthMiddleware(db, nil).Authenticate(okHandler)
+
+	keys := map[string]string{}
+	for _, name := range []string{"legacy", "argon2id"} {
+		key, err := auth.GenerateAPIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[name] = key
+		testClient(t, db, func(c *models.Client) {
+			c.Name = name
+			if name == "legacy" {
+				c.APIKeyHash = auth.LegacyHashAPIKey(key)
+			} else {
+				c.APIKeyHash, c.APIKeyLookup = auth.HashAPIKey(key), auth.APIKeyLookup(key)
+			}
+		})
+	}
+	wrong, _ := auth.GenerateAPIKey()
+
+	authenticate := func(key string) int {
+		r := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		r.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+	for name, key := range keys {
+		if code := authenticate(key); code != http.StatusOK {
+			t.Errorf("%s key got %d, want 200", name, code)
+		}
+	}
+	if code := authenticate(wrong); code != http.StatusUnauthorized {
+		t.Errorf("unknown key got %d, want 401", code)
+	}
+
+	// The legacy key's first use replaced its hash, and it still authenticates
+	client, err := db.GetClientByAPIKeyLookup(auth.APIKeyLookup(keys["legacy"]))
+	if err != nil || client == nil || auth.IsLegacyHash(client.APIKeyHash) {
+		t.Fatalf("legacy client after use = %+v, %v; want an Argon2id hash found by lookup", client, err)
+	}
+	if code := authenticate(keys["legacy"]); code != http.StatusOK {
+		t.Errorf("upgraded legacy key got %d, want 200", code)
+	}
+}
+
+func TestAuthenticateAnyUnrevokedKey(t *testing.T) {
+	db := testDB(t)
+	handler := NewAuthMiddleware(db, nil).Authenticate(okHandler)
+
+	first, _ := auth.GenerateAPIKey()
+	client := testClient(t, db, func(c *models.Client) {
+		c.APIKeyHash, c.APIKeyLookup = auth.HashAPIKey(first), auth.APIKeyLookup(first)
+	})
+	second, _ := auth.GenerateAPIKey()
+	key := &models.APIKey{ClientID: client.ID, Name: "second", KeyHash: auth.HashAPIKey(second), KeyLookup: auth.APIKeyLookup(second)}
+	if err := db.CreateAPIKey(key); err != nil {
+		t.Fatal(err)
+	}
+
+	authenticate := func(key string) int {
+		r := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		r.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+	for _, apiKey := range []string{first, second} {
+		if code := authenticate(apiKey); code != http.StatusOK {
+			t.Errorf("client key got %d, want 200", code)
+		}
+	}
+
+	if _, err := db.RevokeAPIKey(client.ID, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code := authenticate(second); code != http.StatusUnauthorized {
+		t.Errorf("revoked key got %d, want 401", code)
+	}
+	if code := authenticate(first); code != http.StatusOK {
+		t.Errorf("remaining key got %d after revoking the other, want 200", code)
+	}
+}
+
+func TestBurstIsSeparateFromRate(t *testing.T) {
+	db := testDB(t)
+	m := NewRateLimitMiddleware(db, nil, time.Hour)
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		perMinute   int
+		burst       int
+		wantInitial int // Requests allowed at once
+	}{
+		{"explicit burst", 60, 5, 5},
+		{"burst above the rate", 6, 20, 20},
+		{"default burst is a quarter of the rate", 60, 0, 15},
+		{"default burst is at least one", 2, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := testClient(t, db, func(c *models.Client) { c.RateLimitPerMinute, c.RateLimitBurst = tt.perMinute, tt.burst })
+			limiter := m.getLimiter(client)
+
+			allowed := 0
+			for limiter.AllowN(now, 1) {
+				allowed++
+			}
+			if allowed != tt.wantInitial {
+				t.Errorf("%d requests allowed at once, want %d", allowed, tt.wantInitial)
+			}
+
+			// Whatever the burst, the bucket refills at the per-minute rate
+			refill := time.Minute / time.Duration(tt.perMinute)
+			if limiter.AllowN(now.Add(refill/2), 1) {
+				t.Error("a request was allowed before one refill interval passed")
+			}
+			if !limiter.AllowN(now.Add(refill+time.Millisecond), 1) {
+				t.Errorf("no request allowed after the %v refill interval", refill)
+			}
+		})
+	}
+}
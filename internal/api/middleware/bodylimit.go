@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// requestBytesKey is the context key for the request body byte counter
+const requestBytesKey contextKey = "request_bytes"
+
+// BodyLimit caps request bodies at maxBytes and counts the bytes read, so
+// handlers can record the request size with RequestBytes
+func BodyLimit(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			counter := &countingReader{ReadCloser: http.MaxBytesReader(w, r.Body, maxBytes)}
+			r.Body = counter
+			ctx := context.WithValue(r.Context(), requestBytesKey, &counter.n)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestBytes returns how many request body bytes have been read so far
+func RequestBytes(ctx context.Context) int64 {
+	n, ok := ctx.Value(requestBytesKey).(*atomic.Int64)
+	if !ok {
+		return 0
+	}
+	return n.Load()
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
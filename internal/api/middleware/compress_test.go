@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	large := `{"data":"` + strings.Repeat("usage log ", 200) + `"}`
+	small := `{"status":"ok"}`
+	respond := func(contentType, body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, body)
+		})
+	}
+
+	tests := []struct {
+		name           string
+		handler        http.Handler
+		acceptEncoding string
+		wantEncoding   string
+		wantBody       string
+	}{
+		{"large JSON", respond("application/json", large), "gzip, deflate, br", "gzip", large},
+		{"deflate only", respond("application/json; charset=utf-8", large), "deflate", "deflate", large},
+		{"gzip refused", respond("application/json", large), "gzip;q=0, deflate", "deflate", large},
+		{"not accepted", respond("application/json", large), "", "", large},
+		{"small JSON", respond("application/json", small), "gzip", "", small},
+		{"not JSON", respond("text/plain", large), "gzip", "", large},
+		{"event stream", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.WriteHeader(http.StatusCreated)
+			for range 50 {
+				io.WriteString(w, "data: {\"delta\":\"chunk of output\"}\n\n")
+				w.(http.Flusher).Flush()
+			}
+		}), "gzip", "", strings.Repeat("data: {\"delta\":\"chunk of output\"}\n\n", 50)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/usage", nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			Compress(1024)(tt.handler).ServeHTTP(rec, r)
+
+			if rec.Code != http.StatusCreated {
+				t.Errorf("status = %d, want the handler's 201", rec.Code)
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("Vary = %q, want Accept-Encoding", got)
+			}
+
+			var body io.Reader = rec.Body
+			switch tt.wantEncoding {
+			case "gzip":
+				reader, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = reader
+			case "deflate":
+				reader, err := zlib.NewReader(rec.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = reader
+			}
+			decoded, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(decoded) != tt.wantBody {
+				t.Errorf("body = %.60q..., want the handler's response", decoded)
+			}
+		})
+	}
+}
+
+func TestCompressLargeResponseIsSmaller(t *testing.T) {
+	large := `{"data":"` + strings.Repeat("usage log ", 200) + `"}`
+	handler := Compress(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Written in pieces that only pass the threshold together
+		for i := 0; i < len(large); i += 100 {
+			io.WriteString(w, large[i:min(i+100, len(large))])
+		}
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/usage", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Header().Get("Content-Encoding") != "gzip" || rec.Body.Len() >= len(large)/4 {
+		t.Errorf("response = %d bytes with Content-Encoding %q, want %d bytes gzipped well below", rec.Body.Len(), rec.Header().Get("Content-Encoding"), len(large))
+	}
+}
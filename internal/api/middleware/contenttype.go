@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"mime"
+	"net/http"
+)
+
+// RequireJSON rejects requests whose Content-Type isn't application/json with
+// 415, rather than letting the handler fail to decode a form post or an
+// unlabeled body. Parameters such as charset are allowed.
+func RequireJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			RespondError(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// Drainer tracks in-flight requests so shutdown can let them finish
+type Drainer struct {
+	mu       sync.Mutex
+	draining bool
+	active   int // Requests in flight, for progress reporting
+	inFlight sync.WaitGroup
+
+	// abort cancels the contexts of requests still running when draining times out
+	ctx   context.Context
+	abort context.CancelFunc
+}
+
+// NewDrainer creates a new request drainer
+func NewDrainer() *Drainer {
+	ctx, abort := context.WithCancel(context.Background())
+	return &Drainer{ctx: ctx, abort: abort}
+}
+
+// Track registers a request for the duration of its handler and refuses new
+// requests with 503 once draining has started
+func (d *Drainer) Track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		if d.draining {
+			d.mu.Unlock()
+			w.Header().Set("Connection", "close")
+			RespondError(w, r, http.StatusServiceUnavailable, "server is shutting down")
+			return
+		}
+		d.inFlight.Add(1)
+		d.active++
+		d.mu.Unlock()
+		defer func() {
+			d.mu.Lock()
+			d.active--
+			d.mu.Unlock()
+			d.inFlight.Done()
+		}()
+
+		// Cancel the request (and the CLI process it runs) if draining times out
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		stop := context.AfterFunc(d.ctx, cancel)
+		defer stop()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// InFlight returns the number of tracked requests still running
+func (d *Drainer) InFlight() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.active
+}
+
+// Drain stops accepting tracked requests and waits for in-flight ones to finish.
+// If ctx expires first, the remaining requests are cancelled and ctx's error is returned.
+func (d *Drainer) Drain(ctx context.Context) error {
+	d.mu.Lock()
+	d.draining = true
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		d.abort()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDrainCountsAndCancelsInFlight(t *testing.T) {
+	d := NewDrainer()
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	handler := d.Track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+	<-started
+	if got := d.InFlight(); got != 1 {
+		t.Fatalf("InFlight() = %d, want 1", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := d.Drain(ctx); err == nil {
+		t.Fatal("Drain() = nil, want the deadline with a request still running")
+	}
+	<-cancelled
+
+	// Once drained, new requests are refused and the count settles at zero
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status while draining = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	for d.InFlight() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
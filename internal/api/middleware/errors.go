@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// OpenAIError is the error object OpenAI SDKs expect under "error"
+type OpenAIError struct {
+	Message      string  `json:"message"`
+	Type         string  `json:"type"`
+	Code         *string `json:"code"`
+	FinishReason string  `json:"finish_reason,omitempty"` // How a completion that ran ended, e.g. "timeout"
+}
+
+// RespondError sends an error response. Public /v1 routes use the OpenAI
+// envelope {"error":{"message","type","code"}} so OpenAI SDKs can parse it;
+// admin and other routes keep the plain {"error":"..."} shape.
+func RespondError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	RespondFinishedError(w, r, status, message, "")
+}
+
+// RespondFinishedError is RespondError for a completion whose CLI ran and
+// failed, adding finishReason to the error when it is set
+func RespondFinishedError(w http.ResponseWriter, r *http.Request, status int, message, finishReason string) {
+	if !usesOpenAIErrors(r) {
+		body := map[string]string{"error": message}
+		if finishReason != "" {
+			body["finish_reason"] = finishReason
+		}
+		respondJSON(w, status, body)
+		return
+	}
+
+	errType, code := openAIErrorType(status)
+	respondJSON(w, status, map[string]OpenAIError{
+		"error": {Message: message, Type: errType, Code: code, FinishReason: finishReason},
+	})
+}
+
+// usesOpenAIErrors reports whether a request is on an OpenAI-compatible route
+func usesOpenAIErrors(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/v1/") && !strings.HasPrefix(r.URL.Path, "/v1/admin/")
+}
+
+// openAIErrorType maps an HTTP status to an OpenAI error type and code
+func openAIErrorType(status int) (string, *string) {
+	code := func(s string) *string { return &s }
+	switch {
+	case status == http.StatusUnauthorized:
+		return "authentication_error", code("invalid_api_key")
+	case status == http.StatusPaymentRequired:
+		return "insufficient_quota", code("budget_exceeded")
+	case status == http.StatusForbidden:
+		return "permission_error", nil
+	case status == http.StatusNotFound:
+		return "not_found_error", nil
+	case status == http.StatusRequestEntityTooLarge:
+		return "invalid_request_error", code("request_too_large")
+	case status == http.StatusTooManyRequests:
+		return "rate_limit_error", code("rate_limit_exceeded")
+	case status == http.StatusNotImplemented:
+		return "invalid_request_error", code("unsupported")
+	case status == http.StatusServiceUnavailable:
+		return "server_error", code("service_unavailable")
+	case status == http.StatusGatewayTimeout:
+		return "server_error", code("timeout")
+	case status >= 500:
+		return "server_error", nil
+	default:
+		return "invalid_request_error", nil
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRespondErrorShape(t *testing.T) {
+	tests := []struct {
+		path     string
+		status   int
+		openAI   bool
+		wantType string
+		wantCode string
+	}{
+		{"/v1/chat/completions", http.StatusBadRequest, true, "invalid_request_error", ""},
+		{"/v1/chat/completions", http.StatusUnauthorized, true, "authentication_error", "invalid_api_key"},
+		{"/v1/models", http.StatusTooManyRequests, true, "rate_limit_error", "rate_limit_exceeded"},
+		{"/v1/admin/clients", http.StatusBadRequest, false, "", ""},
+		{"/v1/admin/clients", http.StatusUnauthorized, false, "", ""},
+		{"/v1/admin/usage", http.StatusTooManyRequests, false, "", ""},
+		{"/health", http.StatusTooManyRequests, false, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+http.StatusText(tt.status), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			RespondError(rec, httptest.NewRequest(http.MethodGet, tt.path, nil), tt.status, "went wrong")
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %s: %v", rec.Body, err)
+			}
+			if !tt.openAI {
+				var message string
+				if err := json.Unmarshal(body["error"], &message); err != nil || message != "went wrong" {
+					t.Errorf("body = %s, want the plain {\"error\": message} shape", rec.Body)
+				}
+				return
+			}
+
+			var envelope OpenAIError
+			if err := json.Unmarshal(body["error"], &envelope); err != nil {
+				t.Fatalf("body = %s, want the OpenAI envelope: %v", rec.Body, err)
+			}
+			code := ""
+			if envelope.Code != nil {
+				code = *envelope.Code
+			}
+			if envelope.Message != "went wrong" || envelope.Type != tt.wantType || code != tt.wantCode {
+				t.Errorf("error = %s, want type %q and code %q", body["error"], tt.wantType, tt.wantCode)
+			}
+		})
+	}
+}
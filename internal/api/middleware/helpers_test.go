@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/database"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+// testDB opens a migrated database that is removed with the test
+func testDB(t *testing.T) *database.DB {
+	t.Helper()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"), database.Options{BusyTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("database.New() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// testClient creates an active client, after edit adjusts it
+func testClient(t *testing.T, db *database.DB, edit func(*models.Client)) *models.Client {
+	t.Helper()
+	client := &models.Client{Name: t.Name(), Provider: "mock", AllowedModels: `["*"]`, IsActive: true}
+	if edit != nil {
+		edit(client)
+	}
+	if client.APIKeyHash == "" {
+		client.APIKeyHash = "hash of " + client.Name // Unique, as key hashes must be
+	}
+	if err := db.CreateClient(client); err != nil {
+		t.Fatalf("CreateClient() error = %v", err)
+	}
+	return client
+}
+
+// asClient returns r as authenticated by client
+func asClient(r *http.Request, client *models.Client) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), ClientContextKey, client))
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Error rates are kept over loadWindow, in loadBuckets rotating buckets
+const (
+	loadBuckets      = 6
+	loadBucketLength = 10 * time.Second
+	loadWindow       = loadBuckets * loadBucketLength
+)
+
+// LoadTracker counts active requests and recent failures for the /status
+// endpoint. Counts cover only this process.
+type LoadTracker struct {
+	active atomic.Int64
+
+	mu      sync.Mutex
+	buckets [loadBuckets]loadBucket
+}
+
+// loadBucket holds the outcomes of requests that finished in one interval
+type loadBucket struct {
+	interval int64 // Unix time divided by loadBucketLength
+	requests int
+	errors   int
+}
+
+// LoadSnapshot is the tracker's state at a point in time
+type LoadSnapshot struct {
+	Active   int64
+	Requests int // Requests finished within the window
+	Errors   int // Of those, how many failed with a 5xx
+	Window   time.Duration
+}
+
+// NewLoadTracker creates a new load tracker
+func NewLoadTracker() *LoadTracker {
+	return &LoadTracker{}
+}
+
+// Track counts a request as active while its handler runs and records
+// whether it failed once it finishes
+func (t *LoadTracker) Track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.active.Add(1)
+		defer t.active.Add(-1)
+
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(wrapped, r)
+		t.record(time.Now(), wrapped.statusCode >= http.StatusInternalServerError)
+	})
+}
+
+// record adds a finished request to the bucket for now, resetting the bucket
+// if it last held an older interval
+func (t *LoadTracker) record(now time.Time, failed bool) {
+	interval := now.UnixNano() / int64(loadBucketLength)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := &t.buckets[interval%loadBuckets]
+	if b.interval != interval {
+		*b = loadBucket{interval: interval}
+	}
+	b.requests++
+	if failed {
+		b.errors++
+	}
+}
+
+// Snapshot returns the active request count and the outcomes within the window
+func (t *LoadTracker) Snapshot() LoadSnapshot {
+	snapshot := LoadSnapshot{Active: t.active.Load(), Window: loadWindow}
+	oldest := time.Now().UnixNano()/int64(loadBucketLength) - loadBuckets + 1
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, b := range t.buckets {
+		if b.interval >= oldest {
+			snapshot.Requests += b.requests
+			snapshot.Errors += b.errors
+		}
+	}
+	return snapshot
+}
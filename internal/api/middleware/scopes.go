@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/andrew/ai-cli-server/internal/database"
+)
+
+// RequireScope rejects requests whose API key lacks the given scope
+// Must run after Authenticate
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := GetClientFromContext(r.Context())
+			if client == nil {
+				RespondError(w, r, http.StatusInternalServerError, "client not found in context")
+				return
+			}
+
+			if !database.HasScope(client, scope) {
+				RespondError(w, r, http.StatusForbidden, fmt.Sprintf("API key is missing required scope: %s", scope))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
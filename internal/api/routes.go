@@ -4,57 +4,252 @@ import (
 	"log"
 	"net/http"
 
-	"github.com/andrew/ai-cli-server/internal/agents/copilot"
-	"github.com/andrew/ai-cli-server/internal/agents/cursor"
+	"github.com/andrew/ai-cli-server/internal/agents"
 	"github.com/andrew/ai-cli-server/internal/api/handlers"
 	"github.com/andrew/ai-cli-server/internal/api/middleware"
+	"github.com/andrew/ai-cli-server/internal/config"
 	"github.com/andrew/ai-cli-server/internal/database"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+	"github.com/andrew/ai-cli-server/internal/webhook"
 )
 
 // SetupRoutes configures all API routes
 func SetupRoutes(
-	db *database.DB,
-	copilotProvider *copilot.Provider,
-	cursorProvider *cursor.Provider,
+	cfg *config.Config,
+	db database.Store,
+	providers []agents.Provider,
+	drainer *middleware.Drainer,
 	logger *log.Logger,
 ) http.Handler {
 	mux := http.NewServeMux()
 
-	// Create handlers
-	chatHandler := handlers.NewChatHandler(db, copilotProvider, cursorProvider)
-	usageHandler := handlers.NewUsageHandler(db)
+	// Webhook notifications for operational events (nil when not configured)
+	notifier := webhook.NewNotifier(cfg.Webhook, logger)
 
 	// Create middleware
-	authMiddleware := middleware.NewAuthMiddleware(db)
-	rateLimitMiddleware := middleware.NewRateLimitMiddleware(db)
+	authMiddleware := middleware.NewAuthMiddleware(db, cfg.Server.TrustedProxies)
+	rateLimitMiddleware := middleware.NewRateLimitMiddleware(db, notifier, cfg.Retention.CleanupInterval)
 	loggerMiddleware := middleware.NewLogger(logger)
 	corsMiddleware := middleware.NewCORS(nil)
 
-	// Health check (no auth required)
-	mux.HandleFunc("/health", handleHealth)
+	// Server-wide cap on concurrent CLI subprocesses
+	executions := agents.NewExecutionLimiter(cfg.Limits.MaxConcurrentExecutions, cfg.Limits.MaxQueuedExecutions, cfg.Limits.ExecutionWait)
+	load := middleware.NewLoadTracker()
+
+	// Per-phase latency is only measured when metrics are served
+	var phases *handlers.PhaseHistograms
+	if *cfg.Metrics.Enabled {
+		phases = handlers.NewPhaseHistograms()
+	}
+
+	// Create handlers
+	chatHandler := handlers.NewChatHandler(db, cfg, notifier, rateLimitMiddleware, executions, phases, providers...)
+	usageHandler := handlers.NewUsageHandler(db)
+	adminHandler := handlers.NewAdminHandler(db, cfg, logger)
+	healthHandler := handlers.NewHealthHandler(providers...)
+	modelsHandler := handlers.NewModelsHandler(providers...)
+	sessionHandler := handlers.NewSessionHandler(db)
+	metricsHandler := handlers.NewMetricsHandler(executions, phases)
+	statusHandler := handlers.NewStatusHandler(executions, load, providers...)
+	toolsHandler := handlers.NewToolsHandler(providers...)
+
+	// Health checks (no auth required)
+	// /health is a cheap liveness check, /health/ready probes provider availability
+	mux.HandleFunc("GET /health", handleHealth)
+	mux.HandleFunc("GET /health/ready", healthHandler.HandleReady)
+
+	// Metrics for scraping (no auth required, like health checks)
+	if *cfg.Metrics.Enabled {
+		mux.HandleFunc("GET /metrics", metricsHandler.HandleMetrics)
+	}
 
-	// Public API routes (require auth and rate limiting)
-	mux.Handle("/v1/chat/completions", applyMiddleware(
+	// Load for autoscalers, optionally limited to admin keys
+	if cfg.Server.StatusAdminOnly {
+		mux.Handle("GET /status", applyMiddleware(
+			http.HandlerFunc(statusHandler.HandleStatus),
+			authMiddleware.Authenticate,
+			middleware.RequireScope(models.ScopeAdmin),
+		))
+	} else {
+		mux.HandleFunc("GET /status", statusHandler.HandleStatus)
+	}
+
+	// Public API routes (require auth and rate limiting). Every route names its
+	// method, so the mux answers any other with 405 and an Allow header; CORS
+	// preflight OPTIONS requests are answered before they reach it.
+	// Routes that run a CLI are tracked so shutdown can drain them and /status
+	// can report load. Their bodies must be labeled JSON, else 415.
+	mux.Handle("POST /v1/chat/completions", applyMiddleware(
 		http.HandlerFunc(chatHandler.HandleChatCompletion),
+		drainer.Track,
+		load.Track,
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeChat),
+		middleware.RequireJSON,
+		rateLimitMiddleware.RateLimit,
+	))
+
+	mux.Handle("POST /v1/openai/chat/completions", applyMiddleware(
+		http.HandlerFunc(chatHandler.HandleOpenAIChatCompletion),
+		drainer.Track,
+		load.Track,
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeChat),
+		middleware.RequireJSON,
+		rateLimitMiddleware.RateLimit,
+	))
+
+	// Batch items each consume one request of the client's rate limit, so the
+	// rate limit middleware is not applied to the batch request itself
+	mux.Handle("POST /v1/chat/completions/batch", applyMiddleware(
+		http.HandlerFunc(chatHandler.HandleBatchCompletion),
+		drainer.Track,
+		load.Track,
 		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeChat),
+		middleware.RequireJSON,
+	))
+
+	mux.Handle("POST /v1/embeddings", applyMiddleware(
+		http.HandlerFunc(chatHandler.HandleEmbeddings),
+		drainer.Track,
+		load.Track,
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeChat),
+		middleware.RequireJSON,
 		rateLimitMiddleware.RateLimit,
 	))
 
-	mux.Handle("/v1/usage", applyMiddleware(
+	// Estimates run no CLI and record no usage, so they aren't tracked or rate limited
+	mux.Handle("POST /v1/estimate", applyMiddleware(
+		http.HandlerFunc(chatHandler.HandleEstimate),
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeChat),
+		middleware.RequireJSON,
+	))
+
+	// Any valid key may inspect itself, whatever its scopes
+	mux.Handle("GET /v1/whoami", applyMiddleware(
+		http.HandlerFunc(handlers.HandleWhoAmI),
+		authMiddleware.Authenticate,
+	))
+	mux.Handle("GET /v1/tools", applyMiddleware(
+		http.HandlerFunc(toolsHandler.HandleListTools),
+		authMiddleware.Authenticate,
+	))
+
+	mux.Handle("GET /v1/models", applyMiddleware(
+		http.HandlerFunc(modelsHandler.HandleListModels),
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeChat),
+	))
+
+	mux.Handle("GET /v1/usage", applyMiddleware(
 		http.HandlerFunc(usageHandler.HandleGetUsage),
 		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeUsageRead),
 	))
 
-	mux.Handle("/v1/usage/stats", applyMiddleware(
+	mux.Handle("GET /v1/usage/stats", applyMiddleware(
 		http.HandlerFunc(usageHandler.HandleGetUsageStats),
 		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeUsageRead),
+	))
+
+	mux.Handle("GET /v1/usage/timeseries", applyMiddleware(
+		http.HandlerFunc(usageHandler.HandleGetUsageTimeSeries),
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeUsageRead),
+	))
+
+	mux.Handle("GET /v1/sessions", applyMiddleware(
+		http.HandlerFunc(sessionHandler.HandleListSessions),
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeUsageRead),
+	))
+
+	mux.Handle("DELETE /v1/sessions/{session_id}", applyMiddleware(
+		http.HandlerFunc(sessionHandler.HandleRevokeSession),
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeChat),
+	))
+
+	// Client management lives in the CLI (./bin/server --manage); only usage
+	// inspection, resets, and (de)activation are exposed over HTTP, to keys
+	// holding the admin scope
+	mux.Handle("GET /v1/admin/clients/{id}/usage", applyMiddleware(
+		http.HandlerFunc(adminHandler.HandleGetClientUsage),
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeAdmin),
+	))
+
+	mux.Handle("GET /v1/admin/clients/{id}/usage/stats", applyMiddleware(
+		http.HandlerFunc(adminHandler.HandleGetClientUsageStats),
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeAdmin),
+	))
+
+	mux.Handle("GET /v1/admin/usage/stats", applyMiddleware(
+		http.HandlerFunc(adminHandler.HandleGetGlobalUsageStats),
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeAdmin),
+	))
+
+	mux.Handle("GET /v1/admin/clients/{id}/errors", applyMiddleware(
+		http.HandlerFunc(adminHandler.HandleGetClientErrors),
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeAdmin),
+	))
+
+	mux.Handle("DELETE /v1/admin/clients/{id}/usage", applyMiddleware(
+		http.HandlerFunc(adminHandler.HandleResetUsage),
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeAdmin),
+	))
+
+	mux.Handle("POST /v1/admin/clients/{id}/activate", applyMiddleware(
+		http.HandlerFunc(adminHandler.HandleActivateClient),
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeAdmin),
+	))
+
+	mux.Handle("POST /v1/admin/clients/{id}/deactivate", applyMiddleware(
+		http.HandlerFunc(adminHandler.HandleDeactivateClient),
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeAdmin),
 	))
 
-	// Admin endpoints have been removed - use the CLI client management mode instead
-	// Run: ./bin/server --client
+	mux.Handle("GET /v1/admin/clients/{id}/sessions", applyMiddleware(
+		http.HandlerFunc(adminHandler.HandleListClientSessions),
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeAdmin),
+	))
+
+	mux.Handle("DELETE /v1/admin/clients/{id}/sessions/{session_id}", applyMiddleware(
+		http.HandlerFunc(adminHandler.HandleRevokeClientSession),
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeAdmin),
+	))
+
+	mux.Handle("GET /v1/admin/audit", applyMiddleware(
+		http.HandlerFunc(adminHandler.HandleGetAuditLogs),
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeAdmin),
+	))
+
+	mux.Handle("POST /v1/admin/models/refresh", applyMiddleware(
+		http.HandlerFunc(modelsHandler.HandleRefreshModels),
+		authMiddleware.Authenticate,
+		middleware.RequireScope(models.ScopeAdmin),
+	))
 
 	// Apply global middleware
-	handler := corsMiddleware.Handle(mux)
+	handler := middleware.Trace(mux)
+	handler = middleware.BodyLimit(cfg.Limits.MaxRequestBytes)(handler)
+	if *cfg.Server.Compression.Enabled {
+		handler = middleware.Compress(cfg.Server.Compression.MinBytes)(handler)
+	}
+	handler = corsMiddleware.Handle(handler)
 	handler = loggerMiddleware.Log(handler)
 
 	return handler
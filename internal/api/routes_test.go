@@ -0,0 +1,80 @@
+package api
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/api/middleware"
+	"github.com/andrew/ai-cli-server/internal/config"
+	"github.com/andrew/ai-cli-server/internal/database"
+)
+
+// testRoutes sets up the routes over a migrated database and a default config
+func testRoutes(t *testing.T) http.Handler {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(""), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	db, err := database.New(filepath.Join(dir, "test.db"), database.Options{BusyTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("database.New() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return SetupRoutes(cfg, db, nil, middleware.NewDrainer(), log.New(io.Discard, "", 0))
+}
+
+func TestRoutesRejectWrongMethods(t *testing.T) {
+	handler := testRoutes(t)
+
+	tests := []struct {
+		method    string
+		path      string
+		wantAllow string
+	}{
+		{http.MethodGet, "/v1/chat/completions", "POST"},
+		{http.MethodPut, "/v1/openai/chat/completions", "POST"},
+		{http.MethodGet, "/v1/chat/completions/batch", "POST"},
+		{http.MethodGet, "/v1/embeddings", "POST"},
+		{http.MethodPost, "/v1/usage", "GET, HEAD"},
+		{http.MethodDelete, "/v1/usage/stats", "GET, HEAD"},
+		{http.MethodPost, "/v1/usage/timeseries", "GET, HEAD"},
+		{http.MethodPost, "/health", "GET, HEAD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestRoutesAnswerPreflight(t *testing.T) {
+	handler := testRoutes(t)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/v1/chat/completions", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Error("preflight response has no Access-Control-Allow-Methods header")
+	}
+}
@@ -2,7 +2,6 @@ package auth
 
 import (
 "crypto/rand"
-"crypto/sha256"
 "encoding/base64"
 "fmt"
 )
@@ -26,12 +25,6 @@ func GenerateAPIKey() (string, error) {
 	return key, nil
 }
 
-// HashAPIKey creates a SHA-256 hash of an API key for storage
-func HashAPIKey(key string) string {
-	hash := sha256.Sum256([]byte(key))
-	return base64.URLEncoding.EncodeToString(hash[:])
-}
-
 // ValidateAPIKeyFormat checks if an API key has the correct format
 func ValidateAPIKeyFormat(key string) bool {
 	if len(key) < len(APIKeyPrefix) {
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ParseIPPrefixes parses a list of IPs and CIDR ranges
+// Bare IPs are treated as single-address ranges
+func ParseIPPrefixes(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// ParseAllowedIPs parses a client's JSON-encoded IP allowlist
+func ParseAllowedIPs(allowedIPsJSON string) ([]netip.Prefix, error) {
+	if allowedIPsJSON == "" {
+		return nil, nil
+	}
+	var entries []string
+	if err := json.Unmarshal([]byte(allowedIPsJSON), &entries); err != nil {
+		return nil, fmt.Errorf("invalid allowed IPs: %w", err)
+	}
+	return ParseIPPrefixes(entries)
+}
+
+// IPInPrefixes checks if an address falls within any of the prefixes
+func IPInPrefixes(addr netip.Addr, prefixes []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
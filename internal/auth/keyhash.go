@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// API key hashes are stored in one of two forms. Keys created before hashing
+// was upgraded hold an unprefixed base64 SHA-256 digest, found by hashing the
+// presented key. Newer keys hold an Argon2id verifier; its per-key salt rules
+// out lookup by hash, so those clients are found by the key's lookup ID instead
+// and the verifier is checked afterwards. A leaked database then exposes only
+// the lookup ID (a short, non-secret part of each key) and slow hashes.
+const argon2idPrefix = "argon2id$"
+
+// Argon2id parameters, OWASP's recommended minimum
+const (
+	argon2Time    = 2
+	argon2Memory  = 19 * 1024 // KiB
+	argon2Threads = 1
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+// APIKeyLookupLength is how many characters after the prefix form a key's lookup ID
+const APIKeyLookupLength = 12
+
+// verified caches, per stored verifier, a SHA-256 digest of the key that last
+// matched it, so each key pays the Argon2id cost once per process rather than
+// on every request
+var verified sync.Map
+
+// APIKeyLookup returns the lookup ID stored alongside an Argon2id hash, or ""
+// for a key too short to have one
+func APIKeyLookup(key string) string {
+	if len(key) < len(APIKeyPrefix)+APIKeyLookupLength {
+		return ""
+	}
+	return key[len(APIKeyPrefix) : len(APIKeyPrefix)+APIKeyLookupLength]
+}
+
+// HashAPIKey creates an Argon2id verifier for an API key, for storage
+func HashAPIKey(key string) string {
+	salt := make([]byte, argon2SaltLen)
+	rand.Read(salt)
+	hash := argon2.IDKey([]byte(key), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash))
+}
+
+// LegacyHashAPIKey creates the SHA-256 hash that keys were stored as before
+// Argon2id, for finding clients that still have one
+func LegacyHashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return base64.URLEncoding.EncodeToString(hash[:])
+}
+
+// IsLegacyHash reports whether a stored hash is a legacy SHA-256 digest
+func IsLegacyHash(hash string) bool {
+	return !strings.HasPrefix(hash, argon2idPrefix)
+}
+
+// VerifyAPIKey reports whether key matches a stored hash of either form
+func VerifyAPIKey(key, hash string) bool {
+	if IsLegacyHash(hash) {
+		return subtle.ConstantTimeCompare([]byte(LegacyHashAPIKey(key)), []byte(hash)) == 1
+	}
+
+	digest := sha256.Sum256([]byte(key))
+	if cached, ok := verified.Load(hash); ok && subtle.ConstantTimeCompare(cached.([]byte), digest[:]) == 1 {
+		return true
+	}
+
+	salt, want, params, ok := parseArgon2id(hash)
+	if !ok {
+		return false
+	}
+	got := argon2.IDKey([]byte(key), salt, params.time, params.memory, params.threads, uint32(len(want)))
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return false
+	}
+	verified.Store(hash, digest[:])
+	return true
+}
+
+// argon2Params are the cost parameters recorded in a verifier
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// parseArgon2id splits a verifier made by HashAPIKey into its salt, hash, and
+// parameters. Parameters are read back rather than assumed so they can be
+// raised later without invalidating existing keys.
+func parseArgon2id(hash string) ([]byte, []byte, argon2Params, bool) {
+	var params argon2Params
+	parts := strings.Split(strings.TrimPrefix(hash, argon2idPrefix), "$")
+	if len(parts) != 4 {
+		return nil, nil, params, false
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[0], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, params, false
+	}
+	if _, err := fmt.Sscanf(parts[1], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return nil, nil, params, false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, nil, params, false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(want) == 0 {
+		return nil, nil, params, false
+	}
+	return salt, want, params, true
+}
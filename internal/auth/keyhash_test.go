@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyAPIKey(t *testing.T) {
+	key, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		hash       string
+		wantLegacy bool
+	}{
+		{"argon2id", HashAPIKey(key), false},
+		{"legacy sha-256", LegacyHashAPIKey(key), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if IsLegacyHash(tt.hash) != tt.wantLegacy {
+				t.Errorf("IsLegacyHash(%q) = %v, want %v", tt.hash, !tt.wantLegacy, tt.wantLegacy)
+			}
+			if !VerifyAPIKey(key, tt.hash) {
+				t.Error("the key doesn't verify against its own hash")
+			}
+			// Twice, as the second check of an Argon2id hash is served from the cache
+			if !VerifyAPIKey(key, tt.hash) {
+				t.Error("the key doesn't verify a second time")
+			}
+			if VerifyAPIKey(other, tt.hash) {
+				t.Error("another key verifies against the hash")
+			}
+		})
+	}
+}
+
+func TestHashAPIKeyIsSalted(t *testing.T) {
+	key, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := HashAPIKey(key), HashAPIKey(key)
+	if first == second {
+		t.Error("hashing a key twice gave the same verifier; want a fresh salt each time")
+	}
+	if strings.Contains(first, key) || strings.Contains(first, APIKeyLookup(key)) {
+		t.Errorf("verifier %q contains the key", first)
+	}
+}
+
+func TestVerifyAPIKeyRejectsMalformedVerifiers(t *testing.T) {
+	key, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range []string{
+		argon2idPrefix,
+		argon2idPrefix + "v=19$m=19456,t=2,p=1$c2FsdA",
+		argon2idPrefix + "v=1$m=19456,t=2,p=1$c2FsdA$aGFzaA",
+		argon2idPrefix + "v=19$m=19456,t=2,p=1$!!!$aGFzaA",
+	} {
+		if VerifyAPIKey(key, hash) {
+			t.Errorf("VerifyAPIKey() accepted malformed verifier %q", hash)
+		}
+	}
+}
+
+func TestAPIKeyLookup(t *testing.T) {
+	key, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lookup := APIKeyLookup(key); len(lookup) != APIKeyLookupLength || !strings.HasPrefix(key, APIKeyPrefix+lookup) {
+		t.Errorf("APIKeyLookup(%q) = %q, want the %d characters after the prefix", key, lookup, APIKeyLookupLength)
+	}
+	if lookup := APIKeyLookup(APIKeyPrefix + "short"); lookup != "" {
+		t.Errorf("APIKeyLookup() of a short key = %q, want none", lookup)
+	}
+}
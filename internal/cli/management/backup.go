@@ -0,0 +1,65 @@
+package management
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/huh"
+
+	"github.com/andrew/ai-cli-server/internal/database"
+)
+
+// BackupOutput represents JSON output for the backup and restore commands
+type BackupOutput struct {
+	Success bool   `json:"success"`
+	Path    string `json:"path,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BackupJSON writes a consistent copy of the database to dest with JSON output.
+// It is safe to run while the server is serving requests.
+func BackupJSON(db *database.DB, dest string) {
+	if err := db.Backup(dest); err != nil {
+		exitWithJSON(BackupOutput{Success: false, Error: err.Error()})
+	}
+	printBackupJSON(BackupOutput{Success: true, Path: dest})
+}
+
+// RestoreJSON replaces the database at dbPath with the backup at src, with JSON
+// output. Unless confirmed is set, the user is asked to confirm first.
+func RestoreJSON(src, dbPath string, confirmed bool) {
+	if !confirmed {
+		form := huh.NewForm(
+			huh.NewGroup(
+				huh.NewConfirm().
+					Title(fmt.Sprintf("Replace %s with %s? Stop the server first; current data will be lost.", dbPath, src)).
+					Affirmative("Yes, restore").
+					Negative("No, cancel").
+					Value(&confirmed),
+			),
+		)
+		if err := form.Run(); err != nil {
+			exitWithJSON(BackupOutput{Success: false, Error: fmt.Sprintf("confirmation failed (use -yes when not interactive): %v", err)})
+		}
+		if !confirmed {
+			exitWithJSON(BackupOutput{Success: false, Error: "cancelled"})
+		}
+	}
+
+	if err := database.Restore(src, dbPath); err != nil {
+		exitWithJSON(BackupOutput{Success: false, Error: err.Error()})
+	}
+	printBackupJSON(BackupOutput{Success: true, Path: dbPath})
+}
+
+func printBackupJSON(output BackupOutput) {
+	data, _ := json.MarshalIndent(output, "", "  ")
+	fmt.Println(string(data))
+}
+
+// exitWithJSON prints a JSON error and exits
+func exitWithJSON(output BackupOutput) {
+	printBackupJSON(output)
+	os.Exit(1)
+}
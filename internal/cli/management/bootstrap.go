@@ -0,0 +1,37 @@
+package management
+
+import (
+	"fmt"
+
+	"github.com/andrew/ai-cli-server/internal/config"
+	"github.com/andrew/ai-cli-server/internal/database"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+// BootstrapClient creates the configured bootstrap client when the database
+// has no clients, returning it with its API key. It returns a nil client when
+// bootstrapping is disabled or any client exists, so it is safe to call on
+// every startup.
+func BootstrapClient(cfg *config.Config, db *database.DB) (*models.Client, string, error) {
+	if cfg.Bootstrap.Name == "" {
+		return nil, "", nil
+	}
+	clients, err := db.ListClients()
+	if err != nil {
+		return nil, "", err
+	}
+	if len(clients) > 0 {
+		return nil, "", nil
+	}
+
+	client, apiKey, err := NewClientManager(cfg, db).createClient(AddClientInput{
+		Name:     cfg.Bootstrap.Name,
+		Provider: cfg.Bootstrap.Provider,
+		Models:   cfg.Bootstrap.Models,
+		Scopes:   cfg.Bootstrap.Scopes,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to bootstrap client %s: %w", cfg.Bootstrap.Name, err)
+	}
+	return client, apiKey, nil
+}
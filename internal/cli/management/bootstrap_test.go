@@ -0,0 +1,55 @@
+package management
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/auth"
+	"github.com/andrew/ai-cli-server/internal/config"
+	"github.com/andrew/ai-cli-server/internal/database"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+func TestBootstrapClientCreatesOnce(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	yaml := "cli:\n  mock:\n    enabled: true\nbootstrap_client:\n  name: ops\n  provider: mock\n"
+	if err := os.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	db, err := database.New(filepath.Join(dir, "test.db"), database.Options{BusyTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("database.New() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	client, apiKey, err := BootstrapClient(cfg, db)
+	if err != nil {
+		t.Fatalf("BootstrapClient() error = %v", err)
+	}
+	if client == nil || client.Name != "ops" || client.Provider != "mock" {
+		t.Fatalf("BootstrapClient() = %+v, want the ops client on mock", client)
+	}
+	if !auth.VerifyAPIKey(apiKey, client.APIKeyHash) {
+		t.Error("returned API key doesn't match the stored hash")
+	}
+	if !database.HasScope(client, models.ScopeAdmin) {
+		t.Errorf("scopes = %s, want admin by default", client.Scopes)
+	}
+
+	// A later startup finds the client and creates nothing
+	again, _, err := BootstrapClient(cfg, db)
+	if err != nil || again != nil {
+		t.Errorf("second BootstrapClient() = %+v, %v; want nothing created", again, err)
+	}
+	clients, err := db.ListClients()
+	if err != nil || len(clients) != 1 {
+		t.Errorf("ListClients() = %d clients, %v; want exactly 1", len(clients), err)
+	}
+}
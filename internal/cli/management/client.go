@@ -2,15 +2,19 @@ package management
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/huh"
 
 	"github.com/andrew/ai-cli-server/internal/agents"
 	"github.com/andrew/ai-cli-server/internal/agents/copilot"
 	"github.com/andrew/ai-cli-server/internal/agents/cursor"
+	"github.com/andrew/ai-cli-server/internal/agents/mock"
 	"github.com/andrew/ai-cli-server/internal/auth"
 	"github.com/andrew/ai-cli-server/internal/config"
 	"github.com/andrew/ai-cli-server/internal/database"
@@ -24,20 +28,21 @@ type ClientManager struct {
 	cursorProvider  *cursor.Provider
 	availableModels map[string][]string
 	modelsInfo      map[string][]agents.ModelInfo
+	defaults        config.DefaultsConfig
+	keyPolicy       config.KeyPolicyConfig
+	envDenylist     []string
+	binaryDirs      []string // Where binary_path_override may point
+	budgetPeriod    string
+	priority        []string // Provider order for defaults and listings
 }
 
 // NewClientManager creates a new client manager
 func NewClientManager(cfg *config.Config, db *database.DB) *ClientManager {
-	copilotProv := copilot.NewProvider(
-		cfg.CLI.Copilot.BinaryPath,
-		cfg.CLI.Copilot.Timeout,
-		cfg.Auth.CopilotGitHubToken,
-	)
-	cursorProv := cursor.NewProvider(
-		cfg.CLI.Cursor.BinaryPath,
-		cfg.CLI.Cursor.Timeout,
-		cfg.Auth.CursorAPIKey,
-	)
+	copilotProv := copilot.NewProvider(cfg.CLI.Copilot, cfg.Auth.CopilotGitHubToken)
+	cursorProv := cursor.NewProvider(cfg.CLI.Cursor, cfg.Auth.CursorAPIKey)
+	copilotProv.DisableModels(cfg.CLI.DisabledModels)
+	cursorProv.DisableModels(cfg.CLI.DisabledModels)
+	agents.ApplyModelCatalog([]agents.Provider{copilotProv, cursorProv}, cfg.CLI.ModelCatalog)
 
 	availableModels := make(map[string][]string)
 	modelsInfo := make(map[string][]agents.ModelInfo)
@@ -50,6 +55,13 @@ func NewClientManager(cfg *config.Config, db *database.DB) *ClientManager {
 		availableModels["cursor"] = cursorProv.GetSupportedModels()
 		modelsInfo["cursor"] = cursorProv.GetModelsInfo()
 	}
+	if cfg.CLI.Mock.Enabled {
+		mockProv := mock.NewProvider(cfg.CLI.Mock)
+		mockProv.DisableModels(cfg.CLI.DisabledModels)
+		agents.ApplyModelCatalog([]agents.Provider{mockProv}, cfg.CLI.ModelCatalog)
+		availableModels["mock"] = mockProv.GetSupportedModels()
+		modelsInfo["mock"] = mockProv.GetModelsInfo()
+	}
 
 	return &ClientManager{
 		db:              db,
@@ -57,9 +69,24 @@ func NewClientManager(cfg *config.Config, db *database.DB) *ClientManager {
 		cursorProvider:  cursorProv,
 		availableModels: availableModels,
 		modelsInfo:      modelsInfo,
+		defaults:        cfg.Defaults,
+		keyPolicy:       cfg.KeyPolicy,
+		envDenylist:     cfg.CLI.EnvDenylist,
+		binaryDirs:      cfg.CLI.AllowedBinaryDirs,
+		budgetPeriod:    cfg.Limits.BudgetPeriod,
+		priority:        cfg.CLI.ProviderPriority,
 	}
 }
 
+// providerNames returns the available providers in priority order
+func (cm *ClientManager) providerNames() []string {
+	names := make([]string, 0, len(cm.availableModels))
+	for name := range cm.availableModels {
+		names = append(names, name)
+	}
+	return config.RankProviders(cm.priority, names)
+}
+
 // Run starts the interactive TUI
 func (cm *ClientManager) Run() error {
 	for {
@@ -71,6 +98,8 @@ func (cm *ClientManager) Run() error {
 					Options(
 						huh.NewOption("Add new client", "add"),
 						huh.NewOption("List clients", "list"),
+						huh.NewOption("Manage API keys", "keys"),
+						huh.NewOption("Reset client usage", "reset-usage"),
 						huh.NewOption("Delete client", "delete"),
 						huh.NewOption("Exit", "exit"),
 					).
@@ -95,6 +124,14 @@ func (cm *ClientManager) Run() error {
 			if err := cm.listClientsInteractive(); err != nil {
 				fmt.Printf("Error: %v\n", err)
 			}
+		case "keys":
+			if err := cm.manageKeysInteractive(); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+		case "reset-usage":
+			if err := cm.resetUsageInteractive(); err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
 		case "delete":
 			if err := cm.deleteClientInteractive(); err != nil {
 				fmt.Printf("Error: %v\n", err)
@@ -108,32 +145,64 @@ func (cm *ClientManager) Run() error {
 
 // AddClientInput represents JSON input for automation
 type AddClientInput struct {
-	Name      string   `json:"name"`
-	Provider  string   `json:"provider"`
-	Models    []string `json:"models"`
-	RateLimit int      `json:"rate_limit"`
+	Name              string            `json:"name"`
+	Provider          string            `json:"provider"`
+	Models            []string          `json:"models"`
+	DefaultModel      string            `json:"default_model"`
+	RateLimit         *int              `json:"rate_limit"`       // Requests per minute; 0 is unlimited, omitted uses the default
+	RateLimitBurst    int               `json:"rate_limit_burst"` // Requests allowed at once; 0 uses a quarter of rate_limit
+	TokenLimit        int               `json:"token_limit"`      // Estimated tokens per minute; 0 is unlimited
+	MonthlyBudget     float64           `json:"monthly_budget"`   // Cost cap per budget period; 0 is uncapped
+	ModelQuotas       map[string]int    `json:"model_quotas"`     // Requests per day by model; unlisted models are unlimited
+	AllowedIPs        []string          `json:"allowed_ips"`
+	Scopes            []string          `json:"scopes"`
+	Cache             bool              `json:"cache"`
+	ToolsUnrestricted bool              `json:"tools_unrestricted"`   // Allow any CLI tool instead of the read-only set
+	AllowedTools      []string          `json:"allowed_tools"`        // Tools requests may allow; empty means any
+	DeniedTools       []string          `json:"denied_tools"`         // Tools denied on every request
+	Env               map[string]string `json:"env"`                  // Extra environment variables for CLI executions
+	SkipContentFilter bool              `json:"skip_content_filter"`  // Exempt the client from the prompt content filter
+	SystemPrompt      string            `json:"system_prompt"`        // Instructions placed ahead of every prompt
+	PromptLogging     string            `json:"prompt_logging"`       // full, truncate, hash, or none; empty uses logging.prompts
+	ExpiresAt         *time.Time        `json:"expires_at"`           // RFC3339; limited and defaulted by key_policy
+	BinaryPath        string            `json:"binary_path_override"` // CLI binary run instead of the provider's; must lie in cli.allowed_binary_dirs
 }
 
 // AddClientOutput represents JSON output for automation
 type AddClientOutput struct {
-	Success      bool   `json:"success"`
-	ClientID     int64  `json:"client_id,omitempty"`
-	APIKey       string `json:"api_key,omitempty"`
-	Provider     string `json:"provider,omitempty"`
-	DefaultModel string `json:"default_model,omitempty"`
-	Error        string `json:"error,omitempty"`
+	Success      bool       `json:"success"`
+	ClientID     int64      `json:"client_id,omitempty"`
+	APIKey       string     `json:"api_key,omitempty"`
+	Provider     string     `json:"provider,omitempty"`
+	DefaultModel string     `json:"default_model,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Error        string     `json:"error,omitempty"`
 }
 
 // ClientOutput represents a client in JSON output
 type ClientOutput struct {
-	ID            int64    `json:"id"`
-	Name          string   `json:"name"`
-	Provider      string   `json:"provider"`
-	AllowedModels []string `json:"allowed_models"`
-	DefaultModel  string   `json:"default_model"`
-	RateLimit     int      `json:"rate_limit"`
-	IsActive      bool     `json:"is_active"`
-	CreatedAt     string   `json:"created_at"`
+	ID                int64          `json:"id"`
+	Name              string         `json:"name"`
+	Provider          string         `json:"provider"`
+	AllowedModels     []string       `json:"allowed_models"`
+	DefaultModel      string         `json:"default_model"`
+	RateLimit         int            `json:"rate_limit"`
+	RateLimitBurst    int            `json:"rate_limit_burst,omitempty"`
+	TokenLimit        int            `json:"token_limit,omitempty"`
+	MonthlyBudget     float64        `json:"monthly_budget,omitempty"`
+	ModelQuotas       map[string]int `json:"model_quotas,omitempty"`
+	AllowedIPs        []string       `json:"allowed_ips"`
+	Scopes            []string       `json:"scopes"`
+	ExpiresAt         string         `json:"expires_at,omitempty"`
+	ToolsUnrestricted bool           `json:"tools_unrestricted"`
+	AllowedTools      []string       `json:"allowed_tools"`
+	DeniedTools       []string       `json:"denied_tools"`
+	SkipContentFilter bool           `json:"skip_content_filter"`
+	SystemPrompt      string         `json:"system_prompt,omitempty"`
+	PromptLogging     string         `json:"prompt_logging,omitempty"`
+	BinaryPath        string         `json:"binary_path_override,omitempty"`
+	IsActive          bool           `json:"is_active"`
+	CreatedAt         string         `json:"created_at"`
 }
 
 // ListClientsOutput represents JSON output for list command
@@ -147,6 +216,7 @@ type ListClientsOutput struct {
 type ModelInfoOutput struct {
 	Name    string `json:"name"`
 	Enabled bool   `json:"enabled"`
+	agents.ModelCapabilities
 }
 
 // ProviderModelsOutput represents a provider's models in JSON output
@@ -169,6 +239,33 @@ type DeleteClientOutput struct {
 	Error   string `json:"error,omitempty"`
 }
 
+// SetClientActiveOutput represents JSON output for the activate and deactivate commands
+type SetClientActiveOutput struct {
+	Success bool          `json:"success"`
+	Client  *ClientOutput `json:"client,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// ResetUsageOutput represents JSON output for reset-usage command
+type ResetUsageOutput struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// AuditLogsOutput represents the output for listing audit log entries
+type AuditLogsOutput struct {
+	Success bool              `json:"success"`
+	Entries []models.AuditLog `json:"entries,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// UsageReportOutput represents the output for the usage report across all clients
+type UsageReportOutput struct {
+	Success bool                     `json:"success"`
+	Report  *models.GlobalUsageStats `json:"report,omitempty"`
+	Error   string                   `json:"error,omitempty"`
+}
+
 // AddClientJSON handles automated client creation with JSON I/O
 func (cm *ClientManager) AddClientJSON(inputJSON string) {
 	var input AddClientInput
@@ -177,73 +274,167 @@ func (cm *ClientManager) AddClientJSON(inputJSON string) {
 		return
 	}
 
+	client, apiKey, err := cm.createClient(input)
+	if err != nil {
+		cm.exitWithError(AddClientOutput{Success: false, Error: err.Error()})
+		return
+	}
+
+	output := AddClientOutput{
+		Success:      true,
+		ClientID:     client.ID,
+		APIKey:       apiKey,
+		Provider:     client.Provider,
+		DefaultModel: client.DefaultModel,
+		ExpiresAt:    client.ExpiresAt,
+	}
+	cm.printJSON(output)
+}
+
+// createClient validates input, fills unset fields from the configured
+// defaults, and creates the client, returning it with its new API key
+func (cm *ClientManager) createClient(input AddClientInput) (*models.Client, string, error) {
 	// Validate input
 	if input.Name == "" {
-		cm.exitWithError(AddClientOutput{Success: false, Error: "name is required"})
-		return
+		return nil, "", errors.New("name is required")
 	}
 
-	// Default provider to first available
+	// Default provider to the highest priority one available
 	if input.Provider == "" {
-		for p := range cm.availableModels {
-			input.Provider = p
-			break
+		if names := cm.providerNames(); len(names) > 0 {
+			input.Provider = names[0]
 		}
 	}
 
 	// Validate provider is available
 	if _, ok := cm.availableModels[input.Provider]; !ok {
-		cm.exitWithError(AddClientOutput{Success: false, Error: fmt.Sprintf("provider '%s' is not available", input.Provider)})
-		return
+		return nil, "", fmt.Errorf("provider '%s' is not available", input.Provider)
 	}
 
+	// Fill unset fields from the provider's configured defaults
+	defaults := cm.defaults.ForProvider(input.Provider)
 	if len(input.Models) == 0 {
-		input.Models = []string{"*"}
+		input.Models = defaults.AllowedModels
+	}
+	if input.RateLimit == nil {
+		input.RateLimit = defaults.RateLimitPerMinute
+	}
+	if *input.RateLimit < 0 {
+		return nil, "", errors.New("rate_limit must not be negative")
+	}
+	if input.RateLimitBurst < 0 {
+		return nil, "", errors.New("rate_limit_burst must not be negative")
+	}
+	if input.TokenLimit < 0 {
+		return nil, "", errors.New("token_limit must not be negative")
+	}
+	if input.MonthlyBudget < 0 {
+		return nil, "", errors.New("monthly_budget must not be negative")
+	}
+	if _, err := auth.ParseIPPrefixes(input.AllowedIPs); err != nil {
+		return nil, "", fmt.Errorf("invalid allowed_ips: %v", err)
+	}
+	if input.AllowedIPs == nil {
+		input.AllowedIPs = []string{}
 	}
-	if input.RateLimit == 0 {
-		input.RateLimit = 60
+	if len(input.Scopes) == 0 {
+		input.Scopes = models.DefaultScopes
+	}
+	if err := database.ValidateScopes(input.Scopes); err != nil {
+		return nil, "", fmt.Errorf("invalid scopes: %v", err)
+	}
+	if err := database.ValidatePromptLogging(input.PromptLogging); err != nil {
+		return nil, "", err
+	}
+	if err := database.ValidateToolPolicy(input.Provider, input.AllowedTools, input.DeniedTools); err != nil {
+		return nil, "", err
+	}
+	if err := database.ValidateModelQuotas(input.ModelQuotas); err != nil {
+		return nil, "", err
+	}
+	if _, err := agents.ResolveBinaryPath(input.BinaryPath, cm.binaryDirs); err != nil {
+		return nil, "", err
+	}
+	if input.AllowedTools == nil {
+		input.AllowedTools = []string{}
+	}
+	if input.DeniedTools == nil {
+		input.DeniedTools = []string{}
+	}
+	expiresAt, err := cm.keyPolicy.ResolveExpiry(input.ExpiresAt, time.Now())
+	if err != nil {
+		return nil, "", err
 	}
 
-	// Determine default model
-	defaultModel := ""
-	if len(input.Models) > 0 && input.Models[0] != "*" {
-		defaultModel = input.Models[0]
-	} else if models, ok := cm.availableModels[input.Provider]; ok && len(models) > 0 {
-		defaultModel = models[0]
+	if err := agents.ValidateEnv(input.Env, cm.envDenylist); err != nil {
+		return nil, "", fmt.Errorf("invalid env: %v", err)
+	}
+	if input.Env == nil {
+		input.Env = map[string]string{}
+	}
+
+	// Determine default model: explicit, then configured, then first allowed or available
+	defaultModel := input.DefaultModel
+	if defaultModel == "" {
+		defaultModel = defaults.DefaultModel
+	}
+	if defaultModel == "" {
+		if len(input.Models) > 0 && !strings.Contains(input.Models[0], "*") {
+			defaultModel = input.Models[0]
+		} else if models, ok := cm.availableModels[input.Provider]; ok && len(models) > 0 {
+			defaultModel = models[0]
+		}
 	}
 
 	// Generate API key
 	apiKey, err := auth.GenerateAPIKey()
 	if err != nil {
-		cm.exitWithError(AddClientOutput{Success: false, Error: fmt.Sprintf("failed to generate API key: %v", err)})
-		return
+		return nil, "", fmt.Errorf("failed to generate API key: %v", err)
 	}
 
 	modelsJSON, _ := json.Marshal(input.Models)
+	allowedIPsJSON, _ := json.Marshal(input.AllowedIPs)
+	scopesJSON, _ := json.Marshal(input.Scopes)
+	envJSON, _ := json.Marshal(input.Env)
+	allowedToolsJSON, _ := json.Marshal(input.AllowedTools)
+	deniedToolsJSON, _ := json.Marshal(input.DeniedTools)
+	if input.ModelQuotas == nil {
+		input.ModelQuotas = map[string]int{}
+	}
+	modelQuotasJSON, _ := json.Marshal(input.ModelQuotas)
 
 	client := &models.Client{
-		Name:               input.Name,
-		APIKeyHash:         auth.HashAPIKey(apiKey),
-		Provider:           input.Provider,
-		AllowedModels:      string(modelsJSON),
-		DefaultModel:       defaultModel,
-		RateLimitPerMinute: input.RateLimit,
-		IsActive:           true,
+		Name:                input.Name,
+		APIKeyHash:          auth.HashAPIKey(apiKey),
+		APIKeyLookup:        auth.APIKeyLookup(apiKey),
+		Provider:            input.Provider,
+		AllowedModels:       string(modelsJSON),
+		DefaultModel:        defaultModel,
+		RateLimitPerMinute:  *input.RateLimit,
+		RateLimitBurst:      input.RateLimitBurst,
+		TokenLimitPerMinute: input.TokenLimit,
+		MonthlyBudget:       input.MonthlyBudget,
+		ModelQuotas:         string(modelQuotasJSON),
+		IsActive:            true,
+		AllowedIPs:          string(allowedIPsJSON),
+		Scopes:              string(scopesJSON),
+		CacheResponses:      input.Cache,
+		ToolsUnrestricted:   input.ToolsUnrestricted,
+		AllowedTools:        string(allowedToolsJSON),
+		DeniedTools:         string(deniedToolsJSON),
+		SkipContentFilter:   input.SkipContentFilter,
+		SystemPrompt:        input.SystemPrompt,
+		PromptLogging:       input.PromptLogging,
+		BinaryPathOverride:  input.BinaryPath,
+		ExpiresAt:           expiresAt,
+		ClientEnv:           string(envJSON),
 	}
 
 	if err := cm.db.CreateClient(client); err != nil {
-		cm.exitWithError(AddClientOutput{Success: false, Error: fmt.Sprintf("failed to create client: %v", err)})
-		return
-	}
-
-	output := AddClientOutput{
-		Success:      true,
-		ClientID:     client.ID,
-		APIKey:       apiKey,
-		Provider:     input.Provider,
-		DefaultModel: defaultModel,
+		return nil, "", fmt.Errorf("failed to create client: %v", err)
 	}
-	cm.printJSON(output)
+	cm.audit(models.AuditClientCreate, client)
+	return client, apiKey, nil
 }
 
 // ListModelsJSON handles automated model listing with JSON output
@@ -256,8 +447,9 @@ func (cm *ClientManager) ListModelsJSON() {
 	if copilotAvailable {
 		for _, m := range cm.modelsInfo["copilot"] {
 			copilotModels = append(copilotModels, ModelInfoOutput{
-				Name:    m.Name,
-				Enabled: m.Enabled,
+				Name:              m.Name,
+				Enabled:           m.Enabled,
+				ModelCapabilities: m.ModelCapabilities,
 			})
 		}
 	}
@@ -273,8 +465,9 @@ func (cm *ClientManager) ListModelsJSON() {
 	if cursorAvailable {
 		for _, m := range cm.modelsInfo["cursor"] {
 			cursorModels = append(cursorModels, ModelInfoOutput{
-				Name:    m.Name,
-				Enabled: m.Enabled,
+				Name:              m.Name,
+				Enabled:           m.Enabled,
+				ModelCapabilities: m.ModelCapabilities,
 			})
 		}
 	}
@@ -301,27 +494,100 @@ func (cm *ClientManager) ListClientsJSON() {
 
 	clientOutputs := make([]ClientOutput, len(clients))
 	for i, c := range clients {
-		var models []string
-		json.Unmarshal([]byte(c.AllowedModels), &models)
-
-		clientOutputs[i] = ClientOutput{
-			ID:            c.ID,
-			Name:          c.Name,
-			Provider:      c.Provider,
-			AllowedModels: models,
-			DefaultModel:  c.DefaultModel,
-			RateLimit:     c.RateLimitPerMinute,
-			IsActive:      c.IsActive,
-			CreatedAt:     c.CreatedAt.Format("2006-01-02 15:04:05"),
-		}
+		clientOutputs[i] = toClientOutput(c)
 	}
 
 	output := ListClientsOutput{Success: true, Clients: clientOutputs}
 	cm.printJSON(output)
 }
 
+// toClientOutput converts a client to its JSON output form
+func toClientOutput(c models.Client) ClientOutput {
+	var allowedModels []string
+	json.Unmarshal([]byte(c.AllowedModels), &allowedModels)
+	allowedIPs := []string{}
+	json.Unmarshal([]byte(c.AllowedIPs), &allowedIPs)
+	var scopes []string
+	json.Unmarshal([]byte(c.Scopes), &scopes)
+	allowedTools, deniedTools := database.ParseClientTools(&c)
+	expiresAt := ""
+	if c.ExpiresAt != nil {
+		expiresAt = c.ExpiresAt.Format("2006-01-02 15:04:05")
+	}
+
+	return ClientOutput{
+		ID:                c.ID,
+		Name:              c.Name,
+		Provider:          c.Provider,
+		AllowedModels:     allowedModels,
+		DefaultModel:      c.DefaultModel,
+		RateLimit:         c.RateLimitPerMinute,
+		RateLimitBurst:    c.RateLimitBurst,
+		TokenLimit:        c.TokenLimitPerMinute,
+		MonthlyBudget:     c.MonthlyBudget,
+		ModelQuotas:       database.ParseModelQuotas(&c),
+		AllowedIPs:        allowedIPs,
+		Scopes:            scopes,
+		ExpiresAt:         expiresAt,
+		ToolsUnrestricted: c.ToolsUnrestricted,
+		AllowedTools:      allowedTools,
+		DeniedTools:       deniedTools,
+		SkipContentFilter: c.SkipContentFilter,
+		SystemPrompt:      c.SystemPrompt,
+		PromptLogging:     c.PromptLogging,
+		BinaryPath:        c.BinaryPathOverride,
+		IsActive:          c.IsActive,
+		CreatedAt:         c.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// SetClientActiveJSON enables or disables a client's API key with JSON output.
+// An expired key can't be reactivated.
+func (cm *ClientManager) SetClientActiveJSON(clientID int64, active bool) {
+	client, err := cm.db.GetClientByID(clientID)
+	if err != nil {
+		cm.exitWithError(SetClientActiveOutput{Success: false, Error: fmt.Sprintf("failed to get client: %v", err)})
+		return
+	}
+	if client == nil {
+		cm.exitWithError(SetClientActiveOutput{Success: false, Error: fmt.Sprintf("client %d not found", clientID)})
+		return
+	}
+
+	if client.IsActive != active {
+		if active && client.ExpiresAt != nil && client.ExpiresAt.Before(time.Now()) {
+			cm.exitWithError(SetClientActiveOutput{Success: false, Error: fmt.Sprintf("client %d has expired and can't be reactivated", clientID)})
+			return
+		}
+
+		client.IsActive = active
+		if err := cm.db.UpdateClient(client); err != nil {
+			cm.exitWithError(SetClientActiveOutput{Success: false, Error: fmt.Sprintf("failed to update client: %v", err)})
+			return
+		}
+		action := models.AuditClientDeactivate
+		if active {
+			action = models.AuditClientActivate
+		}
+		cm.audit(action, client)
+	}
+
+	output := toClientOutput(*client)
+	cm.printJSON(SetClientActiveOutput{Success: true, Client: &output})
+}
+
 // DeleteClientJSON handles automated client deletion with JSON I/O
 func (cm *ClientManager) DeleteClientJSON(clientID int64) {
+	client, err := cm.db.GetClientByID(clientID)
+	if err != nil {
+		cm.exitWithError(DeleteClientOutput{Success: false, Error: fmt.Sprintf("failed to get client: %v", err)})
+		return
+	}
+	if client == nil {
+		cm.exitWithError(DeleteClientOutput{Success: false, Error: fmt.Sprintf("client %d not found", clientID)})
+		return
+	}
+
 	// Delete usage logs first
 	if err := cm.db.DeleteUsageLogsByClient(clientID); err != nil {
 		cm.exitWithError(DeleteClientOutput{Success: false, Error: fmt.Sprintf("failed to delete usage logs: %v", err)})
@@ -332,10 +598,85 @@ func (cm *ClientManager) DeleteClientJSON(clientID int64) {
 		cm.exitWithError(DeleteClientOutput{Success: false, Error: fmt.Sprintf("failed to delete client: %v", err)})
 		return
 	}
+	cm.audit(models.AuditClientDelete, client)
 
 	cm.printJSON(DeleteClientOutput{Success: true})
 }
 
+// ResetUsageJSON clears a client's usage logs, keeping the client, with JSON output
+func (cm *ClientManager) ResetUsageJSON(clientID int64) {
+	client, err := cm.db.GetClientByID(clientID)
+	if err != nil {
+		cm.exitWithError(ResetUsageOutput{Success: false, Error: fmt.Sprintf("failed to get client: %v", err)})
+		return
+	}
+	if client == nil {
+		cm.exitWithError(ResetUsageOutput{Success: false, Error: fmt.Sprintf("client %d not found", clientID)})
+		return
+	}
+
+	if err := cm.db.DeleteUsageLogsByClient(clientID); err != nil {
+		cm.exitWithError(ResetUsageOutput{Success: false, Error: fmt.Sprintf("failed to delete usage logs: %v", err)})
+		return
+	}
+	cm.audit(models.AuditUsageReset, client)
+
+	cm.printJSON(ResetUsageOutput{Success: true})
+}
+
+// AuditLogsJSON prints the most recent audit log entries with JSON output
+func (cm *ClientManager) AuditLogsJSON(limit int) {
+	logs, err := cm.db.GetAuditLogs(0, limit, 0)
+	if err != nil {
+		cm.exitWithError(AuditLogsOutput{Success: false, Error: fmt.Sprintf("failed to get audit logs: %v", err)})
+		return
+	}
+
+	cm.printJSON(AuditLogsOutput{Success: true, Entries: logs})
+}
+
+// UsageReportJSON prints usage totals across all clients and the top clients,
+// optionally limited to an RFC3339 start and end time, with JSON output
+func (cm *ClientManager) UsageReportJSON(start, end string, top int) {
+	var startTime, endTime *time.Time
+	if start != "" {
+		t, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			cm.exitWithError(UsageReportOutput{Success: false, Error: fmt.Sprintf("invalid start time: %v", err)})
+			return
+		}
+		startTime = &t
+	}
+	if end != "" {
+		t, err := time.Parse(time.RFC3339, end)
+		if err != nil {
+			cm.exitWithError(UsageReportOutput{Success: false, Error: fmt.Sprintf("invalid end time: %v", err)})
+			return
+		}
+		endTime = &t
+	}
+	if top <= 0 {
+		cm.exitWithError(UsageReportOutput{Success: false, Error: "top must be positive"})
+		return
+	}
+
+	report, err := cm.db.GetGlobalUsageStats(startTime, endTime, top)
+	if err != nil {
+		cm.exitWithError(UsageReportOutput{Success: false, Error: fmt.Sprintf("failed to get usage stats: %v", err)})
+		return
+	}
+
+	cm.printJSON(UsageReportOutput{Success: true, Report: report})
+}
+
+// audit records a management action taken through the CLI. The action has
+// already happened, so a failure to record it is reported but not fatal.
+func (cm *ClientManager) audit(action string, client *models.Client) {
+	if err := cm.db.CreateAuditLog(models.AuditActorCLI, action, client.ID, database.AuditDetails(client)); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
+
 func (cm *ClientManager) printJSON(v interface{}) {
 	data, _ := json.MarshalIndent(v, "", "  ")
 	fmt.Println(string(data))
@@ -352,11 +693,12 @@ func (cm *ClientManager) addClientInteractive() error {
 	var selectedProvider string
 	var selectedModels []string
 	var rateLimit int
+	var rateLimitBurst int
 	var defaultModel string
 
 	// Get available providers
 	providerOptions := []huh.Option[string]{}
-	for provider := range cm.availableModels {
+	for _, provider := range cm.providerNames() {
 		providerOptions = append(providerOptions, huh.NewOption(provider, provider))
 	}
 
@@ -443,6 +785,8 @@ func (cm *ClientManager) addClientInteractive() error {
 	}
 
 	if len(defaultModelOptions) > 0 {
+		// Preselect the configured default model for the provider
+		defaultModel = cm.defaults.ForProvider(selectedProvider).DefaultModel
 		form = huh.NewForm(
 			huh.NewGroup(
 				huh.NewSelect[string]().
@@ -459,14 +803,20 @@ func (cm *ClientManager) addClientInteractive() error {
 	}
 
 	// Step 4: Set rate limit
-	rateLimitStr := "60"
+	rateLimitStr := strconv.Itoa(*cm.defaults.ForProvider(selectedProvider).RateLimitPerMinute)
+	rateLimitBurstStr := "0"
 	form = huh.NewForm(
 		huh.NewGroup(
 			huh.NewInput().
 				Title("Rate Limit").
 				Description("Requests per minute (0 for unlimited)").
-				Placeholder("60").
+				Placeholder(rateLimitStr).
 				Value(&rateLimitStr),
+			huh.NewInput().
+				Title("Burst").
+				Description("Requests allowed at once (0 for a quarter of the rate limit)").
+				Placeholder(rateLimitBurstStr).
+				Value(&rateLimitBurstStr),
 		),
 	)
 
@@ -478,6 +828,16 @@ func (cm *ClientManager) addClientInteractive() error {
 	if rateLimit < 0 {
 		rateLimit = 0
 	}
+	fmt.Sscanf(rateLimitBurstStr, "%d", &rateLimitBurst)
+	if rateLimitBurst < 0 {
+		rateLimitBurst = 0
+	}
+
+	// The interactive flow takes the policy's default expiry
+	expiresAt, err := cm.keyPolicy.ResolveExpiry(nil, time.Now())
+	if err != nil {
+		return fmt.Errorf("%w by key_policy; use --add with expires_at instead", err)
+	}
 
 	// Generate API key
 	apiKey, err := auth.GenerateAPIKey()
@@ -490,16 +850,20 @@ func (cm *ClientManager) addClientInteractive() error {
 	client := &models.Client{
 		Name:               name,
 		APIKeyHash:         auth.HashAPIKey(apiKey),
+		APIKeyLookup:       auth.APIKeyLookup(apiKey),
 		Provider:           selectedProvider,
 		AllowedModels:      string(modelsJSON),
 		DefaultModel:       defaultModel,
 		RateLimitPerMinute: rateLimit,
+		RateLimitBurst:     rateLimitBurst,
+		ExpiresAt:          expiresAt,
 		IsActive:           true,
 	}
 
 	if err := cm.db.CreateClient(client); err != nil {
 		return fmt.Errorf("failed to create client: %w", err)
 	}
+	cm.audit(models.AuditClientCreate, client)
 
 	fmt.Println()
 	fmt.Println("✅ Client created successfully!")
@@ -511,6 +875,12 @@ func (cm *ClientManager) addClientInteractive() error {
 	fmt.Printf("   Models:        %v\n", selectedModels)
 	fmt.Printf("   Default Model: %s\n", defaultModel)
 	fmt.Printf("   Rate Limit:    %d req/min\n", rateLimit)
+	if rateLimit > 0 {
+		fmt.Printf("   Burst:         %d requests\n", database.RateLimitBurst(client))
+	}
+	if expiresAt != nil {
+		fmt.Printf("   Expires:       %s\n", expiresAt.Format("2006-01-02 15:04:05"))
+	}
 	fmt.Println()
 	fmt.Println("⚠️  Save the API key - it won't be shown again!")
 	fmt.Println()
@@ -533,6 +903,10 @@ func (cm *ClientManager) listClientsInteractive() error {
 	for _, client := range clients {
 		var models []string
 		json.Unmarshal([]byte(client.AllowedModels), &models)
+		var allowedIPs []string
+		json.Unmarshal([]byte(client.AllowedIPs), &allowedIPs)
+		var scopes []string
+		json.Unmarshal([]byte(client.Scopes), &scopes)
 
 		status := "✅ Active"
 		if !client.IsActive {
@@ -544,7 +918,43 @@ func (cm *ClientManager) listClientsInteractive() error {
 		fmt.Printf("   Provider:      %s\n", client.Provider)
 		fmt.Printf("   Models:        %v\n", models)
 		fmt.Printf("   Default Model: %s\n", client.DefaultModel)
-		fmt.Printf("   Rate Limit:    %d req/min\n", client.RateLimitPerMinute)
+		if client.RateLimitPerMinute > 0 {
+			fmt.Printf("   Rate Limit:    %d req/min\n", client.RateLimitPerMinute)
+			fmt.Printf("   Burst:         %d requests\n", database.RateLimitBurst(&client))
+		} else {
+			fmt.Printf("   Rate Limit:    unlimited\n")
+		}
+		if client.ExpiresAt != nil {
+			fmt.Printf("   Expires:       %s\n", client.ExpiresAt.Format("2006-01-02 15:04:05"))
+		}
+		if client.TokenLimitPerMinute > 0 {
+			fmt.Printf("   Token Limit:   %d tokens/min\n", client.TokenLimitPerMinute)
+		}
+		if client.MonthlyBudget > 0 {
+			fmt.Printf("   Budget:        %.2f per %s\n", client.MonthlyBudget, cm.budgetPeriod)
+		}
+		if quotas := database.ParseModelQuotas(&client); len(quotas) > 0 {
+			fmt.Printf("   Model Quotas:  %v per day\n", quotas)
+		}
+		if len(allowedIPs) > 0 {
+			fmt.Printf("   Allowed IPs:   %v\n", allowedIPs)
+		}
+		fmt.Printf("   Scopes:        %v\n", scopes)
+		if client.ToolsUnrestricted {
+			fmt.Printf("   Tools:         unrestricted\n")
+		}
+		if client.SkipContentFilter {
+			fmt.Printf("   Filter:        skipped\n")
+		}
+		if client.SystemPrompt != "" {
+			fmt.Printf("   System Prompt: %s\n", client.SystemPrompt)
+		}
+		if client.PromptLogging != "" {
+			fmt.Printf("   Prompt Logs:   %s\n", client.PromptLogging)
+		}
+		if client.BinaryPathOverride != "" {
+			fmt.Printf("   Binary:        %s\n", client.BinaryPathOverride)
+		}
 		fmt.Printf("   Created:       %s\n", client.CreatedAt.Format("2006-01-02 15:04:05"))
 	}
 	fmt.Println()
@@ -552,6 +962,85 @@ func (cm *ClientManager) listClientsInteractive() error {
 	return nil
 }
 
+func (cm *ClientManager) resetUsageInteractive() error {
+	clients, err := cm.db.ListClients()
+	if err != nil {
+		return fmt.Errorf("failed to list clients: %w", err)
+	}
+
+	if len(clients) == 0 {
+		fmt.Println("\nNo clients found.")
+		return nil
+	}
+
+	// Build options
+	options := []huh.Option[int64]{}
+	options = append(options, huh.NewOption("Cancel", int64(0)))
+	for _, c := range clients {
+		label := fmt.Sprintf("%s (ID: %d)", c.Name, c.ID)
+		options = append(options, huh.NewOption(label, c.ID))
+	}
+
+	var selectedID int64
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[int64]().
+				Title("Select Client to Reset Usage").
+				Options(options...).
+				Value(&selectedID),
+		),
+	)
+
+	if err := form.Run(); err != nil {
+		return err
+	}
+
+	if selectedID == 0 {
+		fmt.Println("\nCancelled.")
+		return nil
+	}
+
+	// Find client for confirmation
+	var selected models.Client
+	for _, c := range clients {
+		if c.ID == selectedID {
+			selected = c
+			break
+		}
+	}
+	clientName := selected.Name
+
+	// Confirm reset
+	var confirm bool
+	form = huh.NewForm(
+		huh.NewGroup(
+			huh.NewConfirm().
+				Title(fmt.Sprintf("Clear ALL usage history for '%s'? The client is kept.", clientName)).
+				Affirmative("Yes, reset").
+				Negative("No, cancel").
+				Value(&confirm),
+		),
+	)
+
+	if err := form.Run(); err != nil {
+		return err
+	}
+
+	if !confirm {
+		fmt.Println("\nCancelled.")
+		return nil
+	}
+
+	if err := cm.db.DeleteUsageLogsByClient(selectedID); err != nil {
+		return fmt.Errorf("failed to delete usage logs: %w", err)
+	}
+	cm.audit(models.AuditUsageReset, &selected)
+
+	fmt.Printf("\n✅ Usage history for '%s' has been cleared.\n\n", clientName)
+
+	return nil
+}
+
 func (cm *ClientManager) deleteClientInteractive() error {
 	clients, err := cm.db.ListClients()
 	if err != nil {
@@ -590,14 +1079,15 @@ func (cm *ClientManager) deleteClientInteractive() error {
 		return nil
 	}
 
-	// Find client name for confirmation
-	var clientName string
+	// Find client for confirmation
+	var selected models.Client
 	for _, c := range clients {
 		if c.ID == selectedID {
-			clientName = c.Name
+			selected = c
 			break
 		}
 	}
+	clientName := selected.Name
 
 	// Confirm deletion
 	var confirm bool
@@ -628,6 +1118,7 @@ func (cm *ClientManager) deleteClientInteractive() error {
 	if err := cm.db.DeleteClient(selectedID); err != nil {
 		return fmt.Errorf("failed to delete client: %w", err)
 	}
+	cm.audit(models.AuditClientDelete, &selected)
 
 	fmt.Printf("\n✅ Client '%s' and all their history has been deleted.\n\n", clientName)
 
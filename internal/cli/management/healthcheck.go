@@ -0,0 +1,72 @@
+package management
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+)
+
+// healthCheckPrompt is a trivial prompt that exercises auth and model access
+const healthCheckPrompt = "Reply with the single word: ok"
+
+// ProviderHealthOutput represents one provider's self-check result
+type ProviderHealthOutput struct {
+	Provider  string `json:"provider"`
+	Available bool   `json:"available"`
+	Version   string `json:"version,omitempty"`
+	Success   bool   `json:"success"`
+	LatencyMs int64  `json:"latency_ms,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// HealthCheckOutput represents JSON output for the healthcheck command
+type HealthCheckOutput struct {
+	Success   bool                   `json:"success"`
+	Providers []ProviderHealthOutput `json:"providers"`
+}
+
+// HealthCheckJSON runs a trivial prompt through each available provider and
+// prints per-provider results. Unlike IsAvailable, this catches auth and token
+// problems. Returns false if any available provider fails or none is available.
+func HealthCheckJSON(providers []agents.Provider, timeout time.Duration) bool {
+	output := HealthCheckOutput{Success: true}
+	anyAvailable := false
+
+	for _, provider := range providers {
+		result := ProviderHealthOutput{Provider: provider.Name()}
+		if !provider.IsAvailable() {
+			output.Providers = append(output.Providers, result)
+			continue
+		}
+		result.Available = true
+		anyAvailable = true
+		if versioner, ok := provider.(agents.Versioner); ok {
+			result.Version, _ = versioner.Version()
+		}
+
+		startTime := time.Now()
+		_, err := provider.Execute(context.Background(), agents.ExecuteRequest{
+			Prompt:  healthCheckPrompt,
+			Timeout: timeout,
+		})
+		result.LatencyMs = time.Since(startTime).Milliseconds()
+		if err != nil {
+			result.Error = err.Error()
+			output.Success = false
+		} else {
+			result.Success = true
+		}
+		output.Providers = append(output.Providers, result)
+	}
+
+	if !anyAvailable {
+		output.Success = false
+	}
+
+	data, _ := json.MarshalIndent(output, "", "  ")
+	fmt.Println(string(data))
+	return output.Success
+}
@@ -0,0 +1,263 @@
+package management
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/andrew/ai-cli-server/internal/auth"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+	"github.com/charmbracelet/huh"
+)
+
+// AddKeyOutput represents JSON output for the add-key command
+type AddKeyOutput struct {
+	Success  bool   `json:"success"`
+	ClientID int64  `json:"client_id,omitempty"`
+	KeyID    int64  `json:"key_id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	APIKey   string `json:"api_key,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ListKeysOutput represents JSON output for the list-keys command
+type ListKeysOutput struct {
+	Success bool            `json:"success"`
+	Keys    []models.APIKey `json:"keys,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// RevokeKeyOutput represents JSON output for the revoke-key command
+type RevokeKeyOutput struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// addKey generates another API key for an existing client, returning it with
+// the plaintext key, which can't be recovered later
+func (cm *ClientManager) addKey(clientID int64, name string) (*models.APIKey, string, error) {
+	client, err := cm.db.GetClientByID(clientID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get client: %w", err)
+	}
+	if client == nil {
+		return nil, "", fmt.Errorf("client %d not found", clientID)
+	}
+
+	apiKey, err := auth.GenerateAPIKey()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key := &models.APIKey{
+		ClientID:  clientID,
+		Name:      name,
+		KeyHash:   auth.HashAPIKey(apiKey),
+		KeyLookup: auth.APIKeyLookup(apiKey),
+	}
+	if err := cm.db.CreateAPIKey(key); err != nil {
+		return nil, "", err
+	}
+	cm.auditKey(models.AuditKeyCreate, key)
+	return key, apiKey, nil
+}
+
+// revokeKey revokes one of a client's keys, leaving its others working
+func (cm *ClientManager) revokeKey(clientID, keyID int64) error {
+	keys, err := cm.db.ListAPIKeys(clientID)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key.ID != keyID {
+			continue
+		}
+		revoked, err := cm.db.RevokeAPIKey(clientID, keyID)
+		if err != nil {
+			return err
+		}
+		if !revoked {
+			return fmt.Errorf("key %d is already revoked", keyID)
+		}
+		cm.auditKey(models.AuditKeyRevoke, &key)
+		return nil
+	}
+	return fmt.Errorf("client %d has no key %d", clientID, keyID)
+}
+
+// auditKey records an action on an API key. Like audit, a failure to record
+// it is reported but not fatal.
+func (cm *ClientManager) auditKey(action string, key *models.APIKey) {
+	details := map[string]interface{}{"key_id": key.ID, "name": key.Name}
+	if err := cm.db.CreateAuditLog(models.AuditActorCLI, action, key.ClientID, details); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
+
+// AddKeyJSON adds an API key to a client with JSON output
+func (cm *ClientManager) AddKeyJSON(clientID int64, name string) {
+	key, apiKey, err := cm.addKey(clientID, name)
+	if err != nil {
+		cm.exitWithError(AddKeyOutput{Success: false, Error: err.Error()})
+		return
+	}
+	cm.printJSON(AddKeyOutput{Success: true, ClientID: clientID, KeyID: key.ID, Name: key.Name, APIKey: apiKey})
+}
+
+// ListKeysJSON prints a client's API keys, revoked ones included, with JSON output
+func (cm *ClientManager) ListKeysJSON(clientID int64) {
+	client, err := cm.db.GetClientByID(clientID)
+	if err != nil {
+		cm.exitWithError(ListKeysOutput{Success: false, Error: fmt.Sprintf("failed to get client: %v", err)})
+		return
+	}
+	if client == nil {
+		cm.exitWithError(ListKeysOutput{Success: false, Error: fmt.Sprintf("client %d not found", clientID)})
+		return
+	}
+	keys, err := cm.db.ListAPIKeys(clientID)
+	if err != nil {
+		cm.exitWithError(ListKeysOutput{Success: false, Error: err.Error()})
+		return
+	}
+	cm.printJSON(ListKeysOutput{Success: true, Keys: keys})
+}
+
+// RevokeKeyJSON revokes one of a client's API keys with JSON output
+func (cm *ClientManager) RevokeKeyJSON(clientID, keyID int64) {
+	if err := cm.revokeKey(clientID, keyID); err != nil {
+		cm.exitWithError(RevokeKeyOutput{Success: false, Error: err.Error()})
+		return
+	}
+	cm.printJSON(RevokeKeyOutput{Success: true})
+}
+
+func (cm *ClientManager) manageKeysInteractive() error {
+	clients, err := cm.db.ListClients()
+	if err != nil {
+		return fmt.Errorf("failed to list clients: %w", err)
+	}
+
+	if len(clients) == 0 {
+		fmt.Println("\nNo clients found.")
+		return nil
+	}
+
+	// Build options
+	options := []huh.Option[int64]{}
+	options = append(options, huh.NewOption("Cancel", int64(0)))
+	for _, c := range clients {
+		label := fmt.Sprintf("%s (ID: %d)", c.Name, c.ID)
+		options = append(options, huh.NewOption(label, c.ID))
+	}
+
+	var clientID int64
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[int64]().
+				Title("Select Client to Manage API Keys").
+				Options(options...).
+				Value(&clientID),
+		),
+	)
+
+	if err := form.Run(); err != nil {
+		return err
+	}
+
+	if clientID == 0 {
+		fmt.Println("\nCancelled.")
+		return nil
+	}
+
+	keys, err := cm.db.ListAPIKeys(clientID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("\n=== API Keys ===")
+	for _, key := range keys {
+		status := "✅ Active"
+		if key.RevokedAt != nil {
+			status = "❌ Revoked " + key.RevokedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("   %d | %-20s | created %s | %s\n", key.ID, key.Name, key.CreatedAt.Format("2006-01-02 15:04:05"), status)
+	}
+	fmt.Println()
+
+	// Offer the active keys for revocation
+	const addKeyOption = int64(-1)
+	options = []huh.Option[int64]{
+		huh.NewOption("Back", int64(0)),
+		huh.NewOption("Add a key", addKeyOption),
+	}
+	for _, key := range keys {
+		if key.RevokedAt == nil {
+			options = append(options, huh.NewOption(fmt.Sprintf("Revoke %s (ID: %d)", key.Name, key.ID), key.ID))
+		}
+	}
+
+	var action int64
+	form = huh.NewForm(
+		huh.NewGroup(
+			huh.NewSelect[int64]().
+				Title("API Key Action").
+				Options(options...).
+				Value(&action),
+		),
+	)
+
+	if err := form.Run(); err != nil {
+		return err
+	}
+
+	switch action {
+	case 0:
+		return nil
+	case addKeyOption:
+		var name string
+		form = huh.NewForm(
+			huh.NewGroup(
+				huh.NewInput().
+					Title("Key Name").
+					Description("e.g. the region or deployment using it").
+					Value(&name),
+			),
+		)
+		if err := form.Run(); err != nil {
+			return err
+		}
+
+		_, apiKey, err := cm.addKey(clientID, name)
+		if err != nil {
+			return err
+		}
+		fmt.Println("\n✅ API key added!")
+		fmt.Printf("   API Key: %s\n", apiKey)
+		fmt.Println("\n⚠️  Save the API key - it won't be shown again!")
+		fmt.Println()
+	default:
+		var confirm bool
+		form = huh.NewForm(
+			huh.NewGroup(
+				huh.NewConfirm().
+					Title(fmt.Sprintf("Revoke key %d? Requests using it will be rejected.", action)).
+					Affirmative("Yes, revoke").
+					Negative("No, cancel").
+					Value(&confirm),
+			),
+		)
+		if err := form.Run(); err != nil {
+			return err
+		}
+		if !confirm {
+			fmt.Println("\nCancelled.")
+			return nil
+		}
+
+		if err := cm.revokeKey(clientID, action); err != nil {
+			return err
+		}
+		fmt.Printf("\n✅ Key %d has been revoked.\n\n", action)
+	}
+
+	return nil
+}
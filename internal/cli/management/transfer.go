@@ -0,0 +1,354 @@
+package management
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/auth"
+	"github.com/andrew/ai-cli-server/internal/database"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+// ClientExport is one client in an -export-clients dump. The API key hashes
+// are included so imported clients keep working with their existing keys.
+type ClientExport struct {
+	Name              string            `json:"name"`
+	APIKeys           []APIKeyExport    `json:"api_keys"`                 // Unrevoked keys only
+	APIKeyHash        string            `json:"api_key_hash,omitempty"`   // The single key of files from older releases; read on import only
+	APIKeyLookup      string            `json:"api_key_lookup,omitempty"` // Its lookup ID
+	Provider          string            `json:"provider"`
+	AllowedModels     []string          `json:"allowed_models"`
+	DefaultModel      string            `json:"default_model"`
+	RateLimit         int               `json:"rate_limit"`
+	RateLimitBurst    int               `json:"rate_limit_burst"`
+	TokenLimit        int               `json:"token_limit"`
+	MonthlyBudget     float64           `json:"monthly_budget"`
+	ModelQuotas       map[string]int    `json:"model_quotas"`
+	AllowedIPs        []string          `json:"allowed_ips"`
+	Scopes            []string          `json:"scopes"`
+	Cache             bool              `json:"cache"`
+	ToolsUnrestricted bool              `json:"tools_unrestricted"`
+	AllowedTools      []string          `json:"allowed_tools"`
+	DeniedTools       []string          `json:"denied_tools"`
+	Env               map[string]string `json:"env"`
+	SkipContentFilter bool              `json:"skip_content_filter"`
+	SystemPrompt      string            `json:"system_prompt"`
+	PromptLogging     string            `json:"prompt_logging"`
+	BinaryPath        string            `json:"binary_path_override"`
+	Metadata          string            `json:"metadata"`
+	ExpiresAt         *time.Time        `json:"expires_at"`
+	IsActive          bool              `json:"is_active"`
+}
+
+// APIKeyExport is one of an exported client's keys
+type APIKeyExport struct {
+	Name         string `json:"name"`
+	APIKeyHash   string `json:"api_key_hash"`
+	APIKeyLookup string `json:"api_key_lookup,omitempty"` // Empty for legacy SHA-256 hashes
+}
+
+// keys returns the client's exported keys, including the single key of a file
+// from an older release
+func (in ClientExport) keys() []APIKeyExport {
+	if in.APIKeyHash == "" {
+		return in.APIKeys
+	}
+	return append([]APIKeyExport{{Name: "default", APIKeyHash: in.APIKeyHash, APIKeyLookup: in.APIKeyLookup}}, in.APIKeys...)
+}
+
+// ClientsExport is the document written by -export-clients and read by -import-clients
+type ClientsExport struct {
+	Clients []ClientExport `json:"clients"`
+}
+
+// ImportedClient reports one client created by an import. APIKey is only set
+// when fresh keys were generated.
+type ImportedClient struct {
+	Name     string `json:"name"`
+	ClientID int64  `json:"client_id"`
+	APIKey   string `json:"api_key,omitempty"`
+}
+
+// ImportClientsOutput represents JSON output for the import command
+type ImportClientsOutput struct {
+	Success  bool             `json:"success"`
+	Imported []ImportedClient `json:"imported"`
+	Skipped  []string         `json:"skipped"` // Names that already exist
+	Error    string           `json:"error,omitempty"`
+}
+
+// ExportClientsJSON prints every client, key hashes included, as a ClientsExport.
+// The output holds credentials in hashed form and client env values, so treat
+// it as a secret.
+func (cm *ClientManager) ExportClientsJSON() {
+	export, err := cm.exportClients()
+	if err != nil {
+		cm.exitWithError(ListClientsOutput{Success: false, Error: err.Error()})
+		return
+	}
+	cm.printJSON(export)
+}
+
+// exportClients builds the -export-clients document
+func (cm *ClientManager) exportClients() (ClientsExport, error) {
+	clients, err := cm.db.ListClients()
+	if err != nil {
+		return ClientsExport{}, fmt.Errorf("failed to list clients: %w", err)
+	}
+
+	export := ClientsExport{Clients: make([]ClientExport, len(clients))}
+	for i, c := range clients {
+		var allowedModels []string
+		json.Unmarshal([]byte(c.AllowedModels), &allowedModels)
+		allowedIPs := []string{}
+		json.Unmarshal([]byte(c.AllowedIPs), &allowedIPs)
+		var scopes []string
+		json.Unmarshal([]byte(c.Scopes), &scopes)
+		env, _ := database.ParseClientEnv(&c)
+		allowedTools, deniedTools := database.ParseClientTools(&c)
+		keys, err := cm.db.ListAPIKeys(c.ID)
+		if err != nil {
+			return ClientsExport{}, fmt.Errorf("failed to list API keys: %w", err)
+		}
+		exportedKeys := []APIKeyExport{}
+		for _, key := range keys {
+			if key.RevokedAt == nil {
+				exportedKeys = append(exportedKeys, APIKeyExport{Name: key.Name, APIKeyHash: key.KeyHash, APIKeyLookup: key.KeyLookup})
+			}
+		}
+
+		export.Clients[i] = ClientExport{
+			Name:              c.Name,
+			APIKeys:           exportedKeys,
+			Provider:          c.Provider,
+			AllowedModels:     allowedModels,
+			DefaultModel:      c.DefaultModel,
+			RateLimit:         c.RateLimitPerMinute,
+			RateLimitBurst:    c.RateLimitBurst,
+			TokenLimit:        c.TokenLimitPerMinute,
+			MonthlyBudget:     c.MonthlyBudget,
+			ModelQuotas:       database.ParseModelQuotas(&c),
+			AllowedIPs:        allowedIPs,
+			Scopes:            scopes,
+			Cache:             c.CacheResponses,
+			ToolsUnrestricted: c.ToolsUnrestricted,
+			AllowedTools:      allowedTools,
+			DeniedTools:       deniedTools,
+			Env:               env,
+			SkipContentFilter: c.SkipContentFilter,
+			SystemPrompt:      c.SystemPrompt,
+			PromptLogging:     c.PromptLogging,
+			BinaryPath:        c.BinaryPathOverride,
+			Metadata:          c.Metadata,
+			ExpiresAt:         c.ExpiresAt,
+			IsActive:          c.IsActive,
+		}
+	}
+	return export, nil
+}
+
+// ImportClientsJSON recreates the clients in an -export-clients file, skipping
+// names that already exist. Clients keep their key hashes unless newKeys is
+// set, in which case each gets a fresh key (and the key_policy expiry) and the
+// keys are reported. The whole file is validated before anything is created,
+// and the clients are created together or not at all.
+func (cm *ClientManager) ImportClientsJSON(path string, newKeys bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("failed to read import file: %w", err)
+	} else {
+		var output ImportClientsOutput
+		if output, err = cm.importClients(data, newKeys); err == nil {
+			cm.printJSON(output)
+			return
+		}
+	}
+	cm.exitWithError(ImportClientsOutput{Success: false, Imported: []ImportedClient{}, Skipped: []string{}, Error: err.Error()})
+}
+
+// importClients creates the clients in an -export-clients document
+func (cm *ClientManager) importClients(data []byte, newKeys bool) (ImportClientsOutput, error) {
+	var export ClientsExport
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&export); err != nil {
+		return ImportClientsOutput{}, fmt.Errorf("invalid import file: %w", err)
+	}
+
+	existing, err := cm.db.ListClients()
+	if err != nil {
+		return ImportClientsOutput{}, fmt.Errorf("failed to list clients: %w", err)
+	}
+	seen := make(map[string]bool, len(existing))
+	for _, c := range existing {
+		seen[c.Name] = true
+	}
+
+	output := ImportClientsOutput{Success: true, Imported: []ImportedClient{}, Skipped: []string{}}
+	var imports []database.ClientImport
+	for i, in := range export.Clients {
+		if err := cm.validateImport(in, newKeys); err != nil {
+			return ImportClientsOutput{}, fmt.Errorf("clients[%d]: %w", i, err)
+		}
+		if seen[in.Name] {
+			output.Skipped = append(output.Skipped, in.Name)
+			continue
+		}
+		seen[in.Name] = true
+
+		client, err := cm.importedClient(in, newKeys)
+		if err != nil {
+			return ImportClientsOutput{}, fmt.Errorf("clients[%d]: %w", i, err)
+		}
+		imported := ImportedClient{Name: client.Name}
+		var keys []*models.APIKey
+		if newKeys {
+			apiKey, err := auth.GenerateAPIKey()
+			if err != nil {
+				return ImportClientsOutput{}, fmt.Errorf("failed to generate API key: %w", err)
+			}
+			keys = append(keys, &models.APIKey{Name: "default", KeyHash: auth.HashAPIKey(apiKey), KeyLookup: auth.APIKeyLookup(apiKey)})
+			imported.APIKey = apiKey
+		} else {
+			for _, key := range in.keys() {
+				keys = append(keys, &models.APIKey{Name: key.Name, KeyHash: key.APIKeyHash, KeyLookup: key.APIKeyLookup})
+			}
+		}
+		imports = append(imports, database.ClientImport{Client: client, Keys: keys})
+		output.Imported = append(output.Imported, imported)
+	}
+
+	if err := cm.db.ImportClients(imports); err != nil {
+		return ImportClientsOutput{}, fmt.Errorf("nothing imported: %w", err)
+	}
+	for i, in := range imports {
+		cm.audit(models.AuditClientCreate, in.Client)
+		output.Imported[i].ClientID = in.Client.ID
+	}
+	return output, nil
+}
+
+// validateImport checks an exported client the way -add checks a new one,
+// except that its provider needn't be installed on this host
+func (cm *ClientManager) validateImport(in ClientExport, newKeys bool) error {
+	if in.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	switch in.Provider {
+	case "copilot", "cursor", "mock":
+	default:
+		return fmt.Errorf("unknown provider %q", in.Provider)
+	}
+	if !newKeys {
+		keys := in.keys()
+		if len(keys) == 0 {
+			return fmt.Errorf("api_keys is required unless generating new keys")
+		}
+		for j, key := range keys {
+			if key.APIKeyHash == "" {
+				return fmt.Errorf("api_keys[%d]: api_key_hash is required", j)
+			}
+			// Without its lookup ID an Argon2id-hashed key could never be found
+			if !auth.IsLegacyHash(key.APIKeyHash) && key.APIKeyLookup == "" {
+				return fmt.Errorf("api_keys[%d]: api_key_lookup is required with an Argon2id api_key_hash", j)
+			}
+		}
+	}
+	if in.RateLimit < 0 || in.RateLimitBurst < 0 || in.TokenLimit < 0 || in.MonthlyBudget < 0 {
+		return fmt.Errorf("rate_limit, rate_limit_burst, token_limit and monthly_budget must not be negative")
+	}
+	if _, err := auth.ParseIPPrefixes(in.AllowedIPs); err != nil {
+		return fmt.Errorf("invalid allowed_ips: %w", err)
+	}
+	if err := database.ValidateScopes(in.Scopes); err != nil {
+		return fmt.Errorf("invalid scopes: %w", err)
+	}
+	if err := database.ValidatePromptLogging(in.PromptLogging); err != nil {
+		return err
+	}
+	if err := database.ValidateToolPolicy(in.Provider, in.AllowedTools, in.DeniedTools); err != nil {
+		return err
+	}
+	if err := database.ValidateModelQuotas(in.ModelQuotas); err != nil {
+		return err
+	}
+	if _, err := agents.ResolveBinaryPath(in.BinaryPath, cm.binaryDirs); err != nil {
+		return err
+	}
+	if err := agents.ValidateEnv(in.Env, cm.envDenylist); err != nil {
+		return fmt.Errorf("invalid env: %w", err)
+	}
+	return nil
+}
+
+// importedClient builds the client to create for a validated export entry;
+// its keys are created alongside it
+func (cm *ClientManager) importedClient(in ClientExport, newKeys bool) (*models.Client, error) {
+	// Fresh keys are new credentials, so the key policy applies to them
+	expiresAt := in.ExpiresAt
+	if newKeys {
+		var err error
+		if expiresAt, err = cm.keyPolicy.ResolveExpiry(in.ExpiresAt, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	if in.AllowedModels == nil {
+		in.AllowedModels = []string{}
+	}
+	if in.AllowedIPs == nil {
+		in.AllowedIPs = []string{}
+	}
+	if len(in.Scopes) == 0 {
+		in.Scopes = models.DefaultScopes
+	}
+	if in.Env == nil {
+		in.Env = map[string]string{}
+	}
+	if in.AllowedTools == nil {
+		in.AllowedTools = []string{}
+	}
+	if in.DeniedTools == nil {
+		in.DeniedTools = []string{}
+	}
+	modelsJSON, _ := json.Marshal(in.AllowedModels)
+	allowedIPsJSON, _ := json.Marshal(in.AllowedIPs)
+	scopesJSON, _ := json.Marshal(in.Scopes)
+	envJSON, _ := json.Marshal(in.Env)
+	allowedToolsJSON, _ := json.Marshal(in.AllowedTools)
+	deniedToolsJSON, _ := json.Marshal(in.DeniedTools)
+	if in.ModelQuotas == nil {
+		in.ModelQuotas = map[string]int{}
+	}
+	modelQuotasJSON, _ := json.Marshal(in.ModelQuotas)
+
+	return &models.Client{
+		Name:                in.Name,
+		Provider:            in.Provider,
+		AllowedModels:       string(modelsJSON),
+		DefaultModel:        in.DefaultModel,
+		RateLimitPerMinute:  in.RateLimit,
+		RateLimitBurst:      in.RateLimitBurst,
+		TokenLimitPerMinute: in.TokenLimit,
+		MonthlyBudget:       in.MonthlyBudget,
+		ModelQuotas:         string(modelQuotasJSON),
+		ExpiresAt:           expiresAt,
+		IsActive:            in.IsActive,
+		Metadata:            in.Metadata,
+		AllowedIPs:          string(allowedIPsJSON),
+		Scopes:              string(scopesJSON),
+		CacheResponses:      in.Cache,
+		ToolsUnrestricted:   in.ToolsUnrestricted,
+		AllowedTools:        string(allowedToolsJSON),
+		DeniedTools:         string(deniedToolsJSON),
+		ClientEnv:           string(envJSON),
+		SkipContentFilter:   in.SkipContentFilter,
+		SystemPrompt:        in.SystemPrompt,
+		PromptLogging:       in.PromptLogging,
+		BinaryPathOverride:  in.BinaryPath,
+	}, nil
+}
@@ -0,0 +1,169 @@
+package management
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/auth"
+	"github.com/andrew/ai-cli-server/internal/database"
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+// testManager creates a client manager over a fresh database
+func testManager(t *testing.T) *ClientManager {
+	t.Helper()
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"), database.Options{BusyTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("database.New() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &ClientManager{db: db}
+}
+
+// createClient adds a mock client whose first key is named "default"
+func createClient(t *testing.T, cm *ClientManager, name string) *models.Client {
+	t.Helper()
+	apiKey, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &models.Client{
+		Name: name, Provider: "mock", AllowedModels: `["*"]`, IsActive: true, RateLimitPerMinute: 30,
+		APIKeyHash: auth.HashAPIKey(apiKey), APIKeyLookup: auth.APIKeyLookup(apiKey),
+	}
+	if err := cm.db.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// exportJSON exports cm's clients as the file -export-clients writes, sorted
+// by name since clients created in the same instant list in any order
+func exportJSON(t *testing.T, cm *ClientManager) []byte {
+	t.Helper()
+	export, err := cm.exportClients()
+	if err != nil {
+		t.Fatalf("exportClients() error = %v", err)
+	}
+	slices.SortFunc(export.Clients, func(a, b ClientExport) int { return strings.Compare(a.Name, b.Name) })
+	data, err := json.Marshal(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	source := testManager(t)
+	ci := createClient(t, source, "ci")
+	createClient(t, source, "ops")
+	if _, _, err := source.addKey(ci.ID, "eu"); err != nil {
+		t.Fatal(err)
+	}
+	revoked, _, err := source.addKey(ci.ID, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := source.revokeKey(ci.ID, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	target := testManager(t)
+	output, err := target.importClients(exportJSON(t, source), false)
+	if err != nil {
+		t.Fatalf("importClients() error = %v", err)
+	}
+	if len(output.Imported) != 2 || len(output.Skipped) != 0 || output.Imported[0].APIKey != "" {
+		t.Fatalf("importClients() = %+v, want both clients imported with their own keys", output)
+	}
+
+	// Importing the target's export back reproduces the same document
+	if got, want := string(exportJSON(t, target)), string(exportJSON(t, source)); got != want {
+		t.Errorf("export after import = %s\nwant %s", got, want)
+	}
+
+	// The unrevoked keys still authenticate, and keep their names
+	sourceKeys, _ := source.db.ListAPIKeys(ci.ID)
+	i := slices.IndexFunc(output.Imported, func(c ImportedClient) bool { return c.Name == "ci" })
+	imported, err := target.db.GetClientByID(output.Imported[i].ClientID)
+	if err != nil || imported == nil {
+		t.Fatalf("GetClientByID() = %v, %v", imported, err)
+	}
+	targetKeys, _ := target.db.ListAPIKeys(imported.ID)
+	if len(targetKeys) != 2 || targetKeys[0].Name != "default" || targetKeys[1].Name != "eu" {
+		t.Fatalf("imported keys = %+v, want default and eu without the revoked key", targetKeys)
+	}
+	for _, key := range sourceKeys[:2] {
+		found, err := target.db.GetClientByAPIKeyLookup(key.KeyLookup)
+		if err != nil || found == nil || found.Name != "ci" {
+			t.Errorf("GetClientByAPIKeyLookup(%s key) = %v, %v; want ci", key.Name, found, err)
+		}
+	}
+	if found, _ := target.db.GetClientByAPIKeyLookup(sourceKeys[2].KeyLookup); found != nil {
+		t.Error("the revoked key authenticates after import, want it left out")
+	}
+
+	// Names that exist are skipped
+	output, err = target.importClients(exportJSON(t, source), false)
+	if err != nil || len(output.Imported) != 0 || strings.Join(output.Skipped, ",") != "ci,ops" {
+		t.Errorf("second importClients() = %+v, %v; want both skipped", output, err)
+	}
+}
+
+func TestImportNewKeys(t *testing.T) {
+	source := testManager(t)
+	original := createClient(t, source, "ci")
+
+	target := testManager(t)
+	output, err := target.importClients(exportJSON(t, source), true)
+	if err != nil {
+		t.Fatalf("importClients() error = %v", err)
+	}
+	if len(output.Imported) != 1 || output.Imported[0].APIKey == "" {
+		t.Fatalf("importClients() = %+v, want the new key reported", output)
+	}
+
+	imported, err := target.db.GetClientByAPIKeyLookup(auth.APIKeyLookup(output.Imported[0].APIKey))
+	if err != nil || imported == nil || !auth.VerifyAPIKey(output.Imported[0].APIKey, imported.APIKeyHash) {
+		t.Fatalf("the reported key doesn't authenticate: %v, %v", imported, err)
+	}
+	if found, _ := target.db.GetClientByAPIKeyLookup(original.APIKeyLookup); found != nil {
+		t.Error("the exported key authenticates, want only the new one")
+	}
+}
+
+func TestImportRejectsBadFiles(t *testing.T) {
+	cm := testManager(t)
+	existing := createClient(t, cm, "existing")
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"malformed JSON", `{"clients": [`},
+		{"unknown field", `{"clients": [], "extra": true}`},
+		{"missing key", `{"clients": [{"name": "a", "provider": "mock"}]}`},
+		{"unknown provider", `{"clients": [{"name": "a", "provider": "other", "api_key_hash": "h", "api_key_lookup": "l"}]}`},
+		// The first client is valid, but the second reuses an existing key
+		// hash, so the insert fails part way through
+		{"duplicate key", `{"clients": [
+			{"name": "a", "provider": "mock", "api_keys": [{"name": "default", "api_key_hash": "hash-a", "api_key_lookup": "lookup-a"}]},
+			{"name": "b", "provider": "mock", "api_keys": [{"name": "default", "api_key_hash": "` + existing.APIKeyHash + `", "api_key_lookup": "lookup-b"}]}
+		]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := cm.importClients([]byte(tt.data), false); err == nil {
+				t.Fatal("importClients() succeeded, want an error")
+			}
+			clients, err := cm.db.ListClients()
+			if err != nil || len(clients) != 1 {
+				t.Errorf("clients after a failed import = %d, %v; want only the existing one", len(clients), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package management
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/config"
+	"github.com/andrew/ai-cli-server/internal/database"
+)
+
+// CheckStatus is the outcome of one startup check
+type CheckStatus string
+
+// Check outcomes; only a failure stops the server from starting
+const (
+	CheckOK   CheckStatus = "ok"
+	CheckWarn CheckStatus = "warn"
+	CheckFail CheckStatus = "FAIL"
+)
+
+// CheckResult is one startup check's outcome
+type CheckResult struct {
+	Name    string
+	Status  CheckStatus
+	Message string
+}
+
+// String formats the result as one line of the startup summary
+func (r CheckResult) String() string {
+	return fmt.Sprintf("%-4s  %-13s  %s", r.Status, r.Name, r.Message)
+}
+
+// ChecksPassed reports whether none of the results is a failure
+func ChecksPassed(results []CheckResult) bool {
+	for _, result := range results {
+		if result.Status == CheckFail {
+			return false
+		}
+	}
+	return true
+}
+
+// StartupChecks verifies what the server needs before it accepts requests:
+// the config, the database schema, at least one available provider (unless
+// allowNoProviders) and a consistent model catalog. The config and migrations
+// were already loaded and applied to get here, so their checks confirm the
+// result rather than repeat the work.
+func StartupChecks(cfg *config.Config, db *database.DB, providers []agents.Provider, allowNoProviders bool) []CheckResult {
+	return []CheckResult{
+		{Name: "config", Status: CheckOK, Message: "parsed and valid"},
+		checkDatabase(db),
+		checkProviders(providers, allowNoProviders),
+		checkModelCatalog(cfg.CLI.ModelCatalog, providers),
+	}
+}
+
+// checkDatabase confirms every migration this build knows is applied and the
+// database file isn't damaged
+func checkDatabase(db *database.DB) CheckResult {
+	result := CheckResult{Name: "database"}
+	if err := db.IntegrityCheck(); err != nil {
+		result.Status, result.Message = CheckFail, err.Error()
+		return result
+	}
+	pending, unknown, err := db.MigrationStatus()
+	switch {
+	case err != nil:
+		result.Status, result.Message = CheckFail, err.Error()
+	case len(pending) > 0:
+		result.Status, result.Message = CheckFail, "migrations not applied: "+strings.Join(pending, ", ")
+	case len(unknown) > 0:
+		result.Status, result.Message = CheckWarn, "schema is newer than this build, unknown migrations: "+strings.Join(unknown, ", ")
+	default:
+		result.Status, result.Message = CheckOK, "schema up to date"
+	}
+	return result
+}
+
+// checkProviders requires at least one provider to be available
+func checkProviders(providers []agents.Provider, allowNoProviders bool) CheckResult {
+	result := CheckResult{Name: "providers"}
+	var available, missing []string
+	for _, provider := range providers {
+		if provider.IsAvailable() {
+			available = append(available, provider.Name())
+		} else {
+			missing = append(missing, provider.Name())
+		}
+	}
+	switch {
+	case len(available) == 0 && allowNoProviders:
+		result.Status, result.Message = CheckWarn, "no provider CLI is available; every request will fail"
+	case len(available) == 0:
+		result.Status, result.Message = CheckFail, "no provider CLI is available (install one, or start with -allow-no-providers)"
+	case len(missing) > 0:
+		result.Status = CheckOK
+		result.Message = fmt.Sprintf("available: %s; not found: %s", strings.Join(available, ", "), strings.Join(missing, ", "))
+	default:
+		result.Status, result.Message = CheckOK, "available: "+strings.Join(available, ", ")
+	}
+	return result
+}
+
+// checkModelCatalog looks for catalog entries that silently don't do what
+// they say: a later duplicate overriding an earlier one, an entry for a
+// provider that isn't running, or pricing with only one side set, which
+// prices the other at zero
+func checkModelCatalog(entries []config.ModelCatalogEntry, providers []agents.Provider) CheckResult {
+	result := CheckResult{Name: "model_catalog", Status: CheckOK}
+	running := make(map[string]bool)
+	for _, provider := range providers {
+		running[provider.Name()] = true
+	}
+
+	var failures, warnings []string
+	seen := make(map[string]int)
+	for i, entry := range entries {
+		key := entry.Provider + "/" + entry.Name
+		if first, ok := seen[key]; ok {
+			failures = append(failures, fmt.Sprintf("entries %d and %d both describe %s", first, i, catalogLabel(entry)))
+			continue
+		}
+		seen[key] = i
+		if entry.Provider != "" && !running[entry.Provider] {
+			warnings = append(warnings, fmt.Sprintf("entry %d: provider %s is not enabled", i, entry.Provider))
+		}
+		if (entry.InputPrice == nil) != (entry.OutputPrice == nil) {
+			warnings = append(warnings, fmt.Sprintf("entry %d: %s sets only one of input_price and output_price", i, catalogLabel(entry)))
+		}
+	}
+
+	switch {
+	case len(failures) > 0:
+		result.Status, result.Message = CheckFail, strings.Join(append(failures, warnings...), "; ")
+	case len(warnings) > 0:
+		result.Status, result.Message = CheckWarn, strings.Join(warnings, "; ")
+	default:
+		result.Message = fmt.Sprintf("%d entries", len(entries))
+	}
+	return result
+}
+
+// catalogLabel names a catalog entry's model, with its provider when it has one
+func catalogLabel(entry config.ModelCatalogEntry) string {
+	if entry.Provider == "" {
+		return entry.Name
+	}
+	return entry.Provider + "/" + entry.Name
+}
@@ -0,0 +1,74 @@
+package management
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/agents"
+	"github.com/andrew/ai-cli-server/internal/agents/copilot"
+	"github.com/andrew/ai-cli-server/internal/agents/mock"
+	"github.com/andrew/ai-cli-server/internal/config"
+	"github.com/andrew/ai-cli-server/internal/database"
+)
+
+// checkStatuses maps each check's name to its status
+func checkStatuses(results []CheckResult) map[string]CheckStatus {
+	statuses := make(map[string]CheckStatus)
+	for _, result := range results {
+		statuses[result.Name] = result.Status
+	}
+	return statuses
+}
+
+func TestStartupChecks(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "test.db"), database.Options{BusyTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("database.New() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	price := 1.5
+	cfg := &config.Config{}
+	available := []agents.Provider{mock.NewProvider(config.MockConfig{})}
+	missing := []agents.Provider{copilot.NewProvider(config.CopilotConfig{BinaryPath: "/nonexistent/copilot"}, "")}
+
+	results := StartupChecks(cfg, db, available, false)
+	if !ChecksPassed(results) {
+		t.Errorf("StartupChecks() = %v, want a fresh setup to pass", results)
+	}
+
+	// No provider is fatal unless allowed
+	if got := checkStatuses(StartupChecks(cfg, db, missing, false))["providers"]; got != CheckFail {
+		t.Errorf("providers = %s with none available, want %s", got, CheckFail)
+	}
+	if results := StartupChecks(cfg, db, missing, true); !ChecksPassed(results) {
+		t.Errorf("StartupChecks() = %v, want -allow-no-providers to pass", results)
+	}
+
+	// A catalog entry overriding an earlier one is fatal; one-sided pricing warns
+	cfg.CLI.ModelCatalog = []config.ModelCatalogEntry{
+		{Name: "gpt-5", Provider: "mock", InputPrice: &price},
+	}
+	if got := checkStatuses(StartupChecks(cfg, db, available, false))["model_catalog"]; got != CheckWarn {
+		t.Errorf("model_catalog = %s with only an input price, want %s", got, CheckWarn)
+	}
+	cfg.CLI.ModelCatalog = append(cfg.CLI.ModelCatalog, config.ModelCatalogEntry{Name: "gpt-5", Provider: "mock"})
+	if got := checkStatuses(StartupChecks(cfg, db, available, false))["model_catalog"]; got != CheckFail {
+		t.Errorf("model_catalog = %s with a duplicate entry, want %s", got, CheckFail)
+	}
+	cfg.CLI.ModelCatalog = nil
+
+	// A migration that isn't recorded is fatal; one this build doesn't know only warns
+	if _, err := db.Conn().Exec(`INSERT INTO schema_migrations (version) VALUES ('999_future.sql')`); err != nil {
+		t.Fatal(err)
+	}
+	if got := checkStatuses(StartupChecks(cfg, db, available, false))["database"]; got != CheckWarn {
+		t.Errorf("database = %s with an unknown migration, want %s", got, CheckWarn)
+	}
+	if _, err := db.Conn().Exec(`DELETE FROM schema_migrations WHERE version LIKE '024_%'`); err != nil {
+		t.Fatal(err)
+	}
+	if got := checkStatuses(StartupChecks(cfg, db, available, false))["database"]; got != CheckFail {
+		t.Errorf("database = %s with a migration missing, want %s", got, CheckFail)
+	}
+}
@@ -1,20 +1,40 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net/netip"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/andrew/ai-cli-server/internal/database/models"
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
-	CLI      CLIConfig      `yaml:"cli"`
-	Auth     AuthConfig     `yaml:"auth"`
-	Logging  LoggingConfig  `yaml:"logging"`
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	CLI       CLIConfig       `yaml:"cli"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Limits    LimitsConfig    `yaml:"limits"`
+	Filter    FilterConfig    `yaml:"content_filter"`
+	Webhook   WebhookConfig   `yaml:"webhook"`
+	Cache     CacheConfig     `yaml:"cache"`
+	Batch     BatchConfig     `yaml:"batch"`
+	Defaults  DefaultsConfig  `yaml:"defaults"`
+	KeyPolicy KeyPolicyConfig `yaml:"key_policy"`
+	Bootstrap BootstrapConfig `yaml:"bootstrap_client"`
+	Retention RetentionConfig `yaml:"retention"`
+	Logging   LoggingConfig   `yaml:"logging"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
 }
 
 // ServerConfig contains HTTP server configuration
@@ -23,29 +43,193 @@ type ServerConfig struct {
 	Port         int           `yaml:"port"`
 	ReadTimeout  time.Duration `yaml:"read_timeout"`
 	WriteTimeout time.Duration `yaml:"write_timeout"`
+	DrainTimeout time.Duration `yaml:"drain_timeout"` // How long shutdown waits for in-flight requests
+
+	// ShutdownTimeout bounds the whole shutdown: draining, then letting cancelled
+	// requests respond and connections close. Unset is drain_timeout plus 5s.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// StatusAdminOnly requires an admin key for GET /status
+	StatusAdminOnly bool `yaml:"status_admin_only"`
+
+	// TrustedProxies lists proxy IPs/CIDRs whose X-Forwarded-For header is honored
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	TLS TLSConfig `yaml:"tls"`
+
+	// Compression compresses larger JSON responses for clients that accept it
+	Compression CompressionConfig `yaml:"compression"`
+}
+
+// CompressionConfig controls gzip and deflate compression of responses
+type CompressionConfig struct {
+	Enabled  *bool `yaml:"enabled"`   // Defaults to true
+	MinBytes int   `yaml:"min_bytes"` // Smaller responses are sent as they are; unset is 1024
+}
+
+// TLSConfig enables serving HTTPS directly instead of behind a TLS-terminating proxy
+type TLSConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	CertFile string `yaml:"cert_file"` // PEM certificate (chain)
+	KeyFile  string `yaml:"key_file"`  // PEM private key
 }
 
 // DatabaseConfig contains database configuration
 type DatabaseConfig struct {
-	Path string `yaml:"path"`
+	Path         string        `yaml:"path"`
+	BusyTimeout  time.Duration `yaml:"busy_timeout"`   // How long writes wait on a locked database
+	MaxOpenConns int           `yaml:"max_open_conns"` // Connection pool size
 }
 
 // CLIConfig contains CLI tool configurations
 type CLIConfig struct {
 	Copilot CopilotConfig `yaml:"copilot"`
 	Cursor  CursorConfig  `yaml:"cursor"`
+	Mock    MockConfig    `yaml:"mock"`
+
+	// AllowedWorkingDirs lists directory roots a request's working_directory may
+	// point into. Empty rejects every request that sets working_directory.
+	AllowedWorkingDirs []string `yaml:"allowed_working_dirs"`
+
+	// AllowedBinaryDirs lists directories a client's binary_path_override may
+	// point into. Empty rejects every client override.
+	AllowedBinaryDirs []string `yaml:"allowed_binary_dirs"`
+
+	// EnvDenylist adds to the variables clients may never set via client_env;
+	// a trailing * matches any suffix
+	EnvDenylist []string `yaml:"env_denylist"`
+
+	// InheritEnv adds to the server environment variables passed to CLIs
+	// (agents.DefaultInheritEnv); "*" passes them all. StripEnv removes
+	// variables even when inherited. A trailing * matches any suffix in both.
+	InheritEnv []string `yaml:"inherit_env"`
+	StripEnv   []string `yaml:"strip_env"`
+
+	// DisabledModels are refused for every client, e.g. a deprecated upstream model
+	DisabledModels []string `yaml:"disabled_models"`
+
+	// Fallbacks reroute requests to another provider while a CLI is unavailable
+	Fallbacks []FallbackRule `yaml:"fallbacks"`
+
+	// ProviderPriority orders providers when one has to be picked for a client
+	// without a provider, or for a fallback without a to_provider
+	ProviderPriority []string `yaml:"provider_priority"`
+
+	// ModelCatalog describes models the CLIs report, since their --help output
+	// only lists names
+	ModelCatalog []ModelCatalogEntry `yaml:"model_catalog"`
+
+	// EstimateCompletionTokens is the completion length POST /v1/estimate
+	// assumes when a request doesn't give one; unset is 500
+	EstimateCompletionTokens *int `yaml:"estimate_completion_tokens"`
+}
+
+// ModelCatalogEntry holds capability metadata for a model. Unset fields are
+// reported as unknown; an entry for a specific provider wins over one without.
+type ModelCatalogEntry struct {
+	Name           string   `yaml:"name"`
+	Provider       string   `yaml:"provider"` // Empty applies to the model under every provider
+	ContextWindow  int      `yaml:"context_window"`
+	SupportsTools  *bool    `yaml:"supports_tools"`
+	SupportsVision *bool    `yaml:"supports_vision"`
+	InputPrice     *float64 `yaml:"input_price"`  // USD per million prompt tokens
+	OutputPrice    *float64 `yaml:"output_price"` // USD per million completion tokens
+}
+
+// FallbackRule sends requests for Provider, when its CLI is unavailable, to
+// ToProvider instead. The first matching rule wins.
+type FallbackRule struct {
+	Provider   string `yaml:"provider"`
+	Model      string `yaml:"model"`       // Pattern with * wildcards; empty matches every model
+	ToProvider string `yaml:"to_provider"` // Empty picks the first available in provider_priority
+	ToModel    string `yaml:"to_model"`    // Empty keeps the requested model
+}
+
+// Providers the server can run, the default provider_priority
+var knownProviders = []string{"copilot", "cursor", "mock"}
+
+// RankProviders returns names ordered by priority (cli.provider_priority).
+// Names the priority doesn't list follow, alphabetically, so the order never
+// depends on the caller's, e.g. map iteration order.
+func RankProviders(priority, names []string) []string {
+	ranked := slices.Clone(names)
+	slices.SortFunc(ranked, func(a, b string) int {
+		if cmp := compareRank(priority, a, b); cmp != 0 {
+			return cmp
+		}
+		return strings.Compare(a, b)
+	})
+	return ranked
+}
+
+// compareRank orders a and b by their position in priority, unlisted last
+func compareRank(priority []string, a, b string) int {
+	rank := func(name string) int {
+		if i := slices.Index(priority, name); i >= 0 {
+			return i
+		}
+		return len(priority)
+	}
+	return rank(a) - rank(b)
+}
+
+// LongestTimeout returns the longest a single CLI run may take: the greatest
+// timeout or tools_timeout of any provider, or the mock provider's latency
+func (c CLIConfig) LongestTimeout() time.Duration {
+	return max(c.Copilot.Timeout, c.Copilot.ToolsTimeout, c.Cursor.Timeout, c.Cursor.ToolsTimeout, c.Mock.Latency)
 }
 
 // CopilotConfig contains GitHub Copilot CLI configuration
 type CopilotConfig struct {
-	BinaryPath string        `yaml:"binary_path"`
-	Timeout    time.Duration `yaml:"timeout"`
+	BinaryPath   string         `yaml:"binary_path"`
+	Timeout      time.Duration  `yaml:"timeout"`
+	ToolsTimeout time.Duration  `yaml:"tools_timeout"` // Used instead of timeout when tools are enabled; zero keeps timeout
+	PromptAsArg  *bool          `yaml:"prompt_as_arg"` // Pass the prompt in -p instead of stdin; defaults to true
+	Args         []string       `yaml:"args"`          // Argument template; empty uses the built-in default
+	ModelsTTL    *time.Duration `yaml:"models_ttl"`    // How long models parsed from --help are reused; 0 forever, unset 1h
+
+	// StructuredOutput requests JSON output so the CLI's model, session and
+	// token usage are recorded instead of estimated; needs a CLI that supports it
+	StructuredOutput bool `yaml:"structured_output"`
+
+	// PromptPrefix and PromptSuffix frame every prompt sent to this CLI
+	PromptPrefix string `yaml:"prompt_prefix"`
+	PromptSuffix string `yaml:"prompt_suffix"`
+
+	// Backends are several installations sharing the load, e.g. on different
+	// accounts; empty runs binary_path with COPILOT_GITHUB_TOKEN
+	Backends []CopilotBackend `yaml:"backends"`
+}
+
+// CopilotBackend is one Copilot CLI installation requests are spread across
+type CopilotBackend struct {
+	BinaryPath string `yaml:"binary_path"` // Empty uses the provider's binary_path
+	TokenEnv   string `yaml:"token_env"`   // Variable holding this backend's token; empty uses COPILOT_GITHUB_TOKEN
+	Weight     int    `yaml:"weight"`      // Relative share of requests; defaults to 1
+	Token      string `yaml:"-"`           // Not in YAML, loaded from TokenEnv
 }
 
 // CursorConfig contains Cursor CLI configuration
 type CursorConfig struct {
-	BinaryPath string        `yaml:"binary_path"`
-	Timeout    time.Duration `yaml:"timeout"`
+	BinaryPath   string         `yaml:"binary_path"`
+	Timeout      time.Duration  `yaml:"timeout"`
+	ToolsTimeout time.Duration  `yaml:"tools_timeout"` // Used instead of timeout when tools are enabled; zero keeps timeout
+	PromptAsArg  bool           `yaml:"prompt_as_arg"` // Pass the prompt as an argument instead of stdin
+	Args         []string       `yaml:"args"`          // Argument template; empty uses the built-in default
+	ModelsTTL    *time.Duration `yaml:"models_ttl"`    // How long models parsed from --help are reused; 0 forever, unset 1h
+
+	// PromptPrefix and PromptSuffix frame every prompt sent to this CLI
+	PromptPrefix string `yaml:"prompt_prefix"`
+	PromptSuffix string `yaml:"prompt_suffix"`
+}
+
+// MockConfig contains mock provider configuration, for CI and load testing
+type MockConfig struct {
+	Enabled  bool          `yaml:"enabled"`  // Also enabled by MOCK_PROVIDER=true
+	Response string        `yaml:"response"` // Canned response content
+	Echo     bool          `yaml:"echo"`     // Respond with the prompt instead
+	Latency  time.Duration `yaml:"latency"`  // Simulated execution time
+	Error    string        `yaml:"error"`    // When set, every execution fails with this error
 }
 
 // AuthConfig contains authentication configuration
@@ -54,33 +238,569 @@ type AuthConfig struct {
 	CursorAPIKey       string `yaml:"-"` // Not in YAML, loaded from env
 }
 
+// MarshalYAML shows whether each secret is set without revealing its value
+func (a AuthConfig) MarshalYAML() (interface{}, error) {
+	redact := func(secret string) string {
+		if secret == "" {
+			return ""
+		}
+		return "<redacted>"
+	}
+	return map[string]string{
+		"copilot_github_token": redact(a.CopilotGitHubToken),
+		"cursor_api_key":       redact(a.CursorAPIKey),
+	}, nil
+}
+
+// LimitsConfig contains request size limits
+type LimitsConfig struct {
+	MaxRequestBytes int64 `yaml:"max_request_bytes"` // Maximum request body size
+	MaxPromptChars  int   `yaml:"max_prompt_chars"`  // Maximum prompt length after message concatenation
+
+	// MaxResponseBytes caps CLI output; past it the CLI is killed and the
+	// response truncated
+	MaxResponseBytes int `yaml:"max_response_bytes"`
+
+	// MaxConcurrentExecutions caps CLI subprocesses across all clients; requests
+	// queue up to ExecutionWait for a free slot before getting 503
+	MaxConcurrentExecutions int           `yaml:"max_concurrent_executions"`
+	ExecutionWait           time.Duration `yaml:"execution_wait"`
+
+	// MaxQueuedExecutions caps requests waiting for a slot; past it requests get
+	// 503 straight away. Zero leaves the queue unbounded.
+	MaxQueuedExecutions int `yaml:"max_queued_executions"`
+
+	// BudgetPeriod is what a client's monthly_budget covers: the calendar month
+	// or the last 30 days
+	BudgetPeriod string `yaml:"budget_period"`
+}
+
+// Budget periods
+const (
+	BudgetPeriodCalendarMonth = "calendar_month"
+	BudgetPeriodRolling30Days = "rolling_30d"
+)
+
+// BudgetPeriodStart returns when the budget period containing now began: the
+// start of the month in local time, or 30 days ago
+func (l LimitsConfig) BudgetPeriodStart(now time.Time) time.Time {
+	if l.BudgetPeriod == BudgetPeriodRolling30Days {
+		return now.AddDate(0, 0, -30)
+	}
+	now = now.In(time.Local)
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+}
+
+// FilterConfig contains the prompt content filter; prompts matching any rule are rejected
+type FilterConfig struct {
+	Rules []FilterRule `yaml:"rules"`
+}
+
+// FilterRule blocks prompts matching either a regular expression or a keyword
+type FilterRule struct {
+	Name    string `yaml:"name"`    // Reported as the block reason; defaults to the pattern or keyword
+	Pattern string `yaml:"pattern"` // Regular expression
+	Keyword string `yaml:"keyword"` // Case-insensitive substring
+}
+
+// WebhookConfig contains event notification configuration
+type WebhookConfig struct {
+	URL        string        `yaml:"url"`         // Empty disables notifications
+	QueueSize  int           `yaml:"queue_size"`  // Events beyond this backlog are dropped
+	Timeout    time.Duration `yaml:"timeout"`     // Per-delivery HTTP timeout
+	MaxRetries int           `yaml:"max_retries"` // Retries before an event is dropped
+	Cooldown   time.Duration `yaml:"cooldown"`    // Minimum gap between repeats of an event for a client
+}
+
+// CacheConfig contains response cache configuration
+type CacheConfig struct {
+	TTL time.Duration `yaml:"ttl"` // How long cached responses are served
+}
+
+// BatchConfig contains batch completions configuration
+type BatchConfig struct {
+	Workers  int `yaml:"workers"`   // Items of one batch executed concurrently
+	MaxItems int `yaml:"max_items"` // Largest batch accepted
+}
+
+// DefaultsConfig contains per-provider settings for newly created clients
+type DefaultsConfig struct {
+	Copilot ClientDefaults `yaml:"copilot"`
+	Cursor  ClientDefaults `yaml:"cursor"`
+}
+
+// ClientDefaults are applied to new clients when the request leaves them unset
+type ClientDefaults struct {
+	RateLimitPerMinute *int     `yaml:"rate_limit_per_minute"` // 0 is unlimited; unset uses 60
+	DefaultModel       string   `yaml:"default_model"`         // Empty uses the first allowed or available model
+	AllowedModels      []string `yaml:"allowed_models"`
+}
+
+// ForProvider returns the client defaults for a provider
+func (d DefaultsConfig) ForProvider(provider string) ClientDefaults {
+	switch provider {
+	case "copilot":
+		return d.Copilot
+	case "cursor":
+		return d.Cursor
+	}
+	rateLimit := 60
+	return ClientDefaults{RateLimitPerMinute: &rateLimit, AllowedModels: []string{"*"}}
+}
+
+// RetentionConfig contains usage log retention configuration
+type RetentionConfig struct {
+	UsageLogDays int           `yaml:"usage_log_days"` // Older logs are pruned; negative keeps them forever
+	Interval     time.Duration `yaml:"interval"`       // How often pruning runs
+	BatchSize    int           `yaml:"batch_size"`     // Rows deleted per statement, to keep locks short
+
+	// CleanupInterval is how often rate limit buckets, idle rate limiters, and
+	// expired cache entries are cleaned up
+	CleanupInterval time.Duration `yaml:"cleanup_interval"`
+}
+
 // LoggingConfig contains logging configuration
 type LoggingConfig struct {
 	Level  string `yaml:"level"`
 	Format string `yaml:"format"`
+
+	// Prompts sets how much of each prompt usage logs keep: full, truncate,
+	// hash, or none. Clients can override it with their own prompt_logging.
+	Prompts             string `yaml:"prompts"`
+	PromptTruncateChars int    `yaml:"prompt_truncate_chars"` // Characters kept in truncate mode
+
+	// PromptSampleRate is the fraction of requests whose prompt is logged at
+	// all, from 0 (none) to 1, the default when unset; token counts and cost
+	// are always logged. A non-zero PromptSampleSeed makes the sampling
+	// reproducible.
+	PromptSampleRate *float64 `yaml:"prompt_sample_rate"`
+	PromptSampleSeed uint64   `yaml:"prompt_sample_seed"`
+}
+
+// TracingConfig enables OpenTelemetry spans for requests, exported over OTLP/HTTP
+type TracingConfig struct {
+	Enabled     bool     `yaml:"enabled"`
+	Endpoint    string   `yaml:"endpoint"`     // Collector URL, e.g. http://localhost:4318
+	ServiceName string   `yaml:"service_name"` // Reported as service.name
+	SampleRatio *float64 `yaml:"sample_ratio"` // Fraction of requests traced, from 0 to 1; unset traces all
+}
+
+// MetricsConfig controls the Prometheus endpoint at /metrics
+type MetricsConfig struct {
+	// Enabled serves /metrics and records per-phase CLI latency histograms; unset enables
+	Enabled *bool `yaml:"enabled"`
+}
+
+// KeyPolicyConfig limits how long new API keys may stay valid
+type KeyPolicyConfig struct {
+	RequireExpiry bool          `yaml:"require_expiry"` // Reject keys without an expiry when max_lifetime is unset
+	MaxLifetime   time.Duration `yaml:"max_lifetime"`   // Latest allowed expiry, from creation; also the default expiry
+}
+
+// BootstrapConfig seeds an initial client when the server starts with none, so
+// a fresh database is usable without running the management CLI first
+type BootstrapConfig struct {
+	Name     string   `yaml:"name"`     // Client to create; empty disables bootstrapping. BOOTSTRAP_CLIENT overrides
+	Provider string   `yaml:"provider"` // Empty uses the highest priority available provider
+	Models   []string `yaml:"models"`   // Empty uses the provider's defaults
+	Scopes   []string `yaml:"scopes"`   // Empty grants chat, usage:read, and admin
+}
+
+// ResolveExpiry applies the policy to a new key's requested expiry. An omitted
+// expiry defaults to the maximum lifetime, or is rejected if an expiry is
+// required and there is no maximum; one past the maximum is rejected.
+func (p KeyPolicyConfig) ResolveExpiry(requested *time.Time, now time.Time) (*time.Time, error) {
+	if requested == nil {
+		if p.MaxLifetime > 0 {
+			expiresAt := now.Add(p.MaxLifetime).Truncate(time.Second)
+			return &expiresAt, nil
+		}
+		if p.RequireExpiry {
+			return nil, fmt.Errorf("expires_at is required")
+		}
+		return nil, nil
+	}
+	if p.MaxLifetime > 0 && requested.After(now.Add(p.MaxLifetime)) {
+		return nil, fmt.Errorf("expires_at must be at most %s from now", p.MaxLifetime)
+	}
+	return requested, nil
+}
+
+// DefaultPath is the config file used when neither -config nor AICLI_CONFIG is set
+const DefaultPath = "configs/config.yaml"
+
+// Paths returns the config files to load: the comma-separated flag value, else
+// the AICLI_CONFIG environment variable, else DefaultPath
+func Paths(flagValue string) []string {
+	value := flagValue
+	if value == "" {
+		value = getEnv("AICLI_CONFIG", DefaultPath)
+	}
+
+	var paths []string
+	for _, path := range strings.Split(value, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
 }
 
-// Load loads configuration from a YAML file and environment variables
-func Load(configPath string) (*Config, error) {
-	// Read config file
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+// Load loads configuration from one or more YAML files and environment variables.
+// Each file is decoded over the ones before it, so later files override the
+// settings they set; lists are replaced, not appended to.
+func Load(configPaths ...string) (*Config, error) {
+	if len(configPaths) == 0 {
+		return nil, fmt.Errorf("no config file given")
 	}
 
-	// Parse YAML
 	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	for _, configPath := range configPaths {
+		data, err := os.ReadFile(configPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("config file %s does not exist", configPath)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", configPath, err)
+		}
 	}
 
 	// Load sensitive config from environment variables
 	cfg.Auth.CopilotGitHubToken = getEnv("COPILOT_GITHUB_TOKEN", getEnv("GH_TOKEN", ""))
 	cfg.Auth.CursorAPIKey = getEnv("CURSOR_API_KEY", "")
+	for i, backend := range cfg.CLI.Copilot.Backends {
+		if backend.TokenEnv != "" {
+			cfg.CLI.Copilot.Backends[i].Token = getEnv(backend.TokenEnv, "")
+		}
+	}
+	if getEnv("MOCK_PROVIDER", "") == "true" {
+		cfg.CLI.Mock.Enabled = true
+	}
+	cfg.Bootstrap.Name = getEnv("BOOTSTRAP_CLIENT", cfg.Bootstrap.Name)
+
+	applyDefaults(&cfg)
+
+	if err := validate(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
 
 	return &cfg, nil
 }
 
+// validate checks settings that would otherwise fail silently at request time
+func validate(cfg *Config) error {
+	for _, proxy := range cfg.Server.TrustedProxies {
+		if _, err := netip.ParsePrefix(proxy); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(proxy); err != nil {
+			return fmt.Errorf("server.trusted_proxies: %q is not an IP or CIDR", proxy)
+		}
+	}
+	for name, defaults := range map[string]ClientDefaults{"copilot": cfg.Defaults.Copilot, "cursor": cfg.Defaults.Cursor} {
+		if *defaults.RateLimitPerMinute < 0 {
+			return fmt.Errorf("defaults.%s.rate_limit_per_minute must not be negative", name)
+		}
+	}
+	if cfg.Server.TLS.Enabled && (cfg.Server.TLS.CertFile == "" || cfg.Server.TLS.KeyFile == "") {
+		return fmt.Errorf("server.tls: cert_file and key_file are required when enabled")
+	}
+	for _, dir := range cfg.CLI.AllowedWorkingDirs {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("cli.allowed_working_dirs: %q is not an absolute path", dir)
+		}
+	}
+	for _, dir := range cfg.CLI.AllowedBinaryDirs {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("cli.allowed_binary_dirs: %q is not an absolute path", dir)
+		}
+	}
+	for i, rule := range cfg.Filter.Rules {
+		if (rule.Pattern == "") == (rule.Keyword == "") {
+			return fmt.Errorf("content_filter.rules[%d]: exactly one of pattern or keyword is required", i)
+		}
+		if rule.Pattern != "" {
+			if _, err := regexp.Compile(rule.Pattern); err != nil {
+				return fmt.Errorf("content_filter.rules[%d]: invalid pattern: %w", i, err)
+			}
+		}
+	}
+	if cfg.KeyPolicy.MaxLifetime < 0 {
+		return fmt.Errorf("key_policy.max_lifetime must not be negative")
+	}
+	if cfg.Limits.MaxQueuedExecutions < 0 {
+		return fmt.Errorf("limits.max_queued_executions must not be negative")
+	}
+	if cfg.Limits.BudgetPeriod != BudgetPeriodCalendarMonth && cfg.Limits.BudgetPeriod != BudgetPeriodRolling30Days {
+		return fmt.Errorf("limits.budget_period: %q must be %s or %s", cfg.Limits.BudgetPeriod, BudgetPeriodCalendarMonth, BudgetPeriodRolling30Days)
+	}
+	if !slices.Contains(models.PromptLogModes, cfg.Logging.Prompts) {
+		return fmt.Errorf("logging.prompts: %q must be one of %v", cfg.Logging.Prompts, models.PromptLogModes)
+	}
+	if rate := *cfg.Logging.PromptSampleRate; rate < 0 || rate > 1 {
+		return fmt.Errorf("logging.prompt_sample_rate must be between 0 and 1")
+	}
+	if cfg.Tracing.Enabled && cfg.Tracing.Endpoint == "" {
+		return fmt.Errorf("tracing.endpoint is required when tracing is enabled")
+	}
+	if ratio := *cfg.Tracing.SampleRatio; ratio < 0 || ratio > 1 {
+		return fmt.Errorf("tracing.sample_ratio must be between 0 and 1")
+	}
+	for i, name := range cfg.CLI.ProviderPriority {
+		if !slices.Contains(knownProviders, name) {
+			return fmt.Errorf("cli.provider_priority[%d]: unknown provider %q", i, name)
+		}
+		if slices.Contains(cfg.CLI.ProviderPriority[:i], name) {
+			return fmt.Errorf("cli.provider_priority[%d]: %s is listed twice", i, name)
+		}
+	}
+	if cfg.Bootstrap.Provider != "" && !slices.Contains(knownProviders, cfg.Bootstrap.Provider) {
+		return fmt.Errorf("bootstrap_client.provider: unknown provider %q", cfg.Bootstrap.Provider)
+	}
+	for _, scope := range cfg.Bootstrap.Scopes {
+		if !slices.Contains(models.AllScopes, scope) {
+			return fmt.Errorf("bootstrap_client.scopes: unknown scope %q", scope)
+		}
+	}
+	for i, rule := range cfg.CLI.Fallbacks {
+		if rule.Provider == "" {
+			return fmt.Errorf("cli.fallbacks[%d]: provider is required", i)
+		}
+		if rule.Provider == rule.ToProvider {
+			return fmt.Errorf("cli.fallbacks[%d]: to_provider must differ from provider", i)
+		}
+	}
+	for i, backend := range cfg.CLI.Copilot.Backends {
+		if backend.Weight < 0 {
+			return fmt.Errorf("cli.copilot.backends[%d]: weight must not be negative", i)
+		}
+		if backend.TokenEnv != "" && backend.Token == "" {
+			return fmt.Errorf("cli.copilot.backends[%d]: %s is not set", i, backend.TokenEnv)
+		}
+	}
+	if *cfg.CLI.EstimateCompletionTokens < 0 {
+		return fmt.Errorf("cli.estimate_completion_tokens must not be negative")
+	}
+	if err := validateEnvNames("cli.inherit_env", cfg.CLI.InheritEnv); err != nil {
+		return err
+	}
+	if err := validateEnvNames("cli.strip_env", cfg.CLI.StripEnv); err != nil {
+		return err
+	}
+	for i, entry := range cfg.CLI.ModelCatalog {
+		if entry.Name == "" {
+			return fmt.Errorf("cli.model_catalog[%d]: name is required", i)
+		}
+		if entry.Provider != "" && !slices.Contains(knownProviders, entry.Provider) {
+			return fmt.Errorf("cli.model_catalog[%d]: unknown provider %q", i, entry.Provider)
+		}
+		if entry.ContextWindow < 0 {
+			return fmt.Errorf("cli.model_catalog[%d]: context_window must not be negative", i)
+		}
+		if (entry.InputPrice != nil && *entry.InputPrice < 0) || (entry.OutputPrice != nil && *entry.OutputPrice < 0) {
+			return fmt.Errorf("cli.model_catalog[%d]: prices must not be negative", i)
+		}
+	}
+	if err := validateArgs("cli.copilot.args", cfg.CLI.Copilot.Args, copilotArgPlaceholders); err != nil {
+		return err
+	}
+	if *cfg.CLI.Copilot.ModelsTTL < 0 {
+		return fmt.Errorf("cli.copilot.models_ttl must not be negative")
+	}
+	if *cfg.CLI.Cursor.ModelsTTL < 0 {
+		return fmt.Errorf("cli.cursor.models_ttl must not be negative")
+	}
+	if err := validateArgs("cli.cursor.args", cfg.CLI.Cursor.Args, cursorArgPlaceholders); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateEnvNames checks that each entry names a variable, with * allowed
+// only at the end
+func validateEnvNames(field string, names []string) error {
+	for i, name := range names {
+		if name == "" || strings.Contains(strings.TrimSuffix(name, "*"), "*") {
+			return fmt.Errorf("%s[%d]: %q must be a variable name, optionally ending in *", field, i, name)
+		}
+	}
+	return nil
+}
+
+// Placeholders each provider can substitute into its argument template
+var (
+	copilotArgPlaceholders = []string{"prompt", "model", "allow_all_tools", "read_only_tools", "allow_tools", "deny_tools", "force", "structured_output", "stop"}
+	cursorArgPlaceholders  = []string{"prompt", "model", "force", "session_id", "stop"}
+)
+
+// argPlaceholderPattern matches {name} placeholders in argument templates
+var argPlaceholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// validateArgs rejects argument templates that use unknown placeholders
+func validateArgs(field string, template, known []string) error {
+	for _, entry := range template {
+		for _, match := range argPlaceholderPattern.FindAllStringSubmatch(entry, -1) {
+			if !slices.Contains(known, match[1]) {
+				return fmt.Errorf("%s: unknown placeholder {%s} in %q", field, match[1], entry)
+			}
+		}
+	}
+	return nil
+}
+
+// applyDefaults fills in defaults for settings missing from the config file
+func applyDefaults(cfg *Config) {
+	if len(cfg.CLI.ProviderPriority) == 0 {
+		cfg.CLI.ProviderPriority = slices.Clone(knownProviders)
+	}
+	if cfg.Database.BusyTimeout <= 0 {
+		cfg.Database.BusyTimeout = 5 * time.Second
+	}
+	if cfg.Database.MaxOpenConns <= 0 {
+		cfg.Database.MaxOpenConns = 8
+	}
+	if cfg.Server.DrainTimeout <= 0 {
+		cfg.Server.DrainTimeout = 30 * time.Second
+	}
+	if cfg.Server.ShutdownTimeout <= 0 {
+		cfg.Server.ShutdownTimeout = cfg.Server.DrainTimeout + 5*time.Second
+	}
+	if cfg.Limits.MaxRequestBytes <= 0 {
+		cfg.Limits.MaxRequestBytes = 10 << 20 // 10 MiB
+	}
+	if cfg.Limits.MaxPromptChars <= 0 {
+		cfg.Limits.MaxPromptChars = 200000
+	}
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = "ai-cli-server"
+	}
+	if cfg.Server.Compression.Enabled == nil {
+		enabled := true
+		cfg.Server.Compression.Enabled = &enabled
+	}
+	if cfg.Server.Compression.MinBytes <= 0 {
+		cfg.Server.Compression.MinBytes = 1024
+	}
+	if cfg.Metrics.Enabled == nil {
+		enabled := true
+		cfg.Metrics.Enabled = &enabled
+	}
+	if cfg.Tracing.SampleRatio == nil {
+		ratio := 1.0
+		cfg.Tracing.SampleRatio = &ratio
+	}
+	if cfg.Limits.MaxResponseBytes <= 0 {
+		cfg.Limits.MaxResponseBytes = 1 << 20 // 1 MiB
+	}
+	if cfg.Limits.MaxConcurrentExecutions <= 0 {
+		cfg.Limits.MaxConcurrentExecutions = 16
+	}
+	if cfg.Limits.ExecutionWait <= 0 {
+		cfg.Limits.ExecutionWait = 30 * time.Second
+	}
+	if cfg.Limits.BudgetPeriod == "" {
+		cfg.Limits.BudgetPeriod = BudgetPeriodCalendarMonth
+	}
+	if cfg.CLI.Copilot.Timeout <= 0 {
+		cfg.CLI.Copilot.Timeout = 120 * time.Second
+	}
+	if cfg.CLI.Cursor.Timeout <= 0 {
+		cfg.CLI.Cursor.Timeout = 120 * time.Second
+	}
+	for _, ttl := range []**time.Duration{&cfg.CLI.Copilot.ModelsTTL, &cfg.CLI.Cursor.ModelsTTL} {
+		if *ttl == nil {
+			hour := time.Hour
+			*ttl = &hour
+		}
+	}
+	if cfg.CLI.EstimateCompletionTokens == nil {
+		tokens := 500
+		cfg.CLI.EstimateCompletionTokens = &tokens
+	}
+	if cfg.Cache.TTL <= 0 {
+		cfg.Cache.TTL = time.Hour
+	}
+	for _, defaults := range []*ClientDefaults{&cfg.Defaults.Copilot, &cfg.Defaults.Cursor} {
+		if defaults.RateLimitPerMinute == nil {
+			rateLimit := 60
+			defaults.RateLimitPerMinute = &rateLimit
+		}
+		if len(defaults.AllowedModels) == 0 {
+			defaults.AllowedModels = []string{"*"}
+		}
+	}
+	if cfg.Logging.Prompts == "" {
+		cfg.Logging.Prompts = models.PromptLogFull
+	}
+	if cfg.Logging.PromptTruncateChars <= 0 {
+		cfg.Logging.PromptTruncateChars = 200
+	}
+	if cfg.Logging.PromptSampleRate == nil {
+		rate := 1.0
+		cfg.Logging.PromptSampleRate = &rate
+	}
+	if cfg.Retention.UsageLogDays == 0 {
+		cfg.Retention.UsageLogDays = 90
+	}
+	if cfg.Retention.Interval <= 0 {
+		cfg.Retention.Interval = time.Hour
+	}
+	if cfg.Retention.BatchSize <= 0 {
+		cfg.Retention.BatchSize = 1000
+	}
+	if cfg.Retention.CleanupInterval <= 0 {
+		cfg.Retention.CleanupInterval = 5 * time.Minute
+	}
+	if cfg.Batch.Workers <= 0 {
+		cfg.Batch.Workers = 4
+	}
+	if cfg.Batch.MaxItems <= 0 {
+		cfg.Batch.MaxItems = 100
+	}
+	if cfg.Webhook.QueueSize <= 0 {
+		cfg.Webhook.QueueSize = 100
+	}
+	if cfg.Webhook.Timeout <= 0 {
+		cfg.Webhook.Timeout = 5 * time.Second
+	}
+	if cfg.Webhook.MaxRetries == 0 {
+		cfg.Webhook.MaxRetries = 2
+	} else if cfg.Webhook.MaxRetries < 0 {
+		cfg.Webhook.MaxRetries = 0 // Negative disables retries
+	}
+	if cfg.Webhook.Cooldown <= 0 {
+		cfg.Webhook.Cooldown = time.Minute
+	}
+	if len(cfg.Bootstrap.Scopes) == 0 {
+		// The bootstrap client is the one that administers the others
+		cfg.Bootstrap.Scopes = []string{models.ScopeChat, models.ScopeUsageRead, models.ScopeAdmin}
+	}
+	if cfg.CLI.Copilot.PromptAsArg == nil {
+		// Copilot only runs non-interactively with -p, so stdin is opt-in
+		promptAsArg := true
+		cfg.CLI.Copilot.PromptAsArg = &promptAsArg
+	}
+}
+
+// EffectiveYAML renders the loaded configuration, including defaults and
+// environment overrides, with secrets redacted
+func (c *Config) EffectiveYAML() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2) // Match configs/config.yaml
+	if err := enc.Encode(c); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
 // getEnv gets an environment variable with a default fallback
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
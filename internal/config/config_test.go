@@ -0,0 +1,385 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loadYAML loads a config file with the given contents
+func loadYAML(t *testing.T, contents string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path)
+}
+
+func TestCopilotPromptAsArg(t *testing.T) {
+	cfg, err := loadYAML(t, "")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !*cfg.CLI.Copilot.PromptAsArg {
+		t.Error("copilot prompt_as_arg defaults to false, want true")
+	}
+
+	cfg, err = loadYAML(t, "cli:\n  copilot:\n    prompt_as_arg: false\n")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if *cfg.CLI.Copilot.PromptAsArg {
+		t.Error("explicit copilot prompt_as_arg false was overridden")
+	}
+}
+
+func TestModelsTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    time.Duration
+		wantErr string
+	}{
+		{"unset re-reads hourly", "", time.Hour, ""},
+		{"zero caches forever", "cli:\n  copilot:\n    models_ttl: 0s\n", 0, ""},
+		{"explicit value is kept", "cli:\n  copilot:\n    models_ttl: 10m\n", 10 * time.Minute, ""},
+		{"negative is rejected", "cli:\n  copilot:\n    models_ttl: -1m\n", 0, "cli.copilot.models_ttl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadYAML(t, tt.yaml)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got := *cfg.CLI.Copilot.ModelsTTL; got != tt.want {
+				t.Errorf("models_ttl = %v, want %v", got, tt.want)
+			}
+			if got := *cfg.CLI.Cursor.ModelsTTL; got != time.Hour {
+				t.Errorf("cursor models_ttl = %v, want the 1h default", got)
+			}
+		})
+	}
+}
+
+func TestResolveExpiry(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	within, beyond, maximum := now.Add(24*time.Hour), now.Add(48*time.Hour), now.Add(36*time.Hour)
+
+	tests := []struct {
+		name      string
+		policy    KeyPolicyConfig
+		requested *time.Time
+		want      *time.Time
+		wantErr   bool
+	}{
+		{"no policy, no expiry", KeyPolicyConfig{}, nil, nil, false},
+		{"no policy keeps the expiry", KeyPolicyConfig{}, &beyond, &beyond, false},
+		{"required expiry missing", KeyPolicyConfig{RequireExpiry: true}, nil, nil, true},
+		{"maximum is the default", KeyPolicyConfig{MaxLifetime: 36 * time.Hour}, nil, &maximum, false},
+		{"maximum satisfies a required expiry", KeyPolicyConfig{RequireExpiry: true, MaxLifetime: 36 * time.Hour}, nil, &maximum, false},
+		{"expiry within the maximum", KeyPolicyConfig{MaxLifetime: 36 * time.Hour}, &within, &within, false},
+		{"expiry past the maximum", KeyPolicyConfig{MaxLifetime: 36 * time.Hour}, &beyond, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.ResolveExpiry(tt.requested, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveExpiry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got == nil) != (tt.want == nil) || got != nil && !got.Equal(*tt.want) {
+				t.Errorf("ResolveExpiry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultRateLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		yaml        string
+		wantCopilot int
+		wantCursor  int
+		wantErr     string
+	}{
+		{"unset uses 60", "", 60, 60, ""},
+		{"zero is unlimited", "defaults:\n  copilot:\n    rate_limit_per_minute: 0\n", 0, 60, ""},
+		{"explicit value is kept", "defaults:\n  cursor:\n    rate_limit_per_minute: 30\n", 60, 30, ""},
+		{"negative is rejected", "defaults:\n  cursor:\n    rate_limit_per_minute: -1\n", 0, 0, "defaults.cursor.rate_limit_per_minute"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadYAML(t, tt.yaml)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got := *cfg.Defaults.ForProvider("copilot").RateLimitPerMinute; got != tt.wantCopilot {
+				t.Errorf("copilot rate limit = %d, want %d", got, tt.wantCopilot)
+			}
+			if got := *cfg.Defaults.ForProvider("cursor").RateLimitPerMinute; got != tt.wantCursor {
+				t.Errorf("cursor rate limit = %d, want %d", got, tt.wantCursor)
+			}
+		})
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want time.Duration
+	}{
+		{"unset follows the default drain timeout", "", 35 * time.Second},
+		{"unset follows drain_timeout", "server:\n  drain_timeout: 2m\n", 2*time.Minute + 5*time.Second},
+		{"explicit is kept", "server:\n  shutdown_timeout: 10s\n", 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadYAML(t, tt.yaml)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.Server.ShutdownTimeout != tt.want {
+				t.Errorf("shutdown_timeout = %v, want %v", cfg.Server.ShutdownTimeout, tt.want)
+			}
+		})
+	}
+}
+
+func TestTracingSampleRatio(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    float64
+		wantErr string
+	}{
+		{"unset traces everything", "", 1, ""},
+		{"zero traces nothing", "tracing:\n  sample_ratio: 0\n", 0, ""},
+		{"fraction is kept", "tracing:\n  sample_ratio: 0.25\n", 0.25, ""},
+		{"negative is rejected", "tracing:\n  sample_ratio: -0.1\n", 0, "sample_ratio"},
+		{"above one is rejected", "tracing:\n  sample_ratio: 2\n", 0, "sample_ratio"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadYAML(t, tt.yaml)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got := *cfg.Tracing.SampleRatio; got != tt.want {
+				t.Errorf("sample_ratio = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLongestTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want time.Duration
+	}{
+		{"defaults", "", 120 * time.Second},
+		{"tools timeout", "cli:\n  copilot:\n    tools_timeout: 10m\n", 10 * time.Minute},
+		{"cursor timeout", "cli:\n  cursor:\n    timeout: 5m\n", 5 * time.Minute},
+		{"mock latency", "cli:\n  mock:\n    latency: 1h\n", time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadYAML(t, tt.yaml)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got := cfg.CLI.LongestTimeout(); got != tt.want {
+				t.Errorf("LongestTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromptSampleRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    float64
+		wantErr string
+	}{
+		{"unset logs every prompt", "", 1, ""},
+		{"zero logs no prompts", "logging:\n  prompt_sample_rate: 0\n", 0, ""},
+		{"fraction is kept", "logging:\n  prompt_sample_rate: 0.1\n", 0.1, ""},
+		{"negative is rejected", "logging:\n  prompt_sample_rate: -0.5\n", 0, "prompt_sample_rate"},
+		{"above one is rejected", "logging:\n  prompt_sample_rate: 1.5\n", 0, "prompt_sample_rate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := loadYAML(t, tt.yaml)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got := *cfg.Logging.PromptSampleRate; got != tt.want {
+				t.Errorf("prompt_sample_rate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMergesFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	override := filepath.Join(dir, "override.yaml")
+	if err := os.WriteFile(base, []byte("server:\n  host: \"0.0.0.0\"\n  port: 8080\ncli:\n  disabled_models: [\"gpt-4\", \"gpt-3.5\"]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(override, []byte("server:\n  port: 9090\ncli:\n  disabled_models: [\"o1\"]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(base, override)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.Host != "0.0.0.0" || cfg.Server.Port != 9090 {
+		t.Errorf("server = %s:%d, want the base host with the override port", cfg.Server.Host, cfg.Server.Port)
+	}
+	if len(cfg.CLI.DisabledModels) != 1 || cfg.CLI.DisabledModels[0] != "o1" {
+		t.Errorf("disabled_models = %v, want the override's list", cfg.CLI.DisabledModels)
+	}
+
+	missing := filepath.Join(dir, "missing.yaml")
+	if _, err := Load(base, missing); err == nil || !strings.Contains(err.Error(), missing+" does not exist") {
+		t.Errorf("Load() with a missing file error = %v, want one naming it", err)
+	}
+}
+
+func TestRankProviders(t *testing.T) {
+	cfg, err := loadYAML(t, "cli:\n  provider_priority: [cursor, copilot]\n")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// Available providers collected from a map come in any order; the ranking doesn't
+	available := map[string]bool{"mock": true, "copilot": true, "cursor": true}
+	for range 20 {
+		var names []string
+		for name := range available {
+			names = append(names, name)
+		}
+		if got := RankProviders(cfg.CLI.ProviderPriority, names); !slices.Equal(got, []string{"cursor", "copilot", "mock"}) {
+			t.Fatalf("RankProviders(%q) = %q, want cursor, copilot, then the unlisted mock", names, got)
+		}
+	}
+
+	cfg, err = loadYAML(t, "")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := RankProviders(cfg.CLI.ProviderPriority, []string{"mock", "cursor", "copilot"}); !slices.Equal(got, []string{"copilot", "cursor", "mock"}) {
+		t.Errorf("default ranking = %q, want copilot, cursor, mock", got)
+	}
+
+	for _, bad := range []string{"[copilot, copilot]", "[openai]"} {
+		if _, err := loadYAML(t, "cli:\n  provider_priority: "+bad+"\n"); err == nil {
+			t.Errorf("provider_priority %s loaded, want an error", bad)
+		}
+	}
+}
+
+func TestPaths(t *testing.T) {
+	t.Setenv("AICLI_CONFIG", "")
+	if got := Paths(""); len(got) != 1 || got[0] != DefaultPath {
+		t.Errorf("Paths() = %v, want the default", got)
+	}
+
+	t.Setenv("AICLI_CONFIG", "/etc/ai-cli-server/config.yaml")
+	if got := Paths(""); len(got) != 1 || got[0] != "/etc/ai-cli-server/config.yaml" {
+		t.Errorf("Paths() = %v, want AICLI_CONFIG", got)
+	}
+
+	got := Paths("base.yaml, override.yaml")
+	if len(got) != 2 || got[0] != "base.yaml" || got[1] != "override.yaml" {
+		t.Errorf("Paths() = %v, want the flag's files over AICLI_CONFIG", got)
+	}
+}
+
+func TestBootstrapClientFromEnv(t *testing.T) {
+	cfg, err := loadYAML(t, "")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Bootstrap.Name != "" {
+		t.Errorf("bootstrap name = %q, want bootstrapping off by default", cfg.Bootstrap.Name)
+	}
+
+	t.Setenv("BOOTSTRAP_CLIENT", "ops")
+	cfg, err = loadYAML(t, "bootstrap_client:\n  name: admin\n")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Bootstrap.Name != "ops" {
+		t.Errorf("bootstrap name = %q, want BOOTSTRAP_CLIENT to override the file", cfg.Bootstrap.Name)
+	}
+
+	if _, err := loadYAML(t, "bootstrap_client:\n  scopes: [\"root\"]\n"); err == nil {
+		t.Error("Load() accepted an unknown bootstrap scope")
+	}
+}
+
+func TestModelCatalogUnknownProvider(t *testing.T) {
+	if _, err := loadYAML(t, "cli:\n  model_catalog:\n    - name: gpt-5\n      provider: cursr\n"); err == nil {
+		t.Error("Load() accepted a catalog entry for an unknown provider")
+	}
+	if _, err := loadYAML(t, "cli:\n  model_catalog:\n    - name: gpt-5\n      provider: cursor\n"); err != nil {
+		t.Errorf("Load() error = %v", err)
+	}
+}
+
+func TestCopilotBackendTokens(t *testing.T) {
+	t.Setenv("COPILOT_TOKEN_A", "token-a")
+	cfg, err := loadYAML(t, `cli:
+  copilot:
+    backends:
+      - binary_path: /opt/copilot-a/copilot
+        token_env: COPILOT_TOKEN_A
+        weight: 2
+      - binary_path: /opt/copilot-b/copilot
+`)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if backends := cfg.CLI.Copilot.Backends; len(backends) != 2 || backends[0].Token != "token-a" || backends[1].Token != "" {
+		t.Errorf("backends = %+v, want token-a loaded from COPILOT_TOKEN_A", backends)
+	}
+
+	if _, err := loadYAML(t, "cli:\n  copilot:\n    backends: [{token_env: COPILOT_TOKEN_UNSET}]\n"); err == nil {
+		t.Error("Load() with an unset token_env succeeded, want an error")
+	}
+	if _, err := loadYAML(t, "cli:\n  copilot:\n    backends: [{weight: -1}]\n"); err == nil {
+		t.Error("Load() with a negative weight succeeded, want an error")
+	}
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertAPIKey stores key, setting its ID and creation time
+func insertAPIKey(conn execer, key *models.APIKey) error {
+	key.CreatedAt = time.Now()
+	result, err := conn.Exec(
+		`INSERT INTO api_keys (client_id, name, key_hash, key_lookup, created_at) VALUES (?, ?, ?, ?, ?)`,
+		key.ClientID,
+		key.Name,
+		key.KeyHash,
+		sql.NullString{String: key.KeyLookup, Valid: key.KeyLookup != ""}, // Legacy keys have none
+		key.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert API key: %w", err)
+	}
+	if key.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	return nil
+}
+
+// CreateAPIKey adds another API key to an existing client
+func (db *DB) CreateAPIKey(key *models.APIKey) error {
+	return insertAPIKey(db.conn, key)
+}
+
+// ListAPIKeys retrieves a client's API keys, revoked ones included, oldest first
+func (db *DB) ListAPIKeys(clientID int64) ([]models.APIKey, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, client_id, name, key_hash, COALESCE(key_lookup, ''), created_at, revoked_at
+		FROM api_keys
+		WHERE client_id = ?
+		ORDER BY id
+	`, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		if err := rows.Scan(&key.ID, &key.ClientID, &key.Name, &key.KeyHash, &key.KeyLookup, &key.CreatedAt, &key.RevokedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey stops one of a client's keys from authenticating, reporting
+// whether it was found and not already revoked. The client's other keys keep
+// working.
+func (db *DB) RevokeAPIKey(clientID, keyID int64) (bool, error) {
+	result, err := db.conn.Exec(`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND client_id = ? AND revoked_at IS NULL`,
+		time.Now(), keyID, clientID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	return n > 0, nil
+}
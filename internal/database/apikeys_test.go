@@ -0,0 +1,58 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+func TestClientKeysShareClient(t *testing.T) {
+	db := testDB(t)
+
+	client := &models.Client{Name: "multi", Provider: "mock", AllowedModels: `["*"]`, IsActive: true, APIKeyHash: "hash-eu", APIKeyLookup: "lookup-eu"}
+	if err := db.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+	second := &models.APIKey{ClientID: client.ID, Name: "us", KeyHash: "hash-us", KeyLookup: "lookup-us"}
+	if err := db.CreateAPIKey(second); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, lookup := range []string{"lookup-eu", "lookup-us"} {
+		found, err := db.GetClientByAPIKeyLookup(lookup)
+		if err != nil || found == nil || found.ID != client.ID {
+			t.Fatalf("GetClientByAPIKeyLookup(%q) = %v, %v; want client %d", lookup, found, err, client.ID)
+		}
+	}
+	found, err := db.GetClientByAPIKeyHash("hash-us")
+	if err != nil || found == nil || found.APIKeyID != second.ID || found.APIKeyLookup != "lookup-us" {
+		t.Fatalf("GetClientByAPIKeyHash() = %+v, %v; want the client with the us key", found, err)
+	}
+
+	// Revoking one key leaves the other working
+	if revoked, err := db.RevokeAPIKey(client.ID, second.ID); err != nil || !revoked {
+		t.Fatalf("RevokeAPIKey() = %v, %v; want true", revoked, err)
+	}
+	if revoked, err := db.RevokeAPIKey(client.ID, second.ID); err != nil || revoked {
+		t.Errorf("RevokeAPIKey() of a revoked key = %v, %v; want false", revoked, err)
+	}
+	if found, err := db.GetClientByAPIKeyLookup("lookup-us"); found != nil || err != nil {
+		t.Errorf("GetClientByAPIKeyLookup() of a revoked key = %v, %v; want nil, nil", found, err)
+	}
+	if found, err := db.GetClientByAPIKeyLookup("lookup-eu"); found == nil || err != nil {
+		t.Errorf("GetClientByAPIKeyLookup() of the remaining key = %v, %v; want the client", found, err)
+	}
+
+	keys, err := db.ListAPIKeys(client.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].Name != "default" || keys[0].RevokedAt != nil || keys[1].RevokedAt == nil {
+		t.Errorf("ListAPIKeys() = %+v, want the active default key and the revoked us key", keys)
+	}
+
+	// A key can't be revoked through another client
+	if revoked, err := db.RevokeAPIKey(client.ID+1, keys[0].ID); err != nil || revoked {
+		t.Errorf("RevokeAPIKey() through another client = %v, %v; want false", revoked, err)
+	}
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+// CreateAuditLog records a management action. details is stored as a JSON object.
+func (db *DB) CreateAuditLog(actor, action string, clientID int64, details map[string]interface{}) error {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit details: %w", err)
+	}
+
+	query := `INSERT INTO audit_log (actor, action, client_id, timestamp, details) VALUES (?, ?, ?, ?, ?)`
+	if _, err := db.conn.Exec(query, actor, action, clientID, time.Now(), string(detailsJSON)); err != nil {
+		return fmt.Errorf("failed to insert audit log: %w", err)
+	}
+	return nil
+}
+
+// GetAuditLogs retrieves audit log entries, newest first
+// A clientID of 0 returns entries for every client
+func (db *DB) GetAuditLogs(clientID int64, limit, offset int) ([]models.AuditLog, error) {
+	query := `SELECT id, actor, action, client_id, timestamp, details FROM audit_log`
+	args := []interface{}{}
+	if clientID != 0 {
+		query += ` WHERE client_id = ?`
+		args = append(args, clientID)
+	}
+	query += ` ORDER BY id DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit logs: %w", err)
+	}
+	defer rows.Close()
+
+	logs := []models.AuditLog{}
+	for rows.Next() {
+		var entry models.AuditLog
+		var details string
+		if err := rows.Scan(&entry.ID, &entry.Actor, &entry.Action, &entry.ClientID, &entry.Timestamp, &details); err != nil {
+			return nil, fmt.Errorf("failed to scan audit log: %w", err)
+		}
+		entry.Details = json.RawMessage(details)
+		logs = append(logs, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate audit logs: %w", err)
+	}
+	return logs, nil
+}
+
+// AuditDetails summarizes a client's settings for an audit log entry.
+// Env values may be secrets, so only the variable names are included.
+func AuditDetails(client *models.Client) map[string]interface{} {
+	var allowedModels, allowedIPs, scopes []string
+	allowedTools, deniedTools := ParseClientTools(client)
+	json.Unmarshal([]byte(client.AllowedModels), &allowedModels)
+	json.Unmarshal([]byte(client.AllowedIPs), &allowedIPs)
+	json.Unmarshal([]byte(client.Scopes), &scopes)
+
+	env, _ := ParseClientEnv(client)
+	envKeys := make([]string, 0, len(env))
+	for key := range env {
+		envKeys = append(envKeys, key)
+	}
+	sort.Strings(envKeys)
+
+	return map[string]interface{}{
+		"name":                   client.Name,
+		"provider":               client.Provider,
+		"allowed_models":         allowedModels,
+		"default_model":          client.DefaultModel,
+		"rate_limit_per_minute":  client.RateLimitPerMinute,
+		"rate_limit_burst":       client.RateLimitBurst,
+		"token_limit_per_minute": client.TokenLimitPerMinute,
+		"monthly_budget":         client.MonthlyBudget,
+		"model_quotas":           ParseModelQuotas(client),
+		"binary_path_override":   client.BinaryPathOverride,
+		"allowed_ips":            allowedIPs,
+		"scopes":                 scopes,
+		"tools_unrestricted":     client.ToolsUnrestricted,
+		"allowed_tools":          allowedTools,
+		"denied_tools":           deniedTools,
+		"skip_content_filter":    client.SkipContentFilter,
+		"system_prompt":          client.SystemPrompt,
+		"prompt_logging":         client.PromptLogging,
+		"env_keys":               envKeys,
+	}
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+func TestBackupWhileWriting(t *testing.T) {
+	db := testDB(t)
+	client := &models.Client{Name: "backup", Provider: "mock", AllowedModels: `["*"]`, IsActive: true, APIKeyHash: "hash"}
+	if err := db.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+	logUsage := func() error {
+		return db.CreateUsageLog(&models.UsageLog{ClientID: client.ID, Timestamp: time.Now(), Provider: "mock", Model: "m", ResponseStatus: 200})
+	}
+	for range 50 {
+		if err := logUsage(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A writer keeps going while the backup runs, as the server would
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				if err := logUsage(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}
+	}()
+
+	dest := filepath.Join(t.TempDir(), "backups", "copy.db")
+	err := db.Backup(dest)
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+
+	if err := checkBackup(dest); err != nil {
+		t.Fatalf("checkBackup() error = %v", err)
+	}
+	if _, err := os.Stat(dest + "-wal"); err == nil {
+		t.Error("backup has a -wal file, want a standalone copy")
+	}
+	copied, err := New(dest, Options{BusyTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer copied.Close()
+	count, err := copied.CountUsageLogs(client.ID, nil, nil, nil)
+	if err != nil || count < 50 {
+		t.Errorf("CountUsageLogs() on the copy = %d, %v; want at least the 50 logged before", count, err)
+	}
+
+	if err := db.Backup(dest); err == nil {
+		t.Error("Backup() over an existing file succeeded, want an error")
+	}
+}
+
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "backup.db")
+	db := testDB(t)
+	if err := db.CreateClient(&models.Client{Name: "restored", Provider: "mock", AllowedModels: `["*"]`, IsActive: true, APIKeyHash: "hash"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Backup(src); err != nil {
+		t.Fatal(err)
+	}
+
+	dbPath := filepath.Join(dir, "server.db")
+	target, err := New(dbPath, Options{BusyTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The open database is refused
+	if err := Restore(src, dbPath); err == nil {
+		t.Fatal("Restore() while the database is open succeeded, want an error")
+	}
+	target.Close()
+
+	// Stale -wal and -shm files from the old database are removed
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.WriteFile(dbPath+suffix, []byte("stale"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Restore(src, dbPath); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(dbPath + suffix); err == nil {
+			t.Errorf("%s left behind after the restore", suffix)
+		}
+	}
+
+	restored, err := New(dbPath, Options{BusyTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	clients, err := restored.ListClients()
+	if err != nil || len(clients) != 1 || clients[0].Name != "restored" {
+		t.Errorf("ListClients() = %v, %v; want the backed up client", clients, err)
+	}
+
+	if err := Restore(filepath.Join(dir, "missing.db"), dbPath); err == nil {
+		t.Error("Restore() of a missing backup succeeded, want an error")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "junk.db"), []byte("not a database"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Restore(filepath.Join(dir, "junk.db"), dbPath); err == nil {
+		t.Error("Restore() of a non-database succeeded, want an error")
+	}
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+// GetCachedResponse retrieves an unexpired cached response by key
+// Returns nil if there is no entry or it has expired
+func (db *DB) GetCachedResponse(key string) (*models.CachedResponse, error) {
+	query := `
+		SELECT cache_key, provider, model, content, prompt_tokens, completion_tokens, created_at, expires_at
+		FROM response_cache
+		WHERE cache_key = ?
+	`
+
+	var entry models.CachedResponse
+	err := db.conn.QueryRow(query, key).Scan(
+		&entry.Key,
+		&entry.Provider,
+		&entry.Model,
+		&entry.Content,
+		&entry.PromptTokens,
+		&entry.CompletionTokens,
+		&entry.CreatedAt,
+		&entry.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached response: %w", err)
+	}
+
+	if !entry.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+
+	return &entry, nil
+}
+
+// PutCachedResponse stores a response, replacing any existing entry with the same key
+func (db *DB) PutCachedResponse(entry *models.CachedResponse) error {
+	query := `
+		INSERT INTO response_cache (cache_key, provider, model, content, prompt_tokens, completion_tokens, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(cache_key) DO UPDATE SET
+			provider = excluded.provider,
+			model = excluded.model,
+			content = excluded.content,
+			prompt_tokens = excluded.prompt_tokens,
+			completion_tokens = excluded.completion_tokens,
+			created_at = excluded.created_at,
+			expires_at = excluded.expires_at
+	`
+
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	_, err := db.conn.Exec(
+		query,
+		entry.Key,
+		entry.Provider,
+		entry.Model,
+		entry.Content,
+		entry.PromptTokens,
+		entry.CompletionTokens,
+		entry.CreatedAt,
+		entry.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store cached response: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredCacheEntries removes cached responses that expired before the specified time
+func (db *DB) DeleteExpiredCacheEntries(before time.Time) error {
+	query := `DELETE FROM response_cache WHERE expires_at < ?`
+	_, err := db.conn.Exec(query, before)
+	if err != nil {
+		return fmt.Errorf("failed to delete expired cache entries: %w", err)
+	}
+	return nil
+}
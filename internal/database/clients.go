@@ -4,22 +4,146 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/andrew/ai-cli-server/internal/database/models"
 )
 
-// CreateClient creates a new client in the database
+// clientColumns lists the client columns in the order scanClient expects,
+// qualified so they can be selected alongside a joined api_keys row
+const clientColumns = `clients.id, clients.name, clients.provider, clients.allowed_models, COALESCE(clients.default_model, ''),
+			   clients.rate_limit_per_minute, clients.created_at, clients.updated_at, clients.expires_at, clients.is_active, clients.metadata,
+			   clients.allowed_ips, clients.scopes, clients.cache_responses, clients.tools_unrestricted, clients.client_env, clients.skip_content_filter,
+			   clients.token_limit_per_minute, clients.system_prompt, clients.prompt_logging, clients.allowed_tools, clients.denied_tools,
+			   clients.rate_limit_burst, clients.monthly_budget, clients.model_quotas, clients.binary_path_override`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanClient scans a row selected with clientColumns into client, followed by
+// any extra columns selected after them
+func scanClient(row rowScanner, client *models.Client, extra ...interface{}) error {
+	return row.Scan(append([]interface{}{
+		&client.ID,
+		&client.Name,
+		&client.Provider,
+		&client.AllowedModels,
+		&client.DefaultModel,
+		&client.RateLimitPerMinute,
+		&client.CreatedAt,
+		&client.UpdatedAt,
+		&client.ExpiresAt,
+		&client.IsActive,
+		&client.Metadata,
+		&client.AllowedIPs,
+		&client.Scopes,
+		&client.CacheResponses,
+		&client.ToolsUnrestricted,
+		&client.ClientEnv,
+		&client.SkipContentFilter,
+		&client.TokenLimitPerMinute,
+		&client.SystemPrompt,
+		&client.PromptLogging,
+		&client.AllowedTools,
+		&client.DeniedTools,
+		&client.RateLimitBurst,
+		&client.MonthlyBudget,
+		&client.ModelQuotas,
+		&client.BinaryPathOverride,
+	}, extra...)...)
+}
+
+// CreateClient creates a new client in the database, with client.APIKeyHash
+// and client.APIKeyLookup as its first API key
 func (db *DB) CreateClient(client *models.Client) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin client insert: %w", err)
+	}
+	defer tx.Rollback()
+
+	key := &models.APIKey{Name: "default", KeyHash: client.APIKeyHash, KeyLookup: client.APIKeyLookup}
+	if err := insertClient(tx, client, key); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit client insert: %w", err)
+	}
+	return nil
+}
+
+// ClientImport is a client to create along with its API keys, the first of
+// which it is created with
+type ClientImport struct {
+	Client *models.Client
+	Keys   []*models.APIKey
+}
+
+// ImportClients creates clients with their keys in one transaction, so a
+// failure part way through leaves none of them created
+func (db *DB) ImportClients(imports []ClientImport) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin client import: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, in := range imports {
+		if len(in.Keys) == 0 {
+			return fmt.Errorf("client %q has no API key", in.Client.Name)
+		}
+		if err := insertClient(tx, in.Client, in.Keys[0]); err != nil {
+			return fmt.Errorf("client %q: %w", in.Client.Name, err)
+		}
+		for _, key := range in.Keys[1:] {
+			key.ClientID = in.Client.ID
+			if err := insertAPIKey(tx, key); err != nil {
+				return fmt.Errorf("client %q: API key %q: %w", in.Client.Name, key.Name, err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit client import: %w", err)
+	}
+	return nil
+}
+
+// insertClient inserts client within tx, with key as its first API key,
+// setting the IDs and timestamps of both
+func insertClient(tx *sql.Tx, client *models.Client, key *models.APIKey) error {
+	// The unused api_key_hash column is still NOT NULL UNIQUE; see migration 025
 	query := `
-		INSERT INTO clients (name, api_key_hash, provider, allowed_models, default_model, rate_limit_per_minute, expires_at, is_active, metadata)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO clients (name, api_key_hash, provider, allowed_models, default_model, rate_limit_per_minute, expires_at, is_active, metadata, allowed_ips, scopes, cache_responses, tools_unrestricted, client_env, skip_content_filter, token_limit_per_minute, system_prompt, prompt_logging, allowed_tools, denied_tools, rate_limit_burst, monthly_budget, model_quotas, binary_path_override)
+		VALUES (?, 'api_keys:' || lower(hex(randomblob(16))), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := db.conn.Exec(
+	if client.AllowedIPs == "" {
+		client.AllowedIPs = "[]"
+	}
+	if client.ClientEnv == "" {
+		client.ClientEnv = "{}"
+	}
+	if client.AllowedTools == "" {
+		client.AllowedTools = "[]"
+	}
+	if client.DeniedTools == "" {
+		client.DeniedTools = "[]"
+	}
+	if client.ModelQuotas == "" {
+		client.ModelQuotas = "{}"
+	}
+	if client.Scopes == "" {
+		defaultScopes, _ := json.Marshal(models.DefaultScopes)
+		client.Scopes = string(defaultScopes)
+	}
+
+	result, err := tx.Exec(
 		query,
 		client.Name,
-		client.APIKeyHash,
 		client.Provider,
 		client.AllowedModels,
 		client.DefaultModel,
@@ -27,6 +151,21 @@ func (db *DB) CreateClient(client *models.Client) error {
 		client.ExpiresAt,
 		client.IsActive,
 		client.Metadata,
+		client.AllowedIPs,
+		client.Scopes,
+		client.CacheResponses,
+		client.ToolsUnrestricted,
+		client.ClientEnv,
+		client.SkipContentFilter,
+		client.TokenLimitPerMinute,
+		client.SystemPrompt,
+		client.PromptLogging,
+		client.AllowedTools,
+		client.DeniedTools,
+		client.RateLimitBurst,
+		client.MonthlyBudget,
+		client.ModelQuotas,
+		client.BinaryPathOverride,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert client: %w", err)
@@ -36,37 +175,33 @@ func (db *DB) CreateClient(client *models.Client) error {
 	if err != nil {
 		return fmt.Errorf("failed to get last insert id: %w", err)
 	}
+
+	key.ClientID = id
+	if err := insertAPIKey(tx, key); err != nil {
+		return err
+	}
 	client.ID = id
+	client.APIKeyHash, client.APIKeyLookup = key.KeyHash, key.KeyLookup
+	client.APIKeyID = key.ID
 	client.CreatedAt = time.Now()
 	client.UpdatedAt = time.Now()
 
 	return nil
 }
 
-// GetClientByAPIKeyHash retrieves a client by API key hash
-func (db *DB) GetClientByAPIKeyHash(keyHash string) (*models.Client, error) {
-	query := `
-		SELECT id, name, api_key_hash, provider, allowed_models, COALESCE(default_model, ''),
-			   rate_limit_per_minute, created_at, updated_at, expires_at, is_active, metadata
-		FROM clients
-		WHERE api_key_hash = ?
-	`
+// clientByKeyQuery selects a client through one of its unrevoked API keys,
+// along with that key's ID, hash and lookup ID
+const clientByKeyQuery = `
+		SELECT ` + clientColumns + `, api_keys.id, api_keys.key_hash, COALESCE(api_keys.key_lookup, '')
+		FROM api_keys
+		JOIN clients ON clients.id = api_keys.client_id
+		WHERE api_keys.revoked_at IS NULL AND `
 
+// getClientByKey retrieves a client by the unrevoked API key whose column matches value
+func (db *DB) getClientByKey(column, value string) (*models.Client, error) {
 	var client models.Client
-	err := db.conn.QueryRow(query, keyHash).Scan(
-		&client.ID,
-		&client.Name,
-		&client.APIKeyHash,
-		&client.Provider,
-		&client.AllowedModels,
-		&client.DefaultModel,
-		&client.RateLimitPerMinute,
-		&client.CreatedAt,
-		&client.UpdatedAt,
-		&client.ExpiresAt,
-		&client.IsActive,
-		&client.Metadata,
-	)
+	err := scanClient(db.conn.QueryRow(clientByKeyQuery+"api_keys."+column+" = ?", value), &client,
+		&client.APIKeyID, &client.APIKeyHash, &client.APIKeyLookup)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -77,30 +212,40 @@ func (db *DB) GetClientByAPIKeyHash(keyHash string) (*models.Client, error) {
 	return &client, nil
 }
 
+// GetClientByAPIKeyHash retrieves a client by the hash of one of its API keys
+func (db *DB) GetClientByAPIKeyHash(keyHash string) (*models.Client, error) {
+	return db.getClientByKey("key_hash", keyHash)
+}
+
+// GetClientByAPIKeyLookup retrieves a client by the lookup ID of one of its API keys
+func (db *DB) GetClientByAPIKeyLookup(lookup string) (*models.Client, error) {
+	if lookup == "" {
+		return nil, nil
+	}
+	return db.getClientByKey("key_lookup", lookup)
+}
+
+// UpgradeClientKeyHash replaces a client key's legacy hash with a lookup ID and
+// stronger hash. It only applies while the legacy hash is still stored, so
+// concurrent upgrades of the same key are harmless.
+func (db *DB) UpgradeClientKeyHash(id int64, legacyHash, lookup, keyHash string) error {
+	query := `UPDATE api_keys SET key_lookup = ?, key_hash = ? WHERE client_id = ? AND key_hash = ?`
+	if _, err := db.conn.Exec(query, lookup, keyHash, id, legacyHash); err != nil {
+		return fmt.Errorf("failed to upgrade key hash: %w", err)
+	}
+	return nil
+}
+
 // GetClientByID retrieves a client by ID
 func (db *DB) GetClientByID(id int64) (*models.Client, error) {
 	query := `
-		SELECT id, name, api_key_hash, provider, allowed_models, COALESCE(default_model, ''),
-			   rate_limit_per_minute, created_at, updated_at, expires_at, is_active, metadata
+		SELECT ` + clientColumns + `
 		FROM clients
 		WHERE id = ?
 	`
 
 	var client models.Client
-	err := db.conn.QueryRow(query, id).Scan(
-		&client.ID,
-		&client.Name,
-		&client.APIKeyHash,
-		&client.Provider,
-		&client.AllowedModels,
-		&client.DefaultModel,
-		&client.RateLimitPerMinute,
-		&client.CreatedAt,
-		&client.UpdatedAt,
-		&client.ExpiresAt,
-		&client.IsActive,
-		&client.Metadata,
-	)
+	err := scanClient(db.conn.QueryRow(query, id), &client)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -114,8 +259,7 @@ func (db *DB) GetClientByID(id int64) (*models.Client, error) {
 // ListClients retrieves all clients
 func (db *DB) ListClients() ([]models.Client, error) {
 	query := `
-		SELECT id, name, api_key_hash, provider, allowed_models, COALESCE(default_model, ''),
-			   rate_limit_per_minute, created_at, updated_at, expires_at, is_active, metadata
+		SELECT ` + clientColumns + `
 		FROM clients
 		ORDER BY created_at DESC
 	`
@@ -129,21 +273,7 @@ func (db *DB) ListClients() ([]models.Client, error) {
 	var clients []models.Client
 	for rows.Next() {
 		var client models.Client
-		err := rows.Scan(
-			&client.ID,
-			&client.Name,
-			&client.APIKeyHash,
-			&client.Provider,
-			&client.AllowedModels,
-			&client.DefaultModel,
-			&client.RateLimitPerMinute,
-			&client.CreatedAt,
-			&client.UpdatedAt,
-			&client.ExpiresAt,
-			&client.IsActive,
-			&client.Metadata,
-		)
-		if err != nil {
+		if err := scanClient(rows, &client); err != nil {
 			return nil, fmt.Errorf("failed to scan client: %w", err)
 		}
 		clients = append(clients, client)
@@ -156,12 +286,34 @@ func (db *DB) ListClients() ([]models.Client, error) {
 	return clients, nil
 }
 
+// ListClientIDs returns the IDs of all clients
+func (db *DB) ListClientIDs() (map[int64]bool, error) {
+	rows, err := db.conn.Query(`SELECT id FROM clients`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query client IDs: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan client ID: %w", err)
+		}
+		ids[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating client IDs: %w", err)
+	}
+	return ids, nil
+}
+
 // UpdateClient updates a client's information
 func (db *DB) UpdateClient(client *models.Client) error {
 	query := `
 		UPDATE clients
 		SET name = ?, provider = ?, allowed_models = ?, default_model = ?,
-			rate_limit_per_minute = ?, expires_at = ?, is_active = ?, metadata = ?, updated_at = ?
+			rate_limit_per_minute = ?, expires_at = ?, is_active = ?, metadata = ?, allowed_ips = ?, scopes = ?, cache_responses = ?, tools_unrestricted = ?, client_env = ?, skip_content_filter = ?, token_limit_per_minute = ?, system_prompt = ?, prompt_logging = ?, allowed_tools = ?, denied_tools = ?, rate_limit_burst = ?, monthly_budget = ?, model_quotas = ?, binary_path_override = ?, updated_at = ?
 		WHERE id = ?
 	`
 
@@ -176,6 +328,21 @@ func (db *DB) UpdateClient(client *models.Client) error {
 		client.ExpiresAt,
 		client.IsActive,
 		client.Metadata,
+		client.AllowedIPs,
+		client.Scopes,
+		client.CacheResponses,
+		client.ToolsUnrestricted,
+		client.ClientEnv,
+		client.SkipContentFilter,
+		client.TokenLimitPerMinute,
+		client.SystemPrompt,
+		client.PromptLogging,
+		client.AllowedTools,
+		client.DeniedTools,
+		client.RateLimitBurst,
+		client.MonthlyBudget,
+		client.ModelQuotas,
+		client.BinaryPathOverride,
 		client.UpdatedAt,
 		client.ID,
 	)
@@ -196,7 +363,8 @@ func (db *DB) DeleteClient(id int64) error {
 	return nil
 }
 
-// IsModelAllowed checks if a model is in the client's allowed models list
+// IsModelAllowed checks if a model is in the client's allowed models list.
+// Entries may contain "*" wildcards, so "gpt-*" allows a whole model family.
 func IsModelAllowed(client *models.Client, model string) bool {
 	var allowedModels []string
 	if err := json.Unmarshal([]byte(client.AllowedModels), &allowedModels); err != nil {
@@ -204,9 +372,148 @@ func IsModelAllowed(client *models.Client, model string) bool {
 	}
 
 	for _, allowedModel := range allowedModels {
-		if allowedModel == model || allowedModel == "*" {
+		if MatchModelPattern(allowedModel, model) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchModelPattern reports whether model matches pattern, where each "*" in
+// pattern matches any run of characters (including "/" and none at all)
+func MatchModelPattern(pattern, model string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == model
+	}
+
+	// The first part anchors the start, the last anchors the end, and the
+	// ones between must appear in order
+	if !strings.HasPrefix(model, parts[0]) {
+		return false
+	}
+	model = model[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(model, part)
+		if i < 0 {
+			return false
+		}
+		model = model[i+len(part):]
+	}
+	return len(model) >= len(last) && strings.HasSuffix(model, last)
+}
+
+// ParseClientEnv returns the environment variables configured for a client
+func ParseClientEnv(client *models.Client) (map[string]string, error) {
+	env := map[string]string{}
+	if client.ClientEnv == "" {
+		return env, nil
+	}
+	if err := json.Unmarshal([]byte(client.ClientEnv), &env); err != nil {
+		return nil, fmt.Errorf("failed to parse client env: %w", err)
+	}
+	return env, nil
+}
+
+// ParseClientTools returns a client's tool policy: the tools requests may allow
+// (empty means any) and the tools denied on every request
+func ParseClientTools(client *models.Client) (allowed, denied []string) {
+	allowed, denied = []string{}, []string{}
+	json.Unmarshal([]byte(client.AllowedTools), &allowed)
+	json.Unmarshal([]byte(client.DeniedTools), &denied)
+	return allowed, denied
+}
+
+// ParseModelQuotas returns a client's daily request quotas by model name
+func ParseModelQuotas(client *models.Client) map[string]int {
+	quotas := map[string]int{}
+	json.Unmarshal([]byte(client.ModelQuotas), &quotas)
+	return quotas
+}
+
+// ValidateModelQuotas checks a client's model quotas. Unlimited models are left
+// out rather than given a quota of zero.
+func ValidateModelQuotas(quotas map[string]int) error {
+	for model, quota := range quotas {
+		if strings.TrimSpace(model) == "" {
+			return fmt.Errorf("model_quotas model names must not be empty")
+		}
+		if quota <= 0 {
+			return fmt.Errorf("model_quotas for %s must be positive", model)
+		}
+	}
+	return nil
+}
+
+// RateLimitBurst returns how many requests a client may make at once: its
+// rate_limit_burst, or a quarter of its per-minute rate (at least one) when unset
+func RateLimitBurst(client *models.Client) int {
+	if client.RateLimitBurst > 0 {
+		return client.RateLimitBurst
+	}
+	return max(1, client.RateLimitPerMinute/4)
+}
+
+// ValidateToolPolicy checks a client's tool lists. cursor-agent has no per-tool
+// flags, so only copilot and mock clients may have them.
+func ValidateToolPolicy(provider string, allowed, denied []string) error {
+	if len(allowed) == 0 && len(denied) == 0 {
+		return nil
+	}
+	if provider == "cursor" {
+		return fmt.Errorf("allowed_tools and denied_tools are not supported for cursor clients")
+	}
+	for _, tool := range append(slices.Clone(allowed), denied...) {
+		if strings.TrimSpace(tool) == "" {
+			return fmt.Errorf("tool names must not be empty")
+		}
+	}
+	return nil
+}
+
+// HasScope checks if the client's API key was granted a scope
+func HasScope(client *models.Client, scope string) bool {
+	var scopes []string
+	if err := json.Unmarshal([]byte(client.Scopes), &scopes); err != nil {
+		return false
+	}
+
+	for _, s := range scopes {
+		if s == scope {
 			return true
 		}
 	}
 	return false
 }
+
+// ValidateScopes checks that every scope is a known scope
+func ValidateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		known := false
+		for _, s := range models.AllScopes {
+			if s == scope {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown scope %q (valid: %v)", scope, models.AllScopes)
+		}
+	}
+	return nil
+}
+
+// ValidatePromptLogging checks a client's prompt logging mode; empty means
+// the server default
+func ValidatePromptLogging(mode string) error {
+	if mode == "" {
+		return nil
+	}
+	for _, m := range models.PromptLogModes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown prompt_logging %q (valid: %v)", mode, models.PromptLogModes)
+}
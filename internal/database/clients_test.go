@@ -0,0 +1,58 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+func TestIsModelAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed string
+		model   string
+		want    bool
+	}{
+		{"exact match", `["gpt-4o"]`, "gpt-4o", true},
+		{"exact mismatch", `["gpt-4o"]`, "gpt-4o-mini", false},
+		{"full wildcard", `["*"]`, "claude-sonnet-4", true},
+		{"prefix pattern", `["gpt-*"]`, "gpt-4o-mini", true},
+		{"prefix pattern matches the bare prefix", `["gpt-*"]`, "gpt-", true},
+		{"prefix pattern mismatch", `["gpt-*"]`, "claude-gpt-4", false},
+		{"suffix pattern", `["*-mini"]`, "gpt-4o-mini", true},
+		{"suffix pattern mismatch", `["*-mini"]`, "gpt-4o-mini-high", false},
+		{"inner wildcard", `["claude-*-4"]`, "claude-sonnet-4", true},
+		{"wildcard spans slashes", `["openai/*"]`, "openai/gpt/4o", true},
+		{"any pattern in the list", `["sonnet-4", "gpt-*"]`, "gpt-5", true},
+		{"empty list", `[]`, "gpt-4o", false},
+		{"malformed list", `gpt-*`, "gpt-4o", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &models.Client{AllowedModels: tt.allowed}
+			if got := IsModelAllowed(client, tt.model); got != tt.want {
+				t.Errorf("IsModelAllowed(%s, %q) = %v, want %v", tt.allowed, tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitBurstPersists(t *testing.T) {
+	db := testDB(t)
+
+	client := &models.Client{Name: "burst", Provider: "mock", AllowedModels: `["*"]`, IsActive: true, RateLimitPerMinute: 60, RateLimitBurst: 5}
+	if err := db.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+	client.RateLimitBurst = 9
+	if err := db.UpdateClient(client); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := db.GetClientByID(client.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.RateLimitBurst != 9 || RateLimitBurst(stored) != 9 {
+		t.Errorf("stored burst = %d, want the updated 9", stored.RateLimitBurst)
+	}
+}
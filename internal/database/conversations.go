@@ -0,0 +1,84 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+// CreateConversation creates a new conversation owned by a client
+func (db *DB) CreateConversation(conv *models.Conversation) error {
+	now := time.Now()
+	query := `INSERT INTO conversations (id, client_id, created_at, updated_at) VALUES (?, ?, ?, ?)`
+	if _, err := db.conn.Exec(query, conv.ID, conv.ClientID, now, now); err != nil {
+		return fmt.Errorf("failed to insert conversation: %w", err)
+	}
+	conv.CreatedAt = now
+	conv.UpdatedAt = now
+	return nil
+}
+
+// AppendMessage adds a message to the end of a conversation
+func (db *DB) AppendMessage(conversationID, role, content string) error {
+	now := time.Now()
+	query := `
+		INSERT INTO conversation_messages (conversation_id, role, content, created_at)
+		VALUES (?, ?, ?, ?)
+	`
+	if _, err := db.conn.Exec(query, conversationID, role, content, now); err != nil {
+		return fmt.Errorf("failed to append conversation message: %w", err)
+	}
+
+	if _, err := db.conn.Exec(`UPDATE conversations SET updated_at = ? WHERE id = ?`, now, conversationID); err != nil {
+		return fmt.Errorf("failed to update conversation: %w", err)
+	}
+	return nil
+}
+
+// GetConversation retrieves a conversation and its messages in order
+// Returns nil if the conversation doesn't exist
+func (db *DB) GetConversation(id string) (*models.Conversation, error) {
+	query := `SELECT id, client_id, created_at, updated_at FROM conversations WHERE id = ?`
+
+	var conv models.Conversation
+	err := db.conn.QueryRow(query, id).Scan(
+		&conv.ID,
+		&conv.ClientID,
+		&conv.CreatedAt,
+		&conv.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+
+	messagesQuery := `
+		SELECT id, conversation_id, role, content, created_at
+		FROM conversation_messages
+		WHERE conversation_id = ?
+		ORDER BY id
+	`
+	rows, err := db.conn.Query(messagesQuery, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversation messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var msg models.ConversationMessage
+		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.Role, &msg.Content, &msg.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation message: %w", err)
+		}
+		conv.Messages = append(conv.Messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating conversation messages: %w", err)
+	}
+
+	return &conv, nil
+}
@@ -0,0 +1,3 @@
+-- Per-client source IP allowlist (JSON array of IPs/CIDRs, empty means unrestricted)
+
+ALTER TABLE clients ADD COLUMN allowed_ips TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,3 @@
+-- Per-client API key scopes (JSON array). Existing keys keep the access they had before scopes existed.
+
+ALTER TABLE clients ADD COLUMN scopes TEXT NOT NULL DEFAULT '["chat","usage:read"]';
@@ -0,0 +1,3 @@
+-- Per-client opt-in to unrestricted CLI tool use (--allow-all-tools)
+
+ALTER TABLE clients ADD COLUMN tools_unrestricted BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+-- Per-client environment variables injected into CLI executions
+
+ALTER TABLE clients ADD COLUMN client_env TEXT NOT NULL DEFAULT '{}';
@@ -0,0 +1,4 @@
+-- Request body and response content sizes per usage log
+
+ALTER TABLE usage_logs ADD COLUMN request_bytes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE usage_logs ADD COLUMN response_bytes INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- Per-client opt-out of the prompt content filter
+
+ALTER TABLE clients ADD COLUMN skip_content_filter BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,13 @@
+-- Optional per-client tokens-per-minute limit, tracked alongside the request-count buckets
+
+ALTER TABLE clients ADD COLUMN token_limit_per_minute INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS token_rate_limit_buckets (
+  client_id INTEGER NOT NULL,
+  window_start DATETIME NOT NULL,
+  token_count INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (client_id, window_start),
+  FOREIGN KEY (client_id) REFERENCES clients(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_token_rate_limit_window ON token_rate_limit_buckets(window_start);
@@ -0,0 +1,8 @@
+-- Revoked sessions; requests referencing them are rejected
+
+CREATE TABLE IF NOT EXISTS session_revocations (
+  session_id TEXT PRIMARY KEY,
+  client_id INTEGER NOT NULL,
+  revoked_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (client_id) REFERENCES clients(id) ON DELETE CASCADE
+);
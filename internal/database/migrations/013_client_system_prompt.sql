@@ -0,0 +1,3 @@
+-- Per-client guardrail instructions placed ahead of every prompt
+
+ALTER TABLE clients ADD COLUMN system_prompt TEXT NOT NULL DEFAULT '';
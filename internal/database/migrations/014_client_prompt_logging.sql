@@ -0,0 +1,3 @@
+-- Per-client override of how much of a prompt usage logs keep; empty uses the server default
+
+ALTER TABLE clients ADD COLUMN prompt_logging TEXT NOT NULL DEFAULT '';
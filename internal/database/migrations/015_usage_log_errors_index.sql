@@ -0,0 +1,3 @@
+-- Failed requests per client, newest first, for the admin errors endpoint
+
+CREATE INDEX IF NOT EXISTS idx_usage_logs_client_errors ON usage_logs(client_id, timestamp) WHERE response_status != 200;
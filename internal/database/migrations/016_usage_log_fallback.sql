@@ -0,0 +1,3 @@
+-- Provider and model a request asked for when it was served by a fallback
+
+ALTER TABLE usage_logs ADD COLUMN fallback_from TEXT;
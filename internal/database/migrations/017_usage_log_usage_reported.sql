@@ -0,0 +1,3 @@
+-- Whether token counts came from the CLI rather than being estimated
+
+ALTER TABLE usage_logs ADD COLUMN usage_reported INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+-- Keys hashed with Argon2id are found by a lookup ID taken from the key, since
+-- their salted hashes can't be looked up directly. NULL for legacy SHA-256 keys.
+
+ALTER TABLE clients ADD COLUMN api_key_lookup TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_clients_api_key_lookup ON clients(api_key_lookup);
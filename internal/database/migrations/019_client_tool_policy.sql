@@ -0,0 +1,5 @@
+-- Per-client tool policy: requests may only allow tools in allowed_tools (when
+-- non-empty), and denied_tools are denied on every request
+
+ALTER TABLE clients ADD COLUMN allowed_tools TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE clients ADD COLUMN denied_tools TEXT NOT NULL DEFAULT '[]';
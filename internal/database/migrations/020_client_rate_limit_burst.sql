@@ -0,0 +1,4 @@
+-- Requests a client may make at once before the per-minute rate throttles it;
+-- 0 uses a fraction of rate_limit_per_minute
+
+ALTER TABLE clients ADD COLUMN rate_limit_burst INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- Spend cap, in the cost units usage logs record, for the configured budget
+-- period; 0 is uncapped
+
+ALTER TABLE clients ADD COLUMN monthly_budget REAL NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- Caller-supplied tags (JSON object of strings) for attributing usage, e.g. to a project
+
+ALTER TABLE usage_logs ADD COLUMN metadata TEXT;
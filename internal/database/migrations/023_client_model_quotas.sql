@@ -0,0 +1,4 @@
+-- Per-client daily request quotas by model, as a JSON object of model name to
+-- requests per day; models not listed are unlimited
+
+ALTER TABLE clients ADD COLUMN model_quotas TEXT NOT NULL DEFAULT '{}';
@@ -0,0 +1,4 @@
+-- Per-client CLI binary, run instead of the provider's configured one so
+-- clients can be pinned to different CLI versions; empty uses the provider's
+
+ALTER TABLE clients ADD COLUMN binary_path_override TEXT NOT NULL DEFAULT '';
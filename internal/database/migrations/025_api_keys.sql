@@ -0,0 +1,25 @@
+-- API keys move to their own table so a client can hold several, e.g. one per
+-- region, each revocable on its own while sharing the client's quota and usage.
+-- Each client's existing key becomes its first.
+
+CREATE TABLE IF NOT EXISTS api_keys (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  client_id INTEGER NOT NULL,
+  name TEXT NOT NULL DEFAULT '',
+  key_hash TEXT NOT NULL UNIQUE,
+  key_lookup TEXT UNIQUE,
+  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+  revoked_at DATETIME,
+  FOREIGN KEY (client_id) REFERENCES clients(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_client_id ON api_keys(client_id);
+
+INSERT INTO api_keys (client_id, name, key_hash, key_lookup, created_at)
+SELECT id, 'default', api_key_hash, api_key_lookup, created_at FROM clients;
+
+-- SQLite can't drop a UNIQUE column without rebuilding the table, which would
+-- cascade-delete usage logs, so the old columns stay behind unused. The hash
+-- gets a placeholder so the moved key isn't left stored twice.
+DROP INDEX IF EXISTS idx_clients_api_key_lookup;
+UPDATE clients SET api_key_hash = 'api_keys:' || id, api_key_lookup = NULL;
@@ -1,20 +1,92 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+// API key scopes
+const (
+	ScopeChat      = "chat"
+	ScopeUsageRead = "usage:read"
+	ScopeAdmin     = "admin"
+	ScopeRawOutput = "raw_output" // Chat requests may ask for the CLI's unparsed output
+)
+
+// Audit log actions
+const (
+	AuditClientCreate     = "client.create"
+	AuditClientDelete     = "client.delete"
+	AuditClientActivate   = "client.activate"
+	AuditClientDeactivate = "client.deactivate"
+	AuditUsageReset       = "usage.reset"
+	AuditSessionRevoke    = "session.revoke"
+	AuditKeyCreate        = "key.create"
+	AuditKeyRevoke        = "key.revoke"
+)
+
+// Prompt logging modes: how much of a prompt a usage log keeps
+const (
+	PromptLogFull     = "full"
+	PromptLogTruncate = "truncate"
+	PromptLogHash     = "hash"
+	PromptLogNone     = "none"
+)
+
+// PromptLogModes lists every prompt logging mode
+var PromptLogModes = []string{PromptLogFull, PromptLogTruncate, PromptLogHash, PromptLogNone}
+
+// AuditActorCLI identifies actions taken through the management CLI
+const AuditActorCLI = "cli"
+
+// AllScopes lists every scope that can be granted to an API key
+var AllScopes = []string{ScopeChat, ScopeUsageRead, ScopeAdmin, ScopeRawOutput}
+
+// DefaultScopes are granted when a client is created without explicit scopes
+var DefaultScopes = []string{ScopeChat, ScopeUsageRead}
 
 type Client struct {
-	ID                 int64      `json:"id"`
-	Name               string     `json:"name"`
-	APIKeyHash         string     `json:"-"`
-	Provider           string     `json:"provider"`       // Single provider: copilot or cursor
-	AllowedModels      string     `json:"allowed_models"` // JSON array of allowed models
-	DefaultModel       string     `json:"default_model"`  // Default model for requests
-	RateLimitPerMinute int        `json:"rate_limit_per_minute"`
-	CreatedAt          time.Time  `json:"created_at"`
-	UpdatedAt          time.Time  `json:"updated_at"`
-	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
-	IsActive           bool       `json:"is_active"`
-	Metadata           string     `json:"metadata,omitempty"`
+	ID                  int64      `json:"id"`
+	Name                string     `json:"name"`
+	APIKeyID            int64      `json:"-"`              // Key the client was looked up by; 0 when loaded another way
+	APIKeyHash          string     `json:"-"`              // That key's Argon2id verifier, or a legacy SHA-256 digest; the first key on create
+	APIKeyLookup        string     `json:"-"`              // That key's lookup ID; empty for legacy keys
+	Provider            string     `json:"provider"`       // Single provider: copilot or cursor
+	AllowedModels       string     `json:"allowed_models"` // JSON array of allowed models
+	DefaultModel        string     `json:"default_model"`  // Default model for requests
+	RateLimitPerMinute  int        `json:"rate_limit_per_minute"`
+	RateLimitBurst      int        `json:"rate_limit_burst"`       // Requests allowed at once; 0 uses a quarter of the per-minute rate
+	TokenLimitPerMinute int        `json:"token_limit_per_minute"` // Estimated tokens per minute; 0 is unlimited
+	MonthlyBudget       float64    `json:"monthly_budget"`         // Cost cap per budget period; 0 is uncapped
+	ModelQuotas         string     `json:"model_quotas"`           // JSON object of model name to requests per day; unlisted models are unlimited
+	BinaryPathOverride  string     `json:"binary_path_override"`   // CLI binary run instead of the provider's; must lie in cli.allowed_binary_dirs
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	ExpiresAt           *time.Time `json:"expires_at,omitempty"`
+	IsActive            bool       `json:"is_active"`
+	Metadata            string     `json:"metadata,omitempty"`
+	AllowedIPs          string     `json:"allowed_ips"` // JSON array of allowed IPs/CIDRs, empty means unrestricted
+	Scopes              string     `json:"scopes"`      // JSON array of granted scopes
+	CacheResponses      bool       `json:"cache_responses"`
+	ToolsUnrestricted   bool       `json:"tools_unrestricted"`       // Run the CLI with --allow-all-tools
+	AllowedTools        string     `json:"allowed_tools"`            // JSON array of tools requests may allow, empty means any
+	DeniedTools         string     `json:"denied_tools"`             // JSON array of tools denied on every request
+	ClientEnv           string     `json:"-"`                        // JSON object of env vars for CLI executions; values may be secrets
+	SkipContentFilter   bool       `json:"skip_content_filter"`      // Exempt from the prompt content filter
+	SystemPrompt        string     `json:"system_prompt,omitempty"`  // Instructions placed ahead of every prompt
+	PromptLogging       string     `json:"prompt_logging,omitempty"` // Overrides logging.prompts; empty uses it
+}
+
+// APIKey is one of a client's keys. Every key acts as the client, sharing its
+// limits and usage; revoking one leaves the others working.
+type APIKey struct {
+	ID        int64      `json:"id"`
+	ClientID  int64      `json:"client_id"`
+	Name      string     `json:"name"`
+	KeyHash   string     `json:"-"` // Argon2id verifier, or a legacy SHA-256 digest
+	KeyLookup string     `json:"-"` // Lookup ID for Argon2id keys; empty for legacy keys
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
 }
 
 type UsageLog struct {
@@ -32,12 +104,102 @@ type UsageLog struct {
 	ResponseTimeMs   int       `json:"response_time_ms"`
 	ResponseStatus   int       `json:"response_status"`
 	ErrorMessage     *string   `json:"error_message,omitempty"`
+	RequestBytes     int64     `json:"request_bytes"`
+	ResponseBytes    int64     `json:"response_bytes"`
+	FallbackFrom     *string   `json:"fallback_from,omitempty"` // "provider/model" requested, when a fallback served it
+	UsageReported    bool      `json:"usage_reported"`          // Tokens and cost came from the CLI, not estimates
+
+	Metadata map[string]string `json:"metadata,omitempty"` // Tags the request carried, e.g. {"project": "search"}
 }
 
 type UsageStats struct {
-	TotalRequests int            `json:"total_requests"`
-	TotalTokens   int64          `json:"total_tokens"`
-	TotalCost     float64        `json:"total_cost"`
-	ByProvider    map[string]int `json:"by_provider"`
-	ByModel       map[string]int `json:"by_model"`
+	TotalRequests  int                `json:"total_requests"`
+	TotalTokens    int64              `json:"total_tokens"`
+	TotalCost      float64            `json:"total_cost"`
+	ByProvider     map[string]int     `json:"by_provider"` // Request counts
+	ByModel        map[string]int     `json:"by_model"`    // Request counts
+	CostByProvider map[string]float64 `json:"cost_by_provider"`
+	CostByModel    map[string]float64 `json:"cost_by_model"`
+	TokensByModel  map[string]int64   `json:"tokens_by_model"`
+}
+
+// GlobalUsageStats aggregates usage across all clients, with the heaviest users first
+type GlobalUsageStats struct {
+	TotalRequests int           `json:"total_requests"`
+	TotalTokens   int64         `json:"total_tokens"`
+	TotalCost     float64       `json:"total_cost"`
+	TopClients    []ClientUsage `json:"top_clients"`
+}
+
+// ClientUsage is one client's share of GlobalUsageStats
+type ClientUsage struct {
+	ClientID    int64   `json:"client_id"`
+	ClientName  string  `json:"client_name"`
+	Requests    int     `json:"requests"`
+	TotalTokens int64   `json:"total_tokens"`
+	Cost        float64 `json:"cost"`
+}
+
+type UsageBucket struct {
+	Start       time.Time `json:"start"`
+	Requests    int       `json:"requests"`
+	TotalTokens int64     `json:"total_tokens"`
+	Cost        float64   `json:"cost"`
+}
+
+type Conversation struct {
+	ID        string                `json:"id"`
+	ClientID  int64                 `json:"client_id"`
+	CreatedAt time.Time             `json:"created_at"`
+	UpdatedAt time.Time             `json:"updated_at"`
+	Messages  []ConversationMessage `json:"messages,omitempty"`
+}
+
+type ConversationMessage struct {
+	ID             int64     `json:"id"`
+	ConversationID string    `json:"conversation_id"`
+	Role           string    `json:"role"`
+	Content        string    `json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type CachedResponse struct {
+	Key              string    `json:"key"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	Content          string    `json:"content"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	CreatedAt        time.Time `json:"created_at"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+// UsageError is a failed request from the usage log
+type UsageError struct {
+	ID             int64     `json:"id"`
+	Timestamp      time.Time `json:"timestamp"`
+	ResponseStatus int       `json:"response_status"`
+	ErrorMessage   string    `json:"error_message"`
+	SessionID      *string   `json:"session_id,omitempty"`
+	Provider       string    `json:"provider"`
+	Model          string    `json:"model"`
+	ResponseTimeMs int       `json:"response_time_ms"`
+}
+
+type Session struct {
+	ID        string     `json:"session_id"`
+	Requests  int        `json:"requests"`
+	FirstSeen time.Time  `json:"first_seen"`
+	LastSeen  time.Time  `json:"last_seen"`
+	Revoked   bool       `json:"revoked"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type AuditLog struct {
+	ID        int64           `json:"id"`
+	Actor     string          `json:"actor"` // "cli" or "client:<id>" of the admin key
+	Action    string          `json:"action"`
+	ClientID  int64           `json:"client_id"` // Client acted on
+	Timestamp time.Time       `json:"timestamp"`
+	Details   json.RawMessage `json:"details"`
 }
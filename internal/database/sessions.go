@@ -0,0 +1,85 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+// ListSessions summarizes a client's sessions from its usage logs, most recently used first
+func (db *DB) ListSessions(clientID int64, limit, offset int) ([]models.Session, error) {
+	// First and last seen come from the rows holding the lowest and highest IDs, so
+	// the timestamps keep their column type (aggregates of them scan as plain text)
+	query := `
+		SELECT s.session_id, s.requests, f.timestamp, l.timestamp, r.revoked_at
+		FROM (
+			SELECT session_id, COUNT(*) AS requests, MIN(id) AS first_id, MAX(id) AS last_id
+			FROM usage_logs
+			WHERE client_id = ? AND session_id IS NOT NULL AND session_id != ''
+			GROUP BY session_id
+		) s
+		JOIN usage_logs f ON f.id = s.first_id
+		JOIN usage_logs l ON l.id = s.last_id
+		LEFT JOIN session_revocations r ON r.session_id = s.session_id
+		ORDER BY s.last_id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := db.conn.Query(query, clientID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.Requests, &session.FirstSeen, &session.LastSeen, &session.RevokedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		session.Revoked = session.RevokedAt != nil
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// SessionBelongsTo reports whether a client has used a session, either in its
+// usage logs or as the owner of a persisted conversation
+func (db *DB) SessionBelongsTo(clientID int64, sessionID string) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM usage_logs WHERE client_id = ? AND session_id = ?)
+		    OR EXISTS (SELECT 1 FROM conversations WHERE client_id = ? AND id = ?)
+	`
+	var owned bool
+	if err := db.conn.QueryRow(query, clientID, sessionID, clientID, sessionID).Scan(&owned); err != nil {
+		return false, fmt.Errorf("failed to check session owner: %w", err)
+	}
+	return owned, nil
+}
+
+// RevokeSession marks a session as revoked; revoking it again is a no-op
+func (db *DB) RevokeSession(clientID int64, sessionID string) error {
+	query := `INSERT INTO session_revocations (session_id, client_id, revoked_at) VALUES (?, ?, ?) ON CONFLICT(session_id) DO NOTHING`
+	if _, err := db.conn.Exec(query, sessionID, clientID, time.Now()); err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// IsSessionRevoked reports whether a session has been revoked
+func (db *DB) IsSessionRevoked(sessionID string) (bool, error) {
+	var revoked int
+	err := db.conn.QueryRow(`SELECT 1 FROM session_revocations WHERE session_id = ?`, sessionID).Scan(&revoked)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check session revocation: %w", err)
+	}
+	return true, nil
+}
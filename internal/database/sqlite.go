@@ -2,46 +2,68 @@ package database
 
 import (
 	"database/sql"
-	_ "embed"
+	"embed"
 	"fmt"
+	"math/rand/v2"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	_ "modernc.org/sqlite"
 )
 
-//go:embed migrations/001_schema.sql
-var schema string
+// migrations holds the schema files, applied in filename order
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
 
 // DB wraps the SQL database connection
 type DB struct {
 	conn *sql.DB
 }
 
+// Options tunes the connection pool and lock handling
+type Options struct {
+	BusyTimeout  time.Duration // How long a statement waits on a locked database before failing
+	MaxOpenConns int           // Upper bound on pooled connections
+}
+
 // New creates a new database connection and runs migrations
-func New(dbPath string) (*DB, error) {
+func New(dbPath string, opts Options) (*DB, error) {
 	// Ensure directory exists
 	dir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
-	// Open database
-	conn, err := sql.Open("sqlite", dbPath)
+	// Open database. PRAGMAs go in the DSN so every pooled connection gets them:
+	// WAL lets readers run alongside the writer, and busy_timeout makes concurrent
+	// writers wait for the lock instead of failing with "database is locked"
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(%d)",
+		dbPath, opts.BusyTimeout.Milliseconds())
+	conn, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Enable foreign keys
-	if _, err := conn.Exec("PRAGMA foreign_keys = ON"); err != nil {
+	if opts.MaxOpenConns > 0 {
+		conn.SetMaxOpenConns(opts.MaxOpenConns)
+		conn.SetMaxIdleConns(opts.MaxOpenConns)
+	}
+	conn.SetConnMaxIdleTime(5 * time.Minute)
+
+	if err := conn.Ping(); err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
 	db := &DB{conn: conn}
 
-	// Run schema
-	if _, err := db.conn.Exec(schema); err != nil {
+	// Run migrations
+	if err := db.migrate(); err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("schema failed: %w", err)
 	}
@@ -49,6 +71,123 @@ func New(dbPath string) (*DB, error) {
 	return db, nil
 }
 
+// migrate applies migration files that haven't been recorded in schema_migrations yet
+func (db *DB) migrate() error {
+	if _, err := db.conn.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+		  version TEXT PRIMARY KEY,
+		  applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	entries, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	for _, entry := range entries {
+		version := entry.Name()
+
+		var applied int
+		if err := db.conn.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`, version).Scan(&applied); err != nil {
+			return fmt.Errorf("failed to check migration %s: %w", version, err)
+		}
+		if applied > 0 {
+			continue
+		}
+
+		script, err := migrations.ReadFile(path.Join("migrations", version))
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %w", version, err)
+		}
+
+		tx, err := db.conn.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %s: %w", version, err)
+		}
+		if _, err := tx.Exec(string(script)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s failed: %w", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %s: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %s: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+// MigrationStatus compares the recorded migrations with the embedded ones. It
+// returns those not yet applied, and those applied that this build doesn't
+// know, as left by a newer release sharing the database.
+func (db *DB) MigrationStatus() (pending, unknown []string, err error) {
+	rows, err := db.conn.Query(`SELECT version FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+	applied := make(map[string]bool)
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, nil, fmt.Errorf("failed to read applied migrations: %w", err)
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+
+	entries, err := migrations.ReadDir("migrations")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	for _, entry := range entries {
+		if !applied[entry.Name()] {
+			pending = append(pending, entry.Name())
+		}
+		delete(applied, entry.Name())
+	}
+	for version := range applied {
+		unknown = append(unknown, version)
+	}
+	slices.Sort(unknown)
+	return pending, unknown, nil
+}
+
+// IntegrityCheck runs SQLite's quick_check, returning an error describing
+// the first problems found in a damaged database file
+func (db *DB) IntegrityCheck() error {
+	rows, err := db.conn.Query(`PRAGMA quick_check`)
+	if err != nil {
+		return fmt.Errorf("failed to check database integrity: %w", err)
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return fmt.Errorf("failed to check database integrity: %w", err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to check database integrity: %w", err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("database integrity check failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
 // Close closes the database connection
 func (db *DB) Close() error {
 	return db.conn.Close()
@@ -58,3 +197,12 @@ func (db *DB) Close() error {
 func (db *DB) Conn() *sql.DB {
 	return db.conn
 }
+
+// Jitter returns d plus a random extra of up to a fifth of d, so periodic
+// maintenance on several instances doesn't hit the database in lockstep
+func Jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return d + rand.N(d/5+1)
+}
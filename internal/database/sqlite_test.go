@@ -0,0 +1,62 @@
+package database
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+func TestJitter(t *testing.T) {
+	interval := 5 * time.Minute
+	for range 1000 {
+		if got := Jitter(interval); got < interval || got > interval+interval/5 {
+			t.Fatalf("Jitter(%v) = %v, want within a fifth above it", interval, got)
+		}
+	}
+	if got := Jitter(0); got != 0 {
+		t.Errorf("Jitter(0) = %v, want 0", got)
+	}
+}
+
+func TestConcurrentUsageLogWrites(t *testing.T) {
+	// The server's default pool: writers on several connections contend for
+	// SQLite's single write lock and must wait for it rather than fail
+	db, err := New(filepath.Join(t.TempDir(), "test.db"), Options{BusyTimeout: 5 * time.Second, MaxOpenConns: 8})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer db.Close()
+	client := &models.Client{Name: "busy", APIKeyHash: "hash-busy", Provider: "mock", AllowedModels: `["*"]`, IsActive: true}
+	if err := db.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	const writers, writes = 32, 25
+	var wg sync.WaitGroup
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range writes {
+				log := &models.UsageLog{ClientID: client.ID, Timestamp: time.Now(), Provider: "mock", Model: "mock-model", ResponseStatus: 200, TotalTokens: 1}
+				if err := db.CreateUsageLog(log); err != nil {
+					t.Errorf("CreateUsageLog() error = %v", err)
+					return
+				}
+				// Reads alongside the writes don't block them under WAL
+				if _, err := db.CountUsageLogs(client.ID, nil, nil, nil); err != nil {
+					t.Errorf("CountUsageLogs() error = %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if count, err := db.CountUsageLogs(client.ID, nil, nil, nil); err != nil || count != writers*writes {
+		t.Errorf("CountUsageLogs() = %d, %v; want %d", count, err, writers*writes)
+	}
+}
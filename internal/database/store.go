@@ -0,0 +1,74 @@
+package database
+
+import (
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+// Store is the persistence the API depends on. DB, backed by SQLite, is the
+// default implementation; another backend (e.g. Postgres for several server
+// instances sharing state) only has to satisfy this interface. Lookups return
+// nil, not an error, when nothing matches.
+type Store interface {
+	// Clients
+	CreateClient(client *models.Client) error
+	GetClientByAPIKeyHash(keyHash string) (*models.Client, error)
+	GetClientByAPIKeyLookup(lookup string) (*models.Client, error)
+	UpgradeClientKeyHash(id int64, legacyHash, lookup, keyHash string) error
+	GetClientByID(id int64) (*models.Client, error)
+	ListClients() ([]models.Client, error)
+	ListClientIDs() (map[int64]bool, error)
+	UpdateClient(client *models.Client) error
+	DeleteClient(id int64) error
+
+	// API keys. Every unrevoked key authenticates as its client.
+	CreateAPIKey(key *models.APIKey) error
+	ListAPIKeys(clientID int64) ([]models.APIKey, error)
+	RevokeAPIKey(clientID, keyID int64) (bool, error)
+
+	// Usage logs
+	CreateUsageLog(log *models.UsageLog) error
+	GetUsageLogs(clientID int64, limit, offset int, startTime, endTime *time.Time, meta *MetadataFilter) ([]models.UsageLog, error)
+	CountUsageLogs(clientID int64, startTime, endTime *time.Time, meta *MetadataFilter) (int, error)
+	GetUsageErrors(clientID int64, limit, offset int) ([]models.UsageError, error)
+	CountUsageErrors(clientID int64) (int, error)
+	GetUsageStats(clientID int64, startTime, endTime *time.Time, meta *MetadataFilter) (*models.UsageStats, error)
+	GetUsageCost(clientID int64, since time.Time) (float64, error)
+	CountModelUsageSince(clientID int64, model string, since time.Time) (int, error)
+	GetGlobalUsageStats(startTime, endTime *time.Time, topN int) (*models.GlobalUsageStats, error)
+	GetUsageTimeSeries(clientID int64, startTime, endTime *time.Time, interval string) ([]models.UsageBucket, error)
+	DeleteUsageLogsByClient(clientID int64) error
+	DeleteUsageLogsBefore(cutoff time.Time, batchSize int) (int64, error)
+
+	// Rate limits. ReserveTokens must check and add atomically, since several
+	// requests (or server instances) may reserve against the same window.
+	IncrementRateLimitBucket(clientID int64, windowStart time.Time) error
+	GetRateLimitCount(clientID int64, windowStart time.Time) (int, error)
+	ReserveTokens(clientID int64, windowStart time.Time, tokens, limit int) (bool, error)
+	AddTokenUsage(clientID int64, windowStart time.Time, delta int) error
+	CleanupOldRateLimitBuckets(before time.Time) error
+
+	// Response cache
+	GetCachedResponse(key string) (*models.CachedResponse, error)
+	PutCachedResponse(entry *models.CachedResponse) error
+	DeleteExpiredCacheEntries(before time.Time) error
+
+	// Conversations and CLI sessions
+	CreateConversation(conv *models.Conversation) error
+	AppendMessage(conversationID, role, content string) error
+	GetConversation(id string) (*models.Conversation, error)
+	ListSessions(clientID int64, limit, offset int) ([]models.Session, error)
+	SessionBelongsTo(clientID int64, sessionID string) (bool, error)
+	RevokeSession(clientID int64, sessionID string) error
+	IsSessionRevoked(sessionID string) (bool, error)
+
+	// Audit log
+	CreateAuditLog(actor, action string, clientID int64, details map[string]interface{}) error
+	GetAuditLogs(clientID int64, limit, offset int) ([]models.AuditLog, error)
+
+	Close() error
+}
+
+// DB must keep satisfying Store
+var _ Store = (*DB)(nil)
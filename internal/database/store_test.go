@@ -0,0 +1,75 @@
+package database
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+// testDB opens a migrated database that is removed with the test
+func testDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := New(filepath.Join(t.TempDir(), "test.db"), Options{BusyTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestStoreLookupsReturnNilWhenMissing(t *testing.T) {
+	var store Store = testDB(t)
+
+	if client, err := store.GetClientByID(42); client != nil || err != nil {
+		t.Errorf("GetClientByID() = %v, %v; want nil, nil", client, err)
+	}
+	if client, err := store.GetClientByAPIKeyHash("missing"); client != nil || err != nil {
+		t.Errorf("GetClientByAPIKeyHash() = %v, %v; want nil, nil", client, err)
+	}
+	if client, err := store.GetClientByAPIKeyLookup("missing"); client != nil || err != nil {
+		t.Errorf("GetClientByAPIKeyLookup() = %v, %v; want nil, nil", client, err)
+	}
+	if entry, err := store.GetCachedResponse("missing"); entry != nil || err != nil {
+		t.Errorf("GetCachedResponse() = %v, %v; want nil, nil", entry, err)
+	}
+	if conv, err := store.GetConversation("missing"); conv != nil || err != nil {
+		t.Errorf("GetConversation() = %v, %v; want nil, nil", conv, err)
+	}
+}
+
+func TestReserveTokensIsAtomic(t *testing.T) {
+	var store Store = testDB(t)
+	client := &models.Client{Name: "tokens", Provider: "mock", AllowedModels: `["*"]`, IsActive: true}
+	if err := store.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	// Twenty concurrent reservations of 10 against a limit of 100: exactly ten fit
+	window := time.Now().Truncate(time.Minute)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted := 0
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := store.ReserveTokens(client.ID, window, 10, 100)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if ok {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if granted != 10 {
+		t.Errorf("%d reservations granted, want 10", granted)
+	}
+}
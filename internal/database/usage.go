@@ -2,22 +2,93 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/andrew/ai-cli-server/internal/database/models"
 )
 
+// MetadataFilter selects usage logs whose request metadata has Key set to Value
+type MetadataFilter struct {
+	Key   string
+	Value string
+}
+
+// Request metadata limits, keeping tags small enough to store on every usage log
+const (
+	maxMetadataEntries     = 16
+	maxMetadataValueLength = 256
+)
+
+// metadataKeyPattern keeps keys safe to quote into a JSON path
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ValidateMetadataKey checks a request metadata key
+func ValidateMetadataKey(key string) error {
+	if !metadataKeyPattern.MatchString(key) {
+		return fmt.Errorf("metadata key %q must be 1-64 letters, digits, '_' or '-'", key)
+	}
+	return nil
+}
+
+// ValidateMetadata checks the metadata a request tags its usage log with
+func ValidateMetadata(metadata map[string]string) error {
+	if len(metadata) > maxMetadataEntries {
+		return fmt.Errorf("metadata must have at most %d entries", maxMetadataEntries)
+	}
+	for key, value := range metadata {
+		if err := ValidateMetadataKey(key); err != nil {
+			return err
+		}
+		if len(value) > maxMetadataValueLength {
+			return fmt.Errorf("metadata value for %q must be at most %d bytes", key, maxMetadataValueLength)
+		}
+	}
+	return nil
+}
+
+// usageWhere builds the WHERE clause shared by a client's usage queries
+func usageWhere(clientID int64, startTime, endTime *time.Time, meta *MetadataFilter) (string, []interface{}) {
+	where := " WHERE client_id = ?"
+	args := []interface{}{clientID}
+
+	if startTime != nil {
+		where += " AND timestamp >= ?"
+		args = append(args, startTime)
+	}
+	if endTime != nil {
+		where += " AND timestamp <= ?"
+		args = append(args, endTime)
+	}
+	if meta != nil {
+		where += ` AND json_extract(metadata, '$."' || ? || '"') = ?`
+		args = append(args, meta.Key, meta.Value)
+	}
+	return where, args
+}
+
 // CreateUsageLog inserts a new usage log entry
 func (db *DB) CreateUsageLog(log *models.UsageLog) error {
 	query := `
 		INSERT INTO usage_logs (
 			client_id, session_id, timestamp, provider, model,
 			prompt, prompt_tokens, completion_tokens, total_tokens,
-			cost, response_time_ms, response_status, error_message
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			cost, response_time_ms, response_status, error_message,
+			request_bytes, response_bytes, fallback_from, usage_reported, metadata
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
+	var metadata sql.NullString
+	if len(log.Metadata) > 0 {
+		data, err := json.Marshal(log.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to marshal usage log metadata: %w", err)
+		}
+		metadata = sql.NullString{String: string(data), Valid: true}
+	}
+
 	result, err := db.conn.Exec(
 		query,
 		log.ClientID,
@@ -33,6 +104,11 @@ func (db *DB) CreateUsageLog(log *models.UsageLog) error {
 		log.ResponseTimeMs,
 		log.ResponseStatus,
 		log.ErrorMessage,
+		log.RequestBytes,
+		log.ResponseBytes,
+		log.FallbackFrom,
+		log.UsageReported,
+		metadata,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert usage log: %w", err)
@@ -48,26 +124,16 @@ func (db *DB) CreateUsageLog(log *models.UsageLog) error {
 }
 
 // GetUsageLogs retrieves usage logs for a client with optional filters
-func (db *DB) GetUsageLogs(clientID int64, limit, offset int, startTime, endTime *time.Time) ([]models.UsageLog, error) {
+func (db *DB) GetUsageLogs(clientID int64, limit, offset int, startTime, endTime *time.Time, meta *MetadataFilter) ([]models.UsageLog, error) {
+	where, args := usageWhere(clientID, startTime, endTime, meta)
 	query := `
 		SELECT id, client_id, session_id, timestamp, provider, model,
 			   prompt, prompt_tokens, completion_tokens, total_tokens,
-			   cost, response_time_ms, response_status, error_message
-		FROM usage_logs
-		WHERE client_id = ?
+			   cost, response_time_ms, response_status, error_message,
+			   request_bytes, response_bytes, fallback_from, usage_reported, metadata
+		FROM usage_logs` + where + `
+		ORDER BY timestamp DESC LIMIT ? OFFSET ?
 	`
-	args := []interface{}{clientID}
-
-	if startTime != nil {
-		query += " AND timestamp >= ?"
-		args = append(args, startTime)
-	}
-	if endTime != nil {
-		query += " AND timestamp <= ?"
-		args = append(args, endTime)
-	}
-
-	query += " ORDER BY timestamp DESC LIMIT ? OFFSET ?"
 	args = append(args, limit, offset)
 
 	rows, err := db.conn.Query(query, args...)
@@ -79,6 +145,7 @@ func (db *DB) GetUsageLogs(clientID int64, limit, offset int, startTime, endTime
 	var logs []models.UsageLog
 	for rows.Next() {
 		var log models.UsageLog
+		var metadata sql.NullString
 		err := rows.Scan(
 			&log.ID,
 			&log.ClientID,
@@ -94,10 +161,20 @@ func (db *DB) GetUsageLogs(clientID int64, limit, offset int, startTime, endTime
 			&log.ResponseTimeMs,
 			&log.ResponseStatus,
 			&log.ErrorMessage,
+			&log.RequestBytes,
+			&log.ResponseBytes,
+			&log.FallbackFrom,
+			&log.UsageReported,
+			&metadata,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan usage log: %w", err)
 		}
+		if metadata.Valid {
+			if err := json.Unmarshal([]byte(metadata.String), &log.Metadata); err != nil {
+				return nil, fmt.Errorf("failed to parse usage log metadata: %w", err)
+			}
+		}
 		logs = append(logs, log)
 	}
 
@@ -108,26 +185,66 @@ func (db *DB) GetUsageLogs(clientID int64, limit, offset int, startTime, endTime
 	return logs, nil
 }
 
+// CountUsageLogs returns the number of usage logs for a client matching the optional filters
+func (db *DB) CountUsageLogs(clientID int64, startTime, endTime *time.Time, meta *MetadataFilter) (int, error) {
+	where, args := usageWhere(clientID, startTime, endTime, meta)
+
+	var count int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM usage_logs`+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count usage logs: %w", err)
+	}
+	return count, nil
+}
+
+// GetUsageErrors retrieves a client's failed requests (status other than 200), newest first
+func (db *DB) GetUsageErrors(clientID int64, limit, offset int) ([]models.UsageError, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, timestamp, response_status, COALESCE(error_message, ''), session_id,
+			   provider, model, response_time_ms
+		FROM usage_logs
+		WHERE client_id = ? AND response_status != 200
+		ORDER BY timestamp DESC
+		LIMIT ? OFFSET ?
+	`, clientID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage errors: %w", err)
+	}
+	defer rows.Close()
+
+	usageErrors := []models.UsageError{}
+	for rows.Next() {
+		var e models.UsageError
+		if err := rows.Scan(&e.ID, &e.Timestamp, &e.ResponseStatus, &e.ErrorMessage, &e.SessionID,
+			&e.Provider, &e.Model, &e.ResponseTimeMs); err != nil {
+			return nil, fmt.Errorf("failed to scan usage error: %w", err)
+		}
+		usageErrors = append(usageErrors, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating usage errors: %w", err)
+	}
+	return usageErrors, nil
+}
+
+// CountUsageErrors returns the number of failed requests logged for a client
+func (db *DB) CountUsageErrors(clientID int64) (int, error) {
+	var count int
+	err := db.conn.QueryRow(`SELECT COUNT(*) FROM usage_logs WHERE client_id = ? AND response_status != 200`, clientID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count usage errors: %w", err)
+	}
+	return count, nil
+}
+
 // GetUsageStats calculates aggregated usage statistics for a client
-func (db *DB) GetUsageStats(clientID int64, startTime, endTime *time.Time) (*models.UsageStats, error) {
+func (db *DB) GetUsageStats(clientID int64, startTime, endTime *time.Time, meta *MetadataFilter) (*models.UsageStats, error) {
+	where, args := usageWhere(clientID, startTime, endTime, meta)
 	query := `
 		SELECT 
 			COUNT(*) as total_requests,
 			COALESCE(SUM(total_tokens), 0) as total_tokens,
 			COALESCE(SUM(cost), 0) as total_cost
-		FROM usage_logs
-		WHERE client_id = ?
-	`
-	args := []interface{}{clientID}
-
-	if startTime != nil {
-		query += " AND timestamp >= ?"
-		args = append(args, startTime)
-	}
-	if endTime != nil {
-		query += " AND timestamp <= ?"
-		args = append(args, endTime)
-	}
+		FROM usage_logs` + where
 
 	var stats models.UsageStats
 	err := db.conn.QueryRow(query, args...).Scan(
@@ -141,23 +258,14 @@ func (db *DB) GetUsageStats(clientID int64, startTime, endTime *time.Time) (*mod
 
 	// Get breakdown by provider
 	stats.ByProvider = make(map[string]int)
+	stats.CostByProvider = make(map[string]float64)
 	providerQuery := `
-		SELECT provider, COUNT(*) as count
-		FROM usage_logs
-		WHERE client_id = ?
+		SELECT provider, COUNT(*) as count, COALESCE(SUM(cost), 0) as cost
+		FROM usage_logs` + where + `
+		GROUP BY provider
 	`
-	providerArgs := []interface{}{clientID}
-	if startTime != nil {
-		providerQuery += " AND timestamp >= ?"
-		providerArgs = append(providerArgs, startTime)
-	}
-	if endTime != nil {
-		providerQuery += " AND timestamp <= ?"
-		providerArgs = append(providerArgs, endTime)
-	}
-	providerQuery += " GROUP BY provider"
 
-	rows, err := db.conn.Query(providerQuery, providerArgs...)
+	rows, err := db.conn.Query(providerQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get provider stats: %w", err)
 	}
@@ -166,31 +274,25 @@ func (db *DB) GetUsageStats(clientID int64, startTime, endTime *time.Time) (*mod
 	for rows.Next() {
 		var provider string
 		var count int
-		if err := rows.Scan(&provider, &count); err != nil {
+		var cost float64
+		if err := rows.Scan(&provider, &count, &cost); err != nil {
 			return nil, fmt.Errorf("failed to scan provider stats: %w", err)
 		}
 		stats.ByProvider[provider] = count
+		stats.CostByProvider[provider] = cost
 	}
 
 	// Get breakdown by model
 	stats.ByModel = make(map[string]int)
+	stats.CostByModel = make(map[string]float64)
+	stats.TokensByModel = make(map[string]int64)
 	modelQuery := `
-		SELECT model, COUNT(*) as count
-		FROM usage_logs
-		WHERE client_id = ?
+		SELECT model, COUNT(*) as count, COALESCE(SUM(cost), 0) as cost, COALESCE(SUM(total_tokens), 0) as tokens
+		FROM usage_logs` + where + `
+		GROUP BY model
 	`
-	modelArgs := []interface{}{clientID}
-	if startTime != nil {
-		modelQuery += " AND timestamp >= ?"
-		modelArgs = append(modelArgs, startTime)
-	}
-	if endTime != nil {
-		modelQuery += " AND timestamp <= ?"
-		modelArgs = append(modelArgs, endTime)
-	}
-	modelQuery += " GROUP BY model"
 
-	rows, err = db.conn.Query(modelQuery, modelArgs...)
+	rows, err = db.conn.Query(modelQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get model stats: %w", err)
 	}
@@ -199,15 +301,225 @@ func (db *DB) GetUsageStats(clientID int64, startTime, endTime *time.Time) (*mod
 	for rows.Next() {
 		var model string
 		var count int
-		if err := rows.Scan(&model, &count); err != nil {
+		var cost float64
+		var tokens int64
+		if err := rows.Scan(&model, &count, &cost, &tokens); err != nil {
 			return nil, fmt.Errorf("failed to scan model stats: %w", err)
 		}
 		stats.ByModel[model] = count
+		stats.CostByModel[model] = cost
+		stats.TokensByModel[model] = tokens
 	}
 
 	return &stats, nil
 }
 
+// GetUsageCost returns a client's total logged cost since a point in time
+func (db *DB) GetUsageCost(clientID int64, since time.Time) (float64, error) {
+	var cost float64
+	err := db.conn.QueryRow(`
+		SELECT COALESCE(SUM(cost), 0) FROM usage_logs WHERE client_id = ? AND timestamp >= ?
+	`, clientID, since).Scan(&cost)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get usage cost: %w", err)
+	}
+	return cost, nil
+}
+
+// CountModelUsageSince returns how many successful requests a client has made
+// to a model since a point in time
+func (db *DB) CountModelUsageSince(clientID int64, model string, since time.Time) (int, error) {
+	var count int
+	err := db.conn.QueryRow(`
+		SELECT COUNT(*) FROM usage_logs
+		WHERE client_id = ? AND model = ? AND timestamp >= ? AND response_status = 200
+	`, clientID, model, since).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count model usage: %w", err)
+	}
+	return count, nil
+}
+
+// GetGlobalUsageStats totals usage across all clients and ranks the top clients by
+// requests, then tokens. Clients without usage in the range are left out.
+func (db *DB) GetGlobalUsageStats(startTime, endTime *time.Time, topN int) (*models.GlobalUsageStats, error) {
+	where := " WHERE 1 = 1"
+	var args []interface{}
+	if startTime != nil {
+		where += " AND timestamp >= ?"
+		args = append(args, startTime)
+	}
+	if endTime != nil {
+		where += " AND timestamp <= ?"
+		args = append(args, endTime)
+	}
+
+	var stats models.GlobalUsageStats
+	err := db.conn.QueryRow(`
+		SELECT
+			COUNT(*) as total_requests,
+			COALESCE(SUM(total_tokens), 0) as total_tokens,
+			COALESCE(SUM(cost), 0) as total_cost
+		FROM usage_logs`+where, args...).Scan(
+		&stats.TotalRequests,
+		&stats.TotalTokens,
+		&stats.TotalCost,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get global usage stats: %w", err)
+	}
+
+	rows, err := db.conn.Query(`
+		SELECT u.client_id, COALESCE(c.name, ''), u.requests, u.total_tokens, u.cost
+		FROM (
+			SELECT client_id,
+				COUNT(*) as requests,
+				COALESCE(SUM(total_tokens), 0) as total_tokens,
+				COALESCE(SUM(cost), 0) as cost
+			FROM usage_logs`+where+`
+			GROUP BY client_id
+		) u
+		LEFT JOIN clients c ON c.id = u.client_id
+		ORDER BY u.requests DESC, u.total_tokens DESC, u.client_id
+		LIMIT ?
+	`, append(args, topN)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client usage stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats.TopClients = []models.ClientUsage{}
+	for rows.Next() {
+		var c models.ClientUsage
+		if err := rows.Scan(&c.ClientID, &c.ClientName, &c.Requests, &c.TotalTokens, &c.Cost); err != nil {
+			return nil, fmt.Errorf("failed to scan client usage stats: %w", err)
+		}
+		stats.TopClients = append(stats.TopClients, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating client usage stats: %w", err)
+	}
+
+	return &stats, nil
+}
+
+// Time series bucket intervals
+const (
+	IntervalHour = "hour"
+	IntervalDay  = "day"
+)
+
+// maxTimeSeriesBuckets caps gap filling so a wide range with a small interval can't exhaust memory
+const maxTimeSeriesBuckets = 10000
+
+// GetUsageTimeSeries aggregates a client's usage into hourly or daily buckets.
+// Buckets with no activity between the range bounds are filled with zeros.
+// When start or end is nil, the first or last bucket with activity bounds the range.
+func (db *DB) GetUsageTimeSeries(clientID int64, startTime, endTime *time.Time, interval string) ([]models.UsageBucket, error) {
+	var bucketFormat string
+	switch interval {
+	case IntervalHour:
+		bucketFormat = "%Y-%m-%d %H:00:00"
+	case IntervalDay:
+		bucketFormat = "%Y-%m-%d 00:00:00"
+	default:
+		return nil, fmt.Errorf("unsupported interval: %s", interval)
+	}
+
+	// The driver stores timestamps as "2006-01-02 15:04:05.999999999 -0700 MST", which
+	// strftime can't parse as a whole, so bucket on the leading date and time part
+	query := `
+		SELECT
+			strftime(?, substr(timestamp, 1, 19)) as bucket,
+			COUNT(*) as requests,
+			COALESCE(SUM(total_tokens), 0) as total_tokens,
+			COALESCE(SUM(cost), 0) as cost
+		FROM usage_logs
+		WHERE client_id = ?
+	`
+	args := []interface{}{bucketFormat, clientID}
+
+	if startTime != nil {
+		query += " AND timestamp >= ?"
+		args = append(args, startTime)
+	}
+	if endTime != nil {
+		query += " AND timestamp <= ?"
+		args = append(args, endTime)
+	}
+	query += " GROUP BY bucket ORDER BY bucket"
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage time series: %w", err)
+	}
+	defer rows.Close()
+
+	byStart := make(map[time.Time]models.UsageBucket)
+	var first, last time.Time
+	for rows.Next() {
+		var bucketStr string
+		var bucket models.UsageBucket
+		if err := rows.Scan(&bucketStr, &bucket.Requests, &bucket.TotalTokens, &bucket.Cost); err != nil {
+			return nil, fmt.Errorf("failed to scan usage bucket: %w", err)
+		}
+		bucket.Start, err = time.ParseInLocation("2006-01-02 15:04:05", bucketStr, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse usage bucket %q: %w", bucketStr, err)
+		}
+		if len(byStart) == 0 {
+			first = bucket.Start
+		}
+		last = bucket.Start
+		byStart[bucket.Start] = bucket
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating usage buckets: %w", err)
+	}
+
+	// Determine the range to fill
+	if startTime != nil {
+		first = truncateToInterval(*startTime, interval)
+	}
+	if endTime != nil {
+		last = truncateToInterval(*endTime, interval)
+	}
+	if first.IsZero() || last.IsZero() || last.Before(first) {
+		return []models.UsageBucket{}, nil
+	}
+
+	buckets := []models.UsageBucket{}
+	for t := first; !t.After(last); t = nextInterval(t, interval) {
+		if len(buckets) >= maxTimeSeriesBuckets {
+			return nil, fmt.Errorf("time range spans more than %d %s buckets", maxTimeSeriesBuckets, interval)
+		}
+		bucket, ok := byStart[t]
+		if !ok {
+			bucket = models.UsageBucket{Start: t}
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	return buckets, nil
+}
+
+// truncateToInterval returns the start of the bucket containing t in local time
+func truncateToInterval(t time.Time, interval string) time.Time {
+	t = t.In(time.Local)
+	if interval == IntervalHour {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, time.Local)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// nextInterval returns the start of the bucket following t
+func nextInterval(t time.Time, interval string) time.Time {
+	if interval == IntervalHour {
+		return t.Add(time.Hour)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
 // DeleteUsageLogsByClient deletes all usage logs for a specific client
 func (db *DB) DeleteUsageLogsByClient(clientID int64) error {
 	query := `DELETE FROM usage_logs WHERE client_id = ?`
@@ -215,6 +527,31 @@ func (db *DB) DeleteUsageLogsByClient(clientID int64) error {
 	return err
 }
 
+// DeleteUsageLogsBefore deletes usage logs older than cutoff in batches of batchSize,
+// so a large prune never holds the write lock for long. Returns the number of rows deleted.
+func (db *DB) DeleteUsageLogsBefore(cutoff time.Time, batchSize int) (int64, error) {
+	query := `
+		DELETE FROM usage_logs
+		WHERE id IN (SELECT id FROM usage_logs WHERE timestamp < ? LIMIT ?)
+	`
+
+	var total int64
+	for {
+		result, err := db.conn.Exec(query, cutoff, batchSize)
+		if err != nil {
+			return total, fmt.Errorf("failed to delete usage logs: %w", err)
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("failed to get affected rows: %w", err)
+		}
+		total += deleted
+		if deleted < int64(batchSize) {
+			return total, nil
+		}
+	}
+}
+
 // IncrementRateLimitBucket increments the request count for a client's rate limit bucket
 func (db *DB) IncrementRateLimitBucket(clientID int64, windowStart time.Time) error {
 	query := `
@@ -247,12 +584,47 @@ func (db *DB) GetRateLimitCount(clientID int64, windowStart time.Time) (int, err
 	return count, nil
 }
 
-// CleanupOldRateLimitBuckets removes rate limit buckets older than the specified time
-func (db *DB) CleanupOldRateLimitBuckets(before time.Time) error {
-	query := `DELETE FROM rate_limit_buckets WHERE window_start < ?`
-	_, err := db.conn.Exec(query, before)
+// ReserveTokens adds tokens to a client's token bucket for the window unless that
+// would exceed limit, in which case nothing changes and false is returned.
+// A first reservation in a window always succeeds; callers reject tokens > limit.
+func (db *DB) ReserveTokens(clientID int64, windowStart time.Time, tokens, limit int) (bool, error) {
+	query := `
+		INSERT INTO token_rate_limit_buckets (client_id, window_start, token_count)
+		VALUES (?, ?, ?)
+		ON CONFLICT(client_id, window_start) DO UPDATE SET token_count = token_count + excluded.token_count
+		WHERE token_count + excluded.token_count <= ?
+	`
+	result, err := db.conn.Exec(query, clientID, windowStart, tokens, limit)
 	if err != nil {
-		return fmt.Errorf("failed to cleanup old rate limit buckets: %w", err)
+		return false, fmt.Errorf("failed to reserve tokens: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// AddTokenUsage adjusts a client's token bucket for the window by delta, which may
+// be negative, without checking the limit
+func (db *DB) AddTokenUsage(clientID int64, windowStart time.Time, delta int) error {
+	query := `
+		INSERT INTO token_rate_limit_buckets (client_id, window_start, token_count)
+		VALUES (?, ?, MAX(?, 0))
+		ON CONFLICT(client_id, window_start) DO UPDATE SET token_count = MAX(token_count + ?, 0)
+	`
+	if _, err := db.conn.Exec(query, clientID, windowStart, delta, delta); err != nil {
+		return fmt.Errorf("failed to update token usage: %w", err)
+	}
+	return nil
+}
+
+// CleanupOldRateLimitBuckets removes request and token rate limit buckets older than the specified time
+func (db *DB) CleanupOldRateLimitBuckets(before time.Time) error {
+	for _, table := range []string{"rate_limit_buckets", "token_rate_limit_buckets"} {
+		if _, err := db.conn.Exec(`DELETE FROM `+table+` WHERE window_start < ?`, before); err != nil {
+			return fmt.Errorf("failed to cleanup old %s: %w", table, err)
+		}
 	}
 	return nil
 }
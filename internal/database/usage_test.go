@@ -0,0 +1,256 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/database/models"
+)
+
+func TestGetGlobalUsageStats(t *testing.T) {
+	db := testDB(t)
+
+	now := time.Now()
+	usage := map[string][]models.UsageLog{
+		"light": {{Timestamp: now, TotalTokens: 500, Cost: 0.5}},
+		"heavy": {
+			{Timestamp: now, TotalTokens: 100, Cost: 0.1},
+			{Timestamp: now, TotalTokens: 100, Cost: 0.1},
+			{Timestamp: now.Add(-48 * time.Hour), TotalTokens: 100, Cost: 0.1},
+		},
+		"tied": {
+			{Timestamp: now, TotalTokens: 50},
+			{Timestamp: now, TotalTokens: 50},
+		},
+		"idle": nil,
+	}
+	ids := map[string]int64{}
+	for _, name := range []string{"light", "heavy", "tied", "idle"} {
+		client := &models.Client{Name: name, APIKeyHash: "hash-" + name, Provider: "mock", AllowedModels: `["*"]`, IsActive: true}
+		if err := db.CreateClient(client); err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = client.ID
+		for _, log := range usage[name] {
+			log.ClientID = client.ID
+			log.Provider, log.Model, log.ResponseStatus = "mock", "mock-model", 200
+			if err := db.CreateUsageLog(&log); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	stats, err := db.GetGlobalUsageStats(nil, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalRequests != 6 || stats.TotalTokens != 900 {
+		t.Errorf("totals = %d requests, %d tokens; want 6, 900", stats.TotalRequests, stats.TotalTokens)
+	}
+	// Ranked by requests; idle has none and is left out
+	want := []string{"heavy", "tied", "light"}
+	if len(stats.TopClients) != len(want) {
+		t.Fatalf("top clients = %+v, want %v", stats.TopClients, want)
+	}
+	for i, name := range want {
+		if got := stats.TopClients[i]; got.ClientID != ids[name] || got.ClientName != name {
+			t.Errorf("top client %d = %+v, want %s", i, got, name)
+		}
+	}
+
+	// A start time drops heavy's old request, tying it with tied on requests; tokens break the tie
+	start := now.Add(-time.Hour)
+	stats, err = db.GetGlobalUsageStats(&start, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalRequests != 5 || stats.TotalTokens != 800 {
+		t.Errorf("ranged totals = %d requests, %d tokens; want 5, 800", stats.TotalRequests, stats.TotalTokens)
+	}
+	if len(stats.TopClients) != 2 || stats.TopClients[0].ClientName != "heavy" || stats.TopClients[1].ClientName != "tied" {
+		t.Errorf("ranged top clients = %+v, want heavy then tied", stats.TopClients)
+	}
+	if heavy := stats.TopClients[0]; heavy.Requests != 2 || heavy.TotalTokens != 200 {
+		t.Errorf("heavy = %+v, want 2 requests and 200 tokens", heavy)
+	}
+}
+
+func TestUsageMetadataFilter(t *testing.T) {
+	db := testDB(t)
+	client := &models.Client{Name: "tagged", APIKeyHash: "hash-tagged", Provider: "mock", AllowedModels: `["*"]`, IsActive: true}
+	if err := db.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, metadata := range []map[string]string{
+		{"project": "search", "team": "core"},
+		{"project": "search"},
+		{"project": "ads"},
+		nil,
+	} {
+		log := &models.UsageLog{ClientID: client.ID, Timestamp: time.Now(), Provider: "mock", Model: "mock-model", ResponseStatus: 200, TotalTokens: 10, Metadata: metadata}
+		if err := db.CreateUsageLog(log); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search := &MetadataFilter{Key: "project", Value: "search"}
+	logs, err := db.GetUsageLogs(client.ID, 10, 0, nil, nil, search)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("GetUsageLogs() returned %d logs, want the 2 tagged project=search", len(logs))
+	}
+	for _, log := range logs {
+		if log.Metadata["project"] != "search" {
+			t.Errorf("log metadata = %v, want project=search", log.Metadata)
+		}
+	}
+
+	if count, err := db.CountUsageLogs(client.ID, nil, nil, search); err != nil || count != 2 {
+		t.Errorf("CountUsageLogs() = %d, %v; want 2", count, err)
+	}
+	stats, err := db.GetUsageStats(client.ID, nil, nil, &MetadataFilter{Key: "team", Value: "core"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalRequests != 1 || stats.TotalTokens != 10 || stats.ByProvider["mock"] != 1 {
+		t.Errorf("stats for team=core = %+v, want one request", stats)
+	}
+
+	// Without a filter, untagged logs are included and read back without metadata
+	logs, err = db.GetUsageLogs(client.ID, 10, 0, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	untagged := 0
+	for _, log := range logs {
+		if log.Metadata == nil {
+			untagged++
+		}
+	}
+	if len(logs) != 4 || untagged != 1 {
+		t.Errorf("GetUsageLogs() without a filter = %d logs, %d untagged; want 4, 1", len(logs), untagged)
+	}
+}
+
+func TestUsageStatsBreakdownSumsLogs(t *testing.T) {
+	db := testDB(t)
+	client := &models.Client{Name: "breakdown", APIKeyHash: "hash-breakdown", Provider: "copilot", AllowedModels: `["*"]`, IsActive: true}
+	if err := db.CreateClient(client); err != nil {
+		t.Fatal(err)
+	}
+	logs := []models.UsageLog{
+		{Provider: "copilot", Model: "gpt-5", TotalTokens: 100, Cost: 0.25},
+		{Provider: "copilot", Model: "gpt-5", TotalTokens: 300, Cost: 0.5},
+		{Provider: "copilot", Model: "sonnet-4", TotalTokens: 1000, Cost: 2},
+		{Provider: "cursor", Model: "sonnet-4", TotalTokens: 50, Cost: 0.125},
+		{Provider: "cursor", Model: "auto", TotalTokens: 7},
+	}
+	for _, log := range logs {
+		log.ClientID, log.Timestamp, log.ResponseStatus = client.ID, time.Now(), 200
+		if err := db.CreateUsageLog(&log); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Sum the logs independently to compare against the grouped queries
+	costByProvider := map[string]float64{}
+	costByModel := map[string]float64{}
+	tokensByModel := map[string]int64{}
+	countByModel := map[string]int{}
+	for _, log := range logs {
+		costByProvider[log.Provider] += log.Cost
+		costByModel[log.Model] += log.Cost
+		tokensByModel[log.Model] += int64(log.TotalTokens)
+		countByModel[log.Model]++
+	}
+
+	stats, err := db.GetUsageStats(client.ID, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for provider, cost := range costByProvider {
+		if got := stats.CostByProvider[provider]; got != cost {
+			t.Errorf("CostByProvider[%s] = %v, want %v", provider, got, cost)
+		}
+	}
+	for model, cost := range costByModel {
+		if got := stats.CostByModel[model]; got != cost {
+			t.Errorf("CostByModel[%s] = %v, want %v", model, got, cost)
+		}
+		if got := stats.TokensByModel[model]; got != tokensByModel[model] {
+			t.Errorf("TokensByModel[%s] = %d, want %d", model, got, tokensByModel[model])
+		}
+		if got := stats.ByModel[model]; got != countByModel[model] {
+			t.Errorf("ByModel[%s] = %d, want the request count %d", model, got, countByModel[model])
+		}
+	}
+	if len(stats.CostByProvider) != len(costByProvider) || len(stats.CostByModel) != len(costByModel) || len(stats.TokensByModel) != len(tokensByModel) {
+		t.Errorf("breakdowns = %v, %v, %v; want one entry per provider or model", stats.CostByProvider, stats.CostByModel, stats.TokensByModel)
+	}
+	if stats.ByProvider["copilot"] != 3 || stats.ByProvider["cursor"] != 2 {
+		t.Errorf("ByProvider = %v, want request counts copilot 3, cursor 2", stats.ByProvider)
+	}
+}
+
+func TestCountUsageLogsMatchesPages(t *testing.T) {
+	db := testDB(t)
+	var clientIDs []int64
+	for _, name := range []string{"counted", "other"} {
+		client := &models.Client{Name: name, APIKeyHash: "hash-" + name, Provider: "mock", AllowedModels: `["*"]`, IsActive: true}
+		if err := db.CreateClient(client); err != nil {
+			t.Fatal(err)
+		}
+		clientIDs = append(clientIDs, client.ID)
+	}
+
+	// Ten hourly logs for the counted client, and some for another client that
+	// no filter should count
+	base := time.Now().Truncate(time.Hour).Add(-10 * time.Hour)
+	for i := range 10 {
+		for _, clientID := range clientIDs[:1+i%2] {
+			log := &models.UsageLog{ClientID: clientID, Timestamp: base.Add(time.Duration(i) * time.Hour), Provider: "mock", Model: "mock-model", ResponseStatus: 200}
+			if err := db.CreateUsageLog(log); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	start, end := base.Add(3*time.Hour), base.Add(7*time.Hour)
+	tests := []struct {
+		name       string
+		start, end *time.Time
+		want       int
+	}{
+		{"no range", nil, nil, 10},
+		{"start", &start, nil, 7},
+		{"end", nil, &end, 8},
+		{"start and end", &start, &end, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, err := db.CountUsageLogs(clientIDs[0], tt.start, tt.end, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Page through the same range three logs at a time
+			listed := 0
+			for offset := 0; ; offset += 3 {
+				page, err := db.GetUsageLogs(clientIDs[0], 3, offset, tt.start, tt.end, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				listed += len(page)
+				if len(page) < 3 {
+					break
+				}
+			}
+			if count != tt.want || listed != tt.want {
+				t.Errorf("CountUsageLogs() = %d, paged list has %d; want %d", count, listed, tt.want)
+			}
+		})
+	}
+}
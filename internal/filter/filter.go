@@ -0,0 +1,61 @@
+package filter
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/andrew/ai-cli-server/internal/config"
+)
+
+// rule is a compiled content filter rule
+type rule struct {
+	name    string
+	pattern *regexp.Regexp
+	keyword string // Lowercased
+}
+
+// Filter blocks prompts matching configured patterns or keywords before they
+// reach a CLI. A Filter with no rules allows everything.
+type Filter struct {
+	rules []rule
+}
+
+// New compiles the configured rules. Patterns are checked by config.Load, so
+// an invalid one here is a programming error.
+func New(cfg config.FilterConfig) *Filter {
+	f := &Filter{}
+	for _, r := range cfg.Rules {
+		compiled := rule{name: r.Name}
+		if r.Pattern != "" {
+			compiled.pattern = regexp.MustCompile(r.Pattern)
+			if compiled.name == "" {
+				compiled.name = r.Pattern
+			}
+		} else {
+			compiled.keyword = strings.ToLower(r.Keyword)
+			if compiled.name == "" {
+				compiled.name = r.Keyword
+			}
+		}
+		f.rules = append(f.rules, compiled)
+	}
+	return f
+}
+
+// Check reports the name of the first rule the prompt matches, if any
+func (f *Filter) Check(prompt string) (reason string, blocked bool) {
+	if len(f.rules) == 0 {
+		return "", false
+	}
+
+	lowered := strings.ToLower(prompt)
+	for _, r := range f.rules {
+		if r.pattern != nil && r.pattern.MatchString(prompt) {
+			return r.name, true
+		}
+		if r.keyword != "" && strings.Contains(lowered, r.keyword) {
+			return r.name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,75 @@
+// Package tracing wires OpenTelemetry spans through the request lifecycle.
+// Until Setup installs an exporter the global tracer provider is OpenTelemetry's
+// no-op implementation, so spans cost next to nothing when tracing is disabled.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/andrew/ai-cli-server/internal/config"
+)
+
+// tracerName identifies spans created by this server
+const tracerName = "github.com/andrew/ai-cli-server"
+
+// Span attribute keys shared across phases
+const (
+	AttrClientID         = attribute.Key("client.id")
+	AttrProvider         = attribute.Key("cli.provider")
+	AttrModel            = attribute.Key("cli.model")
+	AttrPromptTokens     = attribute.Key("cli.prompt_tokens")
+	AttrCompletionTokens = attribute.Key("cli.completion_tokens")
+	AttrDurationMs       = attribute.Key("cli.duration_ms")
+)
+
+// Setup installs an OTLP/HTTP exporter as the global tracer provider when
+// tracing is enabled. The returned function flushes and stops it; it is a
+// no-op when tracing is disabled.
+func Setup(ctx context.Context, cfg config.TracingConfig) (func(context.Context) error, error) {
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(*cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return provider.Shutdown, nil
+}
+
+// Start begins a span named name as a child of any span in ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// SetClient records the authenticated client on the request's root span
+func SetClient(ctx context.Context, clientID int64) {
+	trace.SpanFromContext(ctx).SetAttributes(AttrClientID.Int64(clientID))
+}
@@ -0,0 +1,135 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/andrew/ai-cli-server/internal/config"
+)
+
+// Event types
+const (
+	EventRateLimitExceeded   = "rate_limit_exceeded"
+	EventProviderUnavailable = "provider_unavailable"
+	EventCLIError            = "cli_error"
+)
+
+// Event represents a notification delivered to the webhook URL
+// Text carries a human-readable summary so chat webhooks (e.g. Slack) can display it
+type Event struct {
+	Type      string                 `json:"event"`
+	Text      string                 `json:"text"`
+	ClientID  int64                  `json:"client_id,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// Notifier delivers events to a webhook URL from a bounded background queue
+// so webhook latency never blocks requests. A nil Notifier discards events.
+type Notifier struct {
+	url        string
+	client     *http.Client
+	queue      chan Event
+	maxRetries int
+	cooldown   time.Duration
+	logger     *log.Logger
+
+	lastSent map[string]time.Time
+	mu       sync.Mutex
+}
+
+// NewNotifier creates a notifier and starts its delivery worker
+// Returns nil when no webhook URL is configured
+func NewNotifier(cfg config.WebhookConfig, logger *log.Logger) *Notifier {
+	if cfg.URL == "" {
+		return nil
+	}
+
+	n := &Notifier{
+		url:        cfg.URL,
+		client:     &http.Client{Timeout: cfg.Timeout},
+		queue:      make(chan Event, cfg.QueueSize),
+		maxRetries: cfg.MaxRetries,
+		cooldown:   cfg.Cooldown,
+		logger:     logger,
+		lastSent:   make(map[string]time.Time),
+	}
+
+	// Start delivery worker
+	go n.run()
+
+	return n
+}
+
+// Notify queues an event for delivery without blocking
+// Repeats of the same event type for the same client within the cooldown are
+// suppressed, and events are dropped when the queue is full
+func (n *Notifier) Notify(event Event) {
+	if n == nil {
+		return
+	}
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	if event.Text == "" {
+		event.Text = fmt.Sprintf("[ai-cli-server] %s (client %d)", event.Type, event.ClientID)
+	}
+
+	key := fmt.Sprintf("%s:%d", event.Type, event.ClientID)
+	n.mu.Lock()
+	if last, ok := n.lastSent[key]; ok && event.Timestamp.Sub(last) < n.cooldown {
+		n.mu.Unlock()
+		return
+	}
+	n.lastSent[key] = event.Timestamp
+	n.mu.Unlock()
+
+	select {
+	case n.queue <- event:
+	default:
+		n.logger.Printf("Webhook queue full, dropping %s event for client %d", event.Type, event.ClientID)
+	}
+}
+
+// run delivers queued events, retrying failures before dropping them
+func (n *Notifier) run() {
+	for event := range n.queue {
+		var err error
+		for attempt := 0; attempt <= n.maxRetries; attempt++ {
+			if attempt > 0 {
+				time.Sleep(time.Duration(attempt) * time.Second)
+			}
+			if err = n.deliver(event); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			n.logger.Printf("Webhook delivery failed, dropping %s event for client %d: %v", event.Type, event.ClientID, err)
+		}
+	}
+}
+
+// deliver POSTs a single event to the webhook URL
+func (n *Notifier) deliver(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}